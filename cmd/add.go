@@ -1,73 +1,74 @@
 package cmd
 
 import (
-	"github.com/MirToykin/passtool/internal/lib/cli"
-	"github.com/MirToykin/passtool/internal/storage/models"
-	"github.com/atotto/clipboard"
+	"fmt"
+	"github.com/MirToykin/passtool/pkg/passtool"
 	"github.com/spf13/cobra"
-	"sync"
 )
 
 // getAddCmd returns the representation of the add command
-func getAddCmd(deps AppDependencies) *cobra.Command {
+func getAddCmd(deps *AppDependencies) *cobra.Command {
 	return &cobra.Command{
 		Use:   "add",
 		Short: "Add your custom password for a service",
 		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			operation := "add password"
 			getPassword, err := getPasswordGetterByGenerateAndLengthFlag(
 				cmd, generateFlag, lengthFlag,
-				"password", deps.printer, deps.config)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
-
-			var service models.Service
-			serviceName := cli.GetUserInput("Enter service name: ", deps.printer)
-			err = service.FetchOrCreate(deps.db, serviceName)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
+				"password", deps.printer, deps.input, deps.config)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			expiresAt, _, err := getExpiryFlag(cmd, expiresFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
 
-			var account models.Account
-			login, err := requestUniqueLoginForService(&account, service, deps.printer, deps.db)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
+			serviceName, err := deps.input.ReadLine("Enter service name: ")
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			service, err := deps.repo.Services().FetchOrCreate(serviceName)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
 
-			account.Service = service
-			account.Login = login
+			login, err := requestUniqueLoginForService(service, deps.printer, deps.input, deps.repo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
 
-			var password models.Password
 			userPassword, err := getPassword()
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
-			secretKey := getSecretWithConfirmation("secret key", "Secret keys are not equal", deps.printer)
-
-			err = encryptPassword(&password, userPassword, secretKey, deps.config.SecretKeyLength, deps.config.PasswordSettings)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
-
-			err = account.SaveWithPassword(deps.db, &password)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
-
-			wg := sync.WaitGroup{}
-			errChan := make(chan error, 2)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			secretKey, err := getSecretKeyWithConfirmation("secret key", "Secret keys are not equal", deps.printer, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			err = deps.vault.Unlock(secretKey)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
 
-			if checkIfBackupNeeded(password.ID, deps.config.BackupIndex) {
-				wg.Add(2)
-				go createBackup(&wg, deps.config, errChan, deps.printer)
-				go clearUnnecessaryBackups(&wg, errChan, deps.config, deps.printer)
+			_, err = deps.vault.Add(passtool.Account{
+				Service:   service.Name,
+				Login:     login,
+				Password:  userPassword,
+				ExpiresAt: expiresAt,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
 			}
 
 			deps.printer.Success("Successfully added password for account with login %q at %q", login, serviceName)
 
-			err = clipboard.WriteAll(userPassword)
+			err = deps.clipboard(userPassword)
 			if err == nil {
 				deps.printer.Simpleln("Password copied to clipboard")
 			}
-
-			wg.Wait()
-			close(errChan)
-
-			for err = range errChan {
-				if err != nil {
-					deps.printer.Warning("failed to handle backup: %v", err)
-				}
-			}
+			return nil
 		},
 	}
 }
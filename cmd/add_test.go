@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "password", "password", "key", "key"}, "add")
+	assertPrompts(t, run,
+		"Enter service name: ",
+		"Enter login: ",
+		"Enter password: ",
+		"Enter password again: ",
+		"Enter secret key: ",
+		"Enter secret key again: ",
+	)
+
+	if !strings.Contains(run.output, `Successfully added password for account with login "bob" at "github.com"`) {
+		t.Errorf("got output:\n%s\nwant the success message", run.output)
+	}
+	if !reflect.DeepEqual(run.copied, []string{"password"}) {
+		t.Errorf("got copied %q, want the password", run.copied)
+	}
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v, want %q", got, err, "password")
+	}
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"bob"}})
+}
+
+func TestAddRepeatsMismatchedConfirmations(t *testing.T) {
+	dir := newTestStorage(t)
+
+	run := mustRun(t, dir, []string{
+		"github.com", "bob",
+		"password", "typo", "password", "password",
+		"key", "typo", "key", "key",
+	}, "add")
+
+	if len(run.prompter.Prompts) != 10 {
+		t.Errorf("got prompts %q, want passwords and secret keys requested again", run.prompter.Prompts)
+	}
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v, want %q", got, err, "password")
+	}
+}
+
+func TestAddRequestsAnotherLoginIfItExists(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "amy", "other", "other", "key", "key"}, "add")
+	assertPrompts(t, run,
+		"Enter service name: ",
+		"Enter login: ",
+		"Enter login: ",
+		"Enter password: ",
+		"Enter password again: ",
+		"Enter secret key: ",
+		"Enter secret key again: ",
+	)
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"bob", "amy"}})
+}
+
+func TestAddPasswordFile(t *testing.T) {
+	dir := newTestStorage(t)
+	passwordFile := filepath.Join(t.TempDir(), "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("from file\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key", "key"}, "add", "--password-file", passwordFile)
+	assertPrompts(t, run, "Enter service name: ", "Enter login: ", "Enter secret key: ", "Enter secret key again: ")
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "from file" {
+		t.Errorf("got stored password %q, %v, want %q", got, err, "from file")
+	}
+}
+
+func TestAddGeneratedPassword(t *testing.T) {
+	dir := newTestStorage(t)
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key", "key"}, "add", "-g", "--length", "20")
+	assertPrompts(t, run, "Enter service name: ", "Enter login: ", "Enter secret key: ", "Enter secret key again: ")
+
+	if len(run.copied) != 1 || len(run.copied[0]) != 20 {
+		t.Fatalf("got copied %q, want the generated password of 20 characters", run.copied)
+	}
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != run.copied[0] {
+		t.Errorf("got stored password %q, %v, want the generated one", got, err)
+	}
+}
+
+func TestAddCancelled(t *testing.T) {
+	dir := newTestStorage(t)
+
+	run := execute(t, dir, []string{"github.com", "bob", "password"}, "add")
+	assertExitCode(t, run, exitCancelled)
+
+	if _, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err == nil {
+		t.Error("got the account added, want nothing saved when the input is cancelled")
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/audit"
+	"github.com/MirToykin/passtool/internal/setup"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/internal/vault"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+const (
+	operationFlag = "operation"
+	serviceFlag   = "service"
+	loginFlag     = "login"
+	sinceFlag     = "since"
+	limitFlag     = "limit"
+	verifyFlag    = "verify"
+)
+
+// audited operations
+const (
+	auditAdd              = "add"
+	auditChangeSecret     = "change-secret"
+	auditShare            = "share"
+	auditUnshare          = "unshare"
+	auditExport           = "export"
+	auditImport           = "import"
+	auditBackupRestore    = "backup-restore"
+	auditRotate           = "rotate"
+	auditExec             = "exec"
+	auditRender           = "render"
+	auditGitCredential    = "git-credential"
+	auditDockerCredential = "docker-credential"
+	auditSSHAgent         = "ssh-agent"
+	auditAPI              = "api"
+	auditNativeHost       = "native-host"
+	auditSecretService    = "secret-service"
+)
+
+// getAuditLogCmd returns the representation of the audit-log command
+func getAuditLogCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "audit-log",
+		Short: "Print the audit log of vault operations or verify its integrity",
+		Long: `Each vault operation is recorded to the append-only audit log with the time, the OS user and the host.
+Entries are hash-chained, so modified or removed entries are detected by --verify. Secrets are never recorded,
+services and logins are not recorded when the storage is encrypted, such entries show the account ID.
+
+The chain is not keyed, so --verify catches accidental or partial edits of the log only. Anyone able to write
+the log file can recompute the hashes of the rewritten log or cut off the latest entries unnoticed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "read audit log"
+			verify, err := cmd.Flags().GetBool(verifyFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if verify {
+				count, err := deps.audit.Verify()
+				if err != nil {
+					return fmt.Errorf("verify audit log: %w", err)
+				}
+				deps.printer.Success("Audit log is intact, %d entries verified", count)
+				return nil
+			}
+
+			var filter audit.Filter
+			filter.Operation, err = cmd.Flags().GetString(operationFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			filter.Service, err = cmd.Flags().GetString(serviceFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			filter.Login, err = cmd.Flags().GetString(loginFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			since, err := cmd.Flags().GetDuration(sinceFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if since > 0 {
+				filter.Since = time.Now().Add(-since)
+			}
+			limit, err := cmd.Flags().GetInt(limitFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			entries, err := deps.audit.Entries(filter)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if len(entries) == 0 {
+				deps.printer.Infoln("There are no audit log entries")
+				return nil
+			}
+
+			if limit > 0 && len(entries) > limit {
+				entries = entries[len(entries)-limit:]
+			}
+
+			for _, e := range entries {
+				deps.printer.Simpleln("%d. %s %s@%s %s %s",
+					e.Seq, e.Time.Local().Format("2006-01-02 15:04:05"), e.User, e.Host, e.Operation, describeAuditAccount(e))
+			}
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// recordAudit records the operation with the account to the audit log, services and logins are recorded
+// only if the storage is not encrypted. Failures are reported as warnings and don't fail the operation.
+func recordAudit(deps *AppDependencies, operation string, account *models.Account, details string) {
+	if err := deps.audit.Record(setup.AuditEntry(deps.repo, operation, account, details)); err != nil {
+		deps.printer.Warning("unable to record audit log: %v", err)
+	}
+}
+
+// auditedVault returns the vault over the opened repository recording its operations to the audit log
+// as the given operation with the details, e.g. of the credential helper changing accounts with it
+func auditedVault(deps *AppDependencies, operation, details string) *passtool.Vault {
+	return vault.New(deps.repo, deps.config, func(_ string, account *models.Account) {
+		recordAudit(deps, operation, account, details)
+	}, deps.printer.Warning)
+}
+
+// describeAuditAccount returns the account reference and details of the entry
+func describeAuditAccount(e audit.Entry) string {
+	description := ""
+	switch {
+	case e.Login != "":
+		description = fmt.Sprintf("%q at %q", e.Login, e.Service)
+	case e.AccountID != 0:
+		description = fmt.Sprintf("account #%d", e.AccountID)
+	}
+
+	if e.Details != "" {
+		description += " (" + e.Details + ")"
+	}
+
+	return description
+}
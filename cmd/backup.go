@@ -0,0 +1,429 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/backup"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"math/rand"
+	"strings"
+)
+
+// verifySampleSize is the count of passwords test-decrypted by the backup verify command
+const verifySampleSize = 3
+
+// getBackupCmd returns the representation of the backup command with its subcommands
+func getBackupCmd(deps *AppDependencies) *cobra.Command {
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Manage storage backups",
+		Long: `Backups are made automatically after a number of changes or after some time since the last backup,
+outdated ones are removed by the retention rules. Backups of the encrypted storage are encrypted with the same key.
+Each backup is also uploaded to the configured targets encrypted with the backup key.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	fetchCmd := getBackupFetchCmd(deps)
+	fetchCmd.Flags().Bool(importKeyFlag, false, "Use the backup key of another machine")
+
+	backupCmd.AddCommand(
+		getBackupListCmd(deps),
+		getBackupCreateCmd(deps),
+		getBackupVerifyCmd(deps),
+		getBackupRestoreCmd(deps),
+		fetchCmd,
+		getBackupKeyCmd(deps),
+	)
+	return backupCmd
+}
+
+// getBackupListCmd returns the representation of the backup list command
+func getBackupListCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Print the list of backups with their sizes and entry counts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "list backups"
+			files, err := deps.backups.List()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if len(files) == 0 {
+				deps.printer.Infoln("There are no backups yet")
+				return nil
+			}
+
+			getKey := getBackupKeyGetter(deps.input)
+			deps.printer.Header("The following backups are available:")
+			for i, file := range files {
+				counts := "unable to open"
+				repo, err := storage.OpenReadOnly(deps.config.StorageBackend, file.Path, getKey)
+				if err == nil {
+					counts, err = countEntries(repo)
+					_ = repo.Close()
+				}
+				if err != nil {
+					counts = fmt.Sprintf("unable to open: %v", err)
+				}
+
+				deps.printer.Infoln("%d. %s", i+1, file.CreatedAt.Format("2006-01-02 15:04:05"))
+				deps.printer.Simpleln("  %s, %s, %s", file.Name(), formatSize(file.Size), counts)
+			}
+			return nil
+		},
+	}
+}
+
+// getBackupCreateCmd returns the representation of the backup create command
+func getBackupCreateCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "create",
+		Short: "Create a backup now regardless of the backup policy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "create backup"
+			file, err := deps.backups.Create(deps.repo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("Backup created: %s (%s)", file.Path, formatSize(file.Size))
+			return nil
+		},
+	}
+}
+
+// getBackupVerifyCmd returns the representation of the backup verify command
+func getBackupVerifyCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Check integrity of a backup and test-decrypt a sample of its passwords",
+		Long: `Checks the backup can be opened and is not corrupted, then test-decrypts passwords of random accounts
+with the given secret key. Passwords the key doesn't open are reported and skipped, as they may be encrypted
+with another secret key, the verification fails only if the key opens none of them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "verify backup"
+			file, err := requestBackup(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if file == nil {
+				return nil
+			}
+
+			repo, err := openBackup(*file, deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			defer repo.Close()
+			counts, err := countEntries(repo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			deps.printer.Success("Backup integrity is ok: %s", counts)
+
+			accounts, err := listAccounts(repo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if len(accounts) == 0 {
+				return nil
+			}
+
+			secret, err := getSecretKey("secret key", false, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			// passwords may be encrypted with different secret keys, so accounts are tried in random order
+			// until the sample is decrypted, the ones the secret key doesn't open are only reported
+			rand.Shuffle(len(accounts), func(i, j int) {
+				accounts[i], accounts[j] = accounts[j], accounts[i]
+			})
+			decrypted := 0
+			for _, account := range accounts {
+				if decrypted == verifySampleSize {
+					break
+				}
+
+				if err = repo.Accounts().LoadPassword(&account); err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				if _, err = account.Password.GetDecrypted(secret, deps.config.SecretKeyLength); err != nil {
+					deps.printer.Warning("Password of %q at %q can't be decrypted with the given secret key",
+						account.Login, account.Service.Name)
+					continue
+				}
+				decrypted++
+			}
+
+			if decrypted == 0 {
+				return fmt.Errorf("%w: none of %d password(s) can be decrypted with the given secret key",
+					models.ErrWrongSecret, len(accounts))
+			}
+
+			deps.printer.Success("%d sampled password(s) decrypted with the given secret key", decrypted)
+			return nil
+		},
+	}
+}
+
+// getBackupRestoreCmd returns the representation of the backup restore command
+func getBackupRestoreCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore",
+		Short: "Replace the storage with a backup",
+		Long:  `Checks the backup can be opened and is not corrupted, then backs up the current storage and replaces it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "restore backup"
+			file, err := requestBackup(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if file == nil {
+				return nil
+			}
+
+			repo, err := openBackup(*file, deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			defer repo.Close()
+			counts, err := countEntries(repo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			answer, err := deps.input.ReadLine(fmt.Sprintf("Replace the storage with the backup of %s (%s)? [y/N]: ",
+				file.CreatedAt.Format("2006-01-02 15:04:05"), counts))
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				return fmt.Errorf("%s: %w", operation, cli.ErrCancelled)
+			}
+
+			safety, err := deps.backups.Restore(*file, deps.config.StoragePath, deps.repo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			recordAudit(deps, auditBackupRestore, nil, "from "+file.Name())
+			if err = commitRestore(deps); err != nil {
+				deps.printer.Warning("unable to commit the restore to the sync repository: %v", err)
+			}
+
+			deps.printer.Simpleln("The current storage is backed up to %s", safety.Path)
+			deps.printer.Success("Storage restored from %s", file.Name())
+			return nil
+		},
+	}
+}
+
+// getBackupFetchCmd returns the representation of the backup fetch command
+func getBackupFetchCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "fetch",
+		Short: "Download backups from the targets which don't exist locally",
+		Long: `Downloads and decrypts the backups missing in the backup directory, so they can be verified and restored.
+Use --import-key on a new machine to enter the backup key printed by the "backup key" command.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "fetch backups"
+			importKey, err := cmd.Flags().GetBool(importKeyFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if len(deps.backups.Targets()) == 0 {
+				deps.printer.Infoln("There are no backup targets, set %s to add them", "PASSTOOL_BACKUP_TARGETS")
+				return nil
+			}
+
+			if importKey {
+				encoded, err := getSecret("backup key", false, deps.input)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				key, err := backup.DecodeKey(encoded)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				err = deps.backups.ImportKey(key)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			}
+
+			for _, target := range deps.backups.Targets() {
+				fetched, err := deps.backups.Fetch(target)
+				// the backups of all the targets are encrypted with the same key
+				if errors.Is(err, backup.ErrInvalidKey) {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				if err != nil {
+					deps.printer.Warning("%v", err)
+					continue
+				}
+
+				deps.printer.Success("%d backup(s) fetched from %s", len(fetched), target.Name())
+			}
+			return nil
+		},
+	}
+}
+
+// getBackupKeyCmd returns the representation of the backup key command
+func getBackupKeyCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "key",
+		Short: "Print the key backups are encrypted with before upload",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "get backup key"
+			key, err := deps.backups.Key()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Warning("Keep the backup key apart from the storage, without it uploaded backups can't be restored.")
+			deps.printer.Simpleln(backup.EncodeKey(key))
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// requestBackup prints the list of backups and requests the one to use from user,
+// nil is returned if there are no backups
+func requestBackup(deps *AppDependencies) (*backup.File, error) {
+	files, err := deps.backups.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		deps.printer.Infoln("There are no backups yet")
+		return nil, nil
+	}
+
+	filesMap := make(map[int]backup.File)
+	for i, f := range files {
+		filesMap[i+1] = f
+	}
+
+	printSortedMap(filesMap, func(fMap map[int]backup.File, key int) string {
+		return fmt.Sprintf("%s %s", fMap[key].CreatedAt.Format("2006-01-02 15:04:05"), fMap[key].Name())
+	}, deps.printer)
+
+	return requestExistingModel(
+		filesMap,
+		files,
+		func(f backup.File) string {
+			return f.Name()
+		},
+		"backup name",
+		deps.printer,
+		deps.input,
+	)
+}
+
+// openBackup opens the backup for reading and checks its integrity
+func openBackup(file backup.File, deps *AppDependencies) (storage.Repository, error) {
+	repo, err := storage.OpenReadOnly(deps.config.StorageBackend, file.Path, getBackupKeyGetter(deps.input))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = repo.CheckIntegrity(); err != nil {
+		_ = repo.Close()
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// commitRestore commits the restored storage to the sync repository, so the restore is synchronized
+// the same way as other changes
+func commitRestore(deps *AppDependencies) error {
+	if !deps.syncer.IsInitialized() {
+		return nil
+	}
+
+	// the repository of the command is closed by the restore
+	repo, err := storage.Open(deps.config.StorageBackend, deps.config.StoragePath, func() (string, error) {
+		return deps.input.ReadSecret("Enter storage key: ")
+	})
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	_, err = deps.syncer.Commit(repo, "Restore backup")
+	return err
+}
+
+// getBackupKeyGetter returns the storage key getter, which requests the key from user once
+func getBackupKeyGetter(input cli.Prompter) storage.KeyGetter {
+	var key string
+	return func() (string, error) {
+		if key != "" {
+			return key, nil
+		}
+
+		var err error
+		key, err = input.ReadSecret("Enter storage key of the backup: ")
+		return key, err
+	}
+}
+
+// countEntries returns the description of counts of services and accounts in the repository
+func countEntries(repo storage.Repository) (string, error) {
+	services, err := repo.Services().List(true)
+	if err != nil {
+		return "", err
+	}
+
+	accounts := 0
+	for _, service := range services {
+		accounts += len(service.Accounts)
+	}
+
+	return fmt.Sprintf("%d service(s), %d account(s)", len(services), accounts), nil
+}
+
+// listAccounts returns all the accounts of the repository with loaded services
+func listAccounts(repo storage.Repository) ([]models.Account, error) {
+	services, err := repo.Services().List(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []models.Account
+	for _, service := range services {
+		for _, account := range service.Accounts {
+			account.Service = service
+			accounts = append(accounts, account)
+		}
+	}
+
+	return accounts, nil
+}
+
+// formatSize returns human-readable file size
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
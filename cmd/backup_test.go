@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestBackupCreateAndList(t *testing.T) {
+	dir := newTestStorage(t)
+	assertGolden(t, "backup_list_empty", mustRun(t, dir, nil, "backup", "list").output)
+
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	run := mustRun(t, dir, nil, "backup", "create")
+	if !strings.Contains(run.output, "Backup created: "+dir) {
+		t.Errorf("got output:\n%s\nwant the backup created in the storage directory", run.output)
+	}
+
+	assertGolden(t, "backup_list", mustRun(t, dir, nil, "backup", "list").output)
+}
+
+func TestBackupVerify(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, nil, "backup", "create")
+
+	run := mustRun(t, dir, []string{"1", "key"}, "backup", "verify")
+	assertPrompts(t, run, "Enter backup name or serial number: ", "Enter secret key: ")
+	assertGolden(t, "backup_verify", run.output)
+
+	run = execute(t, dir, []string{"1", "wrong"}, "backup", "verify")
+	assertExitCode(t, run, exitWrongSecret)
+}
+
+func TestBackupVerifyOfPasswordsWithDifferentSecretKeys(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "gitlab.com", "amy", "other", "other key")
+	mustRun(t, dir, nil, "backup", "create")
+
+	for _, secret := range []string{"key", "other key"} {
+		run := mustRun(t, dir, []string{"1", secret}, "backup", "verify")
+		if !strings.Contains(run.output, "can't be decrypted with the given secret key") ||
+			!strings.Contains(run.output, "1 sampled password(s) decrypted with the given secret key") {
+			t.Errorf("got output:\n%s\nwant the password of the other secret key reported and the other one decrypted", run.output)
+		}
+	}
+
+	run := execute(t, dir, []string{"1", "wrong"}, "backup", "verify")
+	assertExitCode(t, run, exitWrongSecret)
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, nil, "backup", "create")
+	addAccount(t, dir, "gitlab.com", "amy", "other", "key")
+
+	run := execute(t, dir, []string{"1", "n"}, "backup", "restore")
+	assertExitCode(t, run, exitCancelled)
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"bob"}, "gitlab.com": {"amy"}})
+
+	run = mustRun(t, dir, []string{"1", "y"}, "backup", "restore")
+	if prompt := run.prompter.Prompts[len(run.prompter.Prompts)-1]; !strings.HasSuffix(prompt, "(1 service(s), 1 account(s))? [y/N]: ") {
+		t.Errorf("got confirmation %q, want the counts of the backup", prompt)
+	}
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"bob"}})
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v after the restore, want %q", got, err, "password")
+	}
+	if _, err := storedPassword(t, passtool.Options{StoragePath: dir}, "gitlab.com", "amy", "key"); !errors.Is(err, passtool.ErrNotFound) {
+		t.Errorf("got %v for the account added after the backup, want ErrNotFound", err)
+	}
+
+	// the replaced storage is backed up before the restore
+	assertGolden(t, "backup_list_restored", mustRun(t, dir, nil, "backup", "list").output)
+}
+
+func TestBackupFetch(t *testing.T) {
+	target := "file://" + t.TempDir()
+	dir := newTestStorage(t)
+	t.Setenv("PASSTOOL_BACKUP_TARGETS", target)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, nil, "backup", "create")
+	key := strings.TrimSpace(mustRun(t, dir, nil, "backup", "key").output)
+	key = key[strings.LastIndex(key, "\n")+1:]
+
+	// another machine has the backup key of its own
+	other := t.TempDir()
+	run := execute(t, other, nil, "backup", "fetch")
+	assertExitCode(t, run, exitWrongSecret)
+
+	run = mustRun(t, other, []string{key}, "backup", "fetch", "--import-key")
+	if !strings.Contains(run.output, "backup(s) fetched from") {
+		t.Errorf("got output:\n%s\nwant the backups fetched", run.output)
+	}
+}
+
+func TestBackupRestoreIsCommittedToSync(t *testing.T) {
+	remote := newSyncRemote(t)
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, nil, "sync", "init", "--remote", remote)
+	mustRun(t, dir, nil, "backup", "create")
+	addAccount(t, dir, "gitlab.com", "amy", "other", "key")
+
+	mustRun(t, dir, []string{"1", "y"}, "backup", "restore")
+
+	syncPath := testConfig(t, dir).SyncPath
+	output, err := exec.Command("git", "-C", syncPath, "log", "-1", "--format=%s").CombinedOutput()
+	if err != nil || strings.TrimSpace(string(output)) != "Restore backup" {
+		t.Errorf("got the last sync commit %q, %v, want the restore committed", output, err)
+	}
+}
@@ -1,38 +1,58 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/MirToykin/passtool/internal/storage/models"
 	"github.com/spf13/cobra"
+	"time"
 )
 
-// getDelCmd returns the representation of the change-secret command
-func getChangeSecretCmd(deps AppDependencies) *cobra.Command {
+// getChangeSecretCmd returns the representation of the change-secret command
+func getChangeSecretCmd(deps *AppDependencies) *cobra.Command {
 	return &cobra.Command{
 		Use:   "change-secret",
 		Short: "Set new secret key for a password",
-		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
+		Long: `Sets new secret key for a password of the chosen account. If accounts are selected with filters or --all,
+re-encrypts all of them using the given old secret key in a single transaction, accounts using another secret key
+are reported and left unchanged.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
 			operation := "change secret"
-			getHandler := func() func(account models.Account) {
-				return func(account models.Account) {
+			if hasChangedFlags(cmd, accountFilterFlags...) {
+				return changeSecretInBulk(cmd, deps)
+			}
+
+			getHandler := func() func(account models.Account) error {
+				return func(account models.Account) error {
 					password := account.Password
-					decrypted, err := getDecryptedPasswordWithRetry(password, deps.config.SecretKeyLength, 5, deps.printer)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+					decrypted, err := getDecryptedPasswordWithRetry(password, deps.config.SecretKeyLength, 5, deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
-					secretKey := getSecretWithConfirmation("new secret key", "Secret keys are not equal", deps.printer)
+					secretKey, err := getSecretWithConfirmation("new secret key", "Secret keys are not equal", deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 					err = encryptPassword(&password, decrypted, secretKey, deps.config.SecretKeyLength, deps.config.PasswordSettings)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
-					err = password.Save(deps.db)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+					err = deps.repo.Passwords().Save(&password)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+					recordAudit(deps, auditChangeSecret, &account, "")
 
 					deps.printer.Success("Secret key updated")
+					return nil
 				}
 			}
-			genericGet(
+			return genericGet(
 				operation,
-				deps.db,
+				deps.repo,
 				deps.printer,
+				deps.input,
 				getHandler(),
 			)
 		},
@@ -40,3 +60,84 @@ func getChangeSecretCmd(deps AppDependencies) *cobra.Command {
 }
 
 func init() {}
+
+// changeSecretInBulk re-encrypts passwords of the accounts selected by the filter flags with the new secret key
+func changeSecretInBulk(cmd *cobra.Command, deps *AppDependencies) error {
+	operation := "change secret"
+	filter, err := getAccountFilter(cmd, deps)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	accounts, err := deps.repo.Accounts().List()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var selected []models.Account
+	now := time.Now()
+	for _, account := range sortAccountsByService(accounts) {
+		if filter.match(account, deps.config.RotationPeriod, now) {
+			selected = append(selected, account)
+		}
+	}
+
+	if len(selected) == 0 {
+		deps.printer.Infoln("There are no accounts matching the filters")
+		return nil
+	}
+
+	oldSecret, err := getSecretKey("old secret key", false, deps.input)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	newSecret, err := getSecretWithConfirmation("new secret key", "Secret keys are not equal", deps.printer, deps.input)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var changed []models.Account
+	var passwords []models.Password
+	var mismatched []models.Account
+	for i, account := range selected {
+		deps.printer.Simple("\rRe-encrypting passwords: %d/%d", i+1, len(selected))
+
+		decrypted, err := account.Password.GetDecrypted(oldSecret, deps.config.SecretKeyLength)
+		if err != nil {
+			mismatched = append(mismatched, account)
+			continue
+		}
+
+		password := account.Password
+		err = encryptPassword(&password, decrypted, newSecret, deps.config.SecretKeyLength, deps.config.PasswordSettings)
+		if err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+
+		changed = append(changed, account)
+		passwords = append(passwords, password)
+	}
+	deps.printer.Simpleln("")
+
+	if len(passwords) > 0 {
+		err = deps.repo.Passwords().SaveAll(passwords)
+		if err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+
+		for i := range changed {
+			recordAudit(deps, auditChangeSecret, &changed[i], "bulk")
+		}
+	}
+
+	deps.printer.Success("Secret key updated for %d of %d account(s)", len(passwords), len(selected))
+
+	if len(mismatched) > 0 {
+		deps.printer.Warning("The old secret key doesn't match the following accounts, they are left unchanged:")
+		for _, account := range mismatched {
+			deps.printer.Simpleln("  - %q at %q", account.Login, account.Service.Name)
+		}
+	}
+
+	return nil
+}
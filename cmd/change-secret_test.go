@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"strings"
+	"testing"
+)
+
+func TestChangeSecretPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key", "new key", "new key"}, "change-secret")
+	assertPrompts(t, run,
+		"Enter service name or serial number: ",
+		"Enter login or serial number: ",
+		"Enter secret: ",
+		"Enter new secret key: ",
+		"Enter new secret key again: ",
+	)
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "new key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v with the new key, want %q", got, err, "password")
+	}
+}
+
+func TestChangeSecretInBulkPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "gitlab.com", "bob", "other", "key")
+	addAccount(t, dir, "example.com", "amy", "third", "another key")
+
+	run := mustRun(t, dir, []string{"key", "new key", "new key"}, "change-secret", "--all")
+	assertPrompts(t, run, "Enter old secret key: ", "Enter new secret key: ", "Enter new secret key again: ")
+
+	if !strings.Contains(run.output, "Secret key updated for 2 of 3 account(s)") {
+		t.Errorf("got output:\n%s\nwant 2 of 3 accounts updated", run.output)
+	}
+	for service, want := range map[string]string{"github.com": "password", "gitlab.com": "other"} {
+		if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, service, "bob", "new key"); err != nil || got != want {
+			t.Errorf("got stored password %q, %v at %s, want %q", got, err, service, want)
+		}
+	}
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "example.com", "amy", "another key"); err != nil || got != "third" {
+		t.Errorf("got stored password %q, %v of the mismatched account, want it unchanged", got, err)
+	}
+}
+
+func TestChangeSecretInBulkRequiresFilters(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := execute(t, dir, nil, "change-secret", "--login", "")
+	assertExitCode(t, run, exitInvalid)
+}
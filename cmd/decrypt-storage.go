@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+// getDecryptStorageCmd returns the representation of the decrypt-storage command
+func getDecryptStorageCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "decrypt-storage",
+		Short: "Convert the encrypted storage file back to the plain one",
+		Long: `Converts the encrypted storage file to the plain SQLite database in place.
+Passwords stay encrypted with their secret keys, but services, logins and
+timestamps become readable. Existing backups are left encrypted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "decrypt storage"
+			encrypted, err := deps.repo.IsEncrypted()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if !encrypted {
+				deps.printer.Infoln("Storage is not encrypted")
+				return nil
+			}
+
+			err = deps.repo.Decrypt()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("Storage decrypted")
+			return nil
+		},
+	}
+}
+
+func init() {}
@@ -7,37 +7,38 @@ import (
 )
 
 // getDelCmd returns the representation of the del command
-func getDelCmd(deps AppDependencies) *cobra.Command {
+func getDelCmd(deps *AppDependencies) *cobra.Command {
 	return &cobra.Command{
 		Use:   "del",
 		Short: "Delete saved password",
 		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			operation := "delete password"
-			getHandler := func() func(account models.Account) {
-				return func(account models.Account) {
-					_, err := getDecryptedPasswordWithRetry(account.Password, deps.config.SecretKeyLength, 5, deps.printer)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+			getHandler := func() func(account models.Account) error {
+				return func(account models.Account) error {
+					_, err := getDecryptedPasswordWithRetry(account.Password, deps.config.SecretKeyLength, 5, deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
-					err = account.DeleteWithPassword(deps.db)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+					// the vault deletes the service with no accounts left
+					serviceDeleted, err := deps.vault.Delete(account.Service.Name, account.Login)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 					deps.printer.Success("Account and password deleted")
 
-					service := account.Service
-					accountsCount, err := service.AccountsCount(deps.db)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
-
-					if accountsCount == 0 {
-						err = service.Delete(deps.db)
-						checkSimpleErrorWithDetails(err, operation, deps.printer)
-						deps.printer.Success(fmt.Sprintf("The service %q has been deleted because it has no accounts", service.Name))
+					if serviceDeleted {
+						deps.printer.Success("The service %q has been deleted because it has no accounts", account.Service.Name)
 					}
+					return nil
 				}
 			}
-			genericGet(
+			return genericGet(
 				operation,
-				deps.db,
+				deps.repo,
 				deps.printer,
+				deps.input,
 				getHandler(),
 			)
 		},
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"strings"
+	"testing"
+)
+
+func TestDelPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "github.com", "amy", "other", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key"}, "del")
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ", "Enter secret: ")
+
+	if strings.Contains(run.output, "has been deleted") {
+		t.Errorf("got output:\n%s\nwant the service kept while it has accounts", run.output)
+	}
+	if _, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); !errors.Is(err, passtool.ErrNotFound) {
+		t.Errorf("got %v for the deleted account, want ErrNotFound", err)
+	}
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "amy", "key"); err != nil || got != "other" {
+		t.Errorf("got stored password %q, %v of the other account, want it kept", got, err)
+	}
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"amy"}})
+}
+
+func TestDelLastAccountDeletesService(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key"}, "del")
+	if !strings.Contains(run.output, `The service "github.com" has been deleted because it has no accounts`) {
+		t.Errorf("got output:\n%s\nwant the service deletion reported", run.output)
+	}
+	assertStoredServices(t, dir, map[string][]string{})
+}
+
+func TestDelRequiresSecret(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := execute(t, dir, []string{"github.com", "bob", "1", "2", "3", "4", "5", "6"}, "del")
+	assertExitCode(t, run, exitWrongSecret)
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v, want the account kept", got, err)
+	}
+}
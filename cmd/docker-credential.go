@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+// docker credential helper actions
+const (
+	dockerCredentialStore = "store"
+	dockerCredentialGet   = "get"
+	dockerCredentialErase = "erase"
+	dockerCredentialList  = "list"
+)
+
+const (
+	// dockerServicePrefix is the namespace of the services keeping docker registry credentials
+	dockerServicePrefix = "docker:"
+	// errDockerCredentialsNotFound is the message docker recognizes as missing credentials
+	errDockerCredentialsNotFound = "credentials not found in native keychain"
+)
+
+// dockerCredential is the credential passed to and from docker
+type dockerCredential struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// getDockerCredentialCmd returns the representation of the docker-credential command
+func getDockerCredentialCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "docker-credential <store|get|erase|list>",
+		Short: "Docker credential helper keeping registry credentials in the vault",
+		Long: `Implements the docker credential helpers protocol. Docker runs the helper as docker-credential-<name>,
+so create the executable docker-credential-passtool in PATH running "passtool docker-credential" with the same
+arguments and set "credsStore": "passtool" in ~/.docker/config.json.
+Credentials are kept as accounts of the services named "docker:<registry URL>", secrets are requested
+from the terminal.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{stdinProtocolAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "docker credential " + args[0]
+			// stdout is used by the protocol
+			deps.printer = out.NewWithWriter(os.Stderr)
+
+			resolver, err := newTerminalSecretResolver(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			switch args[0] {
+			case dockerCredentialStore:
+				var credential dockerCredential
+				err = json.NewDecoder(os.Stdin).Decode(&credential)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+
+				err = storeDockerCredential(deps, resolver, credential)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			case dockerCredentialGet:
+				serverURL, err := readDockerServerURL(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+
+				account, found := findDockerAccount(resolver.accounts, serverURL)
+				if !found {
+					fmt.Println(errDockerCredentialsNotFound)
+					return exitStatusError{status: 1}
+				}
+
+				password, err := resolver.password(account)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+
+				data, err := json.Marshal(dockerCredential{ServerURL: serverURL, Username: account.Login, Secret: password})
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				fmt.Println(string(data))
+				resolver.recordUsage(auditDockerCredential, dockerCredentialGet)
+			case dockerCredentialErase:
+				serverURL, err := readDockerServerURL(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+
+				account, found := findDockerAccount(resolver.accounts, serverURL)
+				if !found {
+					fmt.Println(errDockerCredentialsNotFound)
+					return exitStatusError{status: 1}
+				}
+
+				_, err = auditedVault(deps, auditDockerCredential, dockerCredentialErase).Delete(account.Service.Name, account.Login)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			case dockerCredentialList:
+				credentials := make(map[string]string)
+				for _, account := range resolver.accounts {
+					if serverURL, ok := strings.CutPrefix(account.Service.Name, dockerServicePrefix); ok {
+						credentials[serverURL] = account.Login
+					}
+				}
+
+				data, err := json.Marshal(credentials)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				fmt.Println(string(data))
+			default:
+				return newValidationError("%s: unknown action", operation)
+			}
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// readDockerServerURL reads the registry URL docker passes as the plain text
+func readDockerServerURL(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("unable to read server URL: %w", err)
+	}
+
+	serverURL := strings.TrimSpace(string(data))
+	if serverURL == "" {
+		return "", fmt.Errorf("no server URL")
+	}
+
+	return serverURL, nil
+}
+
+// findDockerAccount returns the account keeping the credential of the registry
+func findDockerAccount(accounts []models.Account, serverURL string) (models.Account, bool) {
+	for _, account := range accounts {
+		if account.Service.Name == dockerServicePrefix+serverURL {
+			return account, true
+		}
+	}
+
+	return models.Account{}, false
+}
+
+// storeDockerCredential saves the credential of the registry, the registry has the only credential,
+// so the account with another username is replaced
+func storeDockerCredential(deps *AppDependencies, resolver *secretResolver, credential dockerCredential) error {
+	if credential.ServerURL == "" || credential.Username == "" || credential.Secret == "" {
+		return fmt.Errorf("server URL, username and secret are required")
+	}
+
+	vault := auditedVault(deps, auditDockerCredential, dockerCredentialStore)
+	account, found := findDockerAccount(resolver.accounts, credential.ServerURL)
+	if found && account.Login == credential.Username {
+		secret, err := resolver.secretFor(account)
+		if err != nil {
+			return err
+		}
+
+		return setAccountPassword(vault, account, credential.Secret, secret)
+	}
+
+	var secret string
+	var err error
+	if found {
+		// the secret of the replaced account is required to replace it
+		secret, err = resolver.secretFor(account)
+	} else {
+		secret, err = requestNewTerminalSecret(credential.Username, credential.ServerURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	saved, err := saveNewCredential(deps, dockerServicePrefix+credential.ServerURL, credential.Username, credential.Secret, secret)
+	if err != nil {
+		return err
+	}
+	recordAudit(deps, auditDockerCredential, &saved, dockerCredentialStore)
+
+	// the replaced account is deleted only after the new one is saved, so the registry is never left without
+	// the credential
+	if found {
+		if _, err = vault.Delete(account.Service.Name, account.Login); err != nil {
+			return fmt.Errorf("unable to delete the replaced account %q: %w", account.Login, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/MirToykin/passtool/internal/audit"
+	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var errSaveFailed = errors.New("save failed")
+
+// failingAccounts fails saving new accounts
+type failingAccounts struct {
+	storage.AccountRepository
+}
+
+func (failingAccounts) SaveWithPassword(*models.Account, *models.Password) error {
+	return errSaveFailed
+}
+
+// failingRepository is the repository new accounts can't be saved to
+type failingRepository struct {
+	storage.Repository
+	fail bool
+}
+
+func (r *failingRepository) Accounts() storage.AccountRepository {
+	if r.fail {
+		return failingAccounts{r.Repository.Accounts()}
+	}
+	return r.Repository.Accounts()
+}
+
+// newDockerDeps returns the dependencies with the vault keeping the credential of bob for the registry
+func newDockerDeps(t *testing.T) (*AppDependencies, *failingRepository) {
+	t.Helper()
+	dir := newTestStorage(t)
+	fileRepo, err := storage.NewFileRepository(filepath.Join(dir, "passtool.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &failingRepository{Repository: fileRepo}
+	deps := &AppDependencies{
+		repo:    repo,
+		config:  testConfig(t, dir),
+		printer: out.NewWithWriter(io.Discard),
+		audit:   audit.New(filepath.Join(dir, "audit.log")),
+	}
+	if _, err = saveNewCredential(deps, dockerServicePrefix+"registry.example.com", "bob", "password", "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	return deps, repo
+}
+
+// newDockerResolver returns the resolver answering the secret requests with the key
+func newDockerResolver(t *testing.T, deps *AppDependencies) *secretResolver {
+	t.Helper()
+	resolver, err := newSecretResolver(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver.requestSecret = func(string) (string, error) {
+		return "key", nil
+	}
+
+	return resolver
+}
+
+func TestStoreDockerCredentialReplacesAccount(t *testing.T) {
+	deps, _ := newDockerDeps(t)
+
+	credential := dockerCredential{ServerURL: "registry.example.com", Username: "amy", Secret: "other"}
+	if err := storeDockerCredential(deps, newDockerResolver(t, deps), credential); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := newDockerResolver(t, deps)
+	account, found := findDockerAccount(resolver.accounts, "registry.example.com")
+	if !found || account.Login != "amy" || len(resolver.accounts) != 1 {
+		t.Fatalf("got accounts %+v, want the only account of amy", resolver.accounts)
+	}
+	if password, err := resolver.password(account); err != nil || password != "other" {
+		t.Errorf("got password %q, %v, want the new one", password, err)
+	}
+
+	// changes are recorded as the store of the credential helper
+	entries, err := deps.audit.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Operation+" "+e.Login+" "+e.Details)
+	}
+	want := []string{"docker-credential amy store", "docker-credential bob store"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got audit entries %q, want %q", got, want)
+	}
+}
+
+func TestStoreDockerCredentialKeepsAccountIfReplacementFails(t *testing.T) {
+	deps, repo := newDockerDeps(t)
+	repo.fail = true
+
+	credential := dockerCredential{ServerURL: "registry.example.com", Username: "amy", Secret: "other"}
+	if err := storeDockerCredential(deps, newDockerResolver(t, deps), credential); !errors.Is(err, errSaveFailed) {
+		t.Fatalf("got %v, want the save error", err)
+	}
+
+	repo.fail = false
+	resolver := newDockerResolver(t, deps)
+	if account, found := findDockerAccount(resolver.accounts, "registry.example.com"); !found || account.Login != "bob" {
+		t.Errorf("got accounts %+v, want the account of bob kept", resolver.accounts)
+	}
+}
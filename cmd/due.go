@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	withinFlag  = "within"
+	jsonFlag    = "json"
+	expiresFlag = "expires"
+	onFlag      = "on"
+	dateLayout  = "2006-01-02"
+	neverExpiry = "never"
+)
+
+// accountReport is the account metadata printed as JSON for scripts
+type accountReport struct {
+	Service           string     `json:"service"`
+	Login             string     `json:"login"`
+	CreatedAt         time.Time  `json:"created_at"`
+	PasswordChangedAt time.Time  `json:"password_changed_at"`
+	LastAccessedAt    *time.Time `json:"last_accessed_at"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	DueAt             *time.Time `json:"due_at"`
+	Overdue           bool       `json:"overdue"`
+}
+
+// getDueCmd returns the representation of the due command
+func getDueCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "due",
+		Short: "Print accounts whose passwords should be rotated",
+		Long: `Prints accounts whose expiry date has come or whose passwords are older than PASSTOOL_ROTATION_DAYS.
+Use --within to include accounts due soon and --json to use the output in scripts.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "get due accounts"
+			within, err := cmd.Flags().GetDuration(withinFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			asJSON, err := cmd.Flags().GetBool(jsonFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			accounts, err := deps.repo.Accounts().List()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			now := time.Now()
+			var due []models.Account
+			for _, account := range accounts {
+				if account.IsDue(deps.config.RotationPeriod, now.Add(within)) {
+					due = append(due, account)
+				}
+			}
+
+			sort.Slice(due, func(i, j int) bool {
+				return due[i].DueAt(deps.config.RotationPeriod).Before(*due[j].DueAt(deps.config.RotationPeriod))
+			})
+
+			if asJSON {
+				if err := printAccountsJSON(due, deps); err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				return nil
+			}
+
+			if len(due) == 0 {
+				deps.printer.Infoln("There are no accounts due for rotation")
+				return nil
+			}
+
+			deps.printer.Header("The following accounts are due for rotation:")
+			for _, account := range due {
+				dueAt := account.DueAt(deps.config.RotationPeriod)
+				state := "due " + dueAt.Format(dateLayout)
+				if !dueAt.After(now) {
+					state = fmt.Sprintf("overdue since %s", dueAt.Format(dateLayout))
+				}
+				deps.printer.Simpleln("  - %q at %q, %s", account.Login, account.Service.Name, state)
+			}
+			return nil
+		},
+	}
+}
+
+// getExpireCmd returns the representation of the expire command
+func getExpireCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "expire",
+		Short: "Set the date an account password should be rotated by",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "set expiry"
+			expiresAt, _, err := getExpiryFlag(cmd, onFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			return genericGet(
+				operation,
+				deps.repo,
+				deps.printer,
+				deps.input,
+				func(account models.Account) error {
+					err := deps.vault.Expire(account.Service.Name, account.Login, expiresAt)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+
+					if expiresAt == nil {
+						deps.printer.Success("Expiry date removed")
+						return nil
+					}
+					deps.printer.Success("Password expires on %s", expiresAt.Format(dateLayout))
+					return nil
+				},
+			)
+		},
+	}
+}
+
+func init() {}
+
+// getExpiryFlag parses the expiry date flag in YYYY-MM-DD format or "never",
+// returns nil time for "never" and false if the flag is not set
+func getExpiryFlag(cmd *cobra.Command, name string) (*time.Time, bool, error) {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil || value == "" {
+		return nil, false, err
+	}
+
+	if strings.EqualFold(value, neverExpiry) {
+		return nil, true, nil
+	}
+
+	date, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return nil, false, newValidationError("invalid date %q, use YYYY-MM-DD or %q", value, neverExpiry)
+	}
+
+	return &date, true, nil
+}
+
+// newAccountReport returns the metadata of the account with loaded service and password
+func newAccountReport(account models.Account, rotationPeriod time.Duration, now time.Time) accountReport {
+	return accountReport{
+		Service:           account.Service.Name,
+		Login:             account.Login,
+		CreatedAt:         account.CreatedAt,
+		PasswordChangedAt: account.Password.UpdatedAt,
+		LastAccessedAt:    account.LastAccessedAt,
+		ExpiresAt:         account.ExpiresAt,
+		DueAt:             account.DueAt(rotationPeriod),
+		Overdue:           account.IsDue(rotationPeriod, now),
+	}
+}
+
+// printAccountsJSON prints metadata of the accounts as JSON array
+func printAccountsJSON(accounts []models.Account, deps *AppDependencies) error {
+	now := time.Now()
+	reports := make([]accountReport, 0, len(accounts))
+	for _, account := range accounts {
+		reports = append(reports, newAccountReport(account, deps.config.RotationPeriod, now))
+	}
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	deps.printer.Simpleln("%s", data)
+	return nil
+}
+
+// describeAccountDates returns the human-readable metadata of the account with loaded password
+func describeAccountDates(account models.Account, rotationPeriod time.Duration) string {
+	parts := []string{
+		"created " + account.CreatedAt.Format(dateLayout),
+		"password changed " + account.Password.UpdatedAt.Format(dateLayout),
+	}
+
+	if account.LastAccessedAt != nil {
+		parts = append(parts, "last used "+account.LastAccessedAt.Format(dateLayout))
+	} else {
+		parts = append(parts, "never used")
+	}
+
+	if dueAt := account.DueAt(rotationPeriod); dueAt != nil {
+		parts = append(parts, "due "+dueAt.Format(dateLayout))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDueOutput(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "gitlab.com", "bob", "password", "key")
+	mustRun(t, dir, []string{"github.com", "bob", "password", "password", "key", "key"}, "add", "--expires", "2001-01-01")
+	mustRun(t, dir, []string{"github.com", "amy", "other", "other", "key", "key"}, "add", "--expires", "2000-01-01")
+	mustRun(t, dir, []string{"example.com", "amy", "third", "third", "key", "key"}, "add", "--expires", "2100-01-01")
+
+	for name, args := range map[string][]string{
+		"due":             {"due"},
+		"due_json":        {"due", "--json"},
+		"due_within_json": {"due", "--json", "--within", "1000000h"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assertGolden(t, name, mustRun(t, dir, nil, args...).output)
+		})
+	}
+}
+
+func TestExpireRemovesAccountFromDue(t *testing.T) {
+	dir := newTestStorage(t)
+	mustRun(t, dir, []string{"github.com", "bob", "password", "password", "key", "key"}, "add", "--expires", "2000-01-01")
+
+	mustRun(t, dir, []string{"github.com", "bob"}, "expire", "--on", "never")
+	assertGolden(t, "due_empty", mustRun(t, dir, nil, "due").output)
+}
+
+func TestExpirePrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	// the expiry date is metadata, so the secret key is not requested
+	run := mustRun(t, dir, []string{"github.com", "bob"}, "expire", "--on", "2000-01-01")
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ")
+	if !strings.Contains(run.output, "Password expires on 2000-01-01") {
+		t.Errorf("got output:\n%s\nwant the expiry date printed", run.output)
+	}
+	if run = mustRun(t, dir, nil, "due"); !strings.Contains(run.output, "bob") {
+		t.Errorf("got due:\n%s\nwant the expired account", run.output)
+	}
+
+	run = mustRun(t, dir, []string{"github.com", "bob"}, "expire", "--on", "never")
+	if !strings.Contains(run.output, "Expiry date removed") {
+		t.Errorf("got output:\n%s\nwant the expiry date removed", run.output)
+	}
+}
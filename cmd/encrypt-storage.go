@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+// getEncryptStorageCmd returns the representation of the encrypt-storage command
+func getEncryptStorageCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt-storage",
+		Short: "Encrypt the whole storage file with a storage key",
+		Long: `Converts the plain storage file to the encrypted one in place.
+After the conversion the storage key is requested on each run, backups made
+afterwards are encrypted as well.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "encrypt storage"
+			encrypted, err := deps.repo.IsEncrypted()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if encrypted {
+				deps.printer.Infoln("Storage is already encrypted")
+				return nil
+			}
+
+			deps.printer.Warning("There is no way to restore the storage if the storage key is lost.")
+			storageKey, err := getSecretWithConfirmation("storage key", "Storage keys are not equal", deps.printer, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = deps.repo.Encrypt(storageKey)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("Storage encrypted")
+			return nil
+		},
+	}
+}
+
+func init() {}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestEncryptStorage(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"storage key", "storage key"}, "encrypt-storage")
+	assertPrompts(t, run, "Enter storage key: ", "Enter storage key again: ")
+
+	run = mustRun(t, dir, []string{"storage key", "github.com", "bob", "key"}, "get")
+	if len(run.copied) != 1 || run.copied[0] != "password" {
+		t.Errorf("got copied %q, want the password from the encrypted storage", run.copied)
+	}
+
+	run = execute(t, dir, []string{"wrong key"}, "get")
+	assertExitCode(t, run, exitWrongSecret)
+	assertPrompts(t, run, "Enter storage key: ")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/backup"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/sharing"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/pkg/passtool"
+)
+
+// exit codes of the command errors, they are listed in README
+const (
+	exitFailure     = 1
+	exitInvalid     = 2
+	exitNotFound    = 3
+	exitWrongSecret = 4
+	exitCancelled   = 5
+)
+
+// validationError is returned when flags, arguments or values given by user are not valid
+type validationError struct {
+	msg string
+}
+
+func (e validationError) Error() string {
+	return e.msg
+}
+
+// newValidationError returns the validation error with the formatted message
+func newValidationError(format string, a ...interface{}) error {
+	return validationError{msg: fmt.Sprintf(format, a...)}
+}
+
+// notFoundError is returned when the requested entry doesn't exist, it's reported with its own message
+type notFoundError struct {
+	msg string
+}
+
+func (e notFoundError) Error() string {
+	return e.msg
+}
+
+func (e notFoundError) Unwrap() error {
+	return passtool.ErrNotFound
+}
+
+// newNotFoundError returns the not found error with the formatted message
+func newNotFoundError(format string, a ...interface{}) error {
+	return notFoundError{msg: fmt.Sprintf(format, a...)}
+}
+
+// exitStatusError passes the exit status on without printing anything, e.g. the one of the child process
+// or the one required by a protocol, which reports the error itself
+type exitStatusError struct {
+	status int
+}
+
+func (e exitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.status)
+}
+
+// exitCode returns the exit code of the command error
+func exitCode(err error) int {
+	var validation validationError
+	var exitStatus exitStatusError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitStatus):
+		return exitStatus.status
+	case errors.Is(err, cli.ErrCancelled):
+		return exitCancelled
+	case errors.Is(err, models.ErrWrongSecret), errors.Is(err, sharing.ErrWrongPassphrase),
+		errors.Is(err, storage.ErrInvalidKey), errors.Is(err, backup.ErrInvalidKey):
+		return exitWrongSecret
+	case errors.Is(err, passtool.ErrNotFound), errors.Is(err, storage.ErrNotFound):
+		return exitNotFound
+	case errors.As(err, &validation):
+		return exitInvalid
+	default:
+		return exitFailure
+	}
+}
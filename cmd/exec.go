@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+const (
+	envFlag = "env"
+
+	// reference fields
+	fieldPassword = "password"
+	fieldLogin    = "login"
+	fieldService  = "service"
+
+	maxSecretRetries = 3
+)
+
+// getExecCmd returns the representation of the exec command
+func getExecCmd(deps *AppDependencies) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec --env NAME=service/login -- command [args...]",
+		Short: "Run a command with passwords passed in environment variables",
+		Long: `Runs the command with the referenced passwords in its environment, so they never get to the shell history
+or .env files. A value is either a reference "service/login" to the account password or a template with references
+to the account fields, e.g. DB_URL='postgres://{{ passtool "db/admin" "login" }}:{{ passtool "db/admin" }}@localhost/app'.
+Supported fields are password, login and service, the password is used if the field is omitted.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "run command"
+			envs, err := cmd.Flags().GetStringArray(envFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			resolver, err := newSecretResolver(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			environ := os.Environ()
+			for _, env := range envs {
+				name, value, found := strings.Cut(env, "=")
+				if !found || name == "" {
+					return newValidationError("%s: invalid variable %q, use NAME=service/login", operation, env)
+				}
+
+				if !strings.Contains(value, "{{") {
+					value = fmt.Sprintf("{{ passtool %q }}", value)
+				}
+
+				resolved, err := resolver.render(name, value)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				environ = append(environ, name+"="+resolved)
+			}
+
+			resolver.recordUsage(auditExec, filepath.Base(args[0]))
+
+			if status := runCommand(args, environ, deps.printer); status != 0 {
+				return exitStatusError{status: status}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+func init() {}
+
+// runCommand runs the command with the given environment passing the signals to it, returns its exit code
+func runCommand(args []string, environ []string, printer Printer) int {
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = environ
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if err := child.Start(); err != nil {
+		printer.Error("unable to run command: %v", err)
+		return 127
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			_ = child.Process.Signal(sig)
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		printer.Error("unable to run command: %v", err)
+		return 1
+	}
+
+	return 0
+}
+
+// secretResolver resolves references "service/login" to the vault accounts,
+// secrets are requested once and tried for all the referenced passwords
+type secretResolver struct {
+	deps      *AppDependencies
+	accounts  []models.Account
+	secrets   []string
+	passwords map[uint]string
+	used      []models.Account
+	// requestSecret requests the secret described by the prompt from the user
+	requestSecret func(prompt string) (string, error)
+	// retries is the count of attempts to enter the secret
+	retries int
+}
+
+// newSecretResolver returns the resolver of references to the vault accounts
+func newSecretResolver(deps *AppDependencies) (*secretResolver, error) {
+	accounts, err := deps.repo.Accounts().List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load accounts: %w", err)
+	}
+
+	// the secret key given by a flag is the same on each retry
+	retries := maxSecretRetries
+	if cli.HasFixedSecretKey(deps.input) {
+		retries = 1
+	}
+
+	return &secretResolver{
+		deps:      deps,
+		accounts:  accounts,
+		passwords: make(map[uint]string),
+		requestSecret: func(prompt string) (string, error) {
+			return deps.input.ReadSecretKey(fmt.Sprintf("Enter %s: ", prompt))
+		},
+		retries: retries,
+	}, nil
+}
+
+// render executes the template with the passtool function resolving references,
+// e.g. {{ passtool "service/login" "login" }}, the password is used if the field is omitted
+func (r *secretResolver) render(name, text string) (string, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"passtool": r.field,
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse template %s: %w", name, err)
+	}
+
+	var out strings.Builder
+	if err = tmpl.Execute(&out, nil); err != nil {
+		return "", fmt.Errorf("unable to render template %s: %w", name, err)
+	}
+
+	return out.String(), nil
+}
+
+// newTerminalSecretResolver returns the resolver requesting secrets from the terminal
+// for commands whose stdin and stdout are used by a protocol
+func newTerminalSecretResolver(deps *AppDependencies) (*secretResolver, error) {
+	resolver, err := newSecretResolver(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver.requestSecret = func(prompt string) (string, error) {
+		return cli.GetSensitiveTerminalInput(fmt.Sprintf("passtool: enter %s: ", prompt))
+	}
+	resolver.retries = maxSecretRetries
+
+	return resolver, nil
+}
+
+// field returns the field of the referenced account, the password by default
+func (r *secretResolver) field(ref string, field ...string) (string, error) {
+	if len(field) > 1 {
+		return "", fmt.Errorf("too many fields for %q", ref)
+	}
+
+	account, err := r.account(ref)
+	if err != nil {
+		return "", err
+	}
+
+	name := fieldPassword
+	if len(field) == 1 {
+		name = field[0]
+	}
+
+	switch name {
+	case fieldPassword:
+		return r.password(account)
+	case fieldLogin:
+		return account.Login, nil
+	case fieldService:
+		return account.Service.Name, nil
+	default:
+		return "", fmt.Errorf("unknown field %q of %q, use %s, %s or %s", name, ref, fieldPassword, fieldLogin, fieldService)
+	}
+}
+
+// account returns the account referenced as "service/login", the service name may contain slashes
+func (r *secretResolver) account(ref string) (models.Account, error) {
+	i := strings.LastIndex(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		return models.Account{}, fmt.Errorf("invalid reference %q, use service/login", ref)
+	}
+
+	serviceName, login := ref[:i], ref[i+1:]
+	for _, account := range r.accounts {
+		if account.Service.Name == serviceName && account.Login == login {
+			return account, nil
+		}
+	}
+
+	return models.Account{}, newNotFoundError("account %q at %q not found", login, serviceName)
+}
+
+// password returns the decrypted password of the account, tries the secrets given before requesting a new one
+func (r *secretResolver) password(account models.Account) (string, error) {
+	if decrypted, ok := r.passwords[account.ID]; ok {
+		return decrypted, nil
+	}
+
+	decrypted, err := r.decrypt(account)
+	if err != nil {
+		return "", err
+	}
+
+	r.passwords[account.ID] = decrypted
+	r.used = append(r.used, account)
+	return decrypted, nil
+}
+
+// decrypt decrypts the account password with one of the known secrets or the secret requested from the user
+func (r *secretResolver) decrypt(account models.Account) (string, error) {
+	secret, err := r.secretFor(account)
+	if err != nil {
+		return "", err
+	}
+
+	return account.Password.GetDecrypted(secret, r.deps.config.SecretKeyLength)
+}
+
+// secretFor returns the secret matching the account password, one of the known secrets or requested from the user
+func (r *secretResolver) secretFor(account models.Account) (string, error) {
+	keyLen := r.deps.config.SecretKeyLength
+	for _, secret := range r.secrets {
+		if matches, _ := checkSecret(account.Password, secret, keyLen); matches {
+			return secret, nil
+		}
+	}
+
+	for try := 0; try < r.retries; try++ {
+		prompt := "secret"
+		if len(r.secrets) > 0 {
+			prompt = fmt.Sprintf("secret for %q at %q", account.Login, account.Service.Name)
+		}
+
+		secret, err := r.requestSecret(prompt)
+		if err != nil {
+			return "", err
+		}
+
+		if matches, _ := checkSecret(account.Password, secret, keyLen); matches {
+			r.secrets = append(r.secrets, secret)
+			return secret, nil
+		}
+
+		if try < r.retries-1 {
+			r.deps.printer.Warning("Incorrect secret, try again")
+		}
+	}
+
+	return "", fmt.Errorf("unable to decrypt password of %q at %q: %w", account.Login, account.Service.Name, models.ErrWrongSecret)
+}
+
+// recordUsage records the decrypted passwords to the audit log and marks their accounts accessed
+func (r *secretResolver) recordUsage(operation, details string) {
+	now := time.Now()
+	for i := range r.used {
+		recordAudit(r.deps, operation, &r.used[i], details)
+		if err := r.deps.repo.Accounts().MarkAccessed(&r.used[i], now); err != nil {
+			r.deps.printer.Warning("unable to save last access time: %v", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// execEnv runs exec with the variable and returns the value the command got in its environment
+func execEnv(t *testing.T, dir string, answers []string, env string) (commandRun, string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+
+	file := filepath.Join(t.TempDir(), "env")
+	run := execute(t, dir, answers, "exec", "--env", "VALUE="+env, "--", "sh", "-c", `printf %s "$VALUE" > "$0"`, file)
+	value, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return run, string(value)
+}
+
+func TestExecPassesPassword(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run, value := execEnv(t, dir, []string{"key"}, "github.com/bob")
+	if run.err != nil {
+		t.Fatalf("unexpected error: %v\n%s", run.err, run.output)
+	}
+	assertPrompts(t, run, "Enter secret: ")
+	if value != "password" {
+		t.Errorf("got %q in the environment, want the password", value)
+	}
+}
+
+func TestExecRendersTemplates(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run, value := execEnv(t, dir, []string{"wrong", "key"}, `{{ passtool "github.com/bob" "login" }}:{{ passtool "github.com/bob" }}`)
+	if run.err != nil {
+		t.Fatalf("unexpected error: %v\n%s", run.err, run.output)
+	}
+	assertPrompts(t, run, "Enter secret: ", "Enter secret: ")
+	if value != "bob:password" {
+		t.Errorf("got %q in the environment, want the rendered template", value)
+	}
+}
+
+func TestExecMatchesReferencesExactly(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	for _, ref := range []string{"GitHub.com/bob", "github.com/Bob"} {
+		run, value := execEnv(t, dir, []string{"key"}, ref)
+		assertExitCode(t, run, exitNotFound)
+		assertPrompts(t, run)
+		if value != "" {
+			t.Errorf("got %q in the environment of %q, want the command not run", value, ref)
+		}
+	}
+}
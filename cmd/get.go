@@ -1,33 +1,37 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/MirToykin/passtool/internal/storage/models"
-	"github.com/atotto/clipboard"
 	"github.com/spf13/cobra"
 )
 
 // getGetCmd returns the representation of the get command
-func getGetCmd(deps AppDependencies) *cobra.Command {
+func getGetCmd(deps *AppDependencies) *cobra.Command {
 	return &cobra.Command{
 		Use:   "get",
 		Short: "Get saved password",
 		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			operation := "get password"
-			genericGet(
+			return genericGet(
 				operation,
-				deps.db,
+				deps.repo,
 				deps.printer,
-				func(account models.Account) {
-					decrypted, err := getDecryptedPasswordWithRetry(account.Password, deps.config.SecretKeyLength, 5, deps.printer)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+				deps.input,
+				func(account models.Account) error {
+					opened, err := getVaultAccountWithRetry(deps.vault, account, 5, deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
-					err = clipboard.WriteAll(decrypted)
+					err = deps.clipboard(opened.Password)
 					if err != nil {
-						deps.printer.Success("Decoded password: %s", decrypted)
+						deps.printer.Success("Decoded password: %s", opened.Password)
 					}
 
 					deps.printer.Success("Password copied to clipboard")
+					return nil
 				},
 			)
 		},
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key"}, "get")
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ", "Enter secret: ")
+	assertGolden(t, "get", run.output)
+
+	if !reflect.DeepEqual(run.copied, []string{"password"}) {
+		t.Errorf("got copied %q, want the password", run.copied)
+	}
+}
+
+func TestGetBySerialNumbers(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "github.com", "amy", "other", "key")
+
+	// logins are listed in the order of adding
+	run := mustRun(t, dir, []string{"1", "2", "key"}, "get")
+	if !reflect.DeepEqual(run.copied, []string{"other"}) {
+		t.Errorf("got copied %q, want the password of the second account", run.copied)
+	}
+}
+
+func TestGetRequestsUnknownNamesAgain(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"gitlab.com", "github.com", "amy", "bob", "key"}, "get")
+	assertPrompts(t, run,
+		"Enter service name or serial number: ",
+		"Enter service name or serial number: ",
+		"Enter login or serial number: ",
+		"Enter login or serial number: ",
+		"Enter secret: ",
+	)
+}
+
+func TestGetRetriesWrongSecret(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "wrong", "key"}, "get")
+	if !reflect.DeepEqual(run.copied, []string{"password"}) {
+		t.Errorf("got copied %q, want the password after the retry", run.copied)
+	}
+
+	run = execute(t, dir, []string{"github.com", "bob", "1", "2", "3", "4", "5", "6"}, "get")
+	assertExitCode(t, run, exitWrongSecret)
+	if len(run.prompter.Remaining()) != 0 || len(run.copied) != 0 {
+		t.Errorf("got remaining answers %q and copied %q, want all the attempts used and nothing copied",
+			run.prompter.Remaining(), run.copied)
+	}
+}
+
+func TestGetWithoutServices(t *testing.T) {
+	dir := newTestStorage(t)
+
+	run := mustRun(t, dir, nil, "get")
+	assertPrompts(t, run)
+	assertGolden(t, "get_empty", run.output)
+}
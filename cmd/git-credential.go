@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"github.com/spf13/cobra"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// git credential helper actions
+const (
+	gitCredentialGet   = "get"
+	gitCredentialStore = "store"
+	gitCredentialErase = "erase"
+)
+
+// gitCredential is the credential description passed by git
+type gitCredential struct {
+	protocol string
+	host     string
+	path     string
+	username string
+	password string
+}
+
+// getGitCredentialCmd returns the representation of the git-credential command
+func getGitCredentialCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "git-credential <get|store|erase>",
+		Short: "Git credential helper reading and storing credentials in the vault",
+		Long: `Implements the git credential helper protocol, enable it with
+  git config --global credential.helper "!passtool git-credential"
+The host, or the host with the path if git sends it, is used as the service name, the username as the login.
+Secrets are requested from the terminal. A credential rejected by the server is marked expired, it's updated
+by the next store, other stores of existing accounts are ignored as they only confirm the credential.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{stdinProtocolAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "git credential " + args[0]
+			// stdout is used by the protocol
+			deps.printer = out.NewWithWriter(os.Stderr)
+
+			credential, err := readGitCredential(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if credential.host == "" {
+				return nil
+			}
+
+			resolver, err := newTerminalSecretResolver(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			account, found := findGitAccount(resolver.accounts, credential)
+
+			switch args[0] {
+			case gitCredentialGet:
+				if !found {
+					return nil
+				}
+
+				password, err := resolver.password(account)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				fmt.Printf("username=%s\npassword=%s\n", account.Login, password)
+				resolver.recordUsage(auditGitCredential, gitCredentialGet)
+			case gitCredentialStore:
+				err = storeGitCredential(deps, resolver, credential, account, found)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			case gitCredentialErase:
+				if !found {
+					return nil
+				}
+
+				now := time.Now()
+				err = deps.repo.Accounts().SetExpiry(&account, &now)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				recordAudit(deps, auditGitCredential, &account, gitCredentialErase)
+			}
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// readGitCredential reads the credential attributes until the blank line or the end of input
+func readGitCredential(r io.Reader) (gitCredential, error) {
+	var c gitCredential
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return c, fmt.Errorf("invalid credential line %q", line)
+		}
+
+		switch key {
+		case "protocol":
+			c.protocol = value
+		case "host":
+			c.host = value
+		case "path":
+			c.path = value
+		case "username":
+			c.username = value
+		case "password":
+			c.password = value
+		case "url":
+			u, err := url.Parse(value)
+			if err != nil {
+				return c, fmt.Errorf("invalid credential url: %w", err)
+			}
+			c.protocol, c.host, c.path = u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/")
+			if u.User != nil {
+				c.username = u.User.Username()
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return c, fmt.Errorf("unable to read credential: %w", err)
+	}
+
+	return c, nil
+}
+
+// serviceNames returns the names of the service the credential may be stored for, the most specific first
+func (c gitCredential) serviceNames() []string {
+	hosts := []string{c.host}
+	if c.protocol != "" {
+		hosts = append(hosts, c.protocol+"://"+c.host)
+	}
+
+	var names []string
+	if c.path != "" {
+		for _, host := range hosts {
+			names = append(names, host+"/"+c.path)
+		}
+	}
+
+	return append(names, hosts...)
+}
+
+// findGitAccount returns the account of the credential, the username may be omitted if the service
+// has the only account
+func findGitAccount(accounts []models.Account, c gitCredential) (models.Account, bool) {
+	for _, name := range c.serviceNames() {
+		var candidates []models.Account
+		for _, account := range accounts {
+			if account.Service.Name == name && (c.username == "" || account.Login == c.username) {
+				candidates = append(candidates, account)
+			}
+		}
+
+		if len(candidates) > 0 {
+			return candidates[0], len(candidates) == 1
+		}
+	}
+
+	return models.Account{}, false
+}
+
+// storeGitCredential saves the credential as a new account or updates the password of the expired account
+func storeGitCredential(
+	deps *AppDependencies,
+	resolver *secretResolver,
+	credential gitCredential,
+	account models.Account,
+	found bool,
+) error {
+	if credential.username == "" || credential.password == "" {
+		return nil
+	}
+
+	if !found {
+		secret, err := requestNewTerminalSecret(credential.username, credential.host)
+		if err != nil {
+			return err
+		}
+
+		account, err = saveNewCredential(deps, credential.serviceNames()[0], credential.username, credential.password, secret)
+		if err != nil {
+			return err
+		}
+		recordAudit(deps, auditGitCredential, &account, gitCredentialStore)
+		return nil
+	}
+
+	if account.ExpiresAt == nil || account.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	secret, err := resolver.secretFor(account)
+	if err != nil {
+		return err
+	}
+
+	return setAccountPassword(auditedVault(deps, auditGitCredential, gitCredentialStore), account, credential.password, secret)
+}
+
+// requestNewTerminalSecret requests the secret key for the new account from the terminal with confirmation
+func requestNewTerminalSecret(login, serviceName string) (string, error) {
+	secret, err := cli.GetSensitiveTerminalInput(
+		fmt.Sprintf("passtool: enter secret key for %q at %q: ", login, serviceName))
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := cli.GetSensitiveTerminalInput("passtool: enter secret key again: ")
+	if err != nil {
+		return "", err
+	}
+	if secret != confirmation {
+		return "", fmt.Errorf("secret keys are not equal")
+	}
+
+	return secret, nil
+}
+
+// saveNewCredential saves the new account of the service with the password encrypted with the secret
+func saveNewCredential(deps *AppDependencies, serviceName, login, userPassword, secret string) (models.Account, error) {
+	service, err := deps.repo.Services().FetchOrCreate(serviceName)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	account := models.Account{Login: login, Service: service}
+	var password models.Password
+	err = encryptPassword(&password, userPassword, secret, deps.config.SecretKeyLength, deps.config.PasswordSettings)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	if err = deps.repo.Accounts().SaveWithPassword(&account, &password); err != nil {
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+// setAccountPassword saves the new password of the account with the vault unlocked with the secret,
+// the vault removes the expiry which has come and shares the account again
+func setAccountPassword(vault *passtool.Vault, account models.Account, password, secret string) error {
+	if err := vault.Unlock(secret); err != nil {
+		return err
+	}
+
+	_, err := vault.Set(account.Service.Name, account.Login, password)
+	return err
+}
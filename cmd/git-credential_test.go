@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"strings"
+	"testing"
+)
+
+func TestFindGitAccount(t *testing.T) {
+	var accounts []models.Account
+	for i, ref := range []string{"github.com/bob", "github.com/amy", "GitHub.com/eve", "github.com/org/repo/joe"} {
+		j := strings.LastIndex(ref, "/")
+		account := models.Account{Login: ref[j+1:], Service: models.Service{Name: ref[:j]}}
+		account.ID = uint(i + 1)
+		accounts = append(accounts, account)
+	}
+
+	tests := []struct {
+		name       string
+		credential gitCredential
+		wantID     uint
+		wantFound  bool
+	}{
+		{"by username", gitCredential{host: "github.com", username: "amy"}, 2, true},
+		{"several accounts without username", gitCredential{host: "github.com"}, 1, false},
+		{"the only account of the service", gitCredential{host: "GitHub.com"}, 3, true},
+		{"service differing in case", gitCredential{host: "GITHUB.COM", username: "bob"}, 0, false},
+		{"service with path", gitCredential{protocol: "https", host: "github.com", path: "org/repo"}, 4, true},
+		{"host without the path account", gitCredential{host: "github.com", path: "other/repo", username: "bob"}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, found := findGitAccount(accounts, tt.credential)
+			if account.ID != tt.wantID || found != tt.wantFound {
+				t.Errorf("got account %d found %v, want %d found %v", account.ID, found, tt.wantID, tt.wantFound)
+			}
+		})
+	}
+}
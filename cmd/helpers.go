@@ -1,41 +1,40 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/MirToykin/passtool/internal/config"
-	"github.com/MirToykin/passtool/internal/crypto"
 	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/storage"
 	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/pkg/passtool"
 	passGenerator "github.com/sethvargo/go-password/password"
 	"github.com/spf13/cobra"
-	"gorm.io/gorm"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
-	"sync"
 )
 
 // requestUniqueLoginForService request login from user. If login already exists for the given service - retries.
 func requestUniqueLoginForService(
-	account *models.Account,
 	service models.Service,
 	printer Printer,
-	db *gorm.DB,
+	input cli.Prompter,
+	repo storage.Repository,
 ) (string, error) {
 	for {
-		login := cli.GetUserInput("Enter login: ", printer)
+		login, err := input.ReadLine("Enter login: ")
+		if err != nil {
+			return "", err
+		}
 
-		var count int64
-		err := account.FindByLoginAndServiceID(db, login, service.ID).Count(&count).Error
+		exists, err := repo.Accounts().Exists(login, service.ID)
 		if err != nil {
 			return "", fmt.Errorf("faild to request unique login: %w", err)
 		}
 
-		if count > 0 {
-			log.Printf(
+		if exists {
+			printer.Warning(
 				"Account with login %q at %q already exists, to update it use the %q command. Use another login.",
 				login,
 				service.Name,
@@ -47,40 +46,67 @@ func requestUniqueLoginForService(
 	}
 }
 
-// getSecret returns secret given by user (handle possible errors)
-func getSecret(secretName string, confirm bool, printer Printer) string {
+// getSecret returns secret given by user
+func getSecret(secretName string, confirm bool, input cli.Prompter) (string, error) {
+	return requestSecret(input.ReadSecret, secretName, confirm)
+}
+
+// getSecretKey returns the secret key the passwords are encrypted with, it's given by user
+// unless it's known from --secret-stdin or --secret-fd
+func getSecretKey(secretName string, confirm bool, input cli.Prompter) (string, error) {
+	return requestSecret(input.ReadSecretKey, secretName, confirm)
+}
+
+// requestSecret requests the secret with the given read function of the prompter
+func requestSecret(read func(prompt string) (string, error), secretName string, confirm bool) (string, error) {
 	postfix := ""
 	if confirm {
 		postfix = " again"
 	}
 
-	secret, err := cli.GetSensitiveUserInput(fmt.Sprintf("Enter %s%s: ", secretName, postfix), printer)
-	checkSimpleErrorWithDetails(err, fmt.Sprintf("unable to get %s", secretName), printer)
-	return secret
+	secret, err := read(fmt.Sprintf("Enter %s%s: ", secretName, postfix))
+	if err != nil {
+		return "", fmt.Errorf("unable to get %s: %w", secretName, err)
+	}
+	return secret, nil
 }
 
 // getSecretWithConfirmation handles getting pass phrase with confirmation
-func getSecretWithConfirmation(secretName string, retryMsg string, printer Printer) string {
+func getSecretWithConfirmation(secretName string, retryMsg string, printer Printer, input cli.Prompter) (string, error) {
+	return confirmSecret(getSecret, secretName, retryMsg, printer, input)
+}
+
+// getSecretKeyWithConfirmation handles getting the secret key with confirmation
+func getSecretKeyWithConfirmation(secretName string, retryMsg string, printer Printer, input cli.Prompter) (string, error) {
+	return confirmSecret(getSecretKey, secretName, retryMsg, printer, input)
+}
+
+// confirmSecret requests the secret twice with the given get function until both values are equal
+func confirmSecret(
+	get func(secretName string, confirm bool, input cli.Prompter) (string, error),
+	secretName, retryMsg string,
+	printer Printer,
+	input cli.Prompter,
+) (string, error) {
 	for {
-		pass1 := getSecret(secretName, false, printer)
-		pass2 := getSecret(secretName, true, printer)
+		pass1, err := get(secretName, false, input)
+		if err != nil {
+			return "", err
+		}
+		pass2, err := get(secretName, true, input)
+		if err != nil {
+			return "", err
+		}
 
 		if pass1 != pass2 {
-			fmt.Println(retryMsg)
+			printer.Warning(retryMsg)
 		} else {
-			return pass1
+			return pass1, nil
 		}
 	}
 }
 
-// checkSimpleErrorWithDetails handles general error, and prints message with error details to the console
-func checkSimpleErrorWithDetails(err error, msg string, p Printer) {
-	if err != nil {
-		p.ErrorWithExit("%s: %v", msg, err)
-	}
-}
-
-// encryptPassword sets encrypted password and salt for given Password instance
+// encryptPassword sets encrypted password, salt and verification tag for given Password instance
 func encryptPassword(
 	password *models.Password,
 	userPassword, secret string,
@@ -98,133 +124,28 @@ func encryptPassword(
 		return fmt.Errorf("unable to get salt: %w", err)
 	}
 
-	key := crypto.DeriveKey(secret, salt, keyLen)
-
-	encryptedPassword, err := crypto.Encrypt(key, userPassword)
-	if err != nil {
-		return fmt.Errorf("unable to encrypt the password: %w", err)
-	}
-
-	password.Encrypted = encryptedPassword
-	password.Salt = salt
-	return nil
+	return password.SetEncrypted(userPassword, secret, salt, keyLen)
 }
 
 // PrintServiceRequirements prints the information for service to be able to work
-func PrintServiceRequirements(cfg *config.Config, printer Printer) {
-	fmt.Println()
+func PrintServiceRequirements(vars []config.EnvVar, printer Printer) {
+	printer.Simpleln("")
 	printer.Infoln("For the app to work you need to add the following environment variables:")
-	for _, ev := range cfg.GetRequiredEnvVars() {
-		fmt.Println(fmt.Sprintf("  %q - %s", ev.Name, ev.Description))
-	}
-
-	fmt.Println()
-
-	printer.Infoln("You might also want to add the following optional environment variables:")
-	for _, ev := range cfg.GetOptionalEnvVars() {
-		fmt.Println(fmt.Sprintf("  %q - %s", ev.Name, ev.Description))
-	}
-	fmt.Println()
-}
-
-// copyFile copies file from source to destination
-func copyFile(source, destination string) error {
-	sourceFile, err := os.Open(source)
-	if err != nil {
-		return fmt.Errorf("unable to open source file: %w", err)
-	}
-	defer sourceFile.Close()
-
-	destinationFile, err := os.Create(destination)
-	if err != nil {
-		return fmt.Errorf("unable to create destination file: %w", err)
-	}
-	defer destinationFile.Close()
-
-	_, err = io.Copy(destinationFile, sourceFile)
-	if err != nil {
-		return fmt.Errorf("unable to copy file: %w", err)
-	}
-
-	return nil
-}
-
-// checkIfBackupNeeded returns true if backup needed otherwise false
-func checkIfBackupNeeded(passwordID, backupIndex uint) bool {
-	return passwordID%backupIndex == 0
-}
-
-// createBackup creates storage backup
-func createBackup(
-	wg *sync.WaitGroup,
-	cfg *config.Config,
-	errChan chan<- error,
-	printer Printer) {
-	defer wg.Done()
-	printer.Simpleln("Creating backup...")
-
-	err := copyFile(cfg.StoragePath, cfg.GetBackupFilePath())
-	if err != nil {
-		errChan <- fmt.Errorf("unable to create backup: %w", err)
-		return
-	}
-
-	errChan <- nil
-}
-
-// clearUnnecessaryBackups clears outdated backups
-func clearUnnecessaryBackups(
-	wg *sync.WaitGroup,
-	errChan chan<- error,
-	conf *config.Config,
-	printer Printer,
-) {
-	defer wg.Done()
-	errTemplate := "unable to clear backup: %w"
-	files, err := filepath.Glob(conf.GetBackupFilePathMask())
-	if err != nil {
-		errChan <- fmt.Errorf(errTemplate, err)
-		return
-	}
-
-	if len(files) <= int(conf.BackupCountToStore) {
-		errChan <- nil
-		return
-	}
-
-	printer.Simpleln("clearing unnecessary backups...")
-
-	type fileInfo struct {
-		path    string
-		created int64
-	}
-	var fileInfoData []fileInfo
-
-	for _, file := range files {
-		fInfo, err := os.Stat(file)
-		if err != nil {
-			errChan <- fmt.Errorf(errTemplate, err)
-			return
+	for _, ev := range vars {
+		if ev.Required {
+			printer.Simpleln("  %q - %s", ev.Name, ev.Description)
 		}
-
-		fileInfoData = append(fileInfoData, fileInfo{
-			path:    file,
-			created: fInfo.ModTime().Unix(),
-		})
 	}
 
-	sort.Slice(fileInfoData, func(i, j int) bool {
-		return fileInfoData[i].created > fileInfoData[j].created
-	})
+	printer.Simpleln("")
 
-	for _, file := range fileInfoData[conf.BackupCountToStore:] {
-		err = os.Remove(file.path)
-		if err != nil {
-			printer.Warning("unable to remove unnecessary backup file: %s", file.path)
+	printer.Infoln("You might also want to add the following optional environment variables:")
+	for _, ev := range vars {
+		if !ev.Required {
+			printer.Simpleln("  %q - %s", ev.Name, ev.Description)
 		}
 	}
-
-	errChan <- nil
+	printer.Simpleln("")
 }
 
 // requestExistingModel requests name or serial number from user. If it doesn't exist for the given map or slice - retries.
@@ -235,9 +156,13 @@ func requestExistingModel[M any](
 	getModelValue func(m M) string,
 	strIdentifier string,
 	printer Printer,
-) *M {
+	input cli.Prompter,
+) (*M, error) {
 	for {
-		identifier := cli.GetUserInput(fmt.Sprintf("Enter %s or serial number: ", strIdentifier), printer)
+		identifier, err := input.ReadLine(fmt.Sprintf("Enter %s or serial number: ", strIdentifier))
+		if err != nil {
+			return nil, err
+		}
 		var name string
 
 		num, err := strconv.Atoi(identifier)
@@ -246,7 +171,7 @@ func requestExistingModel[M any](
 		} else {
 			model, found := mMap[num]
 			if found {
-				return &model
+				return &model, nil
 			} else {
 				name = identifier
 			}
@@ -254,7 +179,7 @@ func requestExistingModel[M any](
 
 		for _, model := range mSlice {
 			if getModelValue(model) == name {
-				return &model
+				return &model, nil
 			}
 		}
 
@@ -267,7 +192,7 @@ func requestExistingModel[M any](
 }
 
 // printSortedMap prints map key and corresponding string value retrieved from map by key
-func printSortedMap[M any](target map[int]M, getStrVal func(target map[int]M, key int) string) {
+func printSortedMap[M any](target map[int]M, getStrVal func(target map[int]M, key int) string, printer Printer) {
 	keys := make([]int, 0, len(target))
 
 	for key := range target {
@@ -276,42 +201,44 @@ func printSortedMap[M any](target map[int]M, getStrVal func(target map[int]M, ke
 
 	sort.Ints(keys)
 	for _, key := range keys {
-		fmt.Println(key, getStrVal(target, key))
+		printer.Simpleln("%d %s", key, getStrVal(target, key))
 	}
 
-	fmt.Println()
+	printer.Simpleln("")
 }
 
 // genericGet - generic function which retrieves service account and secret phrase from user
 func genericGet(
 	operation string,
-	db *gorm.DB,
+	repo storage.Repository,
 	printer Printer,
+	input cli.Prompter,
 	// models.Account passed to handler is guaranteed to be loaded and have loaded Password and Service dependencies
-	handler func(a models.Account),
-) {
-	var service *models.Service
-	var count int64
-
-	err := service.List(db).Count(&count).Error
-	checkSimpleErrorWithDetails(err, "Unable to check service existence", printer)
+	handler func(a models.Account) error,
+) error {
+	count, err := repo.Services().Count()
+	if err != nil {
+		return fmt.Errorf("unable to check service existence: %w", err)
+	}
 	if count == 0 {
 		printer.Infoln("There are no added services yet")
-		os.Exit(0)
+		return nil
 	}
 
-	servicesMap, err := service.GetMap(db)
-	checkSimpleErrorWithDetails(err, operation, printer)
-	var servicesSlice []models.Service
-	for _, s := range servicesMap {
-		servicesSlice = append(servicesSlice, s)
+	servicesSlice, err := repo.Services().List(false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	servicesMap := make(map[int]models.Service)
+	for i, s := range servicesSlice {
+		servicesMap[i+1] = s
 	}
 	printer.Header("The following services were created:")
 	printSortedMap(servicesMap, func(sMap map[int]models.Service, key int) string {
 		return sMap[key].Name
-	})
+	}, printer)
 
-	service = requestExistingModel(
+	service, err := requestExistingModel(
 		servicesMap,
 		servicesSlice,
 		func(s models.Service) string {
@@ -319,23 +246,29 @@ func genericGet(
 		},
 		"service name",
 		printer,
+		input,
 	)
+	if err != nil {
+		return err
+	}
 
-	err = service.LoadAccounts(db)
-	checkSimpleErrorWithDetails(err, operation, printer)
+	err = repo.Services().LoadAccounts(service)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
 
 	if len(service.Accounts) == 0 {
 		printer.Simpleln("Accounts for service %q not found", service.Name)
-		os.Exit(0)
+		return nil
 	}
 
 	printer.Header("Service %q has accounts with the following logins:", service.Name)
 	accountsMap := service.GetAccountsMap()
 	printSortedMap(accountsMap, func(aMap map[int]models.Account, key int) string {
 		return aMap[key].Login
-	})
+	}, printer)
 
-	account := requestExistingModel(
+	account, err := requestExistingModel(
 		accountsMap,
 		service.Accounts,
 		func(acc models.Account) string {
@@ -343,12 +276,19 @@ func genericGet(
 		},
 		"login",
 		printer,
+		input,
 	)
-	err = account.LoadPassword(db)
-	checkSimpleErrorWithDetails(err, operation, printer)
+	if err != nil {
+		return err
+	}
+
+	err = repo.Accounts().LoadPassword(account)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
 	account.Service = *service
 
-	handler(*account)
+	return handler(*account)
 }
 
 // getDecryptedPasswordWithRetry requests secret key from user to decode the given password (performs retries)
@@ -357,48 +297,107 @@ func getDecryptedPasswordWithRetry(
 	keyLen int,
 	maxRetries int,
 	printer Printer,
+	input cli.Prompter,
 ) (string, error) {
+	return retryWithSecretKey(maxRetries, printer, input, func(secret string) (string, error) {
+		decrypted, err := password.GetDecrypted(secret, keyLen)
+		if err != nil && !errors.Is(err, models.ErrWrongSecret) {
+			// passwords saved without the verification tag only fail to decrypt with another secret key
+			err = fmt.Errorf("%w: %v", models.ErrWrongSecret, err)
+		}
+		return decrypted, err
+	})
+}
+
+// getVaultAccountWithRetry requests secret key from user until the vault opens the given account with it
+func getVaultAccountWithRetry(
+	vault *passtool.Vault,
+	account models.Account,
+	maxRetries int,
+	printer Printer,
+	input cli.Prompter,
+) (passtool.Account, error) {
+	return retryWithSecretKey(maxRetries, printer, input, func(secret string) (passtool.Account, error) {
+		if err := vault.Unlock(secret); err != nil {
+			return passtool.Account{}, err
+		}
+		return vault.Get(account.Service.Name, account.Login)
+	})
+}
+
+// retryWithSecretKey requests secret key from user and passes it to open until it doesn't fail with
+// models.ErrWrongSecret (performs retries), other errors of open are returned at once
+func retryWithSecretKey[T any](
+	maxRetries int,
+	printer Printer,
+	input cli.Prompter,
+	open func(secret string) (T, error),
+) (T, error) {
+	var zero T
 	tryCount := 0
 	for {
-		secret, err := cli.GetSensitiveUserInput("Enter secret: ", printer)
+		secret, err := input.ReadSecretKey("Enter secret: ")
 		if err != nil {
-			return "", fmt.Errorf("unable to get sercret: %w", err)
+			return zero, fmt.Errorf("unable to get sercret: %w", err)
 		}
 
-		decrypted, err := password.GetDecrypted(secret, keyLen)
-		if err != nil {
-			if tryCount >= maxRetries {
-				return "", fmt.Errorf("unable to check secret: %w", err)
-			}
+		opened, err := open(secret)
+		if !errors.Is(err, models.ErrWrongSecret) {
+			return opened, err
+		}
 
-			printer.Warning("Incorrect secret, try again")
-			tryCount++
-		} else {
-			return decrypted, nil
+		// the secret key given by a flag is the same on each retry
+		if tryCount >= maxRetries || cli.HasFixedSecretKey(input) {
+			return zero, fmt.Errorf("unable to check secret: %w", err)
 		}
+
+		printer.Warning("Incorrect secret, try again")
+		tryCount++
 	}
 }
 
-// getPasswordGetterByGenerateAndLengthFlag return function for getting password based on flags -g and --length
+// getPasswordGetterByGenerateAndLengthFlag return function for getting password based on flags -g and --length,
+// the password is read from the file given by --password-file if it's set
 func getPasswordGetterByGenerateAndLengthFlag(
 	cmd *cobra.Command,
 	genFlag, lenFlag, passwordAlias string,
 	printer Printer,
+	input cli.Prompter,
 	conf *config.Config,
 ) (func() (string, error), error) {
+	passwordFile, err := cmd.Flags().GetString(passwordFileFlag)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s flag: %w", passwordFileFlag, err)
+	}
+	if passwordFile != "" {
+		return func() (string, error) {
+			file, err := os.Open(passwordFile)
+			if err != nil {
+				return "", fmt.Errorf("unable to open password file: %w", err)
+			}
+			defer file.Close()
+
+			userPassword, err := cli.ReadValue(file)
+			if err != nil {
+				return "", fmt.Errorf("unable to read password file: %w", err)
+			}
+			return userPassword, nil
+		}, nil
+	}
+
 	needGenerate, err := cmd.Flags().GetBool(genFlag)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get %s flag: %w", genFlag, err)
 	}
 
 	if needGenerate {
-		length, err := cmd.Flags().GetInt(lenFlag)
+		length, err := getLengthFlag(cmd, lenFlag, conf)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get %s flag: %w", lenFlag, err)
+			return nil, err
 		}
 
 		return func() (string, error) {
-			userPassword, err := getGeneratedPassword(length, conf, printer)
+			userPassword, err := getGeneratedPassword(length, conf)
 			if err != nil {
 				return "", fmt.Errorf("unable to get generated password: %w", err)
 			}
@@ -406,7 +405,21 @@ func getPasswordGetterByGenerateAndLengthFlag(
 		}, nil
 	} else {
 		return func() (string, error) {
-			return getSecretWithConfirmation(passwordAlias, "Passwords are not equal", printer), nil
+			return getSecretWithConfirmation(passwordAlias, "Passwords are not equal", printer, input)
 		}, nil
 	}
 }
+
+// getLengthFlag returns the length of generated passwords given by the flag, the default one of the config
+// if the flag is not set
+func getLengthFlag(cmd *cobra.Command, lenFlag string, conf *config.Config) (int, error) {
+	if !cmd.Flags().Changed(lenFlag) {
+		return conf.PasswordSettings.Length, nil
+	}
+
+	length, err := cmd.Flags().GetInt(lenFlag)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get %s flag: %w", lenFlag, err)
+	}
+	return length, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"strings"
+	"testing"
+)
+
+func TestRetryWithSecretKey(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	cfg := testConfig(t, dir)
+	vault, err := passtool.Open(passtool.Options{StoragePath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	repo, err := storage.Open(cfg.StorageBackend, cfg.StoragePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	accounts, err := repo.Accounts().List()
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("got accounts %+v, %v, want the added one", accounts, err)
+	}
+	account, password := accounts[0], accounts[0].Password
+
+	open := map[string]func(printer Printer, input cli.Prompter) (string, error){
+		"password": func(printer Printer, input cli.Prompter) (string, error) {
+			return getDecryptedPasswordWithRetry(password, cfg.SecretKeyLength, 2, printer, input)
+		},
+		"vault account": func(printer Printer, input cli.Prompter) (string, error) {
+			opened, err := getVaultAccountWithRetry(vault, account, 2, printer, input)
+			return opened.Password, err
+		},
+	}
+
+	for name, get := range open {
+		t.Run(name, func(t *testing.T) {
+			tests := []struct {
+				name        string
+				answers     []string
+				fixed       bool
+				wantErr     bool
+				wantPrompts int
+				wantRetries int
+			}{
+				{name: "retried until correct", answers: []string{"wrong", "key"}, wantPrompts: 2, wantRetries: 1},
+				{name: "retries run out", answers: []string{"1", "2", "3", "key"}, wantErr: true, wantPrompts: 3, wantRetries: 2},
+				// the answers are left for other prompts
+				{name: "fixed secret key is not retried", answers: []string{"key"}, fixed: true, wantErr: true},
+			}
+
+			for _, tt := range tests {
+				var output bytes.Buffer
+				prompter := cli.NewScriptedPrompter(tt.answers...)
+				var input cli.Prompter = prompter
+				if tt.fixed {
+					input = cli.WithSecretKey(prompter, "wrong")
+				}
+
+				got, err := get(out.NewWithWriter(&output), input)
+				if tt.wantErr {
+					if !errors.Is(err, models.ErrWrongSecret) {
+						t.Errorf("%s: got %q, %v, want ErrWrongSecret", tt.name, got, err)
+					}
+				} else if err != nil || got != "password" {
+					t.Errorf("%s: got %q, %v, want the password", tt.name, got, err)
+				}
+				if len(prompter.Prompts) != tt.wantPrompts {
+					t.Errorf("%s: got prompts %q, want %d", tt.name, prompter.Prompts, tt.wantPrompts)
+				}
+				if retries := strings.Count(output.String(), "Incorrect secret, try again"); retries != tt.wantRetries {
+					t.Errorf("%s: got %d retries, want %d", tt.name, retries, tt.wantRetries)
+				}
+			}
+		})
+	}
+}
+
+func TestConfirmationWarningsArePrinted(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "amy", "new", "other", "new", "new", "key", "key"}, "add")
+	for _, want := range []string{`Account with login "bob" at "github.com" already exists`, "Passwords are not equal"} {
+		if !strings.Contains(run.output, want) {
+			t.Errorf("got output:\n%s\nwant %q", run.output, want)
+		}
+	}
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"bob", "amy"}})
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/sharing"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	nameFlag = "name"
+	keyFlag  = "key"
+)
+
+// getIdentityCmd returns the representation of the identity command with its subcommands
+func getIdentityCmd(deps *AppDependencies) *cobra.Command {
+	identityCmd := &cobra.Command{
+		Use:   "identity",
+		Short: "Manage identities used for sharing accounts",
+		Long: `Your own identity is a key pair with the private key encrypted with a passphrase,
+teammates are added by their public keys. Accounts are shared by wrapping their data keys for the public keys.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	createCmd := getIdentityCreateCmd(deps)
+	createCmd.Flags().String(nameFlag, "", "Name of your identity")
+	_ = createCmd.MarkFlagRequired(nameFlag)
+
+	addCmd := getIdentityAddCmd(deps)
+	addCmd.Flags().String(nameFlag, "", "Name of the teammate")
+	addCmd.Flags().String(keyFlag, "", "Public key of the teammate")
+	_ = addCmd.MarkFlagRequired(nameFlag)
+	_ = addCmd.MarkFlagRequired(keyFlag)
+
+	removeCmd := getIdentityRemoveCmd(deps)
+	removeCmd.Flags().String(nameFlag, "", "Name of the identity")
+	_ = removeCmd.MarkFlagRequired(nameFlag)
+
+	identityCmd.AddCommand(createCmd, addCmd, getIdentityListCmd(deps), getIdentityExportCmd(deps), removeCmd)
+	return identityCmd
+}
+
+// getIdentityCreateCmd returns the representation of the identity create command
+func getIdentityCreateCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "create",
+		Short: "Create your own identity",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "create identity"
+			name, err := cmd.Flags().GetString(nameFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			own, err := deps.repo.Identities().FetchOwn()
+			if err == nil {
+				return newValidationError("Your identity %q already exists", own.Name)
+			}
+			if !errors.Is(err, storage.ErrNotFound) {
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			}
+
+			passphrase, err := getSecretWithConfirmation("identity passphrase", "Passphrases are not equal", deps.printer, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			identity, err := sharing.NewIdentity(name, passphrase, deps.config.SecretKeyLength)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = deps.repo.Identities().Create(&identity)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("Identity %q created, give your teammates the public key:", name)
+			deps.printer.Simpleln(identity.PublicKey)
+			return nil
+		},
+	}
+}
+
+// getIdentityAddCmd returns the representation of the identity add command
+func getIdentityAddCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "add",
+		Short: "Add the public key of a teammate",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "add identity"
+			name, err := cmd.Flags().GetString(nameFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			key, err := cmd.Flags().GetString(keyFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			identity, err := sharing.NewRecipient(name, key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = deps.repo.Identities().Create(&identity)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("Identity %q added", name)
+			return nil
+		},
+	}
+}
+
+// getIdentityListCmd returns the representation of the identity list command
+func getIdentityListCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Print the list of identities",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			identities, err := deps.repo.Identities().List()
+			if err != nil {
+				return fmt.Errorf("list identities: %w", err)
+			}
+
+			if len(identities) == 0 {
+				deps.printer.Infoln("There are no added identities yet")
+				return nil
+			}
+
+			deps.printer.Header("The following identities were added:")
+			for i, identity := range identities {
+				suffix := ""
+				if identity.IsOwn() {
+					suffix = " (you)"
+				}
+				deps.printer.Infoln("%d. %s%s", i+1, identity.Name, suffix)
+				deps.printer.Simpleln("   %s", identity.PublicKey)
+			}
+			return nil
+		},
+	}
+}
+
+// getIdentityExportCmd returns the representation of the identity export command
+func getIdentityExportCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "export",
+		Short: "Print the public key of your identity",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			own, err := deps.repo.Identities().FetchOwn()
+			if errors.Is(err, storage.ErrNotFound) {
+				return newNotFoundError("You have no identity yet, use the %q command", "identity create")
+			}
+			if err != nil {
+				return fmt.Errorf("export identity: %w", err)
+			}
+
+			deps.printer.Simpleln(own.PublicKey)
+			return nil
+		},
+	}
+}
+
+// getIdentityRemoveCmd returns the representation of the identity remove command
+func getIdentityRemoveCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove",
+		Short: "Remove the identity and the shares for it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "remove identity"
+			name, err := cmd.Flags().GetString(nameFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			identity, err := deps.repo.Identities().FetchByName(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = deps.repo.Identities().Delete(identity)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("Identity %q removed", name)
+			return nil
+		},
+	}
+}
+
+func init() {}
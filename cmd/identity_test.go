@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+// createIdentity creates the own identity with the passphrase and returns its public key
+func createIdentity(t *testing.T, dir, name, passphrase string) string {
+	t.Helper()
+	mustRun(t, dir, []string{passphrase, passphrase}, "identity", "create", "--name", name)
+	return strings.TrimSpace(mustRun(t, dir, nil, "identity", "export").output)
+}
+
+func TestIdentityCreatePrompts(t *testing.T) {
+	dir := newTestStorage(t)
+
+	run := mustRun(t, dir, []string{"phrase", "other", "phrase", "phrase"}, "identity", "create", "--name", "bob")
+	assertPrompts(t, run,
+		"Enter identity passphrase: ",
+		"Enter identity passphrase again: ",
+		"Enter identity passphrase: ",
+		"Enter identity passphrase again: ",
+	)
+
+	publicKey := strings.TrimSpace(mustRun(t, dir, nil, "identity", "export").output)
+	if publicKey == "" || !strings.Contains(run.output, publicKey) {
+		t.Errorf("got output:\n%s\nwant the exported public key %q printed", run.output, publicKey)
+	}
+
+	run = execute(t, dir, nil, "identity", "create", "--name", "amy")
+	assertExitCode(t, run, exitInvalid)
+	assertPrompts(t, run)
+}
+
+func TestIdentityAddListRemove(t *testing.T) {
+	dir := newTestStorage(t)
+	createIdentity(t, dir, "bob", "phrase")
+	amyKey := createIdentity(t, newTestStorage(t), "amy", "other")
+
+	run := execute(t, dir, nil, "identity", "add", "--name", "eve", "--key", "invalid")
+	if run.err == nil {
+		t.Error("got the identity with the invalid key added")
+	}
+	mustRun(t, dir, nil, "identity", "add", "--name", "amy", "--key", amyKey)
+
+	run = mustRun(t, dir, nil, "identity", "list")
+	for _, want := range []string{"bob (you)", "amy", amyKey} {
+		if !strings.Contains(run.output, want) {
+			t.Errorf("got identities:\n%s\nwant %q listed", run.output, want)
+		}
+	}
+
+	mustRun(t, dir, nil, "identity", "remove", "--name", "amy")
+	if run = mustRun(t, dir, nil, "identity", "list"); strings.Contains(run.output, amyKey) {
+		t.Errorf("got identities:\n%s\nwant the removed one not listed", run.output)
+	}
+	assertExitCode(t, execute(t, dir, nil, "identity", "remove", "--name", "amy"), exitNotFound)
+}
+
+func TestIdentityExportWithoutIdentity(t *testing.T) {
+	dir := newTestStorage(t)
+	assertExitCode(t, execute(t, dir, nil, "identity", "export"), exitNotFound)
+}
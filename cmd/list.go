@@ -1,26 +1,83 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/MirToykin/passtool/internal/storage/models"
 	"github.com/spf13/cobra"
+	"sort"
+	"time"
+)
+
+const (
+	staleFlag   = "stale"
+	detailsFlag = "details"
 )
 
 // listCmd represents the list command
-func getListCmd(deps AppDependencies) *cobra.Command {
+func getListCmd(deps *AppDependencies) *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
 		Short: "Prints a list of available services with their accounts",
 		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			operation := "get list"
 			withAccounts, err := cmd.Flags().GetBool("accounts")
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			stale, err := cmd.Flags().GetBool(staleFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			details, err := cmd.Flags().GetBool(detailsFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			asJSON, err := cmd.Flags().GetBool(jsonFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
 
-			service := models.Service{}
-			services, err := service.GetList(deps.db, withAccounts)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
+			if !stale && !details && !asJSON {
+				services, err := deps.repo.Services().List(withAccounts)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
 
-			printServices(services, withAccounts, deps.printer)
+				printServices(services, withAccounts, deps.printer)
+				return nil
+			}
+
+			accounts, err := deps.repo.Accounts().List()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if stale {
+				now := time.Now()
+				var staleAccounts []models.Account
+				for _, account := range accounts {
+					if account.IsDue(deps.config.RotationPeriod, now) {
+						staleAccounts = append(staleAccounts, account)
+					}
+				}
+				accounts = staleAccounts
+			}
+
+			if asJSON {
+				if err := printAccountsJSON(accounts, deps); err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				return nil
+			}
+
+			if len(accounts) == 0 {
+				deps.printer.Infoln("There are no accounts to show")
+				return nil
+			}
+
+			printAccountDetails(accounts, deps)
+			return nil
 		},
 	}
 }
@@ -44,3 +101,32 @@ func printServices(services []models.Service, withAccounts bool, p Printer) {
 		}
 	}
 }
+
+// printAccountDetails prints the accounts grouped by services together with their dates
+func printAccountDetails(accounts []models.Account, deps *AppDependencies) {
+	deps.printer.Header("The following accounts were added:")
+
+	var serviceID uint
+	number := 0
+	for _, account := range sortAccountsByService(accounts) {
+		if account.ServiceID != serviceID || number == 0 {
+			serviceID = account.ServiceID
+			number++
+			deps.printer.Infoln("%d. %s", number, account.Service.Name)
+		}
+		deps.printer.Simpleln("  - %s (%s)", account.Login, describeAccountDates(account, deps.config.RotationPeriod))
+	}
+}
+
+// sortAccountsByService returns the accounts sorted by their service names and logins
+func sortAccountsByService(accounts []models.Account) []models.Account {
+	sorted := append([]models.Account(nil), accounts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Service.Name != sorted[j].Service.Name {
+			return sorted[i].Service.Name < sorted[j].Service.Name
+		}
+		return sorted[i].Login < sorted[j].Login
+	})
+
+	return sorted
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"testing"
+)
+
+// addListedAccounts adds the accounts of two services, one of them expired
+func addListedAccounts(t *testing.T, dir string) {
+	t.Helper()
+	addAccount(t, dir, "gitlab.com", "bob", "password", "key")
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, []string{"github.com", "amy", "other", "other", "key", "key"}, "add", "--expires", "2000-01-01")
+}
+
+func TestListOutput(t *testing.T) {
+	dir := newTestStorage(t)
+	addListedAccounts(t, dir)
+
+	for name, args := range map[string][]string{
+		"list":          {"list"},
+		"list_accounts": {"list", "--accounts"},
+		"list_details":  {"list", "--details"},
+		"list_stale":    {"list", "--stale"},
+		"list_json":     {"list", "--json"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			run := mustRun(t, dir, nil, args...)
+			assertPrompts(t, run)
+			assertGolden(t, name, run.output)
+		})
+	}
+}
+
+func TestListWithoutServices(t *testing.T) {
+	dir := newTestStorage(t)
+
+	for name, args := range map[string][]string{
+		"list_empty":         {"list"},
+		"list_details_empty": {"list", "--details"},
+		"list_json_empty":    {"list", "--json"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assertGolden(t, name, mustRun(t, dir, nil, args...).output)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/nativehost"
+	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/spf13/cobra"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// native messaging host actions
+const (
+	nativeActionFind = "find"
+	nativeActionGet  = "get"
+	nativeActionSave = "save"
+)
+
+// errDenied is returned when the user declines the request of the browser
+var errDenied = errors.New("denied by the user")
+
+// nativeRequest is the message sent by the browser extension
+type nativeRequest struct {
+	ID        json.RawMessage `json:"id,omitempty"`
+	Action    string          `json:"action"`
+	URL       string          `json:"url"`
+	AccountID uint            `json:"account_id,omitempty"`
+	Login     string          `json:"login,omitempty"`
+	Password  string          `json:"password,omitempty"`
+}
+
+// nativeResponse is the message sent to the browser extension, the ID of the request is returned as is
+type nativeResponse struct {
+	ID       json.RawMessage `json:"id,omitempty"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Accounts []nativeAccount `json:"accounts,omitempty"`
+	Login    string          `json:"login,omitempty"`
+	Password string          `json:"password,omitempty"`
+}
+
+// nativeAccount is the account found for the site
+type nativeAccount struct {
+	ID      uint   `json:"id"`
+	Service string `json:"service"`
+	Login   string `json:"login"`
+}
+
+// nativeHost handles the requests of the browser extension
+type nativeHost struct {
+	deps     *AppDependencies
+	resolver *secretResolver
+	// origin is the extension the browser started the host for
+	origin string
+}
+
+// getNativeHostCmd returns the representation of the native-host command
+func getNativeHostCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "native-host",
+		Short: "Native messaging host for browser extensions",
+		Long: `Implements the native messaging protocol, it's started by the browser using the manifest
+written by the "native-manifest" command. Requests are JSON messages with the "action" field:
+  find  accounts of the site given by "url", passwords are not included
+  get   the password of the account "account_id" of the site "url" after the user confirmation
+  save  the new account of the site "url" with "login" and "password" after the user confirmation
+Secret keys and confirmations are requested with PASSTOOL_ASKPASS or in the terminal.`,
+		DisableFlagParsing: true,
+		Annotations:        map[string]string{stdinProtocolAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "run native host"
+			// stdout is used by the protocol
+			deps.printer = out.NewWithWriter(os.Stderr)
+
+			resolver, err := newSecretResolver(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			resolver.requestSecret = func(prompt string) (string, error) {
+				return cli.AskPass(deps.config.AskPassProgram, fmt.Sprintf("passtool: enter %s: ", prompt))
+			}
+
+			host := nativeHost{deps: deps, resolver: resolver, origin: nativeOrigin(args)}
+			err = host.serve(os.Stdin, os.Stdout)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// nativeOrigin returns the extension the host is started for, Chromium-based browsers pass its origin
+// as the first argument, Firefox passes the manifest path and the extension ID
+func nativeOrigin(args []string) string {
+	if len(args) >= 2 {
+		return args[1]
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	return "unknown extension"
+}
+
+// serve handles requests until the browser closes the stream
+func (h nativeHost) serve(r io.Reader, w io.Writer) error {
+	for {
+		var request nativeRequest
+		err := nativehost.ReadMessage(r, &request)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		response, err := h.handle(request)
+		if err != nil {
+			response = nativeResponse{Error: err.Error()}
+		} else {
+			response.OK = true
+		}
+		response.ID = request.ID
+
+		if err = nativehost.WriteMessage(w, response); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles the request of the given action
+func (h nativeHost) handle(request nativeRequest) (nativeResponse, error) {
+	site, err := siteHost(request.URL)
+	if err != nil {
+		return nativeResponse{}, err
+	}
+
+	accounts, err := h.deps.repo.Accounts().List()
+	if err != nil {
+		return nativeResponse{}, fmt.Errorf("unable to load accounts: %w", err)
+	}
+	h.resolver.accounts = accounts
+
+	switch request.Action {
+	case nativeActionFind:
+		found := make([]nativeAccount, 0)
+		for _, account := range sortAccountsByService(accounts) {
+			if serviceMatchesSite(account.Service.Name, site) {
+				found = append(found, nativeAccount{ID: account.ID, Service: account.Service.Name, Login: account.Login})
+			}
+		}
+		return nativeResponse{Accounts: found}, nil
+	case nativeActionGet:
+		return h.get(site, request.AccountID)
+	case nativeActionSave:
+		return nativeResponse{}, h.save(site, request.Login, request.Password)
+	default:
+		return nativeResponse{}, fmt.Errorf("unknown action %q", request.Action)
+	}
+}
+
+// get returns the password of the account of the site after the user confirmation
+func (h nativeHost) get(site string, accountID uint) (nativeResponse, error) {
+	for _, account := range h.resolver.accounts {
+		if account.ID != accountID {
+			continue
+		}
+
+		if !serviceMatchesSite(account.Service.Name, site) {
+			return nativeResponse{}, fmt.Errorf("the account doesn't belong to %s", site)
+		}
+
+		prompt := fmt.Sprintf("Allow %s to fill the password of %q at %q on %s?",
+			h.origin, account.Login, account.Service.Name, site)
+		if err := h.confirm(prompt); err != nil {
+			return nativeResponse{}, err
+		}
+
+		password, err := h.resolver.decrypt(account)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+
+		recordAudit(h.deps, auditNativeHost, &account, nativeActionGet+" "+h.origin)
+		if err = h.deps.repo.Accounts().MarkAccessed(&account, time.Now()); err != nil {
+			h.deps.printer.Warning("unable to save last access time: %v", err)
+		}
+
+		return nativeResponse{Login: account.Login, Password: password}, nil
+	}
+
+	return nativeResponse{}, fmt.Errorf("account %d not found", accountID)
+}
+
+// save saves the new account of the site after the user confirmation, the secret key known to the host
+// is used if there is one
+func (h nativeHost) save(site, login, password string) error {
+	if login == "" || password == "" {
+		return errors.New("login and password are required")
+	}
+
+	for _, account := range h.resolver.accounts {
+		if strings.EqualFold(account.Service.Name, site) && account.Login == login {
+			return fmt.Errorf("account %q at %q already exists", login, site)
+		}
+	}
+
+	if err := h.confirm(fmt.Sprintf("Allow %s to save the password of %q for %s?", h.origin, login, site)); err != nil {
+		return err
+	}
+
+	secret, err := h.newAccountSecret(login, site)
+	if err != nil {
+		return err
+	}
+
+	account, err := saveNewCredential(h.deps, site, login, password, secret)
+	if err != nil {
+		return err
+	}
+	recordAudit(h.deps, auditNativeHost, &account, nativeActionSave+" "+h.origin)
+
+	return nil
+}
+
+// newAccountSecret returns the secret key known to the host or requests the new one with confirmation
+func (h nativeHost) newAccountSecret(login, site string) (string, error) {
+	if len(h.resolver.secrets) > 0 {
+		return h.resolver.secrets[0], nil
+	}
+
+	program := h.deps.config.AskPassProgram
+	secret, err := cli.AskPass(program, fmt.Sprintf("passtool: enter secret key for %q at %q: ", login, site))
+	if err != nil {
+		return "", err
+	}
+
+	confirmation, err := cli.AskPass(program, "passtool: enter secret key again: ")
+	if err != nil {
+		return "", err
+	}
+	if secret != confirmation {
+		return "", errors.New("secret keys are not equal")
+	}
+
+	h.resolver.secrets = append(h.resolver.secrets, secret)
+	return secret, nil
+}
+
+// confirm asks the user to confirm the request, errDenied is returned if it's declined
+func (h nativeHost) confirm(prompt string) error {
+	confirmed, err := cli.AskConfirmation(h.deps.config.AskPassProgram, "passtool: "+prompt)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return errDenied
+	}
+
+	return nil
+}
+
+// siteHost returns the host of the site URL without the www prefix
+func siteHost(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid site URL %q", rawURL)
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."), nil
+}
+
+// serviceMatchesSite checks whether the service is the site host or its parent domain,
+// service names in the URL form or with the path are compared by their hosts
+func serviceMatchesSite(serviceName, site string) bool {
+	name := strings.ToLower(serviceName)
+	if strings.Contains(name, "://") {
+		host, err := siteHost(name)
+		if err != nil {
+			return false
+		}
+		name = host
+	}
+	name, _, _ = strings.Cut(name, "/")
+	name = strings.TrimPrefix(name, "www.")
+
+	return name == site || strings.HasSuffix(site, "."+name)
+}
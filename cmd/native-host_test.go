@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/MirToykin/passtool/internal/nativehost"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// askPassScript answers secret key prompts with "key" and confirms the requests unless they mention amy
+const askPassScript = `#!/bin/sh
+if [ "$PASSTOOL_ASKPASS_PROMPT" = confirm ]; then
+  case "$1" in *amy*) exit 1 ;; esac
+  exit 0
+fi
+echo key
+`
+
+// runNativeHost runs the native host for the extension with the requests written to stdin,
+// returns the responses written to stdout
+func runNativeHost(t *testing.T, dir string, requests ...nativeRequest) []nativeResponse {
+	t.Helper()
+	// the host doesn't parse flags, the browser starts it with the environment of the script
+	t.Setenv("PASSTOOL_STORAGE_PATH", dir)
+	var input bytes.Buffer
+	for _, request := range requests {
+		if err := nativehost.WriteMessage(&input, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setStdin(t, input.String())
+
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	previous := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = previous }()
+
+	mustRun(t, dir, nil, "native-host", "chrome-extension://abc/")
+
+	if _, err = stdout.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var responses []nativeResponse
+	for {
+		var response nativeResponse
+		err = nativehost.ReadMessage(stdout, &response)
+		if errors.Is(err, io.EOF) {
+			return responses
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+}
+
+func TestNativeHost(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "github.com", "amy", "other", "key")
+	addAccount(t, dir, "gitlab.com", "carl", "third", "key")
+	askPass := filepath.Join(t.TempDir(), "askpass")
+	if err := os.WriteFile(askPass, []byte(askPassScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PASSTOOL_ASKPASS", askPass)
+
+	found := runNativeHost(t, dir, nativeRequest{ID: json.RawMessage(`1`), Action: nativeActionFind,
+		URL: "https://www.github.com/login"})
+	if len(found) != 1 || !found[0].OK || string(found[0].ID) != "1" || len(found[0].Accounts) != 2 {
+		t.Fatalf("got responses %+v, want the accounts of github.com", found)
+	}
+	ids := make(map[string]uint)
+	for _, account := range found[0].Accounts {
+		ids[account.Login] = account.ID
+	}
+
+	responses := runNativeHost(t, dir,
+		nativeRequest{Action: nativeActionGet, URL: "https://github.com", AccountID: ids["bob"]},
+		// the user declines the request
+		nativeRequest{Action: nativeActionGet, URL: "https://github.com", AccountID: ids["amy"]},
+		// the account of another site is not given away
+		nativeRequest{Action: nativeActionGet, URL: "https://evil.com", AccountID: ids["bob"]},
+		nativeRequest{Action: nativeActionSave, URL: "https://gitlab.com/users/sign_in", Login: "dan", Password: "fourth"},
+		nativeRequest{Action: "delete", URL: "https://github.com"},
+	)
+	want := []nativeResponse{
+		{OK: true, Login: "bob", Password: "password"},
+		{Error: errDenied.Error()},
+		{Error: "the account doesn't belong to evil.com"},
+		{OK: true},
+		{Error: `unknown action "delete"`},
+	}
+	if !reflect.DeepEqual(responses, want) {
+		t.Errorf("got responses %+v, want %+v", responses, want)
+	}
+
+	got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "gitlab.com", "dan", "key")
+	if err != nil || got != "fourth" {
+		t.Errorf("got stored password %q, %v of the saved account, want %q", got, err, "fourth")
+	}
+}
+
+func TestNativeManifest(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("manifests are written on Linux and macOS only")
+	}
+	dir := newTestStorage(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PASSTOOL_ASKPASS", "/usr/bin/askpass it's")
+
+	run := mustRun(t, dir, nil, "native-manifest", "--chrome-extension", "abc", "--firefox-extension", "passtool@example.com")
+	if strings.Count(run.output, "Manifest for ") != len(nativehost.Browsers) {
+		t.Errorf("got output:\n%s\nwant the manifests of all the browsers written", run.output)
+	}
+
+	scriptPath := filepath.Join(dir, nativeHostScriptName)
+	for _, browser := range nativehost.Browsers {
+		path, err := nativehost.ManifestPath(browser, runtime.GOOS, home)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unable to read manifest of %s: %v", browser, err)
+		}
+
+		var got nativehost.Manifest
+		if err = json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := nativehost.NewManifest(browser, scriptPath, []string{"abc"})
+		if nativehost.IsFirefox(browser) {
+			want = nativehost.NewManifest(browser, scriptPath, []string{"passtool@example.com"})
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got manifest of %s %+v, want %+v", browser, got, want)
+		}
+	}
+
+	info, err := os.Stat(scriptPath)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("got script %v, %v, want it executable by the owner only", info, err)
+	}
+	script, err := os.ReadFile(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`export PASSTOOL_ASKPASS='/usr/bin/askpass it'\''s'`, " native-host \"$@\"\n"} {
+		if !strings.Contains(string(script), want) {
+			t.Errorf("got script:\n%s\nwant %q", script, want)
+		}
+	}
+}
+
+func TestNativeManifestRequiresExtensions(t *testing.T) {
+	dir := newTestStorage(t)
+	t.Setenv("HOME", t.TempDir())
+
+	for _, args := range [][]string{
+		{"native-manifest"},
+		{"native-manifest", "--browser", "firefox", "--chrome-extension", "abc"},
+	} {
+		run := execute(t, dir, nil, args...)
+		assertExitCode(t, run, exitInvalid)
+	}
+}
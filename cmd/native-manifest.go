@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/nativehost"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	browserFlag          = "browser"
+	chromeExtensionFlag  = "chrome-extension"
+	firefoxExtensionFlag = "firefox-extension"
+	nativeHostScriptName = "passtool-native-host"
+	envPrefix            = "PASSTOOL_"
+)
+
+// getNativeManifestCmd returns the representation of the native-manifest command
+func getNativeManifestCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "native-manifest",
+		Short: "Write the native messaging host manifests for browsers",
+		Long: fmt.Sprintf(`Writes the per-user native messaging host manifests allowing the given extensions to start
+"passtool native-host". Browsers start the host without the shell environment, so the script starting it
+with the current PASSTOOL_* variables is written to the storage directory. Supported browsers: %s.`,
+			strings.Join(nativehost.Browsers, ", ")),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "write native messaging manifests"
+			browsers, err := cmd.Flags().GetStringSlice(browserFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			chromeExtensions, err := cmd.Flags().GetStringSlice(chromeExtensionFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			firefoxExtensions, err := cmd.Flags().GetStringSlice(firefoxExtensionFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if len(chromeExtensions) == 0 && len(firefoxExtensions) == 0 {
+				return newValidationError("%s: allow extensions with --%s or --%s",
+					operation, chromeExtensionFlag, firefoxExtensionFlag)
+			}
+
+			explicit := len(browsers) > 0
+			if !explicit {
+				browsers = nativehost.Browsers
+			}
+
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			scriptPath := filepath.Join(deps.config.BasePath, nativeHostScriptName)
+			err = writeNativeHostScript(scriptPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			for _, browser := range browsers {
+				extensions := chromeExtensions
+				if nativehost.IsFirefox(browser) {
+					extensions = firefoxExtensions
+				}
+				if len(extensions) == 0 {
+					if explicit {
+						return newValidationError("%s: no extensions allowed for %s", operation, browser)
+					}
+					continue
+				}
+
+				path, err := nativehost.ManifestPath(browser, runtime.GOOS, home)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+
+				err = nativehost.WriteManifest(path, nativehost.NewManifest(browser, scriptPath, extensions))
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				deps.printer.Success("Manifest for %s is written to %s", browser, path)
+			}
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// writeNativeHostScript writes the script starting the native host with the current passtool environment
+func writeNativeHostScript(path string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find passtool executable: %w", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("unable to find passtool executable: %w", err)
+	}
+
+	var environ []string
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, envPrefix) {
+			environ = append(environ, variable)
+		}
+	}
+	sort.Strings(environ)
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		script.WriteString(fmt.Sprintf("export %s=%s\n", name, shellQuote(value)))
+	}
+	script.WriteString(fmt.Sprintf("exec %s native-host \"$@\"\n", shellQuote(executable)))
+
+	if err = writePrivateFile(path, []byte(script.String())); err != nil {
+		return err
+	}
+
+	return os.Chmod(path, 0700)
+}
+
+// shellQuote quotes the value for the POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
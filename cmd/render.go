@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+// getRenderCmd returns the representation of the render command
+func getRenderCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "render <template> --output <file>",
+		Short: "Render a template with references to the vault accounts",
+		Long: `Renders the template containing references like {{ passtool "service/login" "password" }} and writes
+the output file readable by the owner only. Supported fields are password, login and service, the password is used
+if the field is omitted. Nothing is written if any reference can't be resolved.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "render template"
+			output, err := cmd.Flags().GetString(outputFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			content, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			resolver, err := newSecretResolver(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			rendered, err := resolver.render(filepath.Base(args[0]), string(content))
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = writePrivateFile(output, []byte(rendered))
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			resolver.recordUsage(auditRender, filepath.Base(output))
+
+			deps.printer.Success("Template rendered to %s", output)
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// writePrivateFile replaces the file with the data atomically, the file is readable by the owner only
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create output file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write output file: %w", err)
+	}
+
+	return nil
+}
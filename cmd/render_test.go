@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTemplate writes the template to the temporary directory and returns its path
+func writeTemplate(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRenderPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	tmpl := writeTemplate(t, `{{ passtool "github.com/bob" "login" }}:{{ passtool "github.com/bob" }}@{{ passtool "github.com/bob" "service" }}`)
+	output := filepath.Join(t.TempDir(), "config")
+
+	run := mustRun(t, dir, []string{"wrong", "key"}, "render", tmpl, "--output", output)
+	assertPrompts(t, run, "Enter secret: ", "Enter secret: ")
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "bob:password@github.com" {
+		t.Errorf("got rendered %q, want the fields of the account", content)
+	}
+	if info, err := os.Stat(output); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("got output file %v, %v, want it readable by the owner only", info.Mode(), err)
+	}
+}
+
+func TestRenderWritesNothingOnUnresolvedReference(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	tmpl := writeTemplate(t, `{{ passtool "github.com/bob" }} {{ passtool "github.com/amy" }}`)
+	output := filepath.Join(t.TempDir(), "config")
+
+	run := execute(t, dir, []string{"key"}, "render", tmpl, "--output", output)
+	assertExitCode(t, run, exitNotFound)
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the output file not written", err)
+	}
+
+	run = execute(t, dir, nil, "render", tmpl)
+	assertExitCode(t, run, exitInvalid)
+	assertPrompts(t, run)
+}
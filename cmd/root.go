@@ -1,30 +1,41 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/audit"
+	"github.com/MirToykin/passtool/internal/backup"
 	"github.com/MirToykin/passtool/internal/config"
+	"github.com/MirToykin/passtool/internal/gitsync"
+	"github.com/MirToykin/passtool/internal/lib/cli"
 	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/MirToykin/passtool/internal/setup"
 	"github.com/MirToykin/passtool/internal/storage"
-	"gorm.io/gorm"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/internal/vault"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"github.com/atotto/clipboard"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
-// rootCmd represents the base command when called without any subcommands
-var rootCmd = &cobra.Command{
-	Use:   "passtool",
-	Short: "Tool for password managing",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		_ = cmd.Help()
-	},
-}
-
 const (
-	generateFlag = "generate"
-	lengthFlag   = "length"
+	generateFlag     = "generate"
+	lengthFlag       = "length"
+	storageFlag      = "storage"
+	vaultFlag        = "vault"
+	secretStdinFlag  = "secret-stdin"
+	secretFDFlag     = "secret-fd"
+	passwordFileFlag = "password-file"
 )
 
+// noVaultAnnotation marks commands which don't open the vault
+const noVaultAnnotation = "passtool_no_vault"
+
+// stdinProtocolAnnotation marks commands reading their requests from stdin, so the secret key can't be read from it
+const stdinProtocolAnnotation = "passtool_stdin_protocol"
+
 type GenSettings interface {
 	GetLength() int
 	GetNumDigits() int
@@ -42,60 +53,83 @@ type Printer interface {
 	Header(msg string, a ...interface{})
 	Warning(msg string, a ...interface{})
 	Error(msg string, a ...interface{})
-	ErrorWithExit(msg string, a ...interface{})
 }
 
+// AppDependencies are shared by all the commands, the config and the vault are opened before running a command
+// unless they are given already, e.g. by tests
 type AppDependencies struct {
-	db      *gorm.DB
+	repo    storage.Repository
 	config  *config.Config
 	printer Printer
+	input   cli.Prompter
+	// clipboard copies the text to the clipboard
+	clipboard func(text string) error
+	syncer    *gitsync.Syncer
+	backups   *backup.Manager
+	audit     *audit.Log
+	vault     *passtool.Vault
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
-// This is called by main.main(). It only needs to happen once to the rootCmd.
+// This is called by main.main(). The config is loaded only before running a command which needs it.
+// The error of the command is printed to stderr and its kind defines the exit code listed in README.
 func Execute() {
+	rootCmd := newRootCmd(&AppDependencies{
+		printer:   out.New(),
+		input:     cli.NewPrompter(out.New()),
+		clipboard: clipboard.WriteAll,
+	})
+
 	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	if err == nil {
+		return
 	}
-}
 
-func init() {
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
-
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.passtool.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-
-	printer := out.New()
-	cfg := config.Load()
-	if !cfg.IsValid() {
-		PrintServiceRequirements(cfg, printer)
-		os.Exit(0)
+	var exitStatus exitStatusError
+	if !errors.As(err, &exitStatus) {
+		out.NewWithWriter(os.Stderr).Error("%v\n", err)
 	}
+	os.Exit(exitCode(err))
+}
 
-	db, err := storage.New(cfg.StoragePath)
-	if err != nil {
-		printer.ErrorWithExit("unable to initialize DB: %v", err)
-	}
+func init() {}
 
-	dependencies := AppDependencies{
-		db:      db,
-		config:  cfg,
-		printer: printer,
+// newRootCmd returns the root command with all the subcommands using the given dependencies
+func newRootCmd(dependencies *AppDependencies) *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "passtool",
+		Short: "Tool for password managing",
+		Long:  ``,
+		Args:  cobra.NoArgs,
+		// errors are printed by Execute along with choosing the exit code
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Annotations:   map[string]string{noVaultAnnotation: "true"},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return dependencies.open(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
 	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return validationError{msg: err.Error()}
+	})
+	rootCmd.PersistentFlags().String(storageFlag, "", "Storage directory to use instead of PASSTOOL_STORAGE_PATH")
+	rootCmd.PersistentFlags().String(vaultFlag, "", "Name of the vault of the storage to use instead of the default one")
+	rootCmd.PersistentFlags().Bool(secretStdinFlag, false, "Read the secret key from the first line of stdin")
+	rootCmd.PersistentFlags().Int(secretFDFlag, 0, "Read the secret key from the given file descriptor, e.g. 3 for 3<file")
+	rootCmd.MarkFlagsMutuallyExclusive(secretStdinFlag, secretFDFlag)
 
 	// ============== Register commands ==================
 
 	// requirements
-	rootCmd.AddCommand(getRequirementsCmd(dependencies.config, dependencies.printer))
+	rootCmd.AddCommand(getRequirementsCmd(dependencies))
 
 	// add
 	addCmd := getAddCmd(dependencies)
-	setGenerationFlags(addCmd, dependencies.config.PasswordSettings.Length)
+	setNewPasswordFlags(addCmd)
+	addCmd.Flags().String(expiresFlag, "", "Date to rotate the password by, YYYY-MM-DD")
 	rootCmd.AddCommand(addCmd)
 
 	// get
@@ -106,20 +140,320 @@ func init() {
 
 	// set
 	setCmd := getSetCmd(dependencies)
-	setGenerationFlags(setCmd, dependencies.config.PasswordSettings.Length)
+	setNewPasswordFlags(setCmd)
+	setCmd.Flags().String(expiresFlag, "", "Date to rotate the new password by, YYYY-MM-DD or \"never\"")
 	rootCmd.AddCommand(setCmd)
 
 	// change-secret
-	rootCmd.AddCommand(getChangeSecretCmd(dependencies))
+	changeSecretCmd := getChangeSecretCmd(dependencies)
+	setAccountFilterFlags(changeSecretCmd)
+	rootCmd.AddCommand(changeSecretCmd)
 
 	// list
 	listCmd := getListCmd(dependencies)
 	listCmd.Flags().BoolP("accounts", "a", false, "Print accounts as well")
+	listCmd.Flags().Bool(staleFlag, false, "Print accounts overdue for rotation only")
+	listCmd.Flags().BoolP(detailsFlag, "d", false, "Print accounts with their creation, change, last use and due dates")
+	listCmd.Flags().Bool(jsonFlag, false, "Print accounts with their dates as JSON")
 	rootCmd.AddCommand(listCmd)
+
+	// encrypt-storage
+	rootCmd.AddCommand(getEncryptStorageCmd(dependencies))
+
+	// decrypt-storage
+	rootCmd.AddCommand(getDecryptStorageCmd(dependencies))
+
+	// sync
+	rootCmd.AddCommand(getSyncCmd(dependencies))
+
+	// identity
+	rootCmd.AddCommand(getIdentityCmd(dependencies))
+
+	// share
+	shareCmd := getShareCmd(dependencies)
+	shareCmd.Flags().StringSlice(toFlag, nil, "Names of the teammates to share the account with")
+	_ = shareCmd.MarkFlagRequired(toFlag)
+	rootCmd.AddCommand(shareCmd)
+
+	// unshare
+	unshareCmd := getUnshareCmd(dependencies)
+	unshareCmd.Flags().StringSlice(fromFlag, nil, "Names of the teammates to stop sharing the account with")
+	_ = unshareCmd.MarkFlagRequired(fromFlag)
+	rootCmd.AddCommand(unshareCmd)
+
+	// shared-with
+	rootCmd.AddCommand(getSharedWithCmd(dependencies))
+
+	// share-export
+	shareExportCmd := getShareExportCmd(dependencies)
+	shareExportCmd.Flags().String(toFlag, "", "Name of the teammate to export the shared accounts for")
+	shareExportCmd.Flags().StringP(outputFlag, "o", "", "File to write the bundle to, stdout by default")
+	_ = shareExportCmd.MarkFlagRequired(toFlag)
+	rootCmd.AddCommand(shareExportCmd)
+
+	// share-import
+	rootCmd.AddCommand(getShareImportCmd(dependencies))
+
+	// backup
+	rootCmd.AddCommand(getBackupCmd(dependencies))
+
+	// audit-log
+	auditLogCmd := getAuditLogCmd(dependencies)
+	auditLogCmd.Flags().String(operationFlag, "", "Print entries of the given operation only")
+	auditLogCmd.Flags().String(serviceFlag, "", "Print entries of the given service only")
+	auditLogCmd.Flags().String(loginFlag, "", "Print entries of the given login only")
+	auditLogCmd.Flags().Duration(sinceFlag, 0, "Print entries recorded within the given time, e.g. 24h")
+	auditLogCmd.Flags().IntP(limitFlag, "n", 0, "Print the given number of the latest entries only")
+	auditLogCmd.Flags().Bool(verifyFlag, false, "Verify integrity of the audit log chain")
+	rootCmd.AddCommand(auditLogCmd)
+
+	// due
+	dueCmd := getDueCmd(dependencies)
+	dueCmd.Flags().Duration(withinFlag, 0, "Include accounts due within the given time, e.g. 168h")
+	dueCmd.Flags().Bool(jsonFlag, false, "Print accounts with their dates as JSON")
+	rootCmd.AddCommand(dueCmd)
+
+	// expire
+	expireCmd := getExpireCmd(dependencies)
+	expireCmd.Flags().String(onFlag, "", "Date to rotate the password by, YYYY-MM-DD or \"never\"")
+	_ = expireCmd.MarkFlagRequired(onFlag)
+	rootCmd.AddCommand(expireCmd)
+
+	// rotate
+	rotateCmd := getRotateCmd(dependencies)
+	setAccountFilterFlags(rotateCmd)
+	rotateCmd.Flags().Int(lengthFlag, 0, "Length of generated passwords, PASSTOOL_DEFAULT_PASSWORD_LENGTH by default")
+	rotateCmd.Flags().Bool(abortFlag, false, "Abort the rotation in progress")
+	rootCmd.AddCommand(rotateCmd)
+
+	// verify
+	verifyCmd := getVerifyCmd(dependencies)
+	setAccountFilterFlags(verifyCmd)
+	rootCmd.AddCommand(verifyCmd)
+
+	// exec
+	execCmd := getExecCmd(dependencies)
+	execCmd.Flags().StringArrayP(envFlag, "e", nil, "Variable to pass in form NAME=service/login or NAME=template")
+	rootCmd.AddCommand(execCmd)
+
+	// render
+	renderCmd := getRenderCmd(dependencies)
+	renderCmd.Flags().StringP(outputFlag, "o", "", "File to write the rendered template to")
+	_ = renderCmd.MarkFlagRequired(outputFlag)
+	rootCmd.AddCommand(renderCmd)
+
+	// git-credential
+	rootCmd.AddCommand(getGitCredentialCmd(dependencies))
+
+	// docker-credential
+	rootCmd.AddCommand(getDockerCredentialCmd(dependencies))
+
+	// ssh-key
+	rootCmd.AddCommand(getSSHKeyCmd(dependencies))
+
+	// serve
+	serveCmd := getServeCmd(dependencies)
+	serveCmd.Flags().String(addrFlag, "127.0.0.1:7717", "Loopback address to listen on")
+	serveCmd.Flags().String(socketFlag, "", "Unix socket to listen on instead of the address")
+	serveCmd.Flags().Int(rateFlag, 60, "Number of requests allowed per minute, 0 disables the limit")
+	serveCmd.Flags().String(tokenFileFlag, "", "File to write the session token to instead of printing it")
+	serveCmd.MarkFlagsMutuallyExclusive(addrFlag, socketFlag)
+	rootCmd.AddCommand(serveCmd)
+
+	// native-host
+	rootCmd.AddCommand(getNativeHostCmd(dependencies))
+
+	// native-manifest
+	nativeManifestCmd := getNativeManifestCmd(dependencies)
+	nativeManifestCmd.Flags().StringSlice(browserFlag, nil, "Browsers to write manifests for, all supported by default")
+	nativeManifestCmd.Flags().StringSlice(chromeExtensionFlag, nil, "IDs of extensions of Chromium-based browsers to allow")
+	nativeManifestCmd.Flags().StringSlice(firefoxExtensionFlag, nil, "IDs of Firefox extensions to allow, e.g. passtool@example.com")
+	rootCmd.AddCommand(nativeManifestCmd)
+
+	// secret-service
+	secretServiceCmd := getSecretServiceCmd(dependencies)
+	secretServiceCmd.Flags().String(busAddressFlag, "", "Address of the bus to serve on, the session bus by default")
+	secretServiceCmd.Flags().Bool(replaceFlag, false, "Replace the running Secret Service provider if it allows that")
+	rootCmd.AddCommand(secretServiceCmd)
+
+	// help and completion don't need the vault
+	rootCmd.InitDefaultHelpCmd()
+	rootCmd.InitDefaultCompletionCmd()
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == "help" || cmd.Name() == "completion" {
+			markNoVault(cmd)
+		}
+	}
+
+	wrapArgsValidation(rootCmd)
+
+	return rootCmd
+}
+
+// open loads the config taking --storage and --vault flags into account and opens the vault
+// unless the command is marked by noVaultAnnotation, the given repository is used instead of the storage
+func (d *AppDependencies) open(cmd *cobra.Command, args []string) error {
+	// cobra validates flags after running this hook, while nothing should be opened or read with invalid ones
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return validationError{msg: err.Error()}
+	}
+	if err := cmd.ValidateFlagGroups(); err != nil {
+		return validationError{msg: err.Error()}
+	}
+
+	if cmd.Annotations[stdinProtocolAnnotation] != "" && isSecretStdinGiven(cmd, args) {
+		return newValidationError("--%s can't be used with %s, it reads its requests from stdin", secretStdinFlag, cmd.Name())
+	}
+
+	secretKey, err := readSecretKeyFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if secretKey != "" {
+		d.input = cli.WithSecretKey(d.input, secretKey)
+	}
+
+	storageDir, err := cmd.Flags().GetString(storageFlag)
+	if err != nil {
+		return err
+	}
+	vaultName, err := cmd.Flags().GetString(vaultFlag)
+	if err != nil {
+		return err
+	}
+
+	// commands which don't open the vault work even if the environment can't be parsed
+	if cmd.Annotations[noVaultAnnotation] != "" {
+		return nil
+	}
+
+	d.config, err = config.LoadWithOverrides(config.Overrides{StorageDir: storageDir, Vault: vaultName})
+	if err != nil {
+		return validationError{msg: err.Error()}
+	}
+	if !d.config.IsValid() {
+		PrintServiceRequirements(d.config.EnvVariables, d.printer)
+		return newValidationError("the environment is not configured")
+	}
+
+	var components setup.Components
+	if d.repo != nil {
+		// the injected repository, e.g. of tests, is used instead of the storage of the config
+		components, err = setup.Wrap(d.config, d.repo, d.printer.Warning)
+	} else {
+		components, err = setup.Open(d.config, func() (string, error) {
+			return d.input.ReadSecret("Enter storage key: ")
+		}, d.printer.Warning)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.repo = components.Repo
+	d.syncer = components.Syncer
+	d.backups = components.Backups
+	d.audit = components.Audit
+	d.vault = vault.New(components.Repo, d.config, func(operation string, account *models.Account) {
+		recordAudit(d, operation, account, "")
+	}, d.printer.Warning)
+
+	return nil
+}
+
+// isSecretStdinGiven checks whether --secret-stdin is given, commands not parsing flags get it among the arguments
+func isSecretStdinGiven(cmd *cobra.Command, args []string) bool {
+	if !cmd.DisableFlagParsing {
+		fromStdin, _ := cmd.Flags().GetBool(secretStdinFlag)
+		return fromStdin
+	}
+
+	for _, arg := range args {
+		if arg == "--"+secretStdinFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// readSecretKeyFlags returns the secret key given by --secret-stdin or --secret-fd, it's empty if they are not set
+func readSecretKeyFlags(cmd *cobra.Command) (string, error) {
+	fromStdin, err := cmd.Flags().GetBool(secretStdinFlag)
+	if err != nil {
+		return "", err
+	}
+	if fromStdin {
+		secretKey, err := cli.ReadValue(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret key from stdin: %w", err)
+		}
+		return secretKey, nil
+	}
+
+	if !cmd.Flags().Changed(secretFDFlag) {
+		return "", nil
+	}
+	fd, err := cmd.Flags().GetInt(secretFDFlag)
+	if err != nil {
+		return "", err
+	}
+	if fd < 0 {
+		return "", newValidationError("invalid file descriptor %d", fd)
+	}
+
+	file := os.NewFile(uintptr(fd), secretFDFlag)
+	defer file.Close()
+	secretKey, err := cli.ReadValue(file)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret key from file descriptor %d: %w", fd, err)
+	}
+	return secretKey, nil
+}
+
+// markNoVault marks the command and its subcommands as not opening the vault
+func markNoVault(cmd *cobra.Command) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[noVaultAnnotation] = "true"
+
+	for _, sub := range cmd.Commands() {
+		markNoVault(sub)
+	}
+}
+
+// wrapArgsValidation makes errors of positional arguments validation of the command and its subcommands
+// validation errors
+func wrapArgsValidation(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return validationError{msg: err.Error()}
+			}
+			return nil
+		}
+	}
+
+	for _, sub := range cmd.Commands() {
+		wrapArgsValidation(sub)
+	}
+}
+
+// setAccountFilterFlags sets flags selecting accounts for bulk operations to the given command
+func setAccountFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice(serviceFlag, nil, "Select accounts of the given services")
+	cmd.Flags().String(loginFlag, "", "Select accounts with the given login")
+	cmd.Flags().Duration(olderThanFlag, 0, "Select accounts with passwords not changed within the given time, e.g. 2160h")
+	cmd.Flags().Bool(dueFlag, false, "Select accounts due for rotation")
+	cmd.Flags().String(auditedFlag, "", "Select accounts found in the audit log entries of the given operation, e.g. export")
+	cmd.Flags().Duration(sinceFlag, 0, "Consider audit log entries recorded within the given time only, e.g. 72h")
+	cmd.Flags().Bool(allFlag, false, "Select all the accounts")
 }
 
-// setGenerationFlags sets flags related to password generation to the given command
-func setGenerationFlags(cmd *cobra.Command, defaultLength int) {
+// setNewPasswordFlags sets flags related to password generation and reading the password from file
+// to the given command
+func setNewPasswordFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolP(generateFlag, "g", false, "Generate secure password")
-	cmd.Flags().Int(lengthFlag, defaultLength, "Length of generated password")
+	cmd.Flags().Int(lengthFlag, 0, "Length of generated password, PASSTOOL_DEFAULT_PASSWORD_LENGTH by default")
+	cmd.Flags().String(passwordFileFlag, "", "Read the password from the first line of the file")
+	cmd.MarkFlagsMutuallyExclusive(generateFlag, passwordFileFlag)
 }
@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"github.com/MirToykin/passtool/internal/config"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	out "github.com/MirToykin/passtool/internal/output"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"github.com/fatih/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// volatileOutput are the parts of the output which differ between runs, they are replaced before comparing
+// the output with golden files
+var volatileOutput = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}T[\d:.]+(Z|[+-]\d{2}:\d{2})`), "<time>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}( \d{2}:\d{2}:\d{2})?`), "<date>"},
+	{regexp.MustCompile(`\d+\.passtool_backup`), "<unix>.passtool_backup"},
+	{regexp.MustCompile(`\d+(\.\d)? [KMGTPE]?B\b`), "<size>"},
+}
+
+func TestMain(m *testing.M) {
+	// the output is compared as plain text
+	color.NoColor = true
+	os.Exit(m.Run())
+}
+
+// commandRun is the result of running a command with scripted answers
+type commandRun struct {
+	output   string
+	prompter *cli.ScriptedPrompter
+	copied   []string
+	err      error
+}
+
+// newTestStorage returns the empty storage directory, the passtool environment variables are cleared,
+// so nothing but the directory is used by the test
+func newTestStorage(t *testing.T) string {
+	t.Helper()
+	for _, ev := range config.Variables() {
+		t.Setenv(ev.Name, "")
+	}
+
+	return t.TempDir()
+}
+
+// execute runs the command with the storage in dir answering the prompts with the answers
+func execute(t *testing.T, dir string, answers []string, args ...string) commandRun {
+	t.Helper()
+	return executeWithRepo(t, nil, dir, answers, args...)
+}
+
+// executeWithRepo runs the command like execute with the given repository instead of the storage in dir,
+// the storage is opened if it's nil
+func executeWithRepo(t *testing.T, repo storage.Repository, dir string, answers []string, args ...string) commandRun {
+	t.Helper()
+	return executeContext(context.Background(), t, repo, dir, answers, args...)
+}
+
+// executeContext runs the command like executeWithRepo with the context, e.g. to stop a server
+func executeContext(
+	ctx context.Context,
+	t *testing.T,
+	repo storage.Repository,
+	dir string,
+	answers []string,
+	args ...string,
+) commandRun {
+	t.Helper()
+	var output bytes.Buffer
+	run := commandRun{prompter: cli.NewScriptedPrompter(answers...)}
+	deps := &AppDependencies{
+		repo:    repo,
+		printer: out.NewWithWriter(&output),
+		input:   run.prompter,
+		clipboard: func(text string) error {
+			run.copied = append(run.copied, text)
+			return nil
+		},
+	}
+
+	root := newRootCmd(deps)
+	root.SetOut(&output)
+	root.SetErr(&output)
+	root.SetArgs(append([]string{"--" + storageFlag, dir}, args...))
+	run.err = root.ExecuteContext(ctx)
+	run.output = output.String()
+
+	return run
+}
+
+// mustRun runs the command and fails the test if it fails or leaves answers
+func mustRun(t *testing.T, dir string, answers []string, args ...string) commandRun {
+	t.Helper()
+	run := execute(t, dir, answers, args...)
+	if run.err != nil {
+		t.Fatalf("%s: unexpected error: %v\n%s", strings.Join(args, " "), run.err, run.output)
+	}
+	if remaining := run.prompter.Remaining(); len(remaining) > 0 {
+		t.Fatalf("%s: answers %q are left, prompts were %q", strings.Join(args, " "), remaining, run.prompter.Prompts)
+	}
+
+	return run
+}
+
+// addAccount adds the account with the password encrypted with the secret key
+func addAccount(t *testing.T, dir, service, login, password, secretKey string) {
+	t.Helper()
+	mustRun(t, dir, []string{service, login, password, password, secretKey, secretKey}, "add")
+}
+
+// storedPassword returns the password of the account opened by the library with the secret key
+func storedPassword(t *testing.T, opts passtool.Options, service, login, secretKey string) (string, error) {
+	t.Helper()
+	vault, err := passtool.Open(opts)
+	if err != nil {
+		t.Fatalf("unable to open vault: %v", err)
+	}
+	if err = vault.Unlock(secretKey); err != nil {
+		t.Fatalf("unable to unlock vault: %v", err)
+	}
+
+	account, err := vault.Get(service, login)
+	return account.Password, err
+}
+
+// testConfig returns the config of the storage in dir
+func testConfig(t *testing.T, dir string) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadWithOverrides(config.Overrides{StorageDir: dir})
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+
+	return cfg
+}
+
+// storedServices returns the logins of the accounts by services read from the storage in dir
+func storedServices(t *testing.T, dir string) map[string][]string {
+	t.Helper()
+	cfg := testConfig(t, dir)
+	repo, err := storage.Open(cfg.StorageBackend, cfg.StoragePath, nil)
+	if err != nil {
+		t.Fatalf("unable to open storage: %v", err)
+	}
+
+	services, err := repo.Services().List(true)
+	if err != nil {
+		t.Fatalf("unable to list services: %v", err)
+	}
+
+	logins := make(map[string][]string)
+	for _, service := range services {
+		logins[service.Name] = []string{}
+		for _, account := range service.Accounts {
+			logins[service.Name] = append(logins[service.Name], account.Login)
+		}
+	}
+
+	return logins
+}
+
+// assertStoredServices checks the services and their logins in the storage
+func assertStoredServices(t *testing.T, dir string, want map[string][]string) {
+	t.Helper()
+	if got := storedServices(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stored services %q, want %q", got, want)
+	}
+}
+
+// assertGolden compares the output with testdata/<name>.golden, run the tests with -update to rewrite the file
+func assertGolden(t *testing.T, name, output string) {
+	t.Helper()
+	for _, v := range volatileOutput {
+		output = v.re.ReplaceAllString(output, v.replacement)
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read golden file, run the tests with -update to create it: %v", err)
+	}
+	if output != string(want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, output, want)
+	}
+}
+
+// assertPrompts checks that the prompts were asked in the given order
+func assertPrompts(t *testing.T, run commandRun, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(run.prompter.Prompts, want) {
+		t.Errorf("got prompts:\n%q\nwant:\n%q", run.prompter.Prompts, want)
+	}
+}
+
+// assertExitCode checks the exit code of the command error
+func assertExitCode(t *testing.T, run commandRun, want int) {
+	t.Helper()
+	if got := exitCode(run.err); got != want {
+		t.Errorf("got exit code %d (error %v), want %d", got, run.err, want)
+	}
+}
+
+func TestCommandsWithoutVaultDontNeedStorage(t *testing.T) {
+	newTestStorage(t)
+	for _, args := range [][]string{{"--help"}, {"requirements"}, {"help", "get"}, {"completion", "bash"}} {
+		var output bytes.Buffer
+		root := newRootCmd(&AppDependencies{printer: out.NewWithWriter(&output), input: cli.NewScriptedPrompter()})
+		root.SetOut(&output)
+		root.SetArgs(args)
+		if err := root.Execute(); err != nil {
+			t.Errorf("%s: unexpected error: %v", strings.Join(args, " "), err)
+		}
+	}
+}
+
+func TestCommandsWithoutVaultIgnoreInvalidEnvironment(t *testing.T) {
+	newTestStorage(t)
+	t.Setenv("PASSTOOL_BACKUP_COUNT", "abc")
+	t.Setenv("PASSTOOL_BACKUP_INTERVAL", "zz")
+
+	for _, args := range [][]string{{"--help"}, {"requirements"}, {"help", "add"}, {"completion", "bash"}} {
+		var output bytes.Buffer
+		root := newRootCmd(&AppDependencies{printer: out.NewWithWriter(&output), input: cli.NewScriptedPrompter()})
+		root.SetOut(&output)
+		root.SetArgs(args)
+		if err := root.Execute(); err != nil {
+			t.Errorf("%s: unexpected error: %v", strings.Join(args, " "), err)
+		}
+	}
+}
+
+func TestInvalidEnvironmentIsInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"PASSTOOL_BACKUP_COUNT":            "abc",
+		"PASSTOOL_BACKUP_INTERVAL":         "zz",
+		"PASSTOOL_DEFAULT_PASSWORD_LENGTH": "-1",
+	} {
+		dir := newTestStorage(t)
+		t.Setenv(name, value)
+
+		run := execute(t, dir, nil, "list")
+		assertExitCode(t, run, exitInvalid)
+		if !strings.Contains(run.err.Error(), name) {
+			t.Errorf("got error %v, want %s reported", run.err, name)
+		}
+	}
+}
+
+func TestDefaultPasswordLengthIsTakenFromEnvironment(t *testing.T) {
+	dir := newTestStorage(t)
+	t.Setenv("PASSTOOL_DEFAULT_PASSWORD_LENGTH", "20")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key", "key"}, "add", "-g")
+	if len(run.copied) != 1 || len(run.copied[0]) != 20 {
+		t.Errorf("got copied %q, want the password of 20 characters", run.copied)
+	}
+	run = mustRun(t, dir, []string{"github.com", "amy", "key", "key"}, "add", "-g", "--length", "8")
+	if len(run.copied) != 1 || len(run.copied[0]) != 8 {
+		t.Errorf("got copied %q, want the password of the given length", run.copied)
+	}
+}
+
+func TestCommandWithoutStorageIsInvalid(t *testing.T) {
+	newTestStorage(t)
+	var output bytes.Buffer
+	root := newRootCmd(&AppDependencies{printer: out.NewWithWriter(&output), input: cli.NewScriptedPrompter()})
+	root.SetArgs([]string{"list"})
+
+	err := root.Execute()
+	if got := exitCode(err); got != exitInvalid {
+		t.Errorf("got exit code %d (error %v), want %d", got, err, exitInvalid)
+	}
+}
+
+func TestInvalidFlagsAndArgs(t *testing.T) {
+	dir := newTestStorage(t)
+	for _, args := range [][]string{
+		{"get", "--unknown"},
+		{"unknown"},
+		{"expire"},
+		{"expire", "--on", "01.01.2000"},
+		{"add", "--expires", "tomorrow"},
+		{"add", "-g", "--password-file", "password.txt"},
+		{"get", "--secret-stdin", "--secret-fd", "3"},
+		{"get", "--vault", "../other"},
+		// the protocol requests are read from stdin
+		{"git-credential", "get", "--secret-stdin"},
+		{"--secret-stdin", "docker-credential", "get"},
+		{"native-host", "--secret-stdin"},
+	} {
+		run := execute(t, dir, nil, args...)
+		assertExitCode(t, run, exitInvalid)
+		if len(run.prompter.Prompts) > 0 {
+			t.Errorf("%s: got prompts %q, want none", strings.Join(args, " "), run.prompter.Prompts)
+		}
+	}
+}
+
+func TestSecretFDAnswersSecretKeyPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.WriteString("key\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	defer r.Close()
+
+	// the descriptor is closed after reading, so it's given a copy like a shell redirection does
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "password", "password"},
+		"add", "--secret-fd", strconv.Itoa(fd))
+	assertPrompts(t, run, "Enter service name: ", "Enter login: ", "Enter password: ", "Enter password again: ")
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v, want %q", got, err, "password")
+	}
+}
+
+// setStdin replaces stdin with the pipe giving the input until the end of the test
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+func TestSecretStdinAnswersSecretKeyPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	setStdin(t, "key\n")
+
+	run := mustRun(t, dir, []string{"github.com", "bob"}, "get", "--secret-stdin")
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ")
+	if !reflect.DeepEqual(run.copied, []string{"password"}) {
+		t.Errorf("got copied %q, want the password", run.copied)
+	}
+}
+
+func TestWrongSecretStdinIsNotRetried(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	for _, args := range [][]string{
+		{"get"},
+		{"del"},
+		{"change-secret"},
+		{"exec", "--env", "PASSWORD=github.com/bob", "--", "true"},
+	} {
+		setStdin(t, "wrong\n")
+		// the answers to the service and login prompts are followed by the ones retries would take
+		run := execute(t, dir, []string{"github.com", "bob", "1", "2"}, append([]string{"--secret-stdin"}, args...)...)
+		assertExitCode(t, run, exitWrongSecret)
+		if strings.Contains(run.output, "try again") {
+			t.Errorf("%s: got output:\n%s\nwant no retries with the secret key from stdin", args[0], run.output)
+		}
+	}
+	assertStoredServices(t, dir, map[string][]string{"github.com": {"bob"}})
+}
+
+func TestNamedVaultsAreSeparate(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, []string{"gitlab.com", "amy", "other", "other", "key", "key"}, "add", "--vault", "work")
+
+	if _, err := os.Stat(filepath.Join(dir, "vaults", "work")); err != nil {
+		t.Errorf("the named vault directory is not created: %v", err)
+	}
+
+	work := passtool.Options{StoragePath: dir, Vault: "work"}
+	if got, err := storedPassword(t, work, "gitlab.com", "amy", "key"); err != nil || got != "other" {
+		t.Errorf("got stored password %q, %v in the named vault, want %q", got, err, "other")
+	}
+	if _, err := storedPassword(t, work, "github.com", "bob", "key"); !errors.Is(err, passtool.ErrNotFound) {
+		t.Errorf("got %v for the account of the default vault in the named one, want ErrNotFound", err)
+	}
+	if _, err := storedPassword(t, passtool.Options{StoragePath: dir}, "gitlab.com", "amy", "key"); !errors.Is(err, passtool.ErrNotFound) {
+		t.Errorf("got %v for the account of the named vault in the default one, want ErrNotFound", err)
+	}
+}
+
+func TestInjectedRepository(t *testing.T) {
+	dir := newTestStorage(t)
+	repo, err := storage.NewFileRepository(filepath.Join(t.TempDir(), "passtool.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executeWithRepo(t, repo, dir, []string{"github.com", "bob", "password", "password", "key", "key"}, "add")
+	run := executeWithRepo(t, repo, dir, []string{"github.com", "bob", "key"}, "get")
+	if run.err != nil || !reflect.DeepEqual(run.copied, []string{"password"}) {
+		t.Fatalf("got copied %q, %v, want the password added to the injected repository", run.copied, run.err)
+	}
+
+	accounts, err := repo.Accounts().List()
+	if err != nil || len(accounts) != 1 || accounts[0].Login != "bob" {
+		t.Errorf("got accounts %+v, %v of the injected repository, want the added one", accounts, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "passtool.db")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the storage of the directory not created", err)
+	}
+
+	// the audit log of the config is used with the injected repository
+	run = mustRun(t, dir, nil, "audit-log")
+	if !strings.Contains(run.output, `add "bob" at "github.com"`) || !strings.Contains(run.output, `get "bob" at "github.com"`) {
+		t.Errorf("got audit log:\n%s\nwant the add and get recorded", run.output)
+	}
+}
@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/audit"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/rotation"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+const (
+	olderThanFlag = "older-than"
+	dueFlag       = "due"
+	auditedFlag   = "audited"
+	allFlag       = "all"
+	abortFlag     = "abort"
+)
+
+// accountFilterFlags are the flags selecting accounts for bulk operations
+var accountFilterFlags = []string{serviceFlag, loginFlag, olderThanFlag, dueFlag, auditedFlag, sinceFlag, allFlag}
+
+// accountFilter selects accounts for bulk operations, zero fields match any account
+type accountFilter struct {
+	services  []string
+	login     string
+	olderThan time.Duration
+	due       bool
+	audited   map[uint]bool
+}
+
+// getRotateCmd returns the representation of the rotate command
+func getRotateCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate passwords of many accounts at once",
+		Long: `Selects accounts by the given filters and generates a new password for each of them one by one.
+Change the password on the site and confirm it, only then the new password is saved. The rotation is kept
+in progress until all the accounts are rotated or skipped, run rotate again to resume it after an interruption.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "rotate passwords"
+			abort, err := cmd.Flags().GetBool(abortFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			length, err := getLengthFlag(cmd, lengthFlag, deps.config)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			session, err := rotation.Load(deps.config.RotationPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if abort {
+				if session == nil {
+					deps.printer.Infoln("There is no rotation in progress")
+					return nil
+				}
+				err = session.Finish()
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				deps.printer.Success("Rotation aborted, %d account(s) were rotated", session.Count(rotation.StatusDone))
+				return nil
+			}
+
+			accounts, err := deps.repo.Accounts().List()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			accountsByID := make(map[uint]models.Account, len(accounts))
+			for _, account := range accounts {
+				accountsByID[account.ID] = account
+			}
+
+			if session != nil {
+				if hasChangedFlags(cmd, accountFilterFlags...) {
+					deps.printer.Warning("The rotation started at %s is in progress, filters are ignored, use --%s to start a new one",
+						session.StartedAt.Format("2006-01-02 15:04"), abortFlag)
+				}
+				deps.printer.Infoln("Resuming the rotation started at %s: %d rotated, %d skipped, %d pending",
+					session.StartedAt.Format("2006-01-02 15:04"), session.Count(rotation.StatusDone),
+					session.Count(rotation.StatusSkipped), session.Count(rotation.StatusPending))
+			} else {
+				filter, err := getAccountFilter(cmd, deps)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+
+				var selected []models.Account
+				for _, account := range sortAccountsByService(accounts) {
+					if filter.match(account, deps.config.RotationPeriod, time.Now()) {
+						selected = append(selected, account)
+					}
+				}
+
+				if len(selected) == 0 {
+					deps.printer.Infoln("There are no accounts matching the filters")
+					return nil
+				}
+
+				deps.printer.Header("The following accounts are selected for rotation:")
+				ids := make([]uint, 0, len(selected))
+				for _, account := range selected {
+					deps.printer.Simpleln("  - %q at %q", account.Login, account.Service.Name)
+					ids = append(ids, account.ID)
+				}
+
+				answer, err := deps.input.ReadLine(fmt.Sprintf("Rotate passwords of %d account(s)? [y/N]: ", len(selected)))
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+					return fmt.Errorf("%s: %w", operation, cli.ErrCancelled)
+				}
+
+				session, err = rotation.Start(deps.config.RotationPath, ids, time.Now())
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			}
+
+			secretKey, err := getSecretKey("secret key", false, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			details := "rotation of " + session.StartedAt.Format("2006-01-02 15:04")
+
+			pending := session.Pending()
+			mismatched := 0
+			for i, item := range pending {
+				account, found := accountsByID[item.AccountID]
+				if !found {
+					deps.printer.Warning("Account #%d no longer exists, skipped", item.AccountID)
+					err = session.Resolve(item, rotation.StatusSkipped, time.Now())
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+					continue
+				}
+
+				if _, err := account.Password.GetDecrypted(secretKey, deps.config.SecretKeyLength); err != nil {
+					mismatched++
+					continue
+				}
+
+				deps.printer.Header("%d/%d. %q at %q", i+1, len(pending), account.Login, account.Service.Name)
+				status, quit, err := rotateAccount(deps, session, item, account, secretKey, length, details)
+				if err != nil {
+					return err
+				}
+				if quit {
+					deps.printer.Infoln("Rotation paused, run rotate again to resume it")
+					return nil
+				}
+
+				err = session.Resolve(item, status, time.Now())
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			}
+
+			if mismatched > 0 {
+				deps.printer.Warning("%d account(s) use another secret key, run rotate again with it", mismatched)
+				return nil
+			}
+
+			err = session.Finish()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			deps.printer.Success("Rotation finished: %d rotated, %d skipped",
+				session.Count(rotation.StatusDone), session.Count(rotation.StatusSkipped))
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// rotateAccount offers the new password for the account until the change is confirmed or skipped,
+// returns the final status of the item or quit=true if the user paused the rotation
+func rotateAccount(
+	deps *AppDependencies,
+	session *rotation.Session,
+	item *rotation.Item,
+	account models.Account,
+	secretKey string,
+	length int,
+	details string,
+) (status string, quit bool, err error) {
+	operation := "rotate password"
+	for {
+		var newPassword string
+		if item.Generated != "" {
+			generated := models.Password{Encrypted: item.Generated, Salt: item.Salt}
+			decrypted, err := generated.GetDecrypted(secretKey, deps.config.SecretKeyLength)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", operation, err)
+			}
+			newPassword = decrypted
+			deps.printer.Infoln("The password generated before the interruption is offered again")
+		} else {
+			generated, err := getGeneratedPassword(length, deps.config)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", operation, err)
+			}
+
+			var encrypted models.Password
+			err = encryptPassword(&encrypted, generated, secretKey, deps.config.SecretKeyLength, deps.config.PasswordSettings)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", operation, err)
+			}
+			err = session.SetGenerated(item, encrypted.Encrypted, encrypted.Salt, time.Now())
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", operation, err)
+			}
+			newPassword = generated
+		}
+
+		deps.printer.Success("New password: %s", newPassword)
+		if err := deps.clipboard(newPassword); err == nil {
+			deps.printer.Simpleln("Password copied to clipboard")
+		}
+
+		for {
+			answer, err := deps.input.ReadLine("Change the password on the site, then confirm: [y]es, [s]kip, [r]egenerate, [q]uit: ")
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %w", operation, err)
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y":
+				if err = commitRotation(deps, account, newPassword, secretKey, details); err != nil {
+					return "", false, fmt.Errorf("%s: %w", operation, err)
+				}
+				return rotation.StatusDone, false, nil
+			case "s":
+				return rotation.StatusSkipped, false, nil
+			case "r":
+				item.Generated, item.Salt = "", ""
+			case "q":
+				return "", true, nil
+			default:
+				deps.printer.Warning("Unknown answer %q", answer)
+				continue
+			}
+			break
+		}
+	}
+}
+
+// commitRotation saves the new password of the account, records it to the audit log and shares it again
+func commitRotation(deps *AppDependencies, account models.Account, newPassword, secretKey, details string) error {
+	vault := auditedVault(deps, auditRotate, details)
+	if err := vault.Unlock(secretKey); err != nil {
+		return err
+	}
+
+	// the vault removes the expiry which has come as fulfilled by the new password
+	updated, err := vault.Set(account.Service.Name, account.Login, newPassword)
+	if err != nil {
+		return err
+	}
+	if shared := len(updated.SharedWith); shared > 0 {
+		deps.printer.Infoln("The new password is shared again with %d teammate(s), export the shares to deliver it", shared)
+	}
+
+	deps.printer.Success("Password updated")
+	return nil
+}
+
+// getAccountFilter returns the filter given by the flags set by setAccountFilterFlags,
+// at least one filter or --all is required
+func getAccountFilter(cmd *cobra.Command, deps *AppDependencies) (accountFilter, error) {
+	var filter accountFilter
+	all, err := cmd.Flags().GetBool(allFlag)
+	if err != nil {
+		return filter, err
+	}
+	if filter.services, err = cmd.Flags().GetStringSlice(serviceFlag); err != nil {
+		return filter, err
+	}
+	if filter.login, err = cmd.Flags().GetString(loginFlag); err != nil {
+		return filter, err
+	}
+	if filter.olderThan, err = cmd.Flags().GetDuration(olderThanFlag); err != nil {
+		return filter, err
+	}
+	if filter.due, err = cmd.Flags().GetBool(dueFlag); err != nil {
+		return filter, err
+	}
+
+	auditedOperation, err := cmd.Flags().GetString(auditedFlag)
+	if err != nil {
+		return filter, err
+	}
+	if auditedOperation != "" {
+		auditFilter := audit.Filter{Operation: auditedOperation}
+		since, err := cmd.Flags().GetDuration(sinceFlag)
+		if err != nil {
+			return filter, err
+		}
+		if since > 0 {
+			auditFilter.Since = time.Now().Add(-since)
+		}
+
+		entries, err := deps.audit.Entries(auditFilter)
+		if err != nil {
+			return filter, fmt.Errorf("unable to read audit log: %w", err)
+		}
+
+		filter.audited = make(map[uint]bool)
+		for _, entry := range entries {
+			filter.audited[entry.AccountID] = true
+		}
+	}
+
+	if !all && len(filter.services) == 0 && filter.login == "" && filter.olderThan == 0 && !filter.due && filter.audited == nil {
+		return filter, newValidationError("select accounts with filters or use --%s", allFlag)
+	}
+
+	return filter, nil
+}
+
+// hasChangedFlags checks whether any of the given flags is set
+func hasChangedFlags(cmd *cobra.Command, names ...string) bool {
+	for _, name := range names {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match checks whether the account with loaded service and password satisfies the filter
+func (f accountFilter) match(account models.Account, rotationPeriod time.Duration, now time.Time) bool {
+	if len(f.services) > 0 {
+		found := false
+		for _, service := range f.services {
+			if strings.EqualFold(service, account.Service.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return (f.login == "" || f.login == account.Login) &&
+		(f.olderThan == 0 || !account.Password.UpdatedAt.After(now.Add(-f.olderThan))) &&
+		(!f.due || account.IsDue(rotationPeriod, now)) &&
+		(f.audited == nil || f.audited[account.ID])
+}
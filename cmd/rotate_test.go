@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"os"
+	"testing"
+)
+
+// rotatePrompts are the prompts of rotate starting the rotation of the count of accounts
+func rotatePrompts(count string) []string {
+	return []string{"Rotate passwords of " + count + " account(s)? [y/N]: ", "Enter secret key: "}
+}
+
+const confirmRotationPrompt = "Change the password on the site, then confirm: [y]es, [s]kip, [r]egenerate, [q]uit: "
+
+func TestRotatePrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "gitlab.com", "amy", "other", "key")
+
+	run := mustRun(t, dir, []string{"y", "key", "y", "s"}, "rotate", "--all")
+	assertPrompts(t, run, append(rotatePrompts("2"), confirmRotationPrompt, confirmRotationPrompt)...)
+	if len(run.copied) != 2 {
+		t.Fatalf("got copied %q, want the generated passwords", run.copied)
+	}
+
+	opts := passtool.Options{StoragePath: dir}
+	if got, err := storedPassword(t, opts, "github.com", "bob", "key"); err != nil || got != run.copied[0] {
+		t.Errorf("got stored password %q, %v, want the confirmed one %q", got, err, run.copied[0])
+	}
+	if got, err := storedPassword(t, opts, "gitlab.com", "amy", "key"); err != nil || got != "other" {
+		t.Errorf("got stored password %q, %v, want the skipped account kept", got, err)
+	}
+	rotationPath := testConfig(t, dir).RotationPath
+	if _, err := os.Stat(rotationPath); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the finished rotation removed", err)
+	}
+}
+
+func TestRotateCancelled(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := execute(t, dir, []string{"n"}, "rotate", "--all")
+	assertExitCode(t, run, exitCancelled)
+	assertPrompts(t, run, rotatePrompts("1")[0])
+
+	run = mustRun(t, dir, nil, "rotate", "--service", "unknown.com")
+	assertPrompts(t, run)
+}
+
+func TestRotateResumesAfterQuit(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"y", "key", "q"}, "rotate", "--all")
+	assertPrompts(t, run, append(rotatePrompts("1"), confirmRotationPrompt)...)
+	generated := run.copied
+
+	// the password generated before the interruption is offered again without the selection
+	run = mustRun(t, dir, []string{"key", "y"}, "rotate")
+	assertPrompts(t, run, "Enter secret key: ", confirmRotationPrompt)
+	if len(generated) != 1 || len(run.copied) != 1 || run.copied[0] != generated[0] {
+		t.Fatalf("got copied %q after %q, want the same password offered", run.copied, generated)
+	}
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != generated[0] {
+		t.Errorf("got stored password %q, %v, want the generated one", got, err)
+	}
+}
+
+func TestRotateAbort(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	mustRun(t, dir, []string{"y", "key", "q"}, "rotate", "--all")
+
+	run := mustRun(t, dir, nil, "rotate", "--abort")
+	assertPrompts(t, run)
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v, want the password kept", got, err)
+	}
+
+	// a new rotation selects the accounts again
+	run = execute(t, dir, []string{"n"}, "rotate", "--all")
+	assertExitCode(t, run, exitCancelled)
+	assertPrompts(t, run, rotatePrompts("1")[0])
+}
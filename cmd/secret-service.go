@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/lib/cli"
+	"github.com/MirToykin/passtool/internal/secretservice"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	busAddressFlag = "bus-address"
+	replaceFlag    = "replace"
+)
+
+// secretServiceVault gives the Secret Service provider access to the vault, secret keys are kept in memory
+// while the vault is unlocked
+type secretServiceVault struct {
+	deps    *AppDependencies
+	mu      sync.Mutex
+	secrets []string
+	// matched caches the secret key index matching the encrypted password
+	matched map[string]int
+}
+
+// getSecretServiceCmd returns the representation of the secret-service command
+func getSecretServiceCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "secret-service",
+		Short: "Serve the vault as the freedesktop Secret Service over D-Bus",
+		Long: `Implements the org.freedesktop.secrets D-Bus API, so desktop applications and secret-tool keep their
+secrets in the vault. The vault is the only collection, also available as the default alias, each account is
+its item. Items start locked, unlocking requests the secret key with PASSTOOL_ASKPASS or in the terminal.
+New items are saved to the service named after the item label with the login taken from the username,
+user, account, login or email attribute. Stop GNOME Keyring or KWallet first or use --replace if they allow it,
+use --bus-address to serve on a private bus.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "serve secret service"
+			busAddress, err := cmd.Flags().GetString(busAddressFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			replace, err := cmd.Flags().GetBool(replaceFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			var conn *dbus.Conn
+			if busAddress != "" {
+				conn, err = dbus.Connect(busAddress)
+			} else {
+				conn, err = dbus.ConnectSessionBus()
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			defer conn.Close()
+
+			vault := &secretServiceVault{deps: deps, matched: make(map[string]int)}
+			err = secretservice.NewProvider(conn, vault).Start(replace)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Infoln("Serving %s on %s, press Ctrl+C to stop it", secretservice.BusName, describeBus(busAddress))
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			select {
+			case <-signals:
+			case <-conn.Context().Done():
+				deps.printer.Warning("the bus connection is closed")
+			}
+			deps.printer.Success("The Secret Service is stopped")
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// Accounts returns all the accounts with loaded services and passwords
+func (v *secretServiceVault) Accounts() ([]models.Account, error) {
+	return v.deps.repo.Accounts().List()
+}
+
+// Unlock requests the secret key, it's accepted if it matches any account password or,
+// if the vault is empty, confirmed by entering it again
+func (v *secretServiceVault) Unlock() (bool, error) {
+	accounts, err := v.Accounts()
+	if err != nil {
+		return false, err
+	}
+
+	program := v.deps.config.AskPassProgram
+	for try := 0; try < maxSecretRetries; try++ {
+		secret, err := cli.AskPass(program, "passtool: enter secret key to unlock the vault: ")
+		if err != nil {
+			v.deps.printer.Warning("unlock dismissed: %v", err)
+			return false, nil
+		}
+
+		if len(accounts) == 0 {
+			confirmation, err := cli.AskPass(program, "passtool: enter secret key again: ")
+			if err != nil || confirmation != secret {
+				return false, errors.New("secret keys are not equal")
+			}
+		} else if !v.matchesAny(accounts, secret) {
+			v.deps.printer.Warning("Incorrect secret, try again")
+			continue
+		}
+
+		v.mu.Lock()
+		v.secrets = append(v.secrets, secret)
+		v.mu.Unlock()
+		recordAudit(v.deps, auditSecretService, nil, "unlock")
+		return true, nil
+	}
+
+	return false, models.ErrWrongSecret
+}
+
+// Lock forgets the secret keys
+func (v *secretServiceVault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.secrets = nil
+	v.matched = make(map[string]int)
+}
+
+// IsUnlocked checks whether a secret key is known
+func (v *secretServiceVault) IsUnlocked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return len(v.secrets) > 0
+}
+
+// CanDecrypt checks whether the account password can be decrypted with the known secret keys
+func (v *secretServiceVault) CanDecrypt(account models.Account) bool {
+	_, ok := v.secretFor(account)
+	return ok
+}
+
+// Secret returns the decrypted password of the account
+func (v *secretServiceVault) Secret(account models.Account) (string, error) {
+	secret, ok := v.secretFor(account)
+	if !ok {
+		return "", models.ErrWrongSecret
+	}
+
+	password, err := account.Password.GetDecrypted(secret, v.deps.config.SecretKeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	recordAudit(v.deps, auditSecretService, &account, "get")
+	if err = v.deps.repo.Accounts().MarkAccessed(&account, time.Now()); err != nil {
+		v.deps.printer.Warning("unable to save last access time: %v", err)
+	}
+
+	return password, nil
+}
+
+// Create saves the new account with the password encrypted with the first secret key
+func (v *secretServiceVault) Create(serviceName, login, userPassword, attributes string) (models.Account, error) {
+	v.mu.Lock()
+	if len(v.secrets) == 0 {
+		v.mu.Unlock()
+		return models.Account{}, errors.New("the vault is locked")
+	}
+	secret := v.secrets[0]
+	v.mu.Unlock()
+
+	service, err := v.deps.repo.Services().FetchOrCreate(serviceName)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	account := models.Account{Login: login, Service: service, Attributes: attributes}
+	var password models.Password
+	err = encryptPassword(&password, userPassword, secret, v.deps.config.SecretKeyLength, v.deps.config.PasswordSettings)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	if err = v.deps.repo.Accounts().SaveWithPassword(&account, &password); err != nil {
+		return models.Account{}, err
+	}
+	recordAudit(v.deps, auditSecretService, &account, "create")
+
+	return account, nil
+}
+
+// SetSecret saves the new password of the account encrypted with its secret key
+func (v *secretServiceVault) SetSecret(account models.Account, password string) error {
+	secret, ok := v.secretFor(account)
+	if !ok {
+		return models.ErrWrongSecret
+	}
+
+	return setAccountPassword(auditedVault(v.deps, auditSecretService, "set"), account, password, secret)
+}
+
+// SetAttributes saves the lookup attributes of the account
+func (v *secretServiceVault) SetAttributes(account models.Account, attributes string) error {
+	if err := v.deps.repo.Accounts().SetAttributes(&account, attributes); err != nil {
+		return err
+	}
+	recordAudit(v.deps, auditSecretService, &account, "set attributes")
+
+	return nil
+}
+
+// Delete deletes the account
+func (v *secretServiceVault) Delete(account models.Account) error {
+	_, err := auditedVault(v.deps, auditSecretService, "delete").Delete(account.Service.Name, account.Login)
+	return err
+}
+
+// secretFor returns the known secret key matching the account password
+func (v *secretServiceVault) secretFor(account models.Account) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := account.Password.Salt + account.Password.Encrypted
+	if i, ok := v.matched[key]; ok {
+		return v.secrets[i], true
+	}
+
+	for i, secret := range v.secrets {
+		if matches, _ := checkSecret(account.Password, secret, v.deps.config.SecretKeyLength); matches {
+			v.matched[key] = i
+			return secret, true
+		}
+	}
+
+	return "", false
+}
+
+// matchesAny checks whether the secret key matches the password of any account
+func (v *secretServiceVault) matchesAny(accounts []models.Account, secret string) bool {
+	for _, account := range accounts {
+		if matches, _ := checkSecret(account.Password, secret, v.deps.config.SecretKeyLength); matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+// describeBus returns the bus the provider is served on
+func describeBus(busAddress string) string {
+	if busAddress == "" {
+		return "the session bus"
+	}
+
+	return fmt.Sprintf("the bus %s", busAddress)
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/api"
+	"github.com/MirToykin/passtool/internal/crypto"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	addrFlag      = "addr"
+	rateFlag      = "rate"
+	tokenFileFlag = "token-file"
+	tokenLength   = 32
+)
+
+// getServeCmd returns the representation of the serve command
+func getServeCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the vault over the local HTTP API for integrations",
+		Long: `Unlocks the vault with the secret key and serves the read-only JSON API on the loopback address or
+the Unix socket until it's stopped. Requests are authenticated with the token generated for the session,
+pass it in the Authorization header as "Bearer <token>". Endpoints:
+  GET /v1/accounts?service=&login=  metadata of the accounts, optionally filtered
+  GET /v1/search?q=                 metadata of the accounts whose service or login contains q
+  GET /v1/accounts/<id>             the account with the decrypted password
+Each request is recorded to the audit log.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "serve api"
+			addr, err := cmd.Flags().GetString(addrFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			socketPath, err := cmd.Flags().GetString(socketFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			rateLimit, err := cmd.Flags().GetInt(rateFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			tokenFile, err := cmd.Flags().GetString(tokenFileFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			listener, cleanup, err := listenAPI(addr, socketPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			defer cleanup()
+
+			decrypt, err := unlockAPIVault(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			tokenBytes, err := crypto.RandomBytes(tokenLength)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+			if tokenFile != "" {
+				err = writePrivateFile(tokenFile, []byte(token+"\n"))
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				defer os.Remove(tokenFile)
+			}
+
+			server := &http.Server{
+				Handler: api.NewServer(deps.repo.Accounts(), token, rateLimit, decrypt,
+					func(account *models.Account, details string) {
+						recordAudit(deps, auditAPI, account, details)
+					}),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = server.Shutdown(ctx)
+			}()
+
+			if socketPath != "" {
+				deps.printer.Infoln("Serving the API on the socket %s", socketPath)
+			} else {
+				deps.printer.Infoln("Serving the API on http://%s", listener.Addr())
+			}
+			if tokenFile != "" {
+				deps.printer.Infoln("The session token is written to %s", tokenFile)
+			} else {
+				deps.printer.Simpleln("PASSTOOL_API_TOKEN=%s", token)
+			}
+			deps.printer.Infoln("Press Ctrl+C to stop the server")
+
+			err = server.Serve(listener)
+			if !errors.Is(err, http.ErrServerClosed) {
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			}
+			deps.printer.Success("The server is stopped")
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// unlockAPIVault requests the secret key and returns the function decrypting passwords with it,
+// passwords encrypted with other secret keys stay locked
+func unlockAPIVault(deps *AppDependencies) (func(account models.Account) (string, error), error) {
+	resolver, err := newSecretResolver(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resolver.accounts) > 0 {
+		if _, err = resolver.secretFor(resolver.accounts[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	resolver.requestSecret = func(string) (string, error) {
+		return "", api.ErrLocked
+	}
+
+	return resolver.decrypt, nil
+}
+
+// listenAPI listens on the Unix socket if it's given, otherwise on the loopback address,
+// returns the function removing the socket
+func listenAPI(addr, socketPath string) (net.Listener, func(), error) {
+	if socketPath != "" {
+		socketPath, cleanup, err := prepareSocket(socketPath, "")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to listen on socket: %w", err)
+		}
+		if err = os.Chmod(socketPath, 0600); err != nil {
+			_ = listener.Close()
+			cleanup()
+			return nil, nil, fmt.Errorf("unable to restrict socket permissions: %w", err)
+		}
+
+		return listener, cleanup, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, newValidationError("invalid address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, nil, newValidationError("address %q is not a loopback one, the API is served locally only", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+
+	return listener, func() {}, nil
+}
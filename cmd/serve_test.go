@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveAPI runs the serve command on the socket until the test ends, returns the client of the API with the token
+func serveAPI(t *testing.T, dir string, answers []string) func(path string) (*http.Response, error) {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "api.sock")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan commandRun, 1)
+	go func() {
+		done <- executeContext(ctx, t, nil, dir, answers, "serve", "--socket", socketPath, "--token-file", tokenFile)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if run := <-done; run.err != nil {
+			t.Errorf("got server stopped with %v, want nil\n%s", run.err, run.output)
+		}
+		if _, err := os.Stat(tokenFile); !os.IsNotExist(err) {
+			t.Errorf("got token file kept after stop, %v", err)
+		}
+	})
+
+	// the token file is written once the server listens on the socket
+	var token []byte
+	for deadline := time.Now().Add(5 * time.Second); len(token) == 0; time.Sleep(10 * time.Millisecond) {
+		select {
+		case run := <-done:
+			t.Fatalf("got server stopped with %v\n%s", run.err, run.output)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the server is not started in time")
+		}
+		token, _ = os.ReadFile(tokenFile)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	return func(path string) (*http.Response, error) {
+		r, err := http.NewRequest(http.MethodGet, "http://passtool"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		return client.Do(r)
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "gitlab.com", "amy", "other", "other key")
+	get := serveAPI(t, dir, []string{"key"})
+
+	resp, err := get("/v1/accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accounts []struct {
+		ID    uint   `json:"id"`
+		Login string `json:"login"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&accounts)
+	_ = resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || len(accounts) != 2 {
+		t.Fatalf("got status %d with accounts %v, %v, want both accounts", resp.StatusCode, accounts, err)
+	}
+
+	// the password encrypted with another secret key stays locked
+	want := map[string]int{"bob": http.StatusOK, "amy": http.StatusForbidden}
+	for _, account := range accounts {
+		resp, err = get(fmt.Sprintf("/v1/accounts/%d", account.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Password string `json:"password"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != want[account.Login] {
+			t.Errorf("got status %d for %q, want %d", resp.StatusCode, account.Login, want[account.Login])
+		}
+		if account.Login == "bob" && body.Password != "password" {
+			t.Errorf("got password %q of %q, want %q", body.Password, account.Login, "password")
+		}
+	}
+}
+
+func TestServeRefusesNonLoopbackAddresses(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	for _, addr := range []string{"0.0.0.0:7717", "192.0.2.1:7717", "example.com:7717", "7717"} {
+		run := execute(t, dir, nil, "serve", "--addr", addr)
+		assertExitCode(t, run, exitInvalid)
+		assertPrompts(t, run)
+	}
+}
@@ -1,51 +1,80 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/MirToykin/passtool/internal/config"
 	"github.com/MirToykin/passtool/internal/storage/models"
-	"github.com/atotto/clipboard"
+	"github.com/MirToykin/passtool/pkg/passtool"
 	passGenerator "github.com/sethvargo/go-password/password"
 	"github.com/spf13/cobra"
-	"os"
 )
 
 // getSetCmd returns the representation of the set command
-func getSetCmd(deps AppDependencies) *cobra.Command {
+func getSetCmd(deps *AppDependencies) *cobra.Command {
 	return &cobra.Command{
 		Use:   "set",
 		Short: "Set new password for an existing account",
 		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			operation := "set password"
 			getPassword, err := getPasswordGetterByGenerateAndLengthFlag(
 				cmd, generateFlag, lengthFlag,
-				"new password", deps.printer, deps.config)
-			checkSimpleErrorWithDetails(err, operation, deps.printer)
+				"new password", deps.printer, deps.input, deps.config)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			expiresAt, expiresGiven, err := getExpiryFlag(cmd, expiresFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
 
-			genericGet(
+			return genericGet(
 				operation,
-				deps.db,
+				deps.repo,
 				deps.printer,
-				func(account models.Account) {
-					password := account.Password
-					_, err := getDecryptedPasswordWithRetry(password, deps.config.SecretKeyLength, 5, deps.printer)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+				deps.input,
+				func(account models.Account) error {
+					_, err := getDecryptedPasswordWithRetry(account.Password, deps.config.SecretKeyLength, 5, deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
-					secretKey := getSecretWithConfirmation("secret key for new password", "Secret keys are not equal", deps.printer)
+					secretKey, err := getSecretKeyWithConfirmation("secret key for new password", "Secret keys are not equal", deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 					userPassword, err := getPassword()
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
-					err = encryptPassword(&password, userPassword, secretKey, deps.config.SecretKeyLength, deps.config.PasswordSettings)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+					err = deps.vault.Unlock(secretKey)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
-					err = password.Save(deps.db)
-					checkSimpleErrorWithDetails(err, operation, deps.printer)
+					// the expiry which has come is removed by the vault as fulfilled by the new password
+					// unless the new one is given
+					var updated passtool.Account
+					if expiresGiven {
+						updated, err = deps.vault.SetWithExpiry(account.Service.Name, account.Login, userPassword, expiresAt)
+					} else {
+						updated, err = deps.vault.Set(account.Service.Name, account.Login, userPassword)
+					}
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
 
 					deps.printer.Success("Password updated")
 
-					err = clipboard.WriteAll(userPassword)
+					if shared := len(updated.SharedWith); shared > 0 {
+						deps.printer.Infoln("The new password is shared again with %d teammate(s), export the shares to deliver it", shared)
+					}
+
+					err = deps.clipboard(userPassword)
 					if err == nil {
 						deps.printer.Simpleln("Password copied to clipboard")
 					}
+					return nil
 				},
 			)
 		},
@@ -55,10 +84,10 @@ func getSetCmd(deps AppDependencies) *cobra.Command {
 func init() {}
 
 // getGeneratedPassword returns randomly generated password
-func getGeneratedPassword(length int, config *config.Config, printer Printer) (string, error) {
+func getGeneratedPassword(length int, config *config.Config) (string, error) {
 	if length < config.MinPasswordLength || length > config.MaxPasswordLength {
-		printer.Infoln("The password must be at least %d and no more than %d characters long.", config.MinPasswordLength, config.MaxPasswordLength)
-		os.Exit(0)
+		return "", newValidationError("the password must be at least %d and no more than %d characters long",
+			config.MinPasswordLength, config.MaxPasswordLength)
 	}
 
 	return passGenerator.Generate(
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key", "new key", "new key", "new", "new"}, "set")
+	assertPrompts(t, run,
+		"Enter service name or serial number: ",
+		"Enter login or serial number: ",
+		"Enter secret: ",
+		"Enter secret key for new password: ",
+		"Enter secret key for new password again: ",
+		"Enter new password: ",
+		"Enter new password again: ",
+	)
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "new key"); err != nil || got != "new" {
+		t.Errorf("got stored password %q, %v, want %q", got, err, "new")
+	}
+}
+
+func TestSetPasswordFile(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	passwordFile := filepath.Join(t.TempDir(), "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key", "key", "key"}, "set", "--password-file", passwordFile)
+	assertPrompts(t, run,
+		"Enter service name or serial number: ",
+		"Enter login or serial number: ",
+		"Enter secret: ",
+		"Enter secret key for new password: ",
+		"Enter secret key for new password again: ",
+	)
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "from file" {
+		t.Errorf("got stored password %q, %v, want %q", got, err, "from file")
+	}
+}
+
+func TestSetCancelledKeepsPassword(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := execute(t, dir, []string{"github.com", "bob", "key", "new key", "new key"}, "set")
+	assertExitCode(t, run, exitCancelled)
+
+	if got, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "key"); err != nil || got != "password" {
+		t.Errorf("got stored password %q, %v, want the old one", got, err)
+	}
+	if _, err := storedPassword(t, passtool.Options{StoragePath: dir}, "github.com", "bob", "new key"); !errors.Is(err, passtool.ErrWrongSecret) {
+		t.Errorf("got %v with the new key, want ErrWrongSecret", err)
+	}
+}
+
+func TestSetWithExpiresIsSingleChange(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	mustRun(t, dir, []string{"github.com", "bob", "key", "key", "key", "new", "new"}, "set", "--expires", "2099-01-02")
+
+	run := mustRun(t, dir, nil, "audit-log", "--login", "bob")
+	if strings.Count(run.output, `set "bob" at "github.com"`) != 1 || strings.Contains(run.output, "expire") {
+		t.Errorf("got audit log:\n%s\nwant the single set recorded", run.output)
+	}
+	run = mustRun(t, dir, nil, "list", "--json")
+	if !strings.Contains(run.output, "2099-01-02") {
+		t.Errorf("got accounts:\n%s\nwant the new expiry date", run.output)
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/sharing"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+const outputFlag = "output"
+
+// getShareExportCmd returns the representation of the share-export command
+func getShareExportCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "share-export",
+		Short: "Export accounts shared with a teammate to a bundle only the teammate can open",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "export shares"
+			name, err := cmd.Flags().GetString(toFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			output, err := cmd.Flags().GetString(outputFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			recipient, err := deps.repo.Identities().FetchByName(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			shares, err := deps.repo.Shares().ListByIdentity(recipient.ID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if len(shares) == 0 {
+				deps.printer.Infoln("There are no accounts shared with %q", name)
+				return nil
+			}
+
+			data, err := json.MarshalIndent(sharing.NewBundle(recipient, shares), "", "  ")
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			for _, share := range shares {
+				recordAudit(deps, auditExport, &share.Account, "to "+recipient.Name)
+			}
+
+			if output == "" {
+				deps.printer.Simpleln("%s", data)
+				return nil
+			}
+
+			err = os.WriteFile(output, append(data, '\n'), 0600)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Success("%d shared account(s) exported for %q to %s", len(shares), name, output)
+			return nil
+		},
+	}
+}
+
+func init() {}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/sharing"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+// getShareImportCmd returns the representation of the share-import command
+func getShareImportCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "share-import <bundle>",
+		Short: "Import accounts from a bundle shared with you",
+		Long: `Opens the bundle with the private key of your identity and adds the accounts to the vault,
+their passwords are encrypted with the secret key you enter. Already existing accounts are skipped,
+nothing is imported if any of the accounts can't be opened or saved.
+Bundles are not signed, anyone who knows your public key is able to make one, so import only bundles
+received from the teammate through a channel you trust and check the list of the imported accounts.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "import shares"
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			var bundle sharing.Bundle
+			err = json.Unmarshal(data, &bundle)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			own, err := deps.repo.Identities().FetchOwn()
+			if errors.Is(err, storage.ErrNotFound) {
+				return newNotFoundError("You have no identity yet, use the %q command", "identity create")
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = bundle.CheckRecipient(own)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			passphrase, err := getSecret("identity passphrase", false, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			privateKey, err := sharing.Unlock(own, passphrase, deps.config.SecretKeyLength)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			existing, err := deps.repo.Accounts().List()
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			skip := make(map[string]bool, len(existing))
+			for _, account := range existing {
+				skip[account.Service.Name+"\x00"+account.Login] = true
+			}
+
+			// all the entries are opened before anything is saved
+			var entries []sharing.BundleEntry
+			var userPasswords []string
+			for _, entry := range bundle.Entries {
+				key := entry.Service + "\x00" + entry.Login
+				if skip[key] {
+					deps.printer.Warning("Account with login %q at %q already exists, skipped", entry.Login, entry.Service)
+					continue
+				}
+				skip[key] = true
+
+				userPassword, err := entry.Open(privateKey)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				entries = append(entries, entry)
+				userPasswords = append(userPasswords, userPassword)
+			}
+
+			if len(entries) == 0 {
+				deps.printer.Infoln("There are no new accounts in the bundle of %q", bundle.Recipient)
+				return nil
+			}
+
+			secretKey, err := getSecretKeyWithConfirmation("secret key", "Secret keys are not equal", deps.printer, deps.input)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			accounts := make([]models.Account, len(entries))
+			passwords := make([]models.Password, len(entries))
+			for i, entry := range entries {
+				accounts[i] = models.Account{Login: entry.Login, Service: models.Service{Name: entry.Service}}
+				err = encryptPassword(&passwords[i], userPasswords[i], secretKey, deps.config.SecretKeyLength, deps.config.PasswordSettings)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+			}
+
+			err = deps.repo.Accounts().SaveAllWithPasswords(accounts, passwords)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			deps.printer.Header("The following accounts were imported:")
+			for i := range accounts {
+				recordAudit(deps, auditImport, &accounts[i], "from "+filepath.Base(args[0]))
+				deps.printer.Simpleln("  - %q at %q", accounts[i].Login, accounts[i].Service.Name)
+			}
+
+			deps.printer.Success("%d account(s) imported from the bundle of %q", len(accounts), bundle.Recipient)
+			return nil
+		},
+	}
+}
+
+func init() {}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/sharing"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+const (
+	toFlag   = "to"
+	fromFlag = "from"
+)
+
+// getShareCmd returns the representation of the share command
+func getShareCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "share",
+		Short: "Share an account with teammates",
+		Long: `Encrypts the account password with a new data key and wraps the key for the public keys
+of the given teammates and of those the account is already shared with.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "share account"
+			names, err := cmd.Flags().GetStringSlice(toFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			recipients, err := fetchIdentitiesByNames(deps.repo, names)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			return genericGet(
+				operation,
+				deps.repo,
+				deps.printer,
+				deps.input,
+				func(account models.Account) error {
+					decrypted, err := getDecryptedPasswordWithRetry(account.Password, deps.config.SecretKeyLength, 5, deps.printer, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+
+					existing, err := deps.repo.Shares().ListByAccount(account.ID)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+
+					identities := recipients
+					for _, share := range existing {
+						if !containsIdentity(identities, share.IdentityID) {
+							identities = append(identities, share.Identity)
+						}
+					}
+
+					err = shareAccount(deps.repo, account.ID, decrypted, identities)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+					recordAudit(deps, auditShare, &account, "with "+identityNames(identities))
+
+					deps.printer.Success("Account shared with: %s", identityNames(identities))
+					return nil
+				},
+			)
+		},
+	}
+}
+
+func init() {}
+
+// shareAccount replaces the account shares with the new ones for the given identities
+func shareAccount(repo storage.Repository, accountID uint, password string, identities []models.Identity) error {
+	shares, err := sharing.Share(password, identities)
+	if err != nil {
+		return err
+	}
+
+	return repo.Shares().Replace(accountID, shares)
+}
+
+// fetchIdentitiesByNames returns identities with the given names, fails if any of them doesn't exist
+func fetchIdentitiesByNames(repo storage.Repository, names []string) ([]models.Identity, error) {
+	identities := make([]models.Identity, 0, len(names))
+	for _, name := range names {
+		identity, err := repo.Identities().FetchByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find identity %q: %w", name, err)
+		}
+
+		if !containsIdentity(identities, identity.ID) {
+			identities = append(identities, identity)
+		}
+	}
+
+	return identities, nil
+}
+
+// containsIdentity checks whether the identity with the given ID is in the slice
+func containsIdentity(identities []models.Identity, id uint) bool {
+	for _, identity := range identities {
+		if identity.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identityNames returns comma separated names of the identities
+func identityNames(identities []models.Identity) string {
+	names := make([]string, 0, len(identities))
+	for _, identity := range identities {
+		names = append(names, identity.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
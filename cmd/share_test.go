@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/MirToykin/passtool/pkg/passtool"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSharingStorage returns the storage with the account of bob and the identities of amy and eve added
+func newSharingStorage(t *testing.T) string {
+	t.Helper()
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	createIdentity(t, dir, "bob", "phrase")
+	for _, name := range []string{"amy", "eve"} {
+		mustRun(t, dir, nil, "identity", "add", "--name", name, "--key", createIdentity(t, newTestStorage(t), name, name))
+	}
+
+	return dir
+}
+
+// assertSharedWith checks the output of shared-with for the account of bob
+func assertSharedWith(t *testing.T, dir, want string) {
+	t.Helper()
+	run := mustRun(t, dir, []string{"github.com", "bob"}, "shared-with")
+	if !strings.Contains(run.output, want) {
+		t.Errorf("got output:\n%s\nwant %q", run.output, want)
+	}
+}
+
+func TestSharePrompts(t *testing.T) {
+	dir := newSharingStorage(t)
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "wrong", "key"}, "share", "--to", "amy")
+	assertPrompts(t, run,
+		"Enter service name or serial number: ",
+		"Enter login or serial number: ",
+		"Enter secret: ",
+		"Enter secret: ",
+	)
+	assertSharedWith(t, dir, "The account is shared with:\n  - amy\n")
+
+	// the account stays shared with those it was shared with before
+	mustRun(t, dir, []string{"github.com", "bob", "key"}, "share", "--to", "eve")
+	assertSharedWith(t, dir, "  - amy\n  - eve\n")
+}
+
+func TestShareWithUnknownIdentity(t *testing.T) {
+	dir := newSharingStorage(t)
+
+	run := execute(t, dir, []string{"github.com", "bob", "key"}, "share", "--to", "amy,unknown")
+	assertExitCode(t, run, exitNotFound)
+	assertPrompts(t, run)
+	assertSharedWith(t, dir, "The account is not shared")
+}
+
+func TestUnsharePrompts(t *testing.T) {
+	dir := newSharingStorage(t)
+	mustRun(t, dir, []string{"github.com", "bob", "key"}, "share", "--to", "amy,eve")
+
+	// the secret key is not needed to remove shares
+	run := mustRun(t, dir, []string{"github.com", "bob"}, "unshare", "--from", "amy")
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ")
+	assertSharedWith(t, dir, "The account is shared with:\n  - eve\n")
+
+	run = mustRun(t, dir, []string{"github.com", "bob"}, "unshare", "--from", "amy")
+	if !strings.Contains(run.output, "The account is not shared with: amy") {
+		t.Errorf("got output:\n%s\nwant the account reported as not shared with amy", run.output)
+	}
+
+	mustRun(t, dir, []string{"github.com", "bob"}, "unshare", "--from", "eve")
+	assertSharedWith(t, dir, "The account is not shared")
+}
+
+// exportBundle shares the accounts of bob and joe from the storage of bob with amy and returns the path
+// of the bundle exported for amy and the storage of amy
+func exportBundle(t *testing.T) (bundle, amyDir string) {
+	t.Helper()
+	bobDir := newTestStorage(t)
+	addAccount(t, bobDir, "github.com", "bob", "password", "key")
+	addAccount(t, bobDir, "gitlab.com", "joe", "other", "key")
+	createIdentity(t, bobDir, "bob", "phrase")
+
+	amyDir = newTestStorage(t)
+	mustRun(t, bobDir, nil, "identity", "add", "--name", "amy", "--key", createIdentity(t, amyDir, "amy", "amy phrase"))
+	mustRun(t, bobDir, []string{"github.com", "bob", "key"}, "share", "--to", "amy")
+	mustRun(t, bobDir, []string{"gitlab.com", "joe", "key"}, "share", "--to", "amy")
+
+	bundle = filepath.Join(t.TempDir(), "bundle.json")
+	mustRun(t, bobDir, nil, "share-export", "--to", "amy", "--output", bundle)
+	return bundle, amyDir
+}
+
+func TestShareImportPrompts(t *testing.T) {
+	bundle, amyDir := exportBundle(t)
+	addAccount(t, amyDir, "github.com", "bob", "mine", "amy key")
+
+	run := mustRun(t, amyDir, []string{"amy phrase", "amy key", "amy key"}, "share-import", bundle)
+	assertPrompts(t, run, "Enter identity passphrase: ", "Enter secret key: ", "Enter secret key again: ")
+	for _, want := range []string{`Account with login "bob" at "github.com" already exists, skipped`, `"joe" at "gitlab.com"`} {
+		if !strings.Contains(run.output, want) {
+			t.Errorf("got output:\n%s\nwant %q", run.output, want)
+		}
+	}
+
+	opts := passtool.Options{StoragePath: amyDir}
+	if got, err := storedPassword(t, opts, "gitlab.com", "joe", "amy key"); err != nil || got != "other" {
+		t.Errorf("got stored password %q, %v, want the imported one", got, err)
+	}
+	if got, err := storedPassword(t, opts, "github.com", "bob", "amy key"); err != nil || got != "mine" {
+		t.Errorf("got stored password %q, %v, want the existing account kept", got, err)
+	}
+
+	// nothing is left to import, so the secret key is not requested
+	run = mustRun(t, amyDir, []string{"amy phrase"}, "share-import", bundle)
+	assertPrompts(t, run, "Enter identity passphrase: ")
+	assertStoredServices(t, amyDir, map[string][]string{"github.com": {"bob"}, "gitlab.com": {"joe"}})
+}
+
+func TestShareImportOfChangedBundleImportsNothing(t *testing.T) {
+	bundle, amyDir := exportBundle(t)
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content map[string]interface{}
+	if err = json.Unmarshal(data, &content); err != nil {
+		t.Fatal(err)
+	}
+	entries := content["entries"].([]interface{})
+	entries[1].(map[string]interface{})["encrypted"] = entries[0].(map[string]interface{})["wrapped_key"]
+	if data, err = json.Marshal(content); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(bundle, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := execute(t, amyDir, []string{"amy phrase", "amy key", "amy key"}, "share-import", bundle)
+	if run.err == nil {
+		t.Fatalf("got the changed bundle imported:\n%s", run.output)
+	}
+	assertStoredServices(t, amyDir, map[string][]string{})
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+)
+
+// getSharedWithCmd returns the representation of the shared-with command
+func getSharedWithCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "shared-with",
+		Short: "Print teammates an account is shared with",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "get account shares"
+			return genericGet(
+				operation,
+				deps.repo,
+				deps.printer,
+				deps.input,
+				func(account models.Account) error {
+					shares, err := deps.repo.Shares().ListByAccount(account.ID)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+
+					if len(shares) == 0 {
+						deps.printer.Infoln("The account is not shared")
+						return nil
+					}
+
+					deps.printer.Header("The account is shared with:")
+					for _, share := range shares {
+						deps.printer.Simpleln("  - %s", share.Identity.Name)
+					}
+					return nil
+				},
+			)
+		},
+	}
+}
+
+func init() {}
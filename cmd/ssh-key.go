@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/sshkey"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	typeFlag     = "type"
+	bitsFlag     = "bits"
+	commentFlag  = "comment"
+	socketFlag   = "socket"
+	confirmFlag  = "confirm"
+	lifetimeFlag = "lifetime"
+)
+
+// getSSHKeyCmd returns the representation of the ssh-key command with its subcommands
+func getSSHKeyCmd(deps *AppDependencies) *cobra.Command {
+	sshKeyCmd := &cobra.Command{
+		Use:   "ssh-key",
+		Short: "Keep SSH private keys in the vault and serve them with the ssh-agent",
+		Long: `SSH private keys are kept in the OpenSSH format as passwords of accounts, encrypted with the secret key.
+Public keys are kept in plain, so they can be printed without the secret key.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	generateCmd := getSSHKeyGenerateCmd(deps)
+	setSSHKeyAccountFlags(generateCmd)
+	generateCmd.Flags().String(typeFlag, sshkey.TypeEd25519, "Key type: ed25519, rsa or ecdsa")
+	generateCmd.Flags().Int(bitsFlag, 0, "Key size for rsa and ecdsa keys")
+
+	importCmd := getSSHKeyImportCmd(deps)
+	setSSHKeyAccountFlags(importCmd)
+
+	agentCmd := getSSHKeyAgentCmd(deps)
+	agentCmd.Flags().String(socketFlag, "", "Path of the agent socket, a new temporary directory is used by default")
+	agentCmd.Flags().Bool(confirmFlag, false, "Ask for confirmation before each use of a key")
+	agentCmd.Flags().Duration(lifetimeFlag, 0, "Remove keys from the agent after the given time, e.g. 8h")
+
+	sshKeyCmd.AddCommand(generateCmd, importCmd, getSSHKeyListCmd(deps), getSSHKeyPublicCmd(deps), agentCmd)
+	return sshKeyCmd
+}
+
+// setSSHKeyAccountFlags sets flags of the account to keep the key in
+func setSSHKeyAccountFlags(cmd *cobra.Command) {
+	cmd.Flags().String(serviceFlag, "", "Name of the service to keep the key in, e.g. the host")
+	cmd.Flags().String(loginFlag, "", "Login of the account to keep the key in")
+	cmd.Flags().String(commentFlag, "", "Comment of the key, login@service by default")
+	_ = cmd.MarkFlagRequired(serviceFlag)
+	_ = cmd.MarkFlagRequired(loginFlag)
+}
+
+// getSSHKeyGenerateCmd returns the representation of the ssh-key generate command
+func getSSHKeyGenerateCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "generate",
+		Short: "Generate a new SSH key and keep it in the new account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "generate ssh key"
+			keyType, err := cmd.Flags().GetString(typeFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			bits, err := cmd.Flags().GetInt(bitsFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			return saveSSHKey(cmd, deps, operation, func(comment string) (sshkey.Key, error) {
+				return sshkey.Generate(keyType, bits, comment)
+			})
+		},
+	}
+}
+
+// getSSHKeyImportCmd returns the representation of the ssh-key import command
+func getSSHKeyImportCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <private key file>",
+		Short: "Import an existing SSH private key to the new account",
+		Long: `Imports the private key in any format supported by OpenSSH, the key protected with a passphrase
+is decrypted and kept encrypted with the secret key only. Remove the key file after the import.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "import ssh key"
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			return saveSSHKey(cmd, deps, operation, func(comment string) (sshkey.Key, error) {
+				return sshkey.Import(data, comment, func() (string, error) {
+					return deps.input.ReadSecret("Enter key passphrase: ")
+				})
+			})
+		},
+	}
+}
+
+// getSSHKeyListCmd returns the representation of the ssh-key list command
+func getSSHKeyListCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Print the SSH keys kept in the vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "list ssh keys"
+			keys, err := listSSHKeyAccounts(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			if len(keys) == 0 {
+				deps.printer.Infoln("There are no SSH keys yet")
+				return nil
+			}
+
+			deps.printer.Header("The following SSH keys are kept:")
+			for _, account := range keys {
+				fingerprint, keyType, err := sshkey.Fingerprint(account.SSHPublicKey)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				deps.printer.Simpleln("  - %q at %q: %s %s", account.Login, account.Service.Name, keyType, fingerprint)
+			}
+			return nil
+		},
+	}
+}
+
+// getSSHKeyPublicCmd returns the representation of the ssh-key public command
+func getSSHKeyPublicCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "public",
+		Short: "Print the public key in the authorized_keys format",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "print public key"
+			return genericGet(
+				operation,
+				deps.repo,
+				deps.printer,
+				deps.input,
+				func(account models.Account) error {
+					if !account.IsSSHKey() {
+						return newValidationError("%s: the account doesn't keep an SSH key", operation)
+					}
+
+					deps.printer.Simpleln("%s", account.SSHPublicKey)
+					return nil
+				},
+			)
+		},
+	}
+}
+
+// getSSHKeyAgentCmd returns the representation of the ssh-key agent command
+func getSSHKeyAgentCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "agent",
+		Short: "Run the ssh-agent serving the SSH keys from the vault",
+		Long: `Unlocks the SSH keys of the vault with the secret keys and serves them on the Unix socket
+until it's stopped, set SSH_AUTH_SOCK printed on start to use it. With --confirm each use of a key
+is confirmed in the terminal the agent runs in. Keys are kept in memory only.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "run ssh agent"
+			socketPath, err := cmd.Flags().GetString(socketFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			confirm, err := cmd.Flags().GetBool(confirmFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			lifetime, err := cmd.Flags().GetDuration(lifetimeFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			keys, err := listSSHKeyAccounts(deps)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			if len(keys) == 0 {
+				deps.printer.Infoln("There are no SSH keys yet")
+				return nil
+			}
+
+			keysByFingerprint := make(map[string]models.Account, len(keys))
+			for _, account := range keys {
+				fingerprint, _, err := sshkey.Fingerprint(account.SSHPublicKey)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				keysByFingerprint[fingerprint] = account
+			}
+
+			var confirmUse func(key ssh.PublicKey) bool
+			if confirm {
+				confirmUse = func(key ssh.PublicKey) bool {
+					account := keysByFingerprint[ssh.FingerprintSHA256(key)]
+					answer, err := deps.input.ReadLine(fmt.Sprintf("Allow use of the key of %q at %q? [y/N]: ",
+						account.Login, account.Service.Name))
+					return err == nil && strings.ToLower(strings.TrimSpace(answer)) == "y"
+				}
+			}
+
+			sshAgent := sshkey.NewAgent(confirmUse, func(key ssh.PublicKey) {
+				account := keysByFingerprint[ssh.FingerprintSHA256(key)]
+				recordAudit(deps, auditSSHAgent, &account, "sign")
+			})
+
+			err = unlockSSHKeys(deps, sshAgent, keys, lifetime)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			socketPath, cleanup, err := prepareSocket(socketPath, "passtool-agent-")
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			defer cleanup()
+
+			listener, err := net.Listen("unix", socketPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-signals
+				_ = listener.Close()
+			}()
+
+			deps.printer.Simpleln("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;", socketPath)
+			deps.printer.Infoln("The agent serves %d key(s), press Ctrl+C to stop it", len(keys))
+
+			err = sshAgent.Serve(listener)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			deps.printer.Success("The agent is stopped")
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// saveSSHKey saves the key created by newKey to the new account given by the flags
+func saveSSHKey(
+	cmd *cobra.Command,
+	deps *AppDependencies,
+	operation string,
+	newKey func(comment string) (sshkey.Key, error),
+) error {
+	serviceName, err := cmd.Flags().GetString(serviceFlag)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	login, err := cmd.Flags().GetString(loginFlag)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	comment, err := cmd.Flags().GetString(commentFlag)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	if comment == "" {
+		comment = login + "@" + serviceName
+	}
+
+	service, err := deps.repo.Services().FetchOrCreate(serviceName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	exists, err := deps.repo.Accounts().Exists(login, service.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	if exists {
+		return newValidationError("%s: account with login %q at %q already exists", operation, login, serviceName)
+	}
+
+	key, err := newKey(comment)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	secretKey, err := getSecretKeyWithConfirmation("secret key", "Secret keys are not equal", deps.printer, deps.input)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	account := models.Account{Login: login, Service: service, SSHPublicKey: key.Public}
+	var password models.Password
+	err = encryptPassword(&password, key.Private, secretKey, deps.config.SecretKeyLength, deps.config.PasswordSettings)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	err = deps.repo.Accounts().SaveWithPassword(&account, &password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	recordAudit(deps, auditAdd, &account, "ssh key")
+
+	deps.printer.Success("SSH key saved for account with login %q at %q, the public key:", login, serviceName)
+	deps.printer.Simpleln("%s", key.Public)
+	return nil
+}
+
+// listSSHKeyAccounts returns the accounts keeping SSH keys
+func listSSHKeyAccounts(deps *AppDependencies) ([]models.Account, error) {
+	accounts, err := deps.repo.Accounts().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []models.Account
+	for _, account := range sortAccountsByService(accounts) {
+		if account.IsSSHKey() {
+			keys = append(keys, account)
+		}
+	}
+
+	return keys, nil
+}
+
+// unlockSSHKeys decrypts the keys of the accounts and adds them to the agent
+func unlockSSHKeys(deps *AppDependencies, sshAgent *sshkey.Agent, keys []models.Account, lifetime time.Duration) error {
+	resolver, err := newSecretResolver(deps)
+	if err != nil {
+		return err
+	}
+
+	for _, account := range keys {
+		private, err := resolver.password(account)
+		if err != nil {
+			return err
+		}
+
+		privateKey, err := sshkey.Parse(private)
+		if err != nil {
+			return fmt.Errorf("unable to load key of %q at %q: %w", account.Login, account.Service.Name, err)
+		}
+
+		err = sshAgent.Add(agent.AddedKey{
+			PrivateKey:   privateKey,
+			Comment:      account.Login + "@" + account.Service.Name,
+			LifetimeSecs: uint32(lifetime.Seconds()),
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add key to the agent: %w", err)
+		}
+	}
+
+	resolver.recordUsage(auditSSHAgent, "unlock")
+	return nil
+}
+
+// prepareSocket prepares the path of the Unix socket, a new private temporary directory with the given prefix
+// is used if the path isn't given, returns the function removing the socket
+func prepareSocket(socketPath, tempDirPrefix string) (string, func(), error) {
+	if socketPath != "" {
+		// only a stale socket is removed, so a mistyped path doesn't delete the file
+		fi, err := os.Lstat(socketPath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return "", nil, fmt.Errorf("unable to check socket path: %w", err)
+		case fi.Mode()&os.ModeSocket == 0:
+			return "", nil, newValidationError("%s exists and is not a socket", socketPath)
+		default:
+			if err = os.Remove(socketPath); err != nil {
+				return "", nil, fmt.Errorf("unable to remove stale socket: %w", err)
+			}
+		}
+		return socketPath, func() { _ = os.Remove(socketPath) }, nil
+	}
+
+	dir, err := os.MkdirTemp("", tempDirPrefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create socket directory: %w", err)
+	}
+
+	return filepath.Join(dir, "agent.sock"), func() { _ = os.RemoveAll(dir) }, nil
+}
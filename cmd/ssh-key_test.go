@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareSocketRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unable to listen on unix socket: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = listener.Close()
+
+	got, cleanup, err := prepareSocket(path, "")
+	if err != nil {
+		t.Fatalf("unable to prepare socket: %v", err)
+	}
+	defer cleanup()
+	if got != path {
+		t.Errorf("got socket path %q, want %q", got, path)
+	}
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("got %v checking the stale socket, want it removed", err)
+	}
+}
+
+func TestPrepareSocketKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, dir} {
+		if _, _, err := prepareSocket(path, ""); exitCode(err) != exitInvalid {
+			t.Errorf("got %v preparing socket at %q, want the validation error", err, path)
+		}
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("got %v, want %q kept", err, path)
+		}
+	}
+}
+
+func TestPrepareSocketInTemporaryDirectory(t *testing.T) {
+	path, cleanup, err := prepareSocket("", "passtool-test-")
+	if err != nil {
+		t.Fatalf("unable to prepare socket: %v", err)
+	}
+
+	dir := filepath.Dir(path)
+	if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("got socket directory %v, %v, want the private one", fi, err)
+	}
+	cleanup()
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the socket directory removed", err)
+	}
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/gitsync"
+	"github.com/spf13/cobra"
+)
+
+const (
+	remoteFlag    = "remote"
+	importKeyFlag = "import-key"
+	theirsFlag    = "theirs"
+)
+
+// getSyncCmd returns the representation of the sync command with its subcommands
+func getSyncCmd(deps *AppDependencies) *cobra.Command {
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync the vault through a git repository",
+		Long: `The vault is kept in a local git repository as per-entry files encrypted with the sync key,
+file names and commit messages reveal neither services nor logins. Each change of the vault is committed,
+"sync pull" merges remote changes field by field and reports conflicts, "sync push" publishes local changes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	initCmd := getSyncInitCmd(deps)
+	initCmd.Flags().String(remoteFlag, "", "URL of the remote git repository")
+	initCmd.Flags().Bool(importKeyFlag, false, "Use the sync key of an existing shared vault")
+
+	pullCmd := getSyncPullCmd(deps)
+	pullCmd.Flags().Bool(theirsFlag, false, "Resolve conflicts in favour of remote changes")
+
+	syncCmd.AddCommand(initCmd, pullCmd, getSyncPushCmd(deps), getSyncStatusCmd(deps), getSyncKeyCmd(deps))
+	return syncCmd
+}
+
+// getSyncInitCmd returns the representation of the sync init command
+func getSyncInitCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Initialize the sync repository",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "init sync"
+			remote, err := cmd.Flags().GetString(remoteFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			importKey, err := cmd.Flags().GetBool(importKeyFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			key := deps.syncer.Key()
+			if importKey {
+				var encoded string
+				if encoded, err = getSecret("sync key", false, deps.input); err == nil {
+					key, err = gitsync.DecodeKey(encoded)
+				}
+			} else if key == nil {
+				key, err = gitsync.NewKey()
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			err = deps.syncer.Init(remote, key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			_, err = deps.syncer.Commit(deps.repo, "Initial vault")
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			deps.printer.Success("Sync repository initialized at %s", deps.syncer.Dir())
+
+			if remote != "" {
+				result, err := deps.syncer.Pull(deps.repo, false)
+				if err != nil {
+					return fmt.Errorf("%s: %w", operation, err)
+				}
+				printPullResult(result, deps.printer)
+			}
+
+			if !importKey {
+				deps.printer.Infoln("Share the sync key with other vault users using the %q command", "sync key")
+			}
+			return nil
+		},
+	}
+}
+
+// getSyncPullCmd returns the representation of the sync pull command
+func getSyncPullCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "pull",
+		Short: "Merge remote changes into the vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "pull changes"
+			preferTheirs, err := cmd.Flags().GetBool(theirsFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			result, err := deps.syncer.Pull(deps.repo, preferTheirs)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+			printPullResult(result, deps.printer)
+			return nil
+		},
+	}
+}
+
+// getSyncPushCmd returns the representation of the sync push command
+func getSyncPushCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "push",
+		Short: "Publish local changes of the vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := deps.syncer.Push(deps.repo)
+			if err != nil {
+				return fmt.Errorf("push changes: %w", err)
+			}
+			deps.printer.Success("Changes pushed")
+			return nil
+		},
+	}
+}
+
+// getSyncStatusCmd returns the representation of the sync status command
+func getSyncStatusCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Print the state of the sync repository",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := deps.syncer.Status()
+			if err != nil {
+				return fmt.Errorf("get sync status: %w", err)
+			}
+
+			deps.printer.Simpleln("Repository:  %s", deps.syncer.Dir())
+			if status.LastCommit != "" {
+				deps.printer.Simpleln("Last commit: %s", status.LastCommit)
+			}
+			if status.Remote == "" {
+				deps.printer.Infoln("Remote is not configured")
+				return nil
+			}
+
+			deps.printer.Simpleln("Remote:      %s", status.Remote)
+			deps.printer.Simpleln("Ahead:       %d", status.Ahead)
+			deps.printer.Simpleln("Behind:      %d", status.Behind)
+			return nil
+		},
+	}
+}
+
+// getSyncKeyCmd returns the representation of the sync key command
+func getSyncKeyCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "key",
+		Short: "Print the sync key to share it with other vault users",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !deps.syncer.IsInitialized() {
+				return gitsync.ErrNotInitialized
+			}
+
+			deps.printer.Warning("Anyone with the sync key and access to the remote can read services and logins of the vault.")
+			deps.printer.Simpleln(gitsync.EncodeKey(deps.syncer.Key()))
+			return nil
+		},
+	}
+}
+
+func init() {}
+
+// printPullResult prints changes applied to the vault by pull and the conflicts
+func printPullResult(result gitsync.PullResult, p Printer) {
+	if result.UpToDate {
+		p.Infoln("Vault is up to date")
+		return
+	}
+
+	p.Success("Remote changes merged: %d added, %d updated, %d deleted", result.Added, result.Updated, result.Deleted)
+
+	if len(result.Conflicts) == 0 {
+		return
+	}
+
+	p.Warning("Conflicts:")
+	for _, c := range result.Conflicts {
+		if c.Field == "" {
+			p.Simpleln("  - %s at %s: %s", c.Login, c.Service, c.Reason)
+		} else {
+			p.Simpleln("  - %s at %s, field %q: %s", c.Login, c.Service, c.Field, c.Reason)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newSyncRemote returns the path of the bare repository used as the remote, git configs of the user are not used
+func newSyncRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	remote := t.TempDir()
+	if output, err := exec.Command("git", "init", "--quiet", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("unable to init remote: %v\n%s", err, output)
+	}
+
+	return remote
+}
+
+func TestSyncBetweenStorages(t *testing.T) {
+	remote := newSyncRemote(t)
+	first := newTestStorage(t)
+	addAccount(t, first, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, first, nil, "sync", "init", "--remote", remote)
+	assertPrompts(t, run)
+	mustRun(t, first, nil, "sync", "push")
+
+	lines := strings.Split(strings.TrimSpace(mustRun(t, first, nil, "sync", "key").output), "\n")
+	syncKey := lines[len(lines)-1]
+
+	// the second storage joins the vault with the sync key
+	second := newTestStorage(t)
+	run = mustRun(t, second, []string{syncKey}, "sync", "init", "--remote", remote, "--import-key")
+	assertPrompts(t, run, "Enter sync key: ")
+	if !strings.Contains(run.output, "Remote changes merged: 1 added, 0 updated, 0 deleted") {
+		t.Errorf("got output:\n%s\nwant the account of the remote merged", run.output)
+	}
+	run = mustRun(t, second, []string{"github.com", "bob", "key"}, "get")
+	if !reflect.DeepEqual(run.copied, []string{"password"}) {
+		t.Errorf("got copied %q, want the password synced", run.copied)
+	}
+
+	// changes of the vault are committed and published by push
+	addAccount(t, second, "gitlab.com", "amy", "other", "key")
+	mustRun(t, second, nil, "sync", "push")
+
+	run = mustRun(t, first, nil, "sync", "pull")
+	if !strings.Contains(run.output, "Remote changes merged: 1 added, 0 updated, 0 deleted") {
+		t.Errorf("got output:\n%s\nwant the added account merged", run.output)
+	}
+	assertStoredServices(t, first, map[string][]string{"github.com": {"bob"}, "gitlab.com": {"amy"}})
+
+	if run = mustRun(t, first, nil, "sync", "pull"); !strings.Contains(run.output, "Vault is up to date") {
+		t.Errorf("got output:\n%s\nwant the vault up to date", run.output)
+	}
+	run = mustRun(t, first, nil, "sync", "status")
+	for _, want := range []string{"Remote:      " + remote, "Ahead:       0", "Behind:      0"} {
+		if !strings.Contains(run.output, want) {
+			t.Errorf("got status:\n%s\nwant %q", run.output, want)
+		}
+	}
+}
+
+func TestSyncInitWithInvalidKey(t *testing.T) {
+	remote := newSyncRemote(t)
+	dir := newTestStorage(t)
+
+	run := execute(t, dir, []string{"invalid"}, "sync", "init", "--remote", remote, "--import-key")
+	if run.err == nil {
+		t.Fatal("got sync initialized with the invalid key")
+	}
+	assertPrompts(t, run, "Enter sync key: ")
+
+	if run = execute(t, dir, nil, "sync", "key"); run.err == nil {
+		t.Errorf("got the sync key printed, want the sync not initialized:\n%s", run.output)
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+)
+
+// getUnshareCmd returns the representation of the unshare command
+func getUnshareCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unshare",
+		Short: "Stop sharing an account with teammates",
+		Long: `Removes the account shares for the given teammates. Teammates who already exported the account
+keep the current password, so consider changing it with the "set" command.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "unshare account"
+			names, err := cmd.Flags().GetStringSlice(fromFlag)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			identities, err := fetchIdentitiesByNames(deps.repo, names)
+			if err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+
+			return genericGet(
+				operation,
+				deps.repo,
+				deps.printer,
+				deps.input,
+				func(account models.Account) error {
+					existing, err := deps.repo.Shares().ListByAccount(account.ID)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+
+					var remaining []models.Share
+					for _, share := range existing {
+						if !containsIdentity(identities, share.IdentityID) {
+							remaining = append(remaining, share)
+						}
+					}
+
+					if len(remaining) == len(existing) {
+						deps.printer.Infoln("The account is not shared with: %s", identityNames(identities))
+						return nil
+					}
+
+					err = deps.repo.Shares().Replace(account.ID, remaining)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+					recordAudit(deps, auditUnshare, &account, "from "+identityNames(identities))
+
+					deps.printer.Success("Account is no longer shared with: %s", identityNames(identities))
+					return nil
+				},
+			)
+		},
+	}
+}
+
+func init() {}
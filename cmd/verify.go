@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// getVerifyCmd returns the representation of the verify command
+func getVerifyCmd(deps *AppDependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Check a secret key of a password without printing the password",
+		Long: `Checks whether the secret key matches the password of the chosen account using its verification tag.
+If accounts are selected with filters or --all, prints which of them use the given secret key.
+Passwords saved without the verification tag are checked by decryption, set them again to add the tag.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operation := "verify secret"
+			if hasChangedFlags(cmd, accountFilterFlags...) {
+				return verifyInBulk(cmd, deps)
+			}
+
+			return genericGet(
+				operation,
+				deps.repo,
+				deps.printer,
+				deps.input,
+				func(account models.Account) error {
+					secret, err := getSecretKey("secret", false, deps.input)
+					if err != nil {
+						return fmt.Errorf("%s: %w", operation, err)
+					}
+
+					matches, tagged := checkSecret(account.Password, secret, deps.config.SecretKeyLength)
+					if !matches {
+						return fmt.Errorf("%s: %w", operation, models.ErrWrongSecret)
+					}
+
+					if !tagged {
+						deps.printer.Success("Secret matches, checked by decryption as the password has no verification tag")
+						return nil
+					}
+					deps.printer.Success("Secret matches")
+					return nil
+				},
+			)
+		},
+	}
+}
+
+func init() {}
+
+// verifyInBulk prints which of the accounts selected by the filter flags use the given secret key
+func verifyInBulk(cmd *cobra.Command, deps *AppDependencies) error {
+	operation := "verify secret"
+	filter, err := getAccountFilter(cmd, deps)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	accounts, err := deps.repo.Accounts().List()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	secret, err := getSecretKey("secret", false, deps.input)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var matching, other []models.Account
+	untagged := 0
+	now := time.Now()
+	for _, account := range sortAccountsByService(accounts) {
+		if !filter.match(account, deps.config.RotationPeriod, now) {
+			continue
+		}
+
+		matches, tagged := checkSecret(account.Password, secret, deps.config.SecretKeyLength)
+		if !tagged {
+			untagged++
+		}
+		if matches {
+			matching = append(matching, account)
+		} else {
+			other = append(other, account)
+		}
+	}
+
+	if len(matching)+len(other) == 0 {
+		deps.printer.Infoln("There are no accounts matching the filters")
+		return nil
+	}
+
+	printAccountGroup(deps.printer, "The secret matches the following accounts:", matching)
+	printAccountGroup(deps.printer, "The following accounts use another secret:", other)
+
+	if untagged > 0 {
+		deps.printer.Warning("%d account(s) have no verification tag and were checked by decryption, set them again to add the tag", untagged)
+	}
+
+	return nil
+}
+
+// checkSecret checks the secret against the verification tag of the password, passwords without the tag
+// are checked by decryption, which may rarely succeed with a wrong secret
+func checkSecret(password models.Password, secret string, keyLen int) (matches, tagged bool) {
+	err := password.CheckSecret(secret, keyLen)
+	if !errors.Is(err, models.ErrNoVerifier) {
+		return err == nil, true
+	}
+
+	_, err = password.GetDecrypted(secret, keyLen)
+	return err == nil, false
+}
+
+// printAccountGroup prints the header and the accounts if there are any
+func printAccountGroup(p Printer, header string, accounts []models.Account) {
+	if len(accounts) == 0 {
+		return
+	}
+
+	p.Header(header)
+	for _, account := range accounts {
+		p.Simpleln("  - %q at %q", account.Login, account.Service.Name)
+	}
+}
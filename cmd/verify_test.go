@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestVerifyPrompts(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+
+	run := mustRun(t, dir, []string{"github.com", "bob", "key"}, "verify")
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ", "Enter secret: ")
+	assertGolden(t, "verify", run.output)
+	if len(run.copied) != 0 {
+		t.Errorf("got copied %q, want nothing", run.copied)
+	}
+
+	// the secret key is not requested again
+	run = execute(t, dir, []string{"github.com", "bob", "wrong", "key"}, "verify")
+	assertExitCode(t, run, exitWrongSecret)
+	assertPrompts(t, run, "Enter service name or serial number: ", "Enter login or serial number: ", "Enter secret: ")
+}
+
+func TestVerifyInBulk(t *testing.T) {
+	dir := newTestStorage(t)
+	addAccount(t, dir, "github.com", "bob", "password", "key")
+	addAccount(t, dir, "gitlab.com", "amy", "other", "another")
+	addAccount(t, dir, "example.com", "amy", "third", "key")
+
+	run := mustRun(t, dir, []string{"key"}, "verify", "--all")
+	assertPrompts(t, run, "Enter secret: ")
+	assertGolden(t, "verify_all", run.output)
+
+	run = mustRun(t, dir, []string{"key"}, "verify", "--service", "unknown.com")
+	assertGolden(t, "verify_none", run.output)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is the token bucket allowing the given number of requests per minute with bursts of the same size
+type rateLimiter struct {
+	mu       sync.Mutex
+	perToken time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// newRateLimiter returns the limiter allowing perMinute requests per minute, zero disables the limit
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		perToken: time.Minute / time.Duration(perMinute),
+		burst:    float64(perMinute),
+		tokens:   float64(perMinute),
+	}
+}
+
+// allow takes a token if there is one, otherwise returns the time to wait for the next one
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.perToken)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) * float64(l.perToken))
+	}
+
+	l.tokens--
+	return true, 0
+}
@@ -0,0 +1,265 @@
+// Package api serves the vault accounts over HTTP for local integrations like editor plugins and scripts
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by the decrypt function for passwords encrypted with a secret key the server doesn't know
+var ErrLocked = errors.New("the password is encrypted with another secret key")
+
+const (
+	accountsPath = "/v1/accounts"
+	searchPath   = "/v1/search"
+	// maxDeniedRateLimit is the highest number of requests with invalid tokens allowed per minute
+	maxDeniedRateLimit = 60
+)
+
+// Account is the representation of an account in API responses, the password is included when a single account
+// is requested only
+type Account struct {
+	ID                uint       `json:"id"`
+	Service           string     `json:"service"`
+	Login             string     `json:"login"`
+	CreatedAt         time.Time  `json:"created_at"`
+	PasswordChangedAt time.Time  `json:"password_changed_at"`
+	LastAccessedAt    *time.Time `json:"last_accessed_at"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	SSHPublicKey      string     `json:"ssh_public_key,omitempty"`
+	Password          string     `json:"password,omitempty"`
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server handles the API requests authenticated with the session token
+type Server struct {
+	accounts storage.AccountRepository
+	token    string
+	limiter  *rateLimiter
+	// deniedLimiter limits requests with invalid tokens apart, so they don't use up the limit of the token
+	// and don't flood the audit trail
+	deniedLimiter *rateLimiter
+	// decrypt returns the decrypted password of the account
+	decrypt func(account models.Account) (string, error)
+	// record records the request to the audit trail, account is nil for requests not related to a single account
+	record func(account *models.Account, details string)
+	// mu serializes access to the storage
+	mu  sync.Mutex
+	mux *http.ServeMux
+}
+
+// NewServer returns the server of the accounts, requests are allowed with the given token only,
+// rateLimit is the number of requests allowed per minute, zero disables the limit.
+// Requests with invalid tokens are limited apart to the same number, but no more than 60 per minute.
+func NewServer(
+	accounts storage.AccountRepository,
+	token string,
+	rateLimit int,
+	decrypt func(account models.Account) (string, error),
+	record func(account *models.Account, details string),
+) *Server {
+	s := &Server{
+		accounts:      accounts,
+		token:         token,
+		limiter:       newRateLimiter(rateLimit),
+		deniedLimiter: newRateLimiter(deniedRateLimit(rateLimit)),
+		decrypt:       decrypt,
+		record:        record,
+		mux:           http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc(accountsPath, s.handleList)
+	s.mux.HandleFunc(accountsPath+"/", s.handleGet)
+	s.mux.HandleFunc(searchPath, s.handleSearch)
+	return s
+}
+
+// ServeHTTP checks the token and then the rate limit before handling the request,
+// requests with invalid tokens are limited apart from the ones with the token
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		if !allowRequest(w, s.deniedLimiter) {
+			return
+		}
+
+		s.mu.Lock()
+		s.record(nil, "denied "+r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="passtool"`)
+		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+
+	if !allowRequest(w, s.limiter) {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mux.ServeHTTP(w, r)
+}
+
+// allowRequest takes a token of the limiter, the too many requests response is written if there is none
+func allowRequest(w http.ResponseWriter, limiter *rateLimiter) bool {
+	ok, retryAfter := limiter.allow(time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, "too many requests")
+	}
+
+	return ok
+}
+
+// deniedRateLimit returns the number of requests with invalid tokens allowed per minute
+func deniedRateLimit(rateLimit int) int {
+	if rateLimit <= 0 || rateLimit > maxDeniedRateLimit {
+		return maxDeniedRateLimit
+	}
+
+	return rateLimit
+}
+
+// authorized checks the bearer token of the request
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handleList returns metadata of the accounts filtered by the service and login query parameters
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	service, login := r.URL.Query().Get("service"), r.URL.Query().Get("login")
+	s.respondAccounts(w, "list", func(account models.Account) bool {
+		return (service == "" || strings.EqualFold(account.Service.Name, service)) &&
+			(login == "" || account.Login == login)
+	})
+}
+
+// handleSearch returns metadata of the accounts whose service name or login contains the q query parameter
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "the q parameter is required")
+		return
+	}
+
+	s.respondAccounts(w, "search", func(account models.Account) bool {
+		return strings.Contains(strings.ToLower(account.Service.Name), query) ||
+			strings.Contains(strings.ToLower(account.Login), query)
+	})
+}
+
+// respondAccounts writes metadata of the accounts matching the filter sorted by service name and login
+func (s *Server) respondAccounts(w http.ResponseWriter, details string, match func(account models.Account) bool) {
+	accounts, err := s.accounts.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "unable to load accounts")
+		return
+	}
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if accounts[i].Service.Name != accounts[j].Service.Name {
+			return accounts[i].Service.Name < accounts[j].Service.Name
+		}
+		return accounts[i].Login < accounts[j].Login
+	})
+
+	result := make([]Account, 0, len(accounts))
+	for _, account := range accounts {
+		if match(account) {
+			result = append(result, newAccount(account))
+		}
+	}
+
+	s.record(nil, details)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleGet returns the account with the decrypted password, the account is referenced by its ID
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, accountsPath+"/"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "account not found")
+		return
+	}
+
+	accounts, err := s.accounts.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "unable to load accounts")
+		return
+	}
+
+	for i := range accounts {
+		account := &accounts[i]
+		if uint64(account.ID) != id {
+			continue
+		}
+
+		password, err := s.decrypt(*account)
+		if errors.Is(err, ErrLocked) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "unable to decrypt password")
+			return
+		}
+
+		s.record(account, "get")
+		_ = s.accounts.MarkAccessed(account, time.Now())
+
+		result := newAccount(*account)
+		result.Password = password
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "account not found")
+}
+
+// newAccount returns the representation of the account with loaded service and password
+func newAccount(account models.Account) Account {
+	return Account{
+		ID:                account.ID,
+		Service:           account.Service.Name,
+		Login:             account.Login,
+		CreatedAt:         account.CreatedAt,
+		PasswordChangedAt: account.Password.UpdatedAt,
+		LastAccessedAt:    account.LastAccessedAt,
+		ExpiresAt:         account.ExpiresAt,
+		SSHPublicKey:      account.SSHPublicKey,
+	}
+}
+
+// writeJSON writes the value as the JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
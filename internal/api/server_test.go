@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const testToken = "token"
+
+// testServer is the server over the temporary storage, passwords of the "locked" logins are locked
+type testServer struct {
+	*Server
+	accounts map[string]models.Account
+	records  []string
+}
+
+// newTestServer returns the server of the accounts of bob and locked at github.com and amy at gitlab.com
+func newTestServer(t *testing.T, rateLimit int) *testServer {
+	t.Helper()
+	repo, err := storage.Open(storage.BackendFile, filepath.Join(t.TempDir(), "passtool.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{accounts: make(map[string]models.Account)}
+	for _, a := range [][2]string{{"github.com", "bob"}, {"github.com", "locked"}, {"gitlab.com", "amy"}} {
+		service, err := repo.Services().FetchOrCreate(a[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := models.Account{Login: a[1], Service: service, ServiceID: service.ID}
+		password := models.Password{Encrypted: "password of " + a[1], Salt: "salt"}
+		if err = repo.Accounts().SaveWithPassword(&account, &password); err != nil {
+			t.Fatal(err)
+		}
+		s.accounts[a[1]] = account
+	}
+
+	decrypt := func(account models.Account) (string, error) {
+		if account.Login == "locked" {
+			return "", ErrLocked
+		}
+		return account.Password.Encrypted, nil
+	}
+	record := func(account *models.Account, details string) {
+		if account != nil {
+			details += " " + account.Login
+		}
+		s.records = append(s.records, details)
+	}
+	s.Server = NewServer(repo.Accounts(), testToken, rateLimit, decrypt, record)
+
+	return s
+}
+
+// request makes the request with the token, no Authorization header is sent if it's empty
+func (s *testServer) request(method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+// decodeResponse decodes the JSON body of the response or fails the test
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("unable to decode response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	for name, header := range map[string]string{
+		"missing token": "",
+		"wrong token":   "Bearer wrong",
+		"other scheme":  "Basic " + testToken,
+		"token only":    testToken,
+	} {
+		r := httptest.NewRequest(http.MethodGet, accountsPath, nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: got status %d with headers %v, want %d with the challenge",
+				name, w.Code, w.Header(), http.StatusUnauthorized)
+		}
+	}
+
+	want := []string{"denied GET /v1/accounts", "denied GET /v1/accounts", "denied GET /v1/accounts",
+		"denied GET /v1/accounts"}
+	if !reflect.DeepEqual(s.records, want) {
+		t.Errorf("got records %q, want %q", s.records, want)
+	}
+
+	if w := s.request(http.MethodGet, accountsPath, testToken); w.Code != http.StatusOK {
+		t.Errorf("got status %d with the token, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestServerLimitsRequests(t *testing.T) {
+	s := newTestServer(t, 2)
+
+	// requests with invalid tokens don't use up the limit of the token
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if w := s.request(http.MethodGet, accountsPath, "wrong"); w.Code != want {
+			t.Errorf("got status %d of request %d with the wrong token, want %d", w.Code, i+1, want)
+		}
+	}
+	if len(s.records) != 2 {
+		t.Errorf("got records %q, want the limited request not recorded", s.records)
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := s.request(http.MethodGet, accountsPath, testToken)
+		if w.Code != want {
+			t.Errorf("got status %d of request %d with the token, want %d", w.Code, i+1, want)
+		}
+		if want == http.StatusTooManyRequests {
+			if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+				t.Errorf("got Retry-After %q, want seconds to wait", w.Header().Get("Retry-After"))
+			}
+		}
+	}
+}
+
+func TestServerListsAccounts(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{accountsPath, []string{"bob", "locked", "amy"}},
+		{accountsPath + "?service=GitHub.com", []string{"bob", "locked"}},
+		{accountsPath + "?service=github.com&login=bob", []string{"bob"}},
+		{searchPath + "?q=LAB", []string{"amy"}},
+		{searchPath + "?q=ob", []string{"bob"}},
+		{searchPath + "?q=unknown", []string{}},
+	}
+
+	for _, tt := range tests {
+		w := s.request(http.MethodGet, tt.target, testToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", tt.target, w.Code, http.StatusOK)
+		}
+
+		var accounts []Account
+		decodeResponse(t, w, &accounts)
+		logins := make([]string, 0, len(accounts))
+		for _, account := range accounts {
+			if account.Password != "" {
+				t.Errorf("%s: got password of %q listed, want metadata only", tt.target, account.Login)
+			}
+			logins = append(logins, account.Login)
+		}
+		if !reflect.DeepEqual(logins, tt.want) {
+			t.Errorf("%s: got accounts %q, want %q", tt.target, logins, tt.want)
+		}
+	}
+
+	if w := s.request(http.MethodGet, searchPath, testToken); w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d of search without query, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServerGetsAccount(t *testing.T) {
+	s := newTestServer(t, 0)
+	accountPath := func(login string) string {
+		return accountsPath + "/" + strconv.Itoa(int(s.accounts[login].ID))
+	}
+
+	w := s.request(http.MethodGet, accountPath("bob"), testToken)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("got status %d with headers %v, want %d not cached", w.Code, w.Header(), http.StatusOK)
+	}
+	var account Account
+	decodeResponse(t, w, &account)
+	if account.Login != "bob" || account.Service != "github.com" || account.Password != "password of bob" {
+		t.Errorf("got account %+v, want bob at github.com with the password", account)
+	}
+
+	// the password encrypted with another secret key stays locked
+	w = s.request(http.MethodGet, accountPath("locked"), testToken)
+	var failure errorResponse
+	decodeResponse(t, w, &failure)
+	if w.Code != http.StatusForbidden || failure.Error != ErrLocked.Error() {
+		t.Errorf("got status %d with %q for the locked password, want %d", w.Code, failure.Error, http.StatusForbidden)
+	}
+
+	for _, target := range []string{accountsPath + "/999", accountsPath + "/bob"} {
+		if w = s.request(http.MethodGet, target, testToken); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want %d", target, w.Code, http.StatusNotFound)
+		}
+	}
+	if w = s.request(http.MethodDelete, accountPath("bob"), testToken); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d of delete, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	if want := []string{"get bob"}; !reflect.DeepEqual(s.records, want) {
+		t.Errorf("got records %q, want %q", s.records, want)
+	}
+}
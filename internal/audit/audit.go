@@ -0,0 +1,263 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/lib/filelock"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+const (
+	lockTimeout   = 5 * time.Second
+	tailChunkSize = 4096
+)
+
+// ErrBrokenChain is returned when the audit log was modified after the entries were recorded
+var ErrBrokenChain = errors.New("audit log chain is broken")
+
+// Entry is a record of the audit log. Entries never contain secrets, service and login are omitted
+// when the storage is encrypted, the account is referenced by its ID then.
+type Entry struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	AccountID uint      `json:"account_id,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Login     string    `json:"login,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// computeHash returns the hash of the entry, which covers all the fields except the hash itself
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Filter selects entries of the audit log, zero fields match any entry
+type Filter struct {
+	Operation string
+	Service   string
+	Login     string
+	AccountID uint
+	Since     time.Time
+}
+
+// Match checks whether the entry satisfies the filter
+func (f Filter) Match(e Entry) bool {
+	return (f.Operation == "" || e.Operation == f.Operation) &&
+		(f.Service == "" || strings.EqualFold(e.Service, f.Service)) &&
+		(f.Login == "" || e.Login == f.Login) &&
+		(f.AccountID == 0 || e.AccountID == f.AccountID) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since))
+}
+
+// Log is the append-only audit log kept as a file of JSON lines,
+// each entry contains the hash of the previous one, so modified or removed entries are detected.
+// The hashes are not keyed, the chain detects accidental or partial edits, not the log rewritten as a whole.
+type Log struct {
+	path string
+	now  func() time.Time
+}
+
+// New returns the audit log kept in the file at the given path
+func New(path string) *Log {
+	return &Log{path: path, now: time.Now}
+}
+
+// Record appends the entry to the log, sequence number, time, user, host and hashes are set by the log
+func (l *Log) Record(e Entry) error {
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	last, err := l.last()
+	if err != nil {
+		return err
+	}
+
+	e.Seq = 1
+	if last != nil {
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+	}
+	e.Time = l.now().UTC()
+	e.User, e.Host = currentUser(), currentHost()
+
+	if e.Hash, err = e.computeHash(); err != nil {
+		return fmt.Errorf("unable to hash audit entry: %w", err)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("unable to serialize audit entry: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write audit log: %w", err)
+	}
+
+	return f.Sync()
+}
+
+// Entries returns the entries matching the filter in the order they were recorded
+func (l *Log) Entries(filter Filter) ([]Entry, error) {
+	var entries []Entry
+	err := l.scan(func(e Entry) error {
+		if filter.Match(e) {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+
+	return entries, err
+}
+
+// Verify checks the hash chain of the whole log, returns count of the verified entries.
+// Cutting off the latest entries can't be detected by the chain itself.
+func (l *Log) Verify() (int, error) {
+	count := 0
+	var prev *Entry
+	err := l.scan(func(e Entry) error {
+		hash, err := e.computeHash()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case hash != e.Hash:
+			return fmt.Errorf("%w: entry %d was modified", ErrBrokenChain, e.Seq)
+		case prev == nil && (e.Seq != 1 || e.PrevHash != ""):
+			return fmt.Errorf("%w: entries before %d were removed", ErrBrokenChain, e.Seq)
+		case prev != nil && (e.Seq != prev.Seq+1 || e.PrevHash != prev.Hash):
+			return fmt.Errorf("%w: entries between %d and %d were removed or modified", ErrBrokenChain, prev.Seq, e.Seq)
+		}
+
+		prev = &e
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// scan calls fn for each entry of the log
+func (l *Log) scan(fn func(e Entry) error) error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%w: line %d can't be parsed", ErrBrokenChain, line)
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// last returns the latest entry of the log reading the file from the end, nil if the log is empty
+func (l *Log) last() (*Entry, error) {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var tail []byte
+	for offset := info.Size(); offset > 0; {
+		size := int64(tailChunkSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		chunk := make([]byte, size)
+		if _, err = f.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("unable to read audit log: %w", err)
+		}
+		tail = append(chunk, tail...)
+
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 || offset == 0 {
+			var e Entry
+			if err = json.Unmarshal(trimmed[i+1:], &e); err != nil {
+				return nil, fmt.Errorf("%w: the latest entry can't be parsed", ErrBrokenChain)
+			}
+			return &e, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// lock takes the lock file, so entries recorded by concurrent processes keep the chain
+func (l *Log) lock() (func(), error) {
+	unlock, err := filelock.Lock(l.path+".lock", lockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock audit log: %w", err)
+	}
+
+	return unlock, nil
+}
+
+// currentUser returns the name of the OS user
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// currentHost returns the host name
+func currentHost() string {
+	host, _ := os.Hostname()
+	return host
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestLog returns the log in the temporary directory, each call of now advances the time by a minute
+func newTestLog(t *testing.T) *Log {
+	t.Helper()
+	l := New(filepath.Join(t.TempDir(), "passtool_audit.log"))
+
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	return l
+}
+
+// recordEntries records the entries of the operations or fails the test
+func recordEntries(t *testing.T, l *Log, operations ...string) {
+	t.Helper()
+	for _, operation := range operations {
+		if err := l.Record(Entry{Operation: operation, Service: "github.com", Login: "bob"}); err != nil {
+			t.Fatalf("unable to record %s: %v", operation, err)
+		}
+	}
+}
+
+func TestRecordChainsEntries(t *testing.T) {
+	l := newTestLog(t)
+	recordEntries(t, l, "add", "get", "del")
+
+	entries, err := l.Entries(Filter{})
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("got entries %v, %v, want 3 entries", entries, err)
+	}
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) || e.Hash == "" || e.User == "" || e.Time.IsZero() {
+			t.Errorf("got entry %+v, want sequence number %d, hash, user and time set", e, i+1)
+		}
+		if i > 0 && e.PrevHash != entries[i-1].Hash {
+			t.Errorf("got previous hash %q of entry %d, want %q", e.PrevHash, e.Seq, entries[i-1].Hash)
+		}
+	}
+	if entries[0].PrevHash != "" {
+		t.Errorf("got previous hash %q of the first entry, want none", entries[0].PrevHash)
+	}
+
+	count, err := l.Verify()
+	if err != nil || count != 3 {
+		t.Errorf("got %d verified entries, %v, want 3", count, err)
+	}
+
+	filtered, err := l.Entries(Filter{Operation: "get", Service: "GITHUB.COM"})
+	if err != nil || len(filtered) != 1 || filtered[0].Seq != 2 {
+		t.Errorf("got filtered entries %v, %v, want the get entry", filtered, err)
+	}
+}
+
+func TestVerifyOfMissingLog(t *testing.T) {
+	count, err := newTestLog(t).Verify()
+	if err != nil || count != 0 {
+		t.Errorf("got %d verified entries, %v, want none", count, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines [][]byte) [][]byte
+		want   string
+	}{
+		{
+			name: "modified entry",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte(`"get"`), []byte(`"set"`), 1)
+				return lines
+			},
+			want: "entry 2 was modified",
+		},
+		{
+			name: "removed entry",
+			tamper: func(lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			want: "entries between 1 and 3 were removed or modified",
+		},
+		{
+			name: "removed first entry",
+			tamper: func(lines [][]byte) [][]byte {
+				return lines[1:]
+			},
+			want: "entries before 2 were removed",
+		},
+		{
+			name: "swapped entries",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			want: "entries between 1 and 3 were removed or modified",
+		},
+		{
+			name: "unparsable line",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[2] = []byte("not json")
+				return lines
+			},
+			want: "line 3 can't be parsed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLog(t)
+			recordEntries(t, l, "add", "get", "del")
+
+			data, err := os.ReadFile(l.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := tt.tamper(bytes.Split(bytes.TrimSpace(data), []byte("\n")))
+			if err = os.WriteFile(l.path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = l.Verify()
+			if !errors.Is(err, ErrBrokenChain) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %v: %s", err, ErrBrokenChain, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordOfConcurrentLogsKeepsChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool_audit.log")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- New(path).Record(Entry{Operation: "get"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unable to record entry: %v", err)
+		}
+	}
+
+	count, err := New(path).Verify()
+	if err != nil || count != cap(errs) {
+		t.Errorf("got %d verified entries, %v, want %d", count, err, cap(errs))
+	}
+}
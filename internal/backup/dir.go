@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// dirTarget keeps backups in a local directory, e.g. on another disk
+type dirTarget struct {
+	dir string
+}
+
+// newDirTarget returns the target keeping backups in the given directory
+func newDirTarget(dir string) *dirTarget {
+	return &dirTarget{dir: dir}
+}
+
+// Name returns the directory path
+func (t *dirTarget) Name() string {
+	return t.dir
+}
+
+// Upload writes the backup blob to the directory
+func (t *dirTarget) Upload(name string, data []byte) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return fmt.Errorf("unable to create backup directory: %w", err)
+	}
+
+	return replaceFile(filepath.Join(t.dir, name), data)
+}
+
+// Download reads the backup blob from the directory
+func (t *dirTarget) Download(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(t.dir, name))
+}
+
+// List returns file names in the directory
+func (t *dirTarget) List() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// Delete removes the backup blob from the directory
+func (t *dirTarget) Delete(name string) error {
+	return os.Remove(filepath.Join(t.dir, name))
+}
@@ -0,0 +1,284 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	stateFileName = "passtool_backup_state.json"
+	namePattern   = "%v"
+)
+
+// Snapshotter writes a consistent copy of the storage, storage.Repository is the one
+type Snapshotter interface {
+	Backup(backupPath string) error
+}
+
+// Storage is the storage the backup is restored to, storage.Repository is the one
+type Storage interface {
+	Snapshotter
+	Close() error
+}
+
+// File is a backup file
+type File struct {
+	Path      string
+	CreatedAt time.Time
+	Size      int64
+}
+
+// Name returns the file name of the backup
+func (f File) Name() string {
+	return filepath.Base(f.Path)
+}
+
+// state is what the manager remembers between runs
+type state struct {
+	Changes    uint      `json:"changes"`
+	LastBackup time.Time `json:"last_backup"`
+}
+
+// Manager makes backups of the storage according to the policy and removes outdated ones
+type Manager struct {
+	dir      string
+	template string
+	policy   Policy
+	targets  []Target
+	keyPath  string
+	now      func() time.Time
+	sleep    func(d time.Duration)
+}
+
+// NewManager returns the manager keeping backups in dir, backup file names are made from template
+// by replacing %v with the backup time
+func NewManager(dir, template string, policy Policy) *Manager {
+	return &Manager{dir: dir, template: template, policy: policy, now: time.Now, sleep: time.Sleep}
+}
+
+// Policy returns the policy of the manager
+func (m *Manager) Policy() Policy {
+	return m.policy
+}
+
+// Changed records the change of the storage and makes the backup if it is due according to the policy,
+// returns the backup if it is made
+func (m *Manager) Changed(storage Snapshotter) (*File, error) {
+	st, err := m.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	st.Changes++
+	if !m.policy.IsDue(st.Changes, st.LastBackup, m.now()) {
+		return nil, m.saveState(st)
+	}
+
+	file, err := m.Create(storage)
+	if err != nil && file.Path == "" {
+		// the change is still remembered, so the backup is retried on the next change
+		_ = m.saveState(st)
+		return nil, err
+	}
+	if err != nil {
+		return &file, err
+	}
+
+	return &file, nil
+}
+
+// Create makes the backup regardless of the policy, uploads it to the targets and removes outdated backups
+func (m *Manager) Create(storage Snapshotter) (File, error) {
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return File{}, fmt.Errorf("unable to create backup directory: %w", err)
+	}
+
+	now := m.now()
+	createdAt := now.Unix()
+	path := filepath.Join(m.dir, fmt.Sprintf(m.template, createdAt))
+	// backups made within the same second get the following seconds, so none of them is overwritten
+	for fileExists(path) {
+		createdAt++
+		path = filepath.Join(m.dir, fmt.Sprintf(m.template, createdAt))
+	}
+	file := File{Path: path, CreatedAt: time.Unix(createdAt, 0)}
+
+	if err := storage.Backup(file.Path); err != nil {
+		return File{}, fmt.Errorf("unable to create backup: %w", err)
+	}
+
+	if info, err := os.Stat(file.Path); err == nil {
+		file.Size = info.Size()
+	}
+
+	if err := m.saveState(state{LastBackup: now}); err != nil {
+		return file, err
+	}
+
+	if _, err := m.Prune(); err != nil {
+		return file, err
+	}
+
+	if err := m.upload(file); err != nil {
+		return file, fmt.Errorf("backup %s is created, but %w", file.Name(), err)
+	}
+
+	return file, nil
+}
+
+// List returns the existing backups, the newest first
+func (m *Manager) List() ([]File, error) {
+	paths, err := filepath.Glob(filepath.Join(m.dir, fmt.Sprintf(m.template, "*")))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list backups: %w", err)
+	}
+
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+
+	files := m.parseNames(names)
+	for i := range files {
+		files[i].Path = filepath.Join(m.dir, files[i].Path)
+		info, err := os.Stat(files[i].Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list backups: %w", err)
+		}
+		files[i].Size = info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	return files, nil
+}
+
+// Prune removes the backups not kept by the retention rules of the policy, returns the removed ones
+func (m *Manager) Prune() ([]File, error) {
+	files, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	_, remove := m.policy.Retain(files, m.now())
+	for _, file := range remove {
+		if err = os.Remove(file.Path); err != nil {
+			return nil, fmt.Errorf("unable to remove outdated backup: %w", err)
+		}
+	}
+
+	return remove, nil
+}
+
+// Restore makes the safety backup of the current storage and replaces the storage file at storagePath
+// with the backup, the file is never left partially written. Returns the safety backup.
+// The current storage is closed before its file is replaced and must not be used after the restore.
+func (m *Manager) Restore(file File, storagePath string, current Storage) (File, error) {
+	// the backup is read before the safety one is made, which may remove it as outdated
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return File{}, fmt.Errorf("unable to read backup: %w", err)
+	}
+
+	safety, err := m.Create(current)
+	if err != nil {
+		return File{}, fmt.Errorf("unable to create safety backup: %w", err)
+	}
+
+	if err = current.Close(); err != nil {
+		return safety, fmt.Errorf("unable to close storage: %w", err)
+	}
+
+	return safety, replaceFile(storagePath, data)
+}
+
+// fileExists checks whether the file at the given path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// replaceFile replaces the file content, so the file is never left partially written
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to write temporary file: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to sync temporary file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temporary file: %w", err)
+	}
+
+	if err = os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to set file permissions: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace file: %w", err)
+	}
+
+	return nil
+}
+
+// loadState reads the state file, if it doesn't exist yet the newest backup is considered the last one
+func (m *Manager) loadState() (state, error) {
+	var st state
+	data, err := os.ReadFile(m.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		files, err := m.List()
+		if err == nil && len(files) > 0 {
+			st.LastBackup = files[0].CreatedAt
+		}
+		return st, err
+	}
+	if err != nil {
+		return st, fmt.Errorf("unable to read backup state: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("unable to parse backup state: %w", err)
+	}
+
+	return st, nil
+}
+
+// saveState writes the state file
+func (m *Manager) saveState(st state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("unable to serialize backup state: %w", err)
+	}
+
+	if err = os.MkdirAll(m.dir, 0700); err != nil {
+		return fmt.Errorf("unable to create backup directory: %w", err)
+	}
+
+	if err = os.WriteFile(m.statePath(), data, 0600); err != nil {
+		return fmt.Errorf("unable to write backup state: %w", err)
+	}
+
+	return nil
+}
+
+// statePath returns path to the state file
+func (m *Manager) statePath() string {
+	return filepath.Join(m.dir, stateFileName)
+}
@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// snapshotter writes the given content as the backup of the storage
+type snapshotter string
+
+func (s snapshotter) Backup(backupPath string) error {
+	return os.WriteFile(backupPath, []byte(s), 0600)
+}
+
+// closingStorage is the storage remembering whether it is closed
+type closingStorage struct {
+	snapshotter
+	closed bool
+}
+
+func (s *closingStorage) Close() error {
+	s.closed = true
+	return nil
+}
+
+// newTestManager returns the manager keeping backups in the temporary directory,
+// each call of now advances the time by a minute and the retries don't wait
+func newTestManager(t *testing.T, policy Policy, targets ...Target) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	m := NewManager(filepath.Join(dir, "backups"), "%v.passtool_backup.db", policy).
+		WithTargets(targets, filepath.Join(dir, "backup.key"))
+
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	m.sleep = func(time.Duration) {}
+
+	return m
+}
+
+func TestCreateWithoutRetentionRulesKeepsNewBackup(t *testing.T) {
+	target := newDirTarget(t.TempDir())
+	m := newTestManager(t, Policy{}, target)
+
+	for _, content := range []string{"first", "second"} {
+		file, err := m.Create(snapshotter(content))
+		if err != nil {
+			t.Fatalf("unable to create backup: %v", err)
+		}
+
+		data, err := os.ReadFile(file.Path)
+		if err != nil || string(data) != content {
+			t.Fatalf("got backup %q, %v, want %q", data, err, content)
+		}
+
+		files, err := m.List()
+		if err != nil || len(files) != 1 || files[0].Path != file.Path {
+			t.Errorf("got backups %v, %v, want the new backup only", files, err)
+		}
+
+		names, err := target.List()
+		if err != nil || len(names) != 1 || names[0] != file.Name() {
+			t.Errorf("got uploaded backups %q, %v, want the new backup only", names, err)
+		}
+	}
+}
+
+func TestCreatePrunesOutdatedBackups(t *testing.T) {
+	m := newTestManager(t, Policy{KeepLast: 2})
+
+	var created []File
+	for _, content := range []string{"first", "second", "third"} {
+		file, err := m.Create(snapshotter(content))
+		if err != nil {
+			t.Fatalf("unable to create backup: %v", err)
+		}
+		created = append(created, file)
+	}
+
+	files, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != created[2].Path || files[1].Path != created[1].Path {
+		t.Errorf("got backups %v, want the 2 newest ones", files)
+	}
+}
+
+func TestChangedMakesBackupAfterCountOfChanges(t *testing.T) {
+	// the backup directory doesn't exist before the first backup
+	m := newTestManager(t, Policy{Changes: 2})
+
+	for i, wantBackup := range []bool{false, true, false} {
+		file, err := m.Changed(snapshotter("content"))
+		if err != nil {
+			t.Fatalf("unable to record change %d: %v", i+1, err)
+		}
+		if (file != nil) != wantBackup {
+			t.Errorf("got backup %v after change %d, want backup %v", file, i+1, wantBackup)
+		}
+	}
+}
+
+func TestRestoreReplacesClosedStorage(t *testing.T) {
+	m := newTestManager(t, Policy{})
+	file, err := m.Create(snapshotter("backup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storagePath := filepath.Join(t.TempDir(), "passtool.db")
+	if err = os.WriteFile(storagePath, []byte("current"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	current := &closingStorage{snapshotter: "current"}
+	safety, err := m.Restore(file, storagePath, current)
+	if err != nil {
+		t.Fatalf("unable to restore backup: %v", err)
+	}
+
+	if !current.closed {
+		t.Error("the current storage is not closed before the restore")
+	}
+	if data, err := os.ReadFile(storagePath); err != nil || string(data) != "backup" {
+		t.Errorf("got storage %q, %v, want the backup content", data, err)
+	}
+	if data, err := os.ReadFile(safety.Path); err != nil || string(data) != "current" {
+		t.Errorf("got safety backup %q, %v, want the replaced storage content", data, err)
+	}
+}
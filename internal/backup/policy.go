@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"sort"
+	"time"
+)
+
+// Policy defines when backups are made and which of them are kept
+type Policy struct {
+	// Changes is the count of changes after which the backup is made, 0 disables the rule
+	Changes uint
+	// Interval is the time since the last backup after which any change causes the backup, 0 disables the rule
+	Interval time.Duration
+	// KeepLast is the count of the newest backups to keep
+	KeepLast uint
+	// KeepDaily is the count of the recent days to keep the newest backup of each
+	KeepDaily uint
+	// KeepWeekly is the count of the recent weeks to keep the newest backup of each
+	KeepWeekly uint
+}
+
+// IsDue checks whether the backup is due after the given count of changes made since the last backup
+func (p Policy) IsDue(changes uint, lastBackup, now time.Time) bool {
+	if changes == 0 {
+		return false
+	}
+
+	if p.Changes > 0 && changes >= p.Changes {
+		return true
+	}
+
+	return p.Interval > 0 && now.Sub(lastBackup) >= p.Interval
+}
+
+// Retain splits backups into the ones to keep and the ones to remove according to the retention rules,
+// a backup is kept if any of the rules keeps it. The newest backup is always kept, even if all the rules are disabled.
+func (p Policy) Retain(files []File, now time.Time) (keep, remove []File) {
+	sorted := append([]File(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	days := make(map[int]bool)
+	weeks := make(map[int]bool)
+	today := startOfDay(now)
+
+	for i, file := range sorted {
+		kept := i == 0 || uint(i) < p.KeepLast
+
+		day := daysBetween(startOfDay(file.CreatedAt), today)
+		if day >= 0 && uint(day) < p.KeepDaily && !days[day] {
+			days[day] = true
+			kept = true
+		}
+
+		week := daysBetween(startOfWeek(file.CreatedAt), startOfWeek(now)) / 7
+		if week >= 0 && uint(week) < p.KeepWeekly && !weeks[week] {
+			weeks[week] = true
+			kept = true
+		}
+
+		if kept {
+			keep = append(keep, file)
+		} else {
+			remove = append(remove, file)
+		}
+	}
+
+	return keep, remove
+}
+
+// startOfDay returns the calendar date of t in UTC, so the days are of equal length
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// startOfWeek returns the calendar date of monday of the week t belongs to
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// daysBetween returns count of days from one date to another
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// filesAt returns the backups made at the given times
+func filesAt(times ...time.Time) []File {
+	files := make([]File, 0, len(times))
+	for _, t := range times {
+		files = append(files, File{Path: t.Format(time.RFC3339), CreatedAt: t})
+	}
+
+	return files
+}
+
+func TestRetain(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	files := filesAt(now.Add(-time.Hour), now.Add(-2*time.Hour), now.Add(-day), now.Add(-2*day), now.Add(-10*day))
+
+	for name, test := range map[string]struct {
+		policy Policy
+		keep   int
+	}{
+		"last":             {Policy{KeepLast: 2}, 2},
+		"daily":            {Policy{KeepDaily: 2}, 2},
+		"weekly":           {Policy{KeepWeekly: 1}, 1},
+		"any rule":         {Policy{KeepLast: 1, KeepDaily: 3}, 3},
+		"more than exists": {Policy{KeepLast: 10}, 5},
+		"all rules are 0":  {Policy{}, 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			keep, remove := test.policy.Retain(files, now)
+			if len(keep) != test.keep || len(keep)+len(remove) != len(files) {
+				t.Fatalf("got %d kept and %d removed, want %d kept", len(keep), len(remove), test.keep)
+			}
+			if !reflect.DeepEqual(keep[0], files[0]) {
+				t.Errorf("got %v kept first, want the newest backup kept", keep[0])
+			}
+		})
+	}
+}
+
+func TestIsDue(t *testing.T) {
+	now := time.Now()
+	policy := Policy{Changes: 3, Interval: time.Hour}
+
+	for name, test := range map[string]struct {
+		changes    uint
+		lastBackup time.Time
+		want       bool
+	}{
+		"no changes":      {0, now.Add(-2 * time.Hour), false},
+		"few changes":     {2, now.Add(-time.Minute), false},
+		"enough changes":  {3, now.Add(-time.Minute), true},
+		"interval passed": {1, now.Add(-2 * time.Hour), true},
+		"never backed up": {1, time.Time{}, true},
+	} {
+		if got := policy.IsDue(test.changes, test.lastBackup, now); got != test.want {
+			t.Errorf("%s: got %v, want %v", name, got, test.want)
+		}
+	}
+}
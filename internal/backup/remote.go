@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	uploadAttempts = 3
+	retryDelay     = time.Second
+)
+
+// WithTargets sets targets each backup is uploaded to encrypted with the backup key kept at keyPath
+func (m *Manager) WithTargets(targets []Target, keyPath string) *Manager {
+	m.targets = targets
+	m.keyPath = keyPath
+	return m
+}
+
+// Targets returns the targets backups are uploaded to
+func (m *Manager) Targets() []Target {
+	return m.targets
+}
+
+// Key returns the backup key, creates it if it doesn't exist yet
+func (m *Manager) Key() ([]byte, error) {
+	return LoadKey(m.keyPath)
+}
+
+// ImportKey replaces the backup key, e.g. to fetch backups uploaded from another machine
+func (m *Manager) ImportKey(key []byte) error {
+	return SaveKey(m.keyPath, key)
+}
+
+// upload encrypts the backup and uploads it to all the targets, then removes outdated backups from them.
+// All the targets are tried even if some of them fail.
+func (m *Manager) upload(file File) error {
+	if len(m.targets) == 0 {
+		return nil
+	}
+
+	key, err := m.Key()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("unable to read backup: %w", err)
+	}
+
+	blob, err := encryptBlob(key, data)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, target := range m.targets {
+		err = m.retry(func() error {
+			return target.Upload(file.Name(), blob)
+		})
+		if err == nil {
+			err = m.pruneTarget(target)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to upload backup to %s: %w", target.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// pruneTarget removes the backups not kept by the retention rules of the policy from the target
+func (m *Manager) pruneTarget(target Target) error {
+	names, err := target.List()
+	if err != nil {
+		return err
+	}
+
+	_, remove := m.policy.Retain(m.parseNames(names), m.now())
+	for _, file := range remove {
+		if err = target.Delete(file.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fetch downloads the backups of the target which don't exist locally, returns the downloaded ones
+func (m *Manager) Fetch(target Target) ([]File, error) {
+	key, err := m.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := target.List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list backups of %s: %w", target.Name(), err)
+	}
+
+	if err = os.MkdirAll(m.dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create backup directory: %w", err)
+	}
+
+	var fetched []File
+	for _, remote := range m.parseNames(names) {
+		file := File{Path: filepath.Join(m.dir, remote.Path), CreatedAt: remote.CreatedAt}
+		if fileExists(file.Path) {
+			continue
+		}
+
+		var blob []byte
+		err = m.retry(func() (err error) {
+			blob, err = target.Download(remote.Path)
+			return err
+		})
+		if err != nil {
+			return fetched, fmt.Errorf("unable to download %s: %w", remote.Path, err)
+		}
+
+		data, err := decryptBlob(key, blob)
+		if err != nil {
+			return fetched, fmt.Errorf("unable to decrypt %s: %w", remote.Path, err)
+		}
+
+		if err = replaceFile(file.Path, data); err != nil {
+			return fetched, err
+		}
+
+		file.Size = int64(len(data))
+		fetched = append(fetched, file)
+	}
+
+	return fetched, nil
+}
+
+// parseNames returns backups with the given file names, other files are skipped.
+// Path of each backup is its file name.
+func (m *Manager) parseNames(names []string) []File {
+	prefix, suffix, _ := strings.Cut(m.template, namePattern)
+
+	var files []File
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		timestamp, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, File{Path: name, CreatedAt: time.Unix(timestamp, 0)})
+	}
+
+	return files
+}
+
+// retry calls fn until it succeeds or the attempts are over, the delay between attempts doubles each time
+func (m *Manager) retry(fn func() error) error {
+	delay := retryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt == uploadAttempts {
+			return err
+		}
+
+		m.sleep(delay)
+		delay *= 2
+	}
+}
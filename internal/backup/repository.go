@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"time"
+)
+
+// Repository decorates storage.Repository, so each change of the storage is recorded by the manager
+// and the backup is made when it is due
+type Repository struct {
+	storage.Repository
+	manager *Manager
+	warn    func(msg string, a ...interface{})
+}
+
+// NewRepository returns the repository recording changes with the given manager,
+// failed backups are reported with warn and don't fail the change itself
+func NewRepository(repo storage.Repository, manager *Manager, warn func(msg string, a ...interface{})) *Repository {
+	return &Repository{Repository: repo, manager: manager, warn: warn}
+}
+
+// Services returns the repository of services
+func (r *Repository) Services() storage.ServiceRepository {
+	return backedUpServices{ServiceRepository: r.Repository.Services(), r: r}
+}
+
+// Accounts returns the repository of accounts
+func (r *Repository) Accounts() storage.AccountRepository {
+	return backedUpAccounts{AccountRepository: r.Repository.Accounts(), r: r}
+}
+
+// Passwords returns the repository of passwords
+func (r *Repository) Passwords() storage.PasswordRepository {
+	return backedUpPasswords{PasswordRepository: r.Repository.Passwords(), r: r}
+}
+
+// Identities returns the repository of identities
+func (r *Repository) Identities() storage.IdentityRepository {
+	return backedUpIdentities{IdentityRepository: r.Repository.Identities(), r: r}
+}
+
+// Shares returns the repository of shares
+func (r *Repository) Shares() storage.ShareRepository {
+	return backedUpShares{ShareRepository: r.Repository.Shares(), r: r}
+}
+
+// changed records the change if it succeeded
+func (r *Repository) changed(err error) error {
+	if err != nil {
+		return err
+	}
+
+	if _, backupErr := r.manager.Changed(r.Repository); backupErr != nil {
+		r.warn("failed to handle backup: %v", backupErr)
+	}
+
+	return nil
+}
+
+type backedUpServices struct {
+	storage.ServiceRepository
+	r *Repository
+}
+
+// Delete deletes the service and records the change
+func (s backedUpServices) Delete(service models.Service) error {
+	return s.r.changed(s.ServiceRepository.Delete(service))
+}
+
+type backedUpAccounts struct {
+	storage.AccountRepository
+	r *Repository
+}
+
+// SaveWithPassword saves the account and records the change
+func (a backedUpAccounts) SaveWithPassword(account *models.Account, password *models.Password) error {
+	return a.r.changed(a.AccountRepository.SaveWithPassword(account, password))
+}
+
+// SaveAllWithPasswords saves the accounts and records the change
+func (a backedUpAccounts) SaveAllWithPasswords(accounts []models.Account, passwords []models.Password) error {
+	return a.r.changed(a.AccountRepository.SaveAllWithPasswords(accounts, passwords))
+}
+
+// DeleteWithPassword deletes the account and records the change
+func (a backedUpAccounts) DeleteWithPassword(account models.Account) error {
+	return a.r.changed(a.AccountRepository.DeleteWithPassword(account))
+}
+
+// SetExpiry sets the account expiry and records the change
+func (a backedUpAccounts) SetExpiry(account *models.Account, expiresAt *time.Time) error {
+	return a.r.changed(a.AccountRepository.SetExpiry(account, expiresAt))
+}
+
+// SavePassword saves the account password and records the change
+func (a backedUpAccounts) SavePassword(account *models.Account, expiresAt *time.Time) error {
+	return a.r.changed(a.AccountRepository.SavePassword(account, expiresAt))
+}
+
+// SetSSHPublicKey sets the account public key and records the change
+func (a backedUpAccounts) SetSSHPublicKey(account *models.Account, publicKey string) error {
+	return a.r.changed(a.AccountRepository.SetSSHPublicKey(account, publicKey))
+}
+
+// SetAttributes sets the account attributes and records the change
+func (a backedUpAccounts) SetAttributes(account *models.Account, attributes string) error {
+	return a.r.changed(a.AccountRepository.SetAttributes(account, attributes))
+}
+
+type backedUpPasswords struct {
+	storage.PasswordRepository
+	r *Repository
+}
+
+// Save saves the password and records the change
+func (p backedUpPasswords) Save(password *models.Password) error {
+	return p.r.changed(p.PasswordRepository.Save(password))
+}
+
+// SaveAll saves the passwords and records the change
+func (p backedUpPasswords) SaveAll(passwords []models.Password) error {
+	return p.r.changed(p.PasswordRepository.SaveAll(passwords))
+}
+
+type backedUpIdentities struct {
+	storage.IdentityRepository
+	r *Repository
+}
+
+// Create saves the identity and records the change
+func (i backedUpIdentities) Create(identity *models.Identity) error {
+	return i.r.changed(i.IdentityRepository.Create(identity))
+}
+
+// Delete deletes the identity and records the change
+func (i backedUpIdentities) Delete(identity models.Identity) error {
+	return i.r.changed(i.IdentityRepository.Delete(identity))
+}
+
+type backedUpShares struct {
+	storage.ShareRepository
+	r *Repository
+}
+
+// Replace replaces the account shares and records the change
+func (s backedUpShares) Replace(accountID uint, shares []models.Share) error {
+	return s.r.changed(s.ShareRepository.Replace(accountID, shares))
+}
@@ -0,0 +1,264 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultEndpoint = "https://s3.amazonaws.com"
+	s3DefaultRegion   = "us-east-1"
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+)
+
+// s3Target keeps backups in a bucket of an S3-compatible storage, e.g. AWS S3 or MinIO.
+// Requests are signed with AWS Signature Version 4 and use path-style URLs.
+type s3Target struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// newS3Target returns the target described by s3://[access:secret@]bucket/prefix?endpoint=URL&region=REGION,
+// credentials default to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables
+func newS3Target(u *url.URL, client *http.Client) (*s3Target, error) {
+	query := u.Query()
+	rawEndpoint := query.Get("endpoint")
+	if rawEndpoint == "" {
+		rawEndpoint = s3DefaultEndpoint
+	}
+
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	region := query.Get("region")
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	t := &s3Target{
+		endpoint:  endpoint,
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    region,
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		client:    client,
+		now:       time.Now,
+	}
+
+	if u.User != nil {
+		t.accessKey = u.User.Username()
+		t.secretKey, _ = u.User.Password()
+	}
+
+	if t.bucket == "" {
+		return nil, errors.New("S3 bucket is not specified")
+	}
+	if t.accessKey == "" || t.secretKey == "" {
+		return nil, errors.New("S3 credentials are not specified")
+	}
+
+	return t, nil
+}
+
+// Name returns the bucket URL
+func (t *s3Target) Name() string {
+	return fmt.Sprintf("s3://%s/%s (%s)", t.bucket, t.prefix, t.endpoint.String())
+}
+
+// Upload puts the backup blob to the bucket
+func (t *s3Target) Upload(name string, data []byte) error {
+	_, err := t.do(http.MethodPut, t.key(name), nil, data)
+	return err
+}
+
+// Download gets the backup blob from the bucket
+func (t *s3Target) Download(name string) ([]byte, error) {
+	return t.do(http.MethodGet, t.key(name), nil, nil)
+}
+
+// Delete removes the backup blob from the bucket
+func (t *s3Target) Delete(name string) error {
+	_, err := t.do(http.MethodDelete, t.key(name), nil, nil)
+	return err
+}
+
+// List returns file names of the objects under the prefix
+func (t *s3Target) List() ([]string, error) {
+	type listResult struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	prefix := ""
+	if t.prefix != "" {
+		prefix = t.prefix + "/"
+	}
+
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		body, err := t.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listResult
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("unable to parse S3 response: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, prefix)
+			if name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// key returns the object key of the backup
+func (t *s3Target) key(name string) string {
+	if t.prefix == "" {
+		return name
+	}
+
+	return t.prefix + "/" + name
+}
+
+// do sends the signed request for the object with the given key or for the bucket if the key is empty
+func (t *s3Target) do(method, key string, query url.Values, body []byte) ([]byte, error) {
+	u := *t.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = encodeQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	t.sign(req, body)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to send S3 request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read S3 response: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("S3 request %s %s failed: %s %s", method, key, resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	return respBody, nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request
+func (t *s3Target) sign(req *http.Request, body []byte) {
+	now := t.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, t.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	signingKey = hmacSHA256(signingKey, t.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, t.accessKey, scope, signedHeaders, signature))
+}
+
+// encodeQuery returns the query sorted by keys with values encoded the way Signature Version 4 requires
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode encodes everything except unreserved characters
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// sha256Hex returns hex encoded SHA256 of the data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns HMAC-SHA256 of the data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
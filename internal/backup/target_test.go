@@ -0,0 +1,378 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fileServer keeps the uploaded files in memory, it stands in for the remote storages in tests
+type fileServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	// failures is the count of the following requests answered with 503
+	failures int
+}
+
+// newFileServer starts the server with the given handler of fileServer requests
+func newFileServer(t *testing.T, handler func(fs *fileServer, w http.ResponseWriter, r *http.Request)) (*fileServer, *httptest.Server) {
+	fs := &fileServer{files: make(map[string][]byte)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+
+		if fs.failures > 0 {
+			fs.failures--
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+
+		handler(fs, w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return fs, srv
+}
+
+// failNext answers the following count of requests with 503
+func (fs *fileServer) failNext(count int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failures = count
+}
+
+// names returns the sorted names of the stored files
+func (fs *fileServer) names() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	names := make([]string, 0, len(fs.files))
+	for name := range fs.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// serveFile handles PUT, GET and DELETE of the file at the path
+func (fs *fileServer) serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		fs.files[path] = data
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		data, ok := fs.files[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		if _, ok := fs.files[path]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(fs.files, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+	}
+}
+
+// newWebDAVServer starts the WebDAV server with the /backups/ collection, basic auth of bob is required
+func newWebDAVServer(t *testing.T) (*fileServer, *httptest.Server) {
+	return newFileServer(t, func(fs *fileServer, w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "bob" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != "PROPFIND" {
+			fs.serveFile(w, r, r.URL.Path)
+			return
+		}
+
+		if r.Header.Get("Depth") != "1" {
+			http.Error(w, "depth is required", http.StatusBadRequest)
+			return
+		}
+
+		var body bytes.Buffer
+		body.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		body.WriteString(`<d:response><d:href>/backups/</d:href></d:response>`)
+		for path := range fs.files {
+			if strings.HasPrefix(path, r.URL.Path) {
+				fmt.Fprintf(&body, `<d:response><d:href>%s</d:href></d:response>`, (&url.URL{Path: path}).EscapedPath())
+			}
+		}
+		body.WriteString(`</d:multistatus>`)
+
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write(body.Bytes())
+	})
+}
+
+// newS3Server starts the S3 server with the bucket, requests must be signed with the access key,
+// listing returns one object per page
+func newS3Server(t *testing.T) (*fileServer, *httptest.Server) {
+	return newFileServer(t, func(fs *fileServer, w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, s3Algorithm+" Credential=access/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+			http.Error(w, "unauthorized", http.StatusForbidden)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if r.Header.Get("x-amz-content-sha256") != sha256Hex(body) {
+			http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+			return
+		}
+
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if bucket != "bucket" {
+			http.NotFound(w, r)
+			return
+		}
+		if key != "" {
+			fs.serveFile(w, r, key)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("list-type") != "2" {
+			http.Error(w, "unexpected listing", http.StatusBadRequest)
+			return
+		}
+
+		var keys []string
+		for key := range fs.files {
+			if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		type object struct {
+			Key string `xml:"Key"`
+		}
+		result := struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			Contents              []object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+		}{}
+		if len(keys) > 0 {
+			result.Contents = []object{{Key: keys[0]}}
+			result.IsTruncated = len(keys) > 1
+			result.NextContinuationToken = keys[0]
+		}
+
+		_ = xml.NewEncoder(w).Encode(result)
+	})
+}
+
+// assertTargetRoundTrip uploads, lists, downloads and deletes backups through the target
+func assertTargetRoundTrip(t *testing.T, target Target) {
+	t.Helper()
+	for _, name := range []string{"1.passtool_backup.db", "2.passtool_backup.db", "3.passtool_backup.db"} {
+		if err := target.Upload(name, []byte("blob of "+name)); err != nil {
+			t.Fatalf("unable to upload %s: %v", name, err)
+		}
+	}
+
+	names, err := target.List()
+	if err != nil {
+		t.Fatalf("unable to list backups: %v", err)
+	}
+	sort.Strings(names)
+	if want := []string{"1.passtool_backup.db", "2.passtool_backup.db", "3.passtool_backup.db"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got backups %q, want %q", names, want)
+	}
+
+	data, err := target.Download("2.passtool_backup.db")
+	if err != nil || string(data) != "blob of 2.passtool_backup.db" {
+		t.Errorf("got %q, %v downloading the backup, want its blob", data, err)
+	}
+
+	if err = target.Delete("2.passtool_backup.db"); err != nil {
+		t.Fatalf("unable to delete backup: %v", err)
+	}
+	if _, err = target.Download("2.passtool_backup.db"); err == nil {
+		t.Error("got the deleted backup downloaded, want an error")
+	}
+}
+
+func TestWebDAVTarget(t *testing.T) {
+	fs, srv := newWebDAVServer(t)
+	target, err := ParseTarget(strings.Replace(srv.URL, "http://", "webdav://bob:secret@", 1) + "/backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(target.Name(), "secret") {
+		t.Errorf("got target name %q, want the password redacted", target.Name())
+	}
+
+	assertTargetRoundTrip(t, target)
+	if want := []string{"/backups/1.passtool_backup.db", "/backups/3.passtool_backup.db"}; !reflect.DeepEqual(fs.names(), want) {
+		t.Errorf("got files %q on the server, want %q", fs.names(), want)
+	}
+
+	unauthorized, _ := ParseTarget(strings.Replace(srv.URL, "http://", "webdav://bob:wrong@", 1) + "/backups")
+	if err = unauthorized.Upload("4.passtool_backup.db", []byte("blob")); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v with the wrong password, want the request failed", err)
+	}
+}
+
+func TestS3Target(t *testing.T) {
+	fs, srv := newS3Server(t)
+	target, err := ParseTarget("s3://access:secret@bucket/passtool/?region=eu-west-1&endpoint=" + url.QueryEscape(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertTargetRoundTrip(t, target)
+	if want := []string{"passtool/1.passtool_backup.db", "passtool/3.passtool_backup.db"}; !reflect.DeepEqual(fs.names(), want) {
+		t.Errorf("got objects %q in the bucket, want %q", fs.names(), want)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err = ParseTarget("s3://bucket/passtool?endpoint=" + url.QueryEscape(srv.URL)); err == nil {
+		t.Error("got the target without credentials, want an error")
+	}
+}
+
+func TestS3TargetCredentialsFromEnvironment(t *testing.T) {
+	_, srv := newS3Server(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "access")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	target, err := ParseTarget("s3://bucket?region=eu-west-1&endpoint=" + url.QueryEscape(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = target.Upload("1.passtool_backup.db", []byte("blob")); err != nil {
+		t.Errorf("unable to upload with the credentials of the environment: %v", err)
+	}
+}
+
+func TestUploadIsRetried(t *testing.T) {
+	fs, srv := newWebDAVServer(t)
+	target, err := ParseTarget(strings.Replace(srv.URL, "http://", "webdav://bob:secret@", 1) + "/backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestManager(t, Policy{KeepLast: 5}, target)
+	var delays []time.Duration
+	m.sleep = func(d time.Duration) {
+		delays = append(delays, d)
+	}
+
+	fs.failNext(uploadAttempts - 1)
+	file, err := m.Create(snapshotter("storage"))
+	if err != nil {
+		t.Fatalf("got %v, want the upload succeeded on the last attempt", err)
+	}
+	if want := []time.Duration{retryDelay, 2 * retryDelay}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("got delays %v between attempts, want %v", delays, want)
+	}
+	if want := []string{"/backups/" + file.Name()}; !reflect.DeepEqual(fs.names(), want) {
+		t.Errorf("got files %q on the server, want %q", fs.names(), want)
+	}
+
+	fs.failNext(uploadAttempts)
+	file, err = m.Create(snapshotter("storage"))
+	if err == nil || !strings.Contains(err.Error(), "is created, but unable to upload backup to") {
+		t.Errorf("got %v, want the upload failed after all the attempts", err)
+	}
+	if _, statErr := os.Stat(file.Path); statErr != nil {
+		t.Errorf("got the local backup removed after the failed upload: %v", statErr)
+	}
+}
+
+func TestFetchDecryptsUploadedBackups(t *testing.T) {
+	_, srv := newWebDAVServer(t)
+	target, err := ParseTarget(strings.Replace(srv.URL, "http://", "webdav://bob:secret@", 1) + "/backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploader := newTestManager(t, Policy{KeepLast: 5}, target)
+	created, err := uploader.Create(snapshotter("storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := uploader.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := newTestManager(t, Policy{KeepLast: 5}, target)
+	if _, err = fetcher.Fetch(target); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v fetching with another backup key, want ErrInvalidKey", err)
+	}
+
+	if err = fetcher.ImportKey(key); err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := fetcher.Fetch(target)
+	if err != nil {
+		t.Fatalf("unable to fetch backups: %v", err)
+	}
+	if len(fetched) != 1 || fetched[0].Name() != created.Name() {
+		t.Fatalf("got fetched %v, want the uploaded backup", fetched)
+	}
+	if data, err := os.ReadFile(fetched[0].Path); err != nil || string(data) != "storage" {
+		t.Errorf("got fetched backup %q, %v, want the decrypted one", data, err)
+	}
+}
+
+func TestBlobRoundTrip(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := encryptBlob(key, []byte("storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob, []byte("storage")) {
+		t.Error("got the backup content in the blob, want it encrypted")
+	}
+
+	data, err := decryptBlob(key, blob)
+	if err != nil || string(data) != "storage" {
+		t.Errorf("got %q, %v, want the decrypted backup", data, err)
+	}
+
+	other, _ := NewKey()
+	if _, err = decryptBlob(other, blob); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v with another key, want ErrInvalidKey", err)
+	}
+	if _, err = decryptBlob(key, blob[1:]); err == nil || errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v for the blob without the header, want the corrupted blob error", err)
+	}
+
+	decoded, err := DecodeKey(EncodeKey(key))
+	if err != nil || !bytes.Equal(decoded, key) {
+		t.Errorf("got key %x, %v after encoding, want %x", decoded, err, key)
+	}
+}
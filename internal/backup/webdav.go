@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// webDAVTarget keeps backups in a collection of a WebDAV server, the collection must exist
+type webDAVTarget struct {
+	base     *url.URL
+	user     string
+	password string
+	client   *http.Client
+}
+
+// newWebDAVTarget returns the target described by webdav://[user:password@]host/path, webdavs uses https
+func newWebDAVTarget(u *url.URL, client *http.Client) *webDAVTarget {
+	base := *u
+	base.Scheme = "http"
+	if u.Scheme == "webdavs" {
+		base.Scheme = "https"
+	}
+	base.User = nil
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/"
+
+	t := &webDAVTarget{base: &base, client: client}
+	if u.User != nil {
+		t.user = u.User.Username()
+		t.password, _ = u.User.Password()
+	}
+
+	return t
+}
+
+// Name returns the collection URL
+func (t *webDAVTarget) Name() string {
+	return redacted(t.base)
+}
+
+// Upload puts the backup blob to the collection
+func (t *webDAVTarget) Upload(name string, data []byte) error {
+	_, err := t.do(http.MethodPut, name, nil, data)
+	return err
+}
+
+// Download gets the backup blob from the collection
+func (t *webDAVTarget) Download(name string) ([]byte, error) {
+	return t.do(http.MethodGet, name, nil, nil)
+}
+
+// Delete removes the backup blob from the collection
+func (t *webDAVTarget) Delete(name string) error {
+	_, err := t.do(http.MethodDelete, name, nil, nil)
+	return err
+}
+
+// List returns file names in the collection
+func (t *webDAVTarget) List() ([]string, error) {
+	type multistatus struct {
+		Responses []struct {
+			Href string `xml:"href"`
+		} `xml:"response"`
+	}
+
+	body := []byte(`<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`)
+	resp, err := t.do("PROPFIND", "", http.Header{"Depth": {"1"}, "Content-Type": {"application/xml"}}, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result multistatus
+	if err = xml.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("unable to parse WebDAV response: %w", err)
+	}
+
+	var names []string
+	for _, r := range result.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil || strings.HasSuffix(href, "/") {
+			continue
+		}
+		names = append(names, path.Base(href))
+	}
+
+	return names, nil
+}
+
+// do sends the request for the file with the given name or for the collection if the name is empty
+func (t *webDAVTarget) do(method, name string, header http.Header, body []byte) ([]byte, error) {
+	u := *t.base
+	u.Path += name
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if t.user != "" {
+		req.SetBasicAuth(t.user, t.password)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to send WebDAV request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read WebDAV response: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("WebDAV request %s %s failed: %s", method, name, resp.Status)
+	}
+
+	return respBody, nil
+}
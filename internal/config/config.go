@@ -3,15 +3,29 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type Config struct {
+	Vault                  string
 	BasePath               string
+	StorageBackend         string
 	StoragePath            string
+	SyncPath               string
+	BackupPath             string
+	BackupKeyPath          string
+	BackupTargets          []string
 	BackupFilenameTemplate string
+	AuditLogPath           string
+	RotationPath           string
+	RotationPeriod         time.Duration
+	AskPassProgram         string
 	BackupIndex            uint
+	BackupInterval         time.Duration
 	BackupCountToStore     uint
+	BackupKeepDaily        uint
+	BackupKeepWeekly       uint
 	SecretKeyLength        int
 	MinPasswordLength      int
 	MaxPasswordLength      int
@@ -52,17 +66,6 @@ func (c Config) GetOptionalEnvVars() []EnvVar {
 	return c.filterVars(false)
 }
 
-// GetBackupFilePath returns path to directory where backups are stored
-func (c Config) GetBackupFilePath() string {
-	fileName := fmt.Sprintf(c.BackupFilenameTemplate, time.Now().Unix())
-	return filepath.Join(c.BasePath, fileName)
-}
-
-// GetBackupFilePathMask returns generic mask for backup file name
-func (c Config) GetBackupFilePathMask() string {
-	return filepath.Join(c.BasePath, fmt.Sprintf(c.BackupFilenameTemplate, "*"))
-}
-
 type GeneratorSettings struct {
 	Length      int
 	NumDigits   int
@@ -96,21 +99,110 @@ func (gs GeneratorSettings) GetAllowRepeat() bool {
 	return gs.AllowRepeat
 }
 
+// Overrides replace the environment for a single run, zero fields keep the environment values
+type Overrides struct {
+	// StorageDir is used instead of the storage directory variable
+	StorageDir string
+	// Vault is the name of the vault kept in the vaults directory of the storage, the default vault is used if empty
+	Vault string
+}
+
 // Load creates and returns pointer to Config
-func Load() *Config {
-	environment.loadVars()
-	storageDir := environment.getStorage()
-	return &Config{
+func Load() (*Config, error) {
+	return LoadWithOverrides(Overrides{})
+}
+
+// LoadWithOverrides creates and returns pointer to Config of the environment with the given overrides.
+// Named vaults have their own storage, sync repository and backups, their names can't be paths.
+func LoadWithOverrides(overrides Overrides) (*Config, error) {
+	if name := overrides.Vault; name != "" && (name != filepath.Base(name) || name == "." || name == "..") {
+		return nil, fmt.Errorf("invalid vault name %q", name)
+	}
+
+	env := environment.loadVars()
+	if overrides.StorageDir != "" {
+		env.storage.Value = overrides.StorageDir
+	}
+	return newConfig(env, overrides.Vault)
+}
+
+// Variables returns the environment variables the config is loaded from with their current values
+func Variables() []EnvVar {
+	return environment.loadVars().getVars()
+}
+
+// newConfig returns pointer to Config of the given vault of the loaded environment,
+// it fails if values of the variables can't be parsed
+func newConfig(env *Environment, vault string) (*Config, error) {
+	storageDir := env.getStorage()
+	backend := env.getStorageBackend()
+
+	fileName, backupTemplate := storageFileName, storageBackupFileNameTemplate
+	if backend == fileBackend {
+		fileName, backupTemplate = vaultFileName, vaultBackupFileNameTemplate
+	}
+
+	syncPath := env.getSyncPath()
+	backupPath := env.getBackupPath()
+	if vault != "" && storageDir != "" {
+		storageDir = filepath.Join(storageDir, vaultsDirName, vault)
+		// backup targets are shared by the vaults, so backup names are made different,
+		// while sync repositories can't be nested
+		ext := filepath.Ext(backupTemplate)
+		backupTemplate = strings.TrimSuffix(backupTemplate, ext) + "." + vault + ext
+		if backupPath != "" {
+			backupPath = filepath.Join(backupPath, vaultsDirName, vault)
+		}
+		if syncPath != "" {
+			syncPath += "-" + vault
+		}
+	}
+
+	if syncPath == "" {
+		syncPath = filepath.Join(storageDir, syncDirName)
+	}
+
+	if backupPath == "" {
+		backupPath = storageDir
+	}
+
+	backupInterval, err := env.getBackupInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	// the first error of parsing the numeric variables is kept
+	number := func(value uint, parseErr error) uint {
+		if err == nil {
+			err = parseErr
+		}
+		return value
+	}
+
+	cfg := &Config{
+		Vault:                  vault,
 		BasePath:               storageDir,
-		StoragePath:            filepath.Join(storageDir, storageFileName),
-		BackupFilenameTemplate: storageBackupFileNameTemplate,
-		BackupIndex:            environment.getBackupIndex(),
-		BackupCountToStore:     environment.getBackupCount(),
+		StorageBackend:         backend,
+		StoragePath:            filepath.Join(storageDir, fileName),
+		SyncPath:               syncPath,
+		BackupPath:             backupPath,
+		BackupKeyPath:          filepath.Join(storageDir, backupKeyFileName),
+		BackupTargets:          env.getBackupTargets(),
+		BackupFilenameTemplate: backupTemplate,
+		AuditLogPath:           filepath.Join(storageDir, auditLogFileName),
+		RotationPath:           filepath.Join(storageDir, rotationFileName),
+		RotationPeriod:         time.Duration(number(env.getRotationDays())) * 24 * time.Hour,
+		AskPassProgram:         env.getAskPass(),
+		BackupIndex:            number(env.getBackupIndex()),
+		BackupInterval:         backupInterval,
+		BackupCountToStore:     number(env.getBackupCount()),
+		BackupKeepDaily:        number(env.getBackupKeepDaily()),
+		BackupKeepWeekly:       number(env.getBackupKeepWeekly()),
 		SecretKeyLength:        32,
 		MinPasswordLength:      6,
 		MaxPasswordLength:      100,
 		PasswordSettings: GeneratorSettings{
-			Length:      int(environment.getDefaultPasswordLength()),
+			Length:      int(number(env.getDefaultPasswordLength())),
 			NumDigits:   4,
 			NumSymbols:  4,
 			NoUpper:     false,
@@ -123,6 +215,11 @@ func Load() *Config {
 			NoUpper:     false,
 			AllowRepeat: false,
 		},
-		EnvVariables: environment.getVars(),
+		EnvVariables: env.getVars(),
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
@@ -8,13 +8,37 @@ const (
 	backupIndexEnv           = "PASSTOOL_BACKUP_INDEX"
 	backupCountEnv           = "PASSTOOL_BACKUP_COUNT"
 	defaultPasswordLengthEnv = "PASSTOOL_DEFAULT_PASSWORD_LENGTH"
+	storageBackendEnv        = "PASSTOOL_STORAGE_BACKEND"
+	syncPathEnv              = "PASSTOOL_SYNC_PATH"
+	backupIntervalEnv        = "PASSTOOL_BACKUP_INTERVAL"
+	backupKeepDailyEnv       = "PASSTOOL_BACKUP_KEEP_DAILY"
+	backupKeepWeeklyEnv      = "PASSTOOL_BACKUP_KEEP_WEEKLY"
+	backupPathEnv            = "PASSTOOL_BACKUP_PATH"
+	backupTargetsEnv         = "PASSTOOL_BACKUP_TARGETS"
+	rotationDaysEnv          = "PASSTOOL_ROTATION_DAYS"
+	askPassEnv               = "PASSTOOL_ASKPASS"
 
 	// Defaults
 	defaultBackupIndex    = 5
 	defaultBackupCount    = 5
 	defaultPasswordLength = 12
+	defaultStorageBackend = sqliteBackend
+	defaultBackupInterval = "24h"
+	defaultBackupDaily    = 7
+	defaultBackupWeekly   = 4
 
 	//Other
 	storageFileName               = "passtool_storage.db"
 	storageBackupFileNameTemplate = "%v.passtool_backup.db"
+	vaultFileName                 = "passtool_vault.json"
+	vaultBackupFileNameTemplate   = "%v.passtool_backup.json"
+	syncDirName                   = "sync"
+	vaultsDirName                 = "vaults"
+	backupKeyFileName             = "passtool_backup.key"
+	auditLogFileName              = "passtool_audit.log"
+	rotationFileName              = "passtool_rotation.json"
+
+	// Storage backends
+	sqliteBackend = "sqlite"
+	fileBackend   = "file"
 )
@@ -3,6 +3,7 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -16,6 +17,21 @@ func DeriveKey(passphrase, salt string, keyLen int) string {
 	return string(pbkdf2.Key([]byte(passphrase), []byte(salt), 10000, keyLen, sha256.New))
 }
 
+// verificationMessage is authenticated with the key to get its verification tag
+const verificationMessage = "passtool secret verification"
+
+// VerificationTag returns the tag which allows to check the key without decrypting anything
+func VerificationTag(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(verificationMessage))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckVerificationTag checks whether the tag was created from the given key
+func CheckVerificationTag(key, tag string) bool {
+	return hmac.Equal([]byte(VerificationTag(key)), []byte(tag))
+}
+
 // Encrypt encrypts the given text with the given key
 func Encrypt(key, text string) (string, error) {
 	block, err := aes.NewCipher([]byte(key))
@@ -60,3 +76,53 @@ func Decrypt(key, cryptoText string) (string, error) {
 	result, err := base64.StdEncoding.DecodeString(string(ciphertext))
 	return string(result), err
 }
+
+// EncryptBytes encrypts the given data with the given key using AES-GCM, the nonce is prepended to the result
+func EncryptBytes(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// DecryptBytes decrypts the data encrypted by EncryptBytes with the given key
+func DecryptBytes(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// RandomBytes returns n cryptographically secure random bytes
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// newGCM returns AES-GCM cipher for the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
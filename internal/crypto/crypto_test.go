@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// newKey returns the random key of the given length or fails the test
+func newKey(t *testing.T, n int) []byte {
+	t.Helper()
+	key, err := RandomBytes(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestEncryptBytesRoundTrip(t *testing.T) {
+	for _, keyLen := range []int{16, 24, 32} {
+		key := newKey(t, keyLen)
+		for _, data := range [][]byte{{}, []byte("password"), bytes.Repeat([]byte("data"), 1000)} {
+			encrypted, err := EncryptBytes(key, data)
+			if err != nil {
+				t.Fatalf("unable to encrypt %d bytes with %d byte key: %v", len(data), keyLen, err)
+			}
+			if len(data) > 0 && bytes.Contains(encrypted, data) {
+				t.Errorf("got the data in plain form in the encrypted one")
+			}
+
+			decrypted, err := DecryptBytes(key, encrypted)
+			if err != nil || !bytes.Equal(decrypted, data) {
+				t.Errorf("got %d bytes, %v after decryption, want the %d bytes encrypted", len(decrypted), err, len(data))
+			}
+		}
+	}
+
+	// the nonce is random, so the same data is encrypted differently
+	key := newKey(t, 32)
+	first, _ := EncryptBytes(key, []byte("password"))
+	second, _ := EncryptBytes(key, []byte("password"))
+	if bytes.Equal(first, second) {
+		t.Error("got the same ciphertext for two encryptions")
+	}
+}
+
+func TestDecryptBytesRejectsWrongKeyAndChanges(t *testing.T) {
+	key := newKey(t, 32)
+	encrypted, err := EncryptBytes(key, []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = DecryptBytes(newKey(t, 32), encrypted); err == nil {
+		t.Error("got the data decrypted with the wrong key")
+	}
+
+	changed := append([]byte{}, encrypted...)
+	changed[len(changed)-1] ^= 1
+	if _, err = DecryptBytes(key, changed); err == nil {
+		t.Error("got the changed data decrypted")
+	}
+
+	if _, err = DecryptBytes(key, encrypted[:5]); err == nil {
+		t.Error("got the truncated data decrypted")
+	}
+	if _, err = EncryptBytes(newKey(t, 10), []byte("password")); err == nil {
+		t.Error("got the data encrypted with the key of invalid length")
+	}
+}
+
+func TestVerificationTag(t *testing.T) {
+	key := DeriveKey("secret", "salt", 32)
+	tag := VerificationTag(key)
+
+	if tag != VerificationTag(key) {
+		t.Error("got different tags of the same key, want the tag to be stable")
+	}
+	if !CheckVerificationTag(key, tag) {
+		t.Error("got the tag of the key rejected")
+	}
+
+	tests := map[string]string{
+		"other secret": DeriveKey("other secret", "salt", 32),
+		"other salt":   DeriveKey("secret", "other salt", 32),
+		"shorter key":  DeriveKey("secret", "salt", 16),
+	}
+	for name, other := range tests {
+		if CheckVerificationTag(other, tag) {
+			t.Errorf("got the tag accepted for the key of %s", name)
+		}
+	}
+
+	for _, changed := range []string{"", tag[:len(tag)-1], "A" + tag[1:]} {
+		if changed != tag && CheckVerificationTag(key, changed) {
+			t.Errorf("got changed tag %q accepted", changed)
+		}
+	}
+}
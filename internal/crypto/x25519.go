@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+const wrapInfo = "passtool key wrap v1"
+
+// GenerateKeyPair generates X25519 key pair
+func GenerateKeyPair() (publicKey, privateKey []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key.PublicKey().Bytes(), key.Bytes(), nil
+}
+
+// PublicKeyOf returns X25519 public key of the given private key
+func PublicKeyOf(privateKey []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.PublicKey().Bytes(), nil
+}
+
+// WrapKey encrypts the data key for the owner of the given X25519 public key.
+// The result is the ephemeral public key followed by the encrypted data key.
+func WrapKey(publicKey, dataKey []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	wrapKey, err := deriveWrapKey(shared, ephemeralPublic, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := EncryptBytes(wrapKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ephemeralPublic, encrypted...), nil
+}
+
+// UnwrapKey decrypts the data key wrapped by WrapKey with the given X25519 private key
+func UnwrapKey(privateKey, wrapped []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyLength := len(key.PublicKey().Bytes())
+	if len(wrapped) < publicKeyLength {
+		return nil, errors.New("wrapped key too short")
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(wrapped[:publicKeyLength])
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapKey, err := deriveWrapKey(shared, wrapped[:publicKeyLength], key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return DecryptBytes(wrapKey, wrapped[publicKeyLength:])
+}
+
+// deriveWrapKey derives AES key from X25519 shared secret bound to both public keys
+func deriveWrapKey(shared, ephemeralPublic, recipientPublic []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(wrapInfo)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// newKeyPair generates the key pair or fails the test
+func newKeyPair(t *testing.T) (publicKey, privateKey []byte) {
+	t.Helper()
+	publicKey, privateKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return publicKey, privateKey
+}
+
+func TestWrapKeyRoundTrip(t *testing.T) {
+	publicKey, privateKey := newKeyPair(t)
+	if got, err := PublicKeyOf(privateKey); err != nil || !bytes.Equal(got, publicKey) {
+		t.Errorf("got public key %x, %v, want %x", got, err, publicKey)
+	}
+
+	dataKey := newKey(t, 32)
+	wrapped, err := WrapKey(publicKey, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("got the data key in plain form in the wrapped one")
+	}
+
+	unwrapped, err := UnwrapKey(privateKey, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("got %x, %v, want the wrapped data key", unwrapped, err)
+	}
+
+	// the ephemeral key is new for each wrap
+	if again, _ := WrapKey(publicKey, dataKey); bytes.Equal(again, wrapped) {
+		t.Error("got the same wrapped key twice")
+	}
+}
+
+func TestUnwrapKeyRejectsWrongKeyAndChanges(t *testing.T) {
+	publicKey, privateKey := newKeyPair(t)
+	wrapped, err := WrapKey(publicKey, newKey(t, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherPrivate := newKeyPair(t)
+	if _, err = UnwrapKey(otherPrivate, wrapped); err == nil {
+		t.Error("got the data key unwrapped with the private key of another recipient")
+	}
+
+	changed := append([]byte{}, wrapped...)
+	changed[0] ^= 1
+	if _, err = UnwrapKey(privateKey, changed); err == nil {
+		t.Error("got the data key unwrapped with the changed ephemeral key")
+	}
+
+	if _, err = UnwrapKey(privateKey, wrapped[:16]); err == nil {
+		t.Error("got the truncated wrapped key unwrapped")
+	}
+	if _, err = WrapKey([]byte("short"), newKey(t, 32)); err == nil {
+		t.Error("got the data key wrapped for the invalid public key")
+	}
+}
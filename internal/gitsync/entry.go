@@ -0,0 +1,125 @@
+package gitsync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/crypto"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"strings"
+)
+
+const (
+	passwordField     = "password"
+	sshPublicKeyField = "ssh_public_key"
+	attributesField   = "attributes"
+	entryIDLength     = 40
+)
+
+// Entry is the representation of an account in the sync repository.
+// Service and Login identify the entry, Fields are merged independently of each other.
+type Entry struct {
+	Service string            `json:"service"`
+	Login   string            `json:"login"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// newEntry creates the entry from the account with loaded password
+func newEntry(serviceName string, account models.Account) Entry {
+	e := Entry{
+		Service: serviceName,
+		Login:   account.Login,
+		Fields: map[string]string{
+			passwordField: encodePassword(account.Password),
+		},
+	}
+
+	if account.SSHPublicKey != "" {
+		e.Fields[sshPublicKeyField] = account.SSHPublicKey
+	}
+	if account.Attributes != "" {
+		e.Fields[attributesField] = account.Attributes
+	}
+
+	return e
+}
+
+// encodePassword returns the password field value, the verification tag is appended only if there is one,
+// so entries of passwords saved without it are left unchanged
+func encodePassword(password models.Password) string {
+	value := password.Salt + "\n" + password.Encrypted
+	if password.Verifier != "" {
+		value += "\n" + password.Verifier
+	}
+
+	return value
+}
+
+// password returns the encrypted password, its salt and verification tag stored in the entry
+func (e Entry) password() (encrypted, salt, verifier string) {
+	salt, rest, _ := strings.Cut(e.Fields[passwordField], "\n")
+	encrypted, verifier, _ = strings.Cut(rest, "\n")
+	return encrypted, salt, verifier
+}
+
+// equal checks whether entries have the same content
+func (e Entry) equal(other Entry) bool {
+	if e.Service != other.Service || e.Login != other.Login || len(e.Fields) != len(other.Fields) {
+		return false
+	}
+
+	for name, value := range e.Fields {
+		otherValue, ok := other.Fields[name]
+		if !ok || otherValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// entryID returns the file name of the entry, it doesn't reveal service name and login
+func entryID(key []byte, service, login string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(service + "\x00" + login))
+	return hex.EncodeToString(mac.Sum(nil))[:entryIDLength]
+}
+
+// encodeEntry returns the encrypted file content of the entry
+func encodeEntry(key []byte, e Entry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize entry: %w", err)
+	}
+
+	encrypted, err := crypto.EncryptBytes(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt entry: %w", err)
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(encrypted) + "\n"), nil
+}
+
+// decodeEntry decrypts the entry file content
+func decodeEntry(key []byte, content []byte) (Entry, error) {
+	var e Entry
+
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return e, fmt.Errorf("unable to decode entry: %w", err)
+	}
+
+	data, err := crypto.DecryptBytes(key, encrypted)
+	if err != nil {
+		return e, fmt.Errorf("unable to decrypt entry, check the sync key: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("unable to parse entry: %w", err)
+	}
+
+	return e, nil
+}
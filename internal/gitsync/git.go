@@ -0,0 +1,99 @@
+package gitsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// git runs git commands in the repository directory
+type git struct {
+	dir string
+}
+
+// output runs git command and returns its raw output
+func (g git) output(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		details := strings.TrimSpace(stderr.String())
+		if details == "" {
+			details = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], details)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// run runs git command and returns its trimmed output
+func (g git) run(args ...string) (string, error) {
+	out, err := g.output(args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// check runs git command which reports the result with its exit code, e.g. merge-base --is-ancestor
+func (g git) check(args ...string) (bool, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return true, nil
+}
+
+// revExists checks whether the given revision exists
+func (g git) revExists(rev string) bool {
+	_, err := g.run("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	return err == nil
+}
+
+// tree returns blob hashes of the files in the given directory at the given revision, keyed by file names.
+// Empty revision means the empty tree.
+func (g git) tree(rev, dir string) (map[string]string, error) {
+	blobs := make(map[string]string)
+	if rev == "" {
+		return blobs, nil
+	}
+
+	out, err := g.run("ls-tree", "-r", rev, "--", dir+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		// <mode> SP <type> SP <object> TAB <file>
+		meta, path, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+
+		blobs[strings.TrimPrefix(path, dir+"/")] = fields[2]
+	}
+
+	return blobs, nil
+}
+
+// blob returns content of the blob with the given hash
+func (g git) blob(hash string) ([]byte, error) {
+	return g.output("cat-file", "blob", hash)
+}
@@ -0,0 +1,104 @@
+package gitsync
+
+import "sort"
+
+// Conflict describes a change made both locally and remotely which can't be merged automatically
+type Conflict struct {
+	Service string
+	Login   string
+	// Field is the conflicting field, empty if the entry was deleted on one side and changed on the other
+	Field  string
+	Reason string
+}
+
+// mergeEntry performs three-way merge of the entry. Any of base, ours and theirs is nil if the entry is absent.
+// Conflicting fields take the local value unless preferTheirs is set.
+// Deletion never wins over a change, so no data is lost in case of the conflict.
+func mergeEntry(base, ours, theirs *Entry, preferTheirs bool) (*Entry, []Conflict) {
+	switch {
+	case ours == nil && theirs == nil:
+		return nil, nil
+	case ours == nil:
+		if base != nil && base.equal(*theirs) {
+			return nil, nil
+		}
+		if base == nil {
+			return theirs, nil
+		}
+		return theirs, []Conflict{{
+			Service: theirs.Service,
+			Login:   theirs.Login,
+			Reason:  "deleted locally, changed remotely, the remote version is kept",
+		}}
+	case theirs == nil:
+		if base != nil && base.equal(*ours) {
+			return nil, nil
+		}
+		if base == nil {
+			return ours, nil
+		}
+		return ours, []Conflict{{
+			Service: ours.Service,
+			Login:   ours.Login,
+			Reason:  "changed locally, deleted remotely, the local version is kept",
+		}}
+	}
+
+	baseFields := map[string]string{}
+	if base != nil {
+		baseFields = base.Fields
+	}
+
+	merged := Entry{Service: ours.Service, Login: ours.Login, Fields: map[string]string{}}
+	var conflicts []Conflict
+
+	for _, name := range fieldNames(baseFields, ours.Fields, theirs.Fields) {
+		b, inBase := baseFields[name]
+		o, inOurs := ours.Fields[name]
+		t, inTheirs := theirs.Fields[name]
+
+		value, present := o, inOurs
+		switch {
+		case inOurs == inTheirs && o == t:
+		case inBase == inOurs && b == o:
+			value, present = t, inTheirs
+		case inBase == inTheirs && b == t:
+		default:
+			resolution := "the local value is kept"
+			if preferTheirs {
+				value, present = t, inTheirs
+				resolution = "the remote value is kept"
+			}
+			conflicts = append(conflicts, Conflict{
+				Service: ours.Service,
+				Login:   ours.Login,
+				Field:   name,
+				Reason:  "changed both locally and remotely, " + resolution,
+			})
+		}
+
+		if present {
+			merged.Fields[name] = value
+		}
+	}
+
+	return &merged, conflicts
+}
+
+// fieldNames returns sorted union of the fields names
+func fieldNames(fieldSets ...map[string]string) []string {
+	unique := make(map[string]struct{})
+	for _, fields := range fieldSets {
+		for name := range fields {
+			unique[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(unique))
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
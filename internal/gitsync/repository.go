@@ -0,0 +1,109 @@
+package gitsync
+
+import (
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"time"
+)
+
+// Repository decorates storage.Repository, so each change of the vault is committed to the sync repository.
+// Commit messages don't mention services and logins, the same as the entry files.
+type Repository struct {
+	storage.Repository
+	syncer *Syncer
+	warn   func(msg string, a ...interface{})
+}
+
+// NewRepository returns the repository committing changes with the given syncer,
+// failed commits are reported with warn and don't fail the change itself
+func NewRepository(repo storage.Repository, syncer *Syncer, warn func(msg string, a ...interface{})) *Repository {
+	return &Repository{Repository: repo, syncer: syncer, warn: warn}
+}
+
+// Services returns the repository of services
+func (r *Repository) Services() storage.ServiceRepository {
+	return syncedServices{ServiceRepository: r.Repository.Services(), r: r}
+}
+
+// Accounts returns the repository of accounts
+func (r *Repository) Accounts() storage.AccountRepository {
+	return syncedAccounts{AccountRepository: r.Repository.Accounts(), r: r}
+}
+
+// Passwords returns the repository of passwords
+func (r *Repository) Passwords() storage.PasswordRepository {
+	return syncedPasswords{PasswordRepository: r.Repository.Passwords(), r: r}
+}
+
+// commit commits the vault to the sync repository if the change succeeded
+func (r *Repository) commit(err error, message string) error {
+	if err != nil {
+		return err
+	}
+
+	if _, syncErr := r.syncer.Commit(r.Repository, message); syncErr != nil {
+		r.warn("unable to commit the change to the sync repository: %v", syncErr)
+	}
+
+	return nil
+}
+
+type syncedServices struct {
+	storage.ServiceRepository
+	r *Repository
+}
+
+// Delete deletes the service and commits the vault
+func (s syncedServices) Delete(service models.Service) error {
+	return s.r.commit(s.ServiceRepository.Delete(service), "Delete service")
+}
+
+type syncedAccounts struct {
+	storage.AccountRepository
+	r *Repository
+}
+
+// SaveWithPassword saves the account and commits the vault
+func (a syncedAccounts) SaveWithPassword(account *models.Account, password *models.Password) error {
+	return a.r.commit(a.AccountRepository.SaveWithPassword(account, password), "Add account")
+}
+
+// SaveAllWithPasswords saves the accounts and commits the vault once
+func (a syncedAccounts) SaveAllWithPasswords(accounts []models.Account, passwords []models.Password) error {
+	return a.r.commit(a.AccountRepository.SaveAllWithPasswords(accounts, passwords), "Add accounts")
+}
+
+// DeleteWithPassword deletes the account and commits the vault
+func (a syncedAccounts) DeleteWithPassword(account models.Account) error {
+	return a.r.commit(a.AccountRepository.DeleteWithPassword(account), "Delete account")
+}
+
+// SavePassword saves the account password and commits the vault
+func (a syncedAccounts) SavePassword(account *models.Account, expiresAt *time.Time) error {
+	return a.r.commit(a.AccountRepository.SavePassword(account, expiresAt), "Update password")
+}
+
+// SetSSHPublicKey sets the account public key and commits the vault
+func (a syncedAccounts) SetSSHPublicKey(account *models.Account, publicKey string) error {
+	return a.r.commit(a.AccountRepository.SetSSHPublicKey(account, publicKey), "Update account")
+}
+
+// SetAttributes sets the account attributes and commits the vault
+func (a syncedAccounts) SetAttributes(account *models.Account, attributes string) error {
+	return a.r.commit(a.AccountRepository.SetAttributes(account, attributes), "Update account")
+}
+
+type syncedPasswords struct {
+	storage.PasswordRepository
+	r *Repository
+}
+
+// Save saves the password and commits the vault
+func (p syncedPasswords) Save(password *models.Password) error {
+	return p.r.commit(p.PasswordRepository.Save(password), "Update password")
+}
+
+// SaveAll saves the passwords and commits the vault once
+func (p syncedPasswords) SaveAll(passwords []models.Password) error {
+	return p.r.commit(p.PasswordRepository.SaveAll(passwords), "Update passwords")
+}
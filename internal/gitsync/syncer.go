@@ -0,0 +1,621 @@
+package gitsync
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/crypto"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	entriesDir  = "entries"
+	keyFileName = "passtool-sync.key"
+	remoteName  = "origin"
+	branchName  = "main"
+	keyLength   = 32
+)
+
+var (
+	// ErrNotInitialized is returned when the sync repository is not initialized yet
+	ErrNotInitialized = errors.New("sync repository is not initialized, use the \"sync init\" command")
+	// ErrNoRemote is returned when the remote is required but not configured
+	ErrNoRemote = errors.New("remote is not configured, use the \"sync init --remote\" command")
+	// ErrPushRejected is returned when the remote has changes which are not pulled yet
+	ErrPushRejected = errors.New("remote has changes which are not pulled yet, use the \"sync pull\" command first")
+)
+
+// Syncer keeps the vault in the local git repository as per-entry encrypted files
+// and synchronizes it with the remote repository
+type Syncer struct {
+	dir    string
+	git    git
+	key    []byte
+	paused bool
+}
+
+// PullResult describes changes applied to the vault by pull
+type PullResult struct {
+	UpToDate  bool
+	Added     int
+	Updated   int
+	Deleted   int
+	Conflicts []Conflict
+}
+
+// Status describes the state of the sync repository
+type Status struct {
+	Remote     string
+	LastCommit string
+	Ahead      int
+	Behind     int
+}
+
+// change is the merged entry to apply locally, nil entry means that the entry must be deleted.
+// content is set if the entry is taken from the remote as is, so the file is kept byte for byte.
+type change struct {
+	entry   *Entry
+	content []byte
+}
+
+// vaultEntry is the entry together with the account it is made of
+type vaultEntry struct {
+	entry   Entry
+	account models.Account
+	service models.Service
+}
+
+// New returns Syncer for the repository in the given directory, loads the sync key if the repository is initialized
+func New(dir string) (*Syncer, error) {
+	s := &Syncer{dir: dir, git: git{dir: dir}}
+
+	encoded, err := os.ReadFile(s.keyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sync key: %w", err)
+	}
+
+	s.key, err = DecodeKey(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewKey generates the new sync key
+func NewKey() ([]byte, error) {
+	return crypto.RandomBytes(keyLength)
+}
+
+// EncodeKey returns the text representation of the sync key to share it with other vault users
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// DecodeKey parses the text representation of the sync key
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != keyLength {
+		return nil, errors.New("invalid sync key")
+	}
+
+	return key, nil
+}
+
+// IsInitialized checks whether the sync repository is initialized
+func (s *Syncer) IsInitialized() bool {
+	return s.key != nil
+}
+
+// Key returns the sync key
+func (s *Syncer) Key() []byte {
+	return s.key
+}
+
+// Dir returns the directory of the sync repository
+func (s *Syncer) Dir() string {
+	return s.dir
+}
+
+// Init initializes the sync repository with the given key, remote is optional
+func (s *Syncer) Init(remote string, key []byte) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("unable to create sync directory: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if _, err = s.git.run("init", "--quiet"); err != nil {
+			return err
+		}
+		if _, err = s.git.run("symbolic-ref", "HEAD", "refs/heads/"+branchName); err != nil {
+			return err
+		}
+	}
+
+	if email, _ := s.git.run("config", "user.email"); email == "" {
+		host, _ := os.Hostname()
+		if _, err := s.git.run("config", "user.name", "passtool"); err != nil {
+			return err
+		}
+		if _, err := s.git.run("config", "user.email", "passtool@"+host); err != nil {
+			return err
+		}
+	}
+
+	if remote != "" {
+		args := []string{"remote", "add", remoteName, remote}
+		if s.hasRemote() {
+			args = []string{"remote", "set-url", remoteName, remote}
+		}
+		if _, err := s.git.run(args...); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(s.keyPath(), []byte(EncodeKey(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("unable to save sync key: %w", err)
+	}
+
+	s.key = key
+	return nil
+}
+
+// Commit writes the vault to the sync repository and commits the changes.
+// Returns false if there was nothing to commit.
+func (s *Syncer) Commit(repo storage.Repository, message string) (bool, error) {
+	if !s.IsInitialized() {
+		return false, ErrNotInitialized
+	}
+
+	if s.paused {
+		return false, nil
+	}
+
+	if err := s.export(repo); err != nil {
+		return false, err
+	}
+
+	if _, err := s.git.run("add", "--all"); err != nil {
+		return false, err
+	}
+
+	changes, err := s.git.run("status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	if changes == "" {
+		return false, nil
+	}
+
+	if _, err = s.git.run("commit", "--quiet", "-m", message); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Pull fetches remote changes, merges them with the local ones field by field and applies the result to the vault.
+// Conflicting fields take the local value unless preferTheirs is set.
+func (s *Syncer) Pull(repo storage.Repository, preferTheirs bool) (PullResult, error) {
+	var result PullResult
+
+	if _, err := s.Commit(repo, "Update vault"); err != nil {
+		return result, err
+	}
+
+	remoteRef, err := s.fetch()
+	if err != nil {
+		return result, err
+	}
+
+	if !s.git.revExists(remoteRef) {
+		result.UpToDate = true
+		return result, nil
+	}
+
+	oursRev, baseRev := "", ""
+	fastForward := true
+	if s.git.revExists("HEAD") {
+		oursRev = "HEAD"
+
+		upToDate, err := s.git.check("merge-base", "--is-ancestor", remoteRef, "HEAD")
+		if err != nil {
+			return result, err
+		}
+		if upToDate {
+			result.UpToDate = true
+			return result, nil
+		}
+
+		if fastForward, err = s.git.check("merge-base", "--is-ancestor", "HEAD", remoteRef); err != nil {
+			return result, err
+		}
+
+		// there is no merge base for unrelated histories, the empty tree is used instead
+		baseRev, _ = s.git.run("merge-base", "HEAD", remoteRef)
+	}
+
+	changes, conflicts, err := s.merge(baseRev, oursRev, remoteRef, preferTheirs)
+	if err != nil {
+		return result, err
+	}
+	result.Conflicts = conflicts
+
+	s.paused = true
+	err = s.apply(repo, changes, &result)
+	s.paused = false
+	if err != nil {
+		return result, fmt.Errorf("unable to apply remote changes to the vault: %w", err)
+	}
+
+	if fastForward {
+		_, err = s.git.run("merge", "--quiet", "--ff-only", remoteRef)
+		return result, err
+	}
+
+	_, err = s.git.run("merge", "--quiet", "--no-commit", "--allow-unrelated-histories", "-s", "ours", remoteRef)
+	if err != nil {
+		return result, err
+	}
+
+	for id, c := range changes {
+		if c.content != nil {
+			err = os.WriteFile(filepath.Join(s.dir, entriesDir, id), c.content, 0600)
+		} else {
+			err = s.writeEntry(id, c.entry)
+		}
+		if err != nil {
+			return result, fmt.Errorf("unable to write entry: %w", err)
+		}
+	}
+
+	if _, err = s.git.run("add", "--all"); err != nil {
+		return result, err
+	}
+
+	_, err = s.git.run("commit", "--quiet", "-m", "Merge remote vault changes")
+	return result, err
+}
+
+// Push commits the vault and pushes it to the remote repository
+func (s *Syncer) Push(repo storage.Repository) error {
+	if _, err := s.Commit(repo, "Update vault"); err != nil {
+		return err
+	}
+
+	remoteRef, err := s.fetch()
+	if err != nil {
+		return err
+	}
+
+	if !s.git.revExists("HEAD") {
+		return nil
+	}
+
+	if s.git.revExists(remoteRef) {
+		pulled, err := s.git.check("merge-base", "--is-ancestor", remoteRef, "HEAD")
+		if err != nil {
+			return err
+		}
+		if !pulled {
+			return ErrPushRejected
+		}
+	}
+
+	_, err = s.git.run("push", "--quiet", remoteName, "HEAD:refs/heads/"+branchName)
+	return err
+}
+
+// Status returns the state of the sync repository, remote state is fetched first if the remote is configured
+func (s *Syncer) Status() (Status, error) {
+	var status Status
+	if !s.IsInitialized() {
+		return status, ErrNotInitialized
+	}
+
+	if s.git.revExists("HEAD") {
+		status.LastCommit, _ = s.git.run("log", "-1", "--format=%h %ci %s")
+	}
+
+	if !s.hasRemote() {
+		return status, nil
+	}
+
+	status.Remote, _ = s.git.run("remote", "get-url", remoteName)
+	remoteRef, err := s.fetch()
+	if err != nil {
+		return status, err
+	}
+
+	if !s.git.revExists("HEAD") || !s.git.revExists(remoteRef) {
+		return status, nil
+	}
+
+	counts, err := s.git.run("rev-list", "--left-right", "--count", "HEAD..."+remoteRef)
+	if err != nil {
+		return status, err
+	}
+
+	if fields := strings.Fields(counts); len(fields) == 2 {
+		status.Ahead, _ = strconv.Atoi(fields[0])
+		status.Behind, _ = strconv.Atoi(fields[1])
+	}
+
+	return status, nil
+}
+
+// fetch fetches the remote and returns the remote branch reference
+func (s *Syncer) fetch() (string, error) {
+	if !s.hasRemote() {
+		return "", ErrNoRemote
+	}
+
+	if _, err := s.git.run("fetch", "--quiet", remoteName); err != nil {
+		return "", err
+	}
+
+	return "refs/remotes/" + remoteName + "/" + branchName, nil
+}
+
+// hasRemote checks whether the remote is configured
+func (s *Syncer) hasRemote() bool {
+	_, err := s.git.run("remote", "get-url", remoteName)
+	return err == nil
+}
+
+// merge performs three-way merge of the entries and returns the changes to apply locally keyed by entry IDs
+func (s *Syncer) merge(baseRev, oursRev, theirsRev string, preferTheirs bool) (map[string]change, []Conflict, error) {
+	trees := make([]map[string]string, 3)
+	for i, rev := range []string{baseRev, oursRev, theirsRev} {
+		tree, err := s.git.tree(rev, entriesDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		trees[i] = tree
+	}
+	baseTree, oursTree, theirsTree := trees[0], trees[1], trees[2]
+
+	ids := make(map[string]struct{})
+	for _, tree := range trees {
+		for id := range tree {
+			ids[id] = struct{}{}
+		}
+	}
+
+	changes := make(map[string]change)
+	var conflicts []Conflict
+
+	for id := range ids {
+		b, o, t := baseTree[id], oursTree[id], theirsTree[id]
+		if o == t || b == t {
+			continue
+		}
+
+		// the same content may be encrypted differently on each side, so entries are compared decrypted
+		entries := make([]*Entry, 3)
+		contents := make([][]byte, 3)
+		for i, blob := range []string{b, o, t} {
+			e, content, err := s.readBlob(blob)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[i], contents[i] = e, content
+		}
+
+		base, ours, theirs := entries[0], entries[1], entries[2]
+		merged, content := theirs, contents[2]
+		if b != o {
+			var entryConflicts []Conflict
+			merged, entryConflicts = mergeEntry(base, ours, theirs, preferTheirs)
+			conflicts = append(conflicts, entryConflicts...)
+			if merged != theirs {
+				content = nil
+			}
+		}
+
+		if merged == nil && ours == nil || merged != nil && ours != nil && merged.equal(*ours) {
+			continue
+		}
+		changes[id] = change{entry: merged, content: content}
+	}
+
+	return changes, conflicts, nil
+}
+
+// readBlob reads and decrypts the entry stored in the blob, returns nil for the empty hash
+func (s *Syncer) readBlob(hash string) (*Entry, []byte, error) {
+	if hash == "" {
+		return nil, nil, nil
+	}
+
+	content, err := s.git.blob(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e, err := decodeEntry(s.key, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &e, content, nil
+}
+
+// apply applies the merged changes to the vault
+func (s *Syncer) apply(repo storage.Repository, changes map[string]change, result *PullResult) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	entries, err := s.vaultEntries(repo)
+	if err != nil {
+		return err
+	}
+
+	for id, c := range changes {
+		e := c.entry
+		existing, found := entries[id]
+
+		switch {
+		case e == nil && found:
+			if err = repo.Accounts().DeleteWithPassword(existing.account); err != nil {
+				return err
+			}
+
+			count, err := repo.Services().AccountsCount(existing.service)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				if err = repo.Services().Delete(existing.service); err != nil {
+					return err
+				}
+			}
+			result.Deleted++
+		case e == nil:
+		case found:
+			password := existing.account.Password
+			password.Encrypted, password.Salt, password.Verifier = e.password()
+			if err = repo.Passwords().Save(&password); err != nil {
+				return err
+			}
+			if publicKey := e.Fields[sshPublicKeyField]; publicKey != existing.account.SSHPublicKey {
+				if err = repo.Accounts().SetSSHPublicKey(&existing.account, publicKey); err != nil {
+					return err
+				}
+			}
+			if attributes := e.Fields[attributesField]; attributes != existing.account.Attributes {
+				if err = repo.Accounts().SetAttributes(&existing.account, attributes); err != nil {
+					return err
+				}
+			}
+			result.Updated++
+		default:
+			service, err := repo.Services().FetchOrCreate(e.Service)
+			if err != nil {
+				return err
+			}
+
+			account := models.Account{
+				Login:        e.Login,
+				Service:      service,
+				SSHPublicKey: e.Fields[sshPublicKeyField],
+				Attributes:   e.Fields[attributesField],
+			}
+			var password models.Password
+			password.Encrypted, password.Salt, password.Verifier = e.password()
+			if err = repo.Accounts().SaveWithPassword(&account, &password); err != nil {
+				return err
+			}
+			result.Added++
+		}
+	}
+
+	return nil
+}
+
+// vaultEntries returns entries of all the vault accounts keyed by entry IDs
+func (s *Syncer) vaultEntries(repo storage.Repository) (map[string]vaultEntry, error) {
+	services, err := repo.Services().List(true)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]vaultEntry)
+	for _, service := range services {
+		for _, account := range service.Accounts {
+			if err = repo.Accounts().LoadPassword(&account); err != nil {
+				return nil, err
+			}
+
+			entries[entryID(s.key, service.Name, account.Login)] = vaultEntry{
+				entry:   newEntry(service.Name, account),
+				account: account,
+				service: service,
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// export writes the vault entries to the work tree, unchanged entries are left as is
+func (s *Syncer) export(repo storage.Repository) error {
+	entries, err := s.vaultEntries(repo)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.dir, entriesDir)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create entries directory: %w", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read entries directory: %w", err)
+	}
+
+	for _, file := range files {
+		if _, found := entries[file.Name()]; !found {
+			if err = s.writeEntry(file.Name(), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	for id, ve := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, id))
+		if err == nil {
+			if existing, err := decodeEntry(s.key, content); err == nil && existing.equal(ve.entry) {
+				continue
+			}
+		}
+
+		e := ve.entry
+		if err = s.writeEntry(id, &e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeEntry writes the entry file to the work tree, nil entry removes the file
+func (s *Syncer) writeEntry(id string, e *Entry) error {
+	path := filepath.Join(s.dir, entriesDir, id)
+	if e == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove entry: %w", err)
+		}
+		return nil
+	}
+
+	content, err := encodeEntry(s.key, *e)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create entries directory: %w", err)
+	}
+
+	if err = os.WriteFile(path, content, 0600); err != nil {
+		return fmt.Errorf("unable to write entry: %w", err)
+	}
+
+	return nil
+}
+
+// keyPath returns path to the sync key file, it is kept inside .git directory so it is never committed
+func (s *Syncer) keyPath() string {
+	return filepath.Join(s.dir, ".git", keyFileName)
+}
@@ -0,0 +1,350 @@
+package gitsync
+
+import (
+	"errors"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// machine is the vault together with its sync repository, several machines share the same remote
+type machine struct {
+	repo   storage.Repository
+	syncer *Syncer
+}
+
+// newRemote returns the path of the bare repository used as the remote, git configs of the user are not used
+func newRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	remote := t.TempDir()
+	if _, err := (git{dir: remote}).run("init", "--quiet", "--bare"); err != nil {
+		t.Fatal(err)
+	}
+
+	return remote
+}
+
+// newMachine returns the machine with the empty vault and the sync repository initialized with the remote
+func newMachine(t *testing.T, remote string, key []byte) machine {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := storage.NewFileRepository(filepath.Join(dir, "passtool.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncer, err := New(filepath.Join(dir, "sync"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = syncer.Init(remote, key); err != nil {
+		t.Fatalf("unable to init sync repository: %v", err)
+	}
+
+	return machine{repo: repo, syncer: syncer}
+}
+
+// newMachines returns two machines sharing the remote, both have the account of bob at github.com
+func newMachines(t *testing.T) (machine, machine) {
+	t.Helper()
+	remote := newRemote(t)
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := newMachine(t, remote, key), newMachine(t, remote, key)
+	a.add(t, "github.com", "bob", "password")
+	a.push(t)
+	b.pull(t, false)
+
+	return a, b
+}
+
+// add saves the new account with the password
+func (m machine) add(t *testing.T, service, login, password string) {
+	t.Helper()
+	s, err := m.repo.Services().FetchOrCreate(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := models.Account{Login: login, Service: s}
+	if err = m.repo.Accounts().SaveWithPassword(&account, &models.Password{Encrypted: password, Salt: "salt"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// find returns the account with loaded password, false if it doesn't exist
+func (m machine) find(t *testing.T, service, login string) (models.Account, bool) {
+	t.Helper()
+	accounts, err := m.repo.Accounts().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		if account.Service.Name == service && account.Login == login {
+			return account, true
+		}
+	}
+
+	return models.Account{}, false
+}
+
+// mustFind returns the account with loaded password and fails the test if it doesn't exist
+func (m machine) mustFind(t *testing.T, service, login string) models.Account {
+	t.Helper()
+	account, found := m.find(t, service, login)
+	if !found {
+		t.Fatalf("account %q at %q is not found", login, service)
+	}
+
+	return account
+}
+
+// setPassword changes the encrypted password of the account
+func (m machine) setPassword(t *testing.T, service, login, password string) {
+	t.Helper()
+	account := m.mustFind(t, service, login)
+	account.Password.Encrypted = password
+	if err := m.repo.Passwords().Save(&account.Password); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setAttributes changes the attributes of the account
+func (m machine) setAttributes(t *testing.T, service, login, attributes string) {
+	t.Helper()
+	account := m.mustFind(t, service, login)
+	if err := m.repo.Accounts().SetAttributes(&account, attributes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// delete deletes the account
+func (m machine) delete(t *testing.T, service, login string) {
+	t.Helper()
+	if err := m.repo.Accounts().DeleteWithPassword(m.mustFind(t, service, login)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// push pushes the vault to the remote
+func (m machine) push(t *testing.T) {
+	t.Helper()
+	if err := m.syncer.Push(m.repo); err != nil {
+		t.Fatalf("unable to push: %v", err)
+	}
+}
+
+// pull pulls the remote changes to the vault
+func (m machine) pull(t *testing.T, preferTheirs bool) PullResult {
+	t.Helper()
+	result, err := m.syncer.Pull(m.repo, preferTheirs)
+	if err != nil {
+		t.Fatalf("unable to pull: %v", err)
+	}
+
+	return result
+}
+
+// assertPassword checks the encrypted password of the account
+func (m machine) assertPassword(t *testing.T, service, login, want string) {
+	t.Helper()
+	if got := m.mustFind(t, service, login).Password.Encrypted; got != want {
+		t.Errorf("got password %q of %q at %q, want %q", got, login, service, want)
+	}
+}
+
+// assertStatus checks the count of commits the machine is ahead and behind of the remote
+func (m machine) assertStatus(t *testing.T, ahead, behind int) {
+	t.Helper()
+	status, err := m.syncer.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Ahead != ahead || status.Behind != behind {
+		t.Errorf("got %d ahead and %d behind, want %d and %d", status.Ahead, status.Behind, ahead, behind)
+	}
+}
+
+func TestPullFastForward(t *testing.T) {
+	remote := newRemote(t)
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newMachine(t, remote, key), newMachine(t, remote, key)
+
+	a.add(t, "github.com", "bob", "password")
+	a.add(t, "gitlab.com", "amy", "other")
+	a.push(t)
+
+	result := b.pull(t, false)
+	if result.Added != 2 || result.UpToDate || len(result.Conflicts) > 0 {
+		t.Errorf("got %+v, want 2 accounts added", result)
+	}
+	b.assertPassword(t, "github.com", "bob", "password")
+	b.assertPassword(t, "gitlab.com", "amy", "other")
+	b.assertStatus(t, 0, 0)
+
+	a.setPassword(t, "github.com", "bob", "changed")
+	a.delete(t, "gitlab.com", "amy")
+	a.push(t)
+	b.assertStatus(t, 0, 1)
+
+	result = b.pull(t, false)
+	if result.Updated != 1 || result.Deleted != 1 || len(result.Conflicts) > 0 {
+		t.Errorf("got %+v, want 1 account updated and 1 deleted", result)
+	}
+	b.assertPassword(t, "github.com", "bob", "changed")
+	if _, found := b.find(t, "gitlab.com", "amy"); found {
+		t.Error("got the account deleted remotely, want it deleted locally")
+	}
+	if services, _ := b.repo.Services().Count(); services != 1 {
+		t.Errorf("got %d services, want the service without accounts deleted", services)
+	}
+
+	if result = b.pull(t, false); !result.UpToDate {
+		t.Errorf("got %+v pulling again, want up to date", result)
+	}
+}
+
+func TestPullMergesFieldsOfDivergedChanges(t *testing.T) {
+	a, b := newMachines(t)
+
+	a.setPassword(t, "github.com", "bob", "changed remotely")
+	a.add(t, "gitlab.com", "amy", "other")
+	a.push(t)
+	b.setAttributes(t, "github.com", "bob", `{"changed":"locally"}`)
+	b.add(t, "example.com", "eve", "third")
+
+	result := b.pull(t, false)
+	if len(result.Conflicts) > 0 {
+		t.Errorf("got conflicts %+v, want the fields merged", result.Conflicts)
+	}
+	b.assertPassword(t, "github.com", "bob", "changed remotely")
+	if got := b.mustFind(t, "github.com", "bob").Attributes; got != `{"changed":"locally"}` {
+		t.Errorf("got attributes %q, want the local change kept", got)
+	}
+	b.mustFind(t, "gitlab.com", "amy")
+	b.mustFind(t, "example.com", "eve")
+	b.assertStatus(t, 2, 0)
+
+	b.push(t)
+	a.pull(t, false)
+	if got := a.mustFind(t, "github.com", "bob").Attributes; got != `{"changed":"locally"}` {
+		t.Errorf("got attributes %q on the other machine, want the merged ones", got)
+	}
+	a.mustFind(t, "example.com", "eve")
+	a.assertStatus(t, 0, 0)
+}
+
+func TestPullConflict(t *testing.T) {
+	for name, preferTheirs := range map[string]bool{"ours": false, "theirs": true} {
+		t.Run(name, func(t *testing.T) {
+			a, b := newMachines(t)
+			a.setPassword(t, "github.com", "bob", "remote")
+			a.push(t)
+			b.setPassword(t, "github.com", "bob", "local")
+
+			result := b.pull(t, preferTheirs)
+			want := []Conflict{{
+				Service: "github.com",
+				Login:   "bob",
+				Field:   passwordField,
+				Reason:  "changed both locally and remotely, the local value is kept",
+			}}
+			kept := "local"
+			if preferTheirs {
+				want[0].Reason = "changed both locally and remotely, the remote value is kept"
+				kept = "remote"
+			}
+			if !reflect.DeepEqual(result.Conflicts, want) {
+				t.Errorf("got conflicts %+v, want %+v", result.Conflicts, want)
+			}
+			b.assertPassword(t, "github.com", "bob", kept)
+
+			// the merge result is the same on both machines
+			b.push(t)
+			a.pull(t, false)
+			a.assertPassword(t, "github.com", "bob", kept)
+		})
+	}
+}
+
+func TestPullDeletedOnOneSideChangedOnOther(t *testing.T) {
+	t.Run("deleted remotely", func(t *testing.T) {
+		a, b := newMachines(t)
+		a.delete(t, "github.com", "bob")
+		a.push(t)
+		b.setPassword(t, "github.com", "bob", "changed")
+
+		result := b.pull(t, false)
+		if len(result.Conflicts) != 1 || result.Conflicts[0].Reason != "changed locally, deleted remotely, the local version is kept" {
+			t.Errorf("got conflicts %+v, want the remote deletion reported", result.Conflicts)
+		}
+		b.assertPassword(t, "github.com", "bob", "changed")
+
+		b.push(t)
+		a.pull(t, false)
+		a.assertPassword(t, "github.com", "bob", "changed")
+	})
+
+	t.Run("deleted locally", func(t *testing.T) {
+		a, b := newMachines(t)
+		a.setPassword(t, "github.com", "bob", "changed")
+		a.push(t)
+		b.delete(t, "github.com", "bob")
+
+		result := b.pull(t, false)
+		if len(result.Conflicts) != 1 || result.Conflicts[0].Reason != "deleted locally, changed remotely, the remote version is kept" {
+			t.Errorf("got conflicts %+v, want the local deletion reported", result.Conflicts)
+		}
+		if result.Added != 1 {
+			t.Errorf("got %+v, want the account added back", result)
+		}
+		b.assertPassword(t, "github.com", "bob", "changed")
+	})
+
+	t.Run("deleted on both sides", func(t *testing.T) {
+		a, b := newMachines(t)
+		b.add(t, "gitlab.com", "amy", "other")
+		a.delete(t, "github.com", "bob")
+		a.push(t)
+		b.delete(t, "github.com", "bob")
+
+		result := b.pull(t, false)
+		if len(result.Conflicts) > 0 || result.Deleted > 0 {
+			t.Errorf("got %+v, want nothing to apply", result)
+		}
+		if _, found := b.find(t, "github.com", "bob"); found {
+			t.Error("got the account deleted on both sides restored")
+		}
+	})
+}
+
+func TestPushRejectedUntilPulled(t *testing.T) {
+	a, b := newMachines(t)
+	a.setPassword(t, "github.com", "bob", "changed")
+	a.push(t)
+	b.add(t, "gitlab.com", "amy", "other")
+
+	if err := b.syncer.Push(b.repo); !errors.Is(err, ErrPushRejected) {
+		t.Fatalf("got %v pushing before pull, want ErrPushRejected", err)
+	}
+
+	b.pull(t, false)
+	b.push(t)
+	a.pull(t, false)
+	a.mustFind(t, "gitlab.com", "amy")
+}
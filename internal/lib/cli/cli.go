@@ -2,43 +2,58 @@ package cli
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"golang.org/x/term"
+	"io"
 	"os"
+	"os/exec"
 	"strings"
 )
 
+// ErrCancelled is returned when the input ends before the value is given, e.g. by Ctrl-D
+var ErrCancelled = errors.New("cancelled")
+
 type Print interface {
 	Info(msg string, a ...interface{})
 	Warning(msg string, a ...interface{})
 }
 
 // GetUserInput gets input from user terminal with retrying if input is empty.
-func GetUserInput(prompt string, prt Print) string {
+func GetUserInput(prompt string, prt Print) (string, error) {
 	reader := bufio.NewReader(os.Stdin)
 	for {
 		prt.Info(prompt)
-		input, _ := reader.ReadString('\n')
+		input, err := reader.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && input != "") {
+			return "", inputError(err)
+		}
 		input = strings.TrimSpace(input)
 
 		if input == "" {
 			prt.Warning("value can't be empty")
 		} else {
-			return input
+			return input, nil
 		}
 	}
 }
 
 // GetSensitiveUserInput gets input from user terminal with retrying if input is empty. The input is invisible for user.
+// If stdin is not a terminal, the input is read from the controlling terminal of the process.
 func GetSensitiveUserInput(prompt string, prt Print) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return GetSensitiveTerminalInput(prompt)
+	}
+
 	for {
 		prt.Info(prompt)
 		bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
 		if err != nil {
-			return "", fmt.Errorf("unable to get sensitive input: %w", err)
+			return "", inputError(err)
 		}
 
-		fmt.Println() // Print a newline because ReadPassword does not capture the enter key
+		prt.Info("\n") // Print a newline because ReadPassword does not capture the enter key
 
 		if len(bytePassword) == 0 {
 			prt.Warning("value can't be empty")
@@ -47,3 +62,100 @@ func GetSensitiveUserInput(prompt string, prt Print) (string, error) {
 		}
 	}
 }
+
+// GetSensitiveTerminalInput gets invisible input from the controlling terminal of the process,
+// so it works when stdin and stdout are used for other purposes, e.g. by a protocol
+func GetSensitiveTerminalInput(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("unable to open terminal: %w", err)
+	}
+	defer tty.Close()
+
+	for {
+		_, _ = fmt.Fprint(tty, prompt)
+		bytePassword, err := term.ReadPassword(int(tty.Fd()))
+		_, _ = fmt.Fprintln(tty)
+		if err != nil {
+			return "", inputError(err)
+		}
+
+		if len(bytePassword) > 0 {
+			return string(bytePassword), nil
+		}
+		_, _ = fmt.Fprintln(tty, "value can't be empty")
+	}
+}
+
+// inputError returns ErrCancelled if the input has ended, otherwise the error of reading
+func inputError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return ErrCancelled
+	}
+	return fmt.Errorf("unable to get input: %w", err)
+}
+
+// AskPassPromptEnv is set to "confirm" for the askpass program when a confirmation is requested
+const AskPassPromptEnv = "PASSTOOL_ASKPASS_PROMPT"
+
+// AskPass gets invisible input with the askpass program, the controlling terminal is used if the program is not set
+func AskPass(program, prompt string) (string, error) {
+	if program == "" {
+		return GetSensitiveTerminalInput(prompt)
+	}
+
+	var stdout bytes.Buffer
+	command := exec.Command(program, prompt)
+	command.Stdout = &stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("unable to run askpass program: %w", err)
+	}
+
+	input := strings.TrimRight(stdout.String(), "\r\n")
+	if input == "" {
+		return "", errors.New("value can't be empty")
+	}
+
+	return input, nil
+}
+
+// AskConfirmation asks for confirmation with the askpass program which confirms by the exit status 0,
+// the controlling terminal is used if the program is not set
+func AskConfirmation(program, prompt string) (bool, error) {
+	if program == "" {
+		return getTerminalConfirmation(prompt + " [y/N]: ")
+	}
+
+	command := exec.Command(program, prompt)
+	command.Env = append(os.Environ(), AskPassPromptEnv+"=confirm")
+	command.Stderr = os.Stderr
+	err := command.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to run askpass program: %w", err)
+	}
+
+	return true, nil
+}
+
+// getTerminalConfirmation asks for confirmation in the controlling terminal of the process
+func getTerminalConfirmation(prompt string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("unable to open terminal: %w", err)
+	}
+	defer tty.Close()
+
+	_, _ = fmt.Fprint(tty, prompt)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("unable to get confirmation: %w", err)
+	}
+
+	return strings.EqualFold(strings.TrimSpace(answer), "y"), nil
+}
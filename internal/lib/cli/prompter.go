@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prompter asks user for the values commands need
+type Prompter interface {
+	// ReadLine reads the non-empty line, e.g. a service name or an answer to a question
+	ReadLine(prompt string) (string, error)
+	// ReadSecret reads the non-empty sensitive value, e.g. a password or a passphrase
+	ReadSecret(prompt string) (string, error)
+	// ReadSecretKey reads the secret key the passwords are encrypted with
+	ReadSecretKey(prompt string) (string, error)
+}
+
+// NewPrompter returns the prompter reading from stdin, values are hidden if stdin is a terminal.
+// Piped stdin is read by PipePrompter, sensitive values included, so scripts can answer all the prompts,
+// while GetSensitiveUserInput used without the prompter reads them from /dev/tty if stdin is not a terminal.
+func NewPrompter(prt Print) Prompter {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return NewTTYPrompter(prt)
+	}
+
+	return NewPipePrompter(os.Stdin, prt)
+}
+
+// TTYPrompter reads values from the terminal, sensitive values are not echoed
+type TTYPrompter struct {
+	prt Print
+}
+
+// NewTTYPrompter returns the prompter reading values from the terminal
+func NewTTYPrompter(prt Print) TTYPrompter {
+	return TTYPrompter{prt: prt}
+}
+
+// ReadLine reads the non-empty line from the terminal
+func (p TTYPrompter) ReadLine(prompt string) (string, error) {
+	return GetUserInput(prompt, p.prt)
+}
+
+// ReadSecret reads the non-empty value from the terminal without echoing it
+func (p TTYPrompter) ReadSecret(prompt string) (string, error) {
+	return GetSensitiveUserInput(prompt, p.prt)
+}
+
+// ReadSecretKey reads the secret key from the terminal without echoing it
+func (p TTYPrompter) ReadSecretKey(prompt string) (string, error) {
+	return p.ReadSecret(prompt)
+}
+
+// PipePrompter reads values line by line from the reader, e.g. from stdin of a script,
+// sensitive values are read the same way
+type PipePrompter struct {
+	reader *bufio.Reader
+	prt    Print
+}
+
+// NewPipePrompter returns the prompter reading values from r
+func NewPipePrompter(r io.Reader, prt Print) *PipePrompter {
+	return &PipePrompter{reader: bufio.NewReader(r), prt: prt}
+}
+
+// ReadLine reads the next non-empty line
+func (p *PipePrompter) ReadLine(prompt string) (string, error) {
+	for {
+		// the answer is not echoed, so the prompt is finished by the new line
+		p.prt.Info(prompt + "\n")
+		input, err := p.reader.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && input != "") {
+			return "", inputError(err)
+		}
+
+		input = strings.TrimSpace(input)
+		if input != "" {
+			return input, nil
+		}
+		p.prt.Warning("value can't be empty")
+	}
+}
+
+// ReadSecret reads the next non-empty line
+func (p *PipePrompter) ReadSecret(prompt string) (string, error) {
+	return p.ReadLine(prompt)
+}
+
+// ReadSecretKey reads the next non-empty line
+func (p *PipePrompter) ReadSecretKey(prompt string) (string, error) {
+	return p.ReadLine(prompt)
+}
+
+// ScriptedPrompter answers with the given answers in order and keeps the prompts, it's used by tests
+type ScriptedPrompter struct {
+	answers []string
+	// Prompts are the prompts asked so far
+	Prompts []string
+}
+
+// NewScriptedPrompter returns the prompter giving the answers, ErrCancelled is returned when they run out
+func NewScriptedPrompter(answers ...string) *ScriptedPrompter {
+	return &ScriptedPrompter{answers: answers}
+}
+
+// ReadLine returns the next answer
+func (p *ScriptedPrompter) ReadLine(prompt string) (string, error) {
+	p.Prompts = append(p.Prompts, prompt)
+	if len(p.answers) == 0 {
+		return "", ErrCancelled
+	}
+
+	answer := p.answers[0]
+	p.answers = p.answers[1:]
+	return answer, nil
+}
+
+// ReadSecret returns the next answer
+func (p *ScriptedPrompter) ReadSecret(prompt string) (string, error) {
+	return p.ReadLine(prompt)
+}
+
+// ReadSecretKey returns the next answer
+func (p *ScriptedPrompter) ReadSecretKey(prompt string) (string, error) {
+	return p.ReadLine(prompt)
+}
+
+// Remaining returns the answers which are not given yet
+func (p *ScriptedPrompter) Remaining() []string {
+	return p.answers
+}
+
+// secretKeyPrompter answers the secret key prompts with the known secret key
+type secretKeyPrompter struct {
+	Prompter
+	secretKey string
+}
+
+// ReadSecretKey returns the known secret key
+func (p secretKeyPrompter) ReadSecretKey(string) (string, error) {
+	return p.secretKey, nil
+}
+
+// hasFixedSecretKey reports the secret key prompts are answered with the same key every time
+func (p secretKeyPrompter) hasFixedSecretKey() bool {
+	return true
+}
+
+// WithSecretKey returns the prompter answering the secret key prompts with secretKey,
+// other values are read by p
+func WithSecretKey(p Prompter, secretKey string) Prompter {
+	return secretKeyPrompter{Prompter: p, secretKey: secretKey}
+}
+
+// HasFixedSecretKey checks whether p answers the secret key prompts with the same key every time,
+// e.g. the one given by --secret-stdin, so the wrong secret key is not requested again
+func HasFixedSecretKey(p Prompter) bool {
+	fixed, ok := p.(interface{ hasFixedSecretKey() bool })
+	return ok && fixed.hasFixedSecretKey()
+}
+
+// ReadValue reads the first line of r, e.g. the secret key given by a file descriptor.
+// It reads byte by byte, so the rest of r is left for other readers.
+func ReadValue(r io.Reader) (string, error) {
+	var value strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			value.WriteByte(buf[0])
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to read value: %w", err)
+		}
+	}
+
+	result := strings.TrimSuffix(value.String(), "\r")
+	if result == "" {
+		return "", errors.New("value can't be empty")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// discardPrint drops prompts and warnings
+type discardPrint struct{}
+
+func (discardPrint) Info(string, ...interface{})    {}
+func (discardPrint) Warning(string, ...interface{}) {}
+
+func TestPipePrompterReadsLinesInOrder(t *testing.T) {
+	p := NewPipePrompter(strings.NewReader("github.com\n\n  bob  \nsecret\r\nkey"), discardPrint{})
+
+	for _, read := range []struct {
+		name string
+		fn   func(string) (string, error)
+		want string
+	}{
+		{"line", p.ReadLine, "github.com"},
+		{"line after empty one", p.ReadLine, "bob"},
+		{"secret", p.ReadSecret, "secret"},
+		{"secret key without new line", p.ReadSecretKey, "key"},
+	} {
+		got, err := read.fn("prompt: ")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", read.name, err)
+		}
+		if got != read.want {
+			t.Errorf("%s: got %q, want %q", read.name, got, read.want)
+		}
+	}
+
+	if _, err := p.ReadLine("prompt: "); !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v at the end of input, want ErrCancelled", err)
+	}
+}
+
+func TestScriptedPrompter(t *testing.T) {
+	p := NewScriptedPrompter("github.com", "secret", "key")
+
+	for _, prompt := range []string{"Enter service name: ", "Enter password: ", "Enter secret key: "} {
+		if _, err := p.ReadLine(prompt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if _, err := p.ReadSecret("Enter password again: "); !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v when answers run out, want ErrCancelled", err)
+	}
+
+	want := []string{"Enter service name: ", "Enter password: ", "Enter secret key: ", "Enter password again: "}
+	if !reflect.DeepEqual(p.Prompts, want) {
+		t.Errorf("got prompts %q, want %q", p.Prompts, want)
+	}
+	if len(p.Remaining()) != 0 {
+		t.Errorf("got remaining answers %q, want none", p.Remaining())
+	}
+}
+
+func TestWithSecretKeyAnswersSecretKeyPromptsOnly(t *testing.T) {
+	scripted := NewScriptedPrompter("bob", "password")
+	p := WithSecretKey(scripted, "key")
+
+	for i := 0; i < 2; i++ {
+		got, err := p.ReadSecretKey("Enter secret key: ")
+		if err != nil || got != "key" {
+			t.Fatalf("got %q, %v, want the given secret key", got, err)
+		}
+	}
+
+	if got, _ := p.ReadLine("Enter login: "); got != "bob" {
+		t.Errorf("got login %q, want %q", got, "bob")
+	}
+	if got, _ := p.ReadSecret("Enter password: "); got != "password" {
+		t.Errorf("got password %q, want %q", got, "password")
+	}
+	if len(scripted.Prompts) != 2 {
+		t.Errorf("got prompts %q, want secret key prompts to be answered without asking", scripted.Prompts)
+	}
+}
+
+func TestHasFixedSecretKey(t *testing.T) {
+	scripted := NewScriptedPrompter()
+	if HasFixedSecretKey(scripted) || HasFixedSecretKey(NewPipePrompter(strings.NewReader(""), discardPrint{})) {
+		t.Error("got the fixed secret key of the prompter asking for it")
+	}
+	if !HasFixedSecretKey(WithSecretKey(scripted, "key")) {
+		t.Error("got the secret key given to the prompter not fixed")
+	}
+}
+
+func TestReadValueLeavesRestOfInput(t *testing.T) {
+	r := strings.NewReader("key\r\ngithub.com\n")
+
+	got, err := ReadValue(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "key" {
+		t.Errorf("got %q, want %q", got, "key")
+	}
+
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "github.com\n" {
+		t.Errorf("got the rest %q, want %q", rest, "github.com\n")
+	}
+}
+
+func TestReadValueRejectsEmptyValue(t *testing.T) {
+	for _, input := range []string{"", "\n", "\r\n"} {
+		if _, err := ReadValue(strings.NewReader(input)); err == nil {
+			t.Errorf("got no error for %q, want the empty value error", input)
+		}
+	}
+}
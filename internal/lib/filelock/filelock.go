@@ -0,0 +1,36 @@
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const retryInterval = 20 * time.Millisecond
+
+// ErrLocked is returned when the lock file is not released by another process in time
+var ErrLocked = errors.New("locked by another process")
+
+// Lock creates the lock file at the given path, retrying until the file is removed by its owner or the timeout
+// passes, returns the function removing the lock file. The file is created exclusively, so only one process holds
+// the lock, the lock file left by a crashed process has to be removed by hand.
+func Lock(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+			_ = f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("unable to create lock file: %w", err)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w, remove %s if no other process is running", ErrLocked, path)
+		}
+		time.Sleep(retryInterval)
+	}
+}
@@ -0,0 +1,75 @@
+package filelock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockIsExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.lock")
+	unlock, err := Lock(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Lock(path, 50*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v taking the held lock, want ErrLocked", err)
+	}
+
+	unlock()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the lock file removed", err)
+	}
+	if unlock, err = Lock(path, 50*time.Millisecond); err != nil {
+		t.Errorf("got %v taking the released lock", err)
+	} else {
+		unlock()
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.lock")
+	holders, maxHolders := 0, 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := Lock(path, 5*time.Second)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxHolders != 1 {
+		t.Errorf("got %d holders of the lock at once, want 1", maxHolders)
+	}
+}
+
+func TestLockFailsInMissingDirectory(t *testing.T) {
+	if _, err := Lock(filepath.Join(t.TempDir(), "missing", "file.lock"), time.Second); err == nil || errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, want the error creating the lock file", err)
+	}
+}
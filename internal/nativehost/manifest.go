@@ -0,0 +1,111 @@
+package nativehost
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// HostName is the name extensions connect to the host by
+const HostName = "com.github.mirtoykin.passtool"
+
+const (
+	BrowserChrome   = "chrome"
+	BrowserChromium = "chromium"
+	BrowserBrave    = "brave"
+	BrowserEdge     = "edge"
+	BrowserFirefox  = "firefox"
+)
+
+// Browsers are the supported browsers
+var Browsers = []string{BrowserChrome, BrowserChromium, BrowserBrave, BrowserEdge, BrowserFirefox}
+
+// manifestDirs are the directories of per-user manifests relative to the home directory by OS and browser
+var manifestDirs = map[string]map[string]string{
+	"linux": {
+		BrowserChrome:   ".config/google-chrome/NativeMessagingHosts",
+		BrowserChromium: ".config/chromium/NativeMessagingHosts",
+		BrowserBrave:    ".config/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		BrowserEdge:     ".config/microsoft-edge/NativeMessagingHosts",
+		BrowserFirefox:  ".mozilla/native-messaging-hosts",
+	},
+	"darwin": {
+		BrowserChrome:   "Library/Application Support/Google/Chrome/NativeMessagingHosts",
+		BrowserChromium: "Library/Application Support/Chromium/NativeMessagingHosts",
+		BrowserBrave:    "Library/Application Support/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		BrowserEdge:     "Library/Application Support/Microsoft Edge/NativeMessagingHosts",
+		BrowserFirefox:  "Library/Application Support/Mozilla/NativeMessagingHosts",
+	},
+}
+
+// Manifest is the native messaging host manifest, Chromium-based browsers use AllowedOrigins,
+// Firefox uses AllowedExtensions
+type Manifest struct {
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	Path              string   `json:"path"`
+	Type              string   `json:"type"`
+	AllowedOrigins    []string `json:"allowed_origins,omitempty"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+}
+
+// NewManifest returns the manifest of the host executable for the browser allowing the given extensions,
+// extension IDs of Chromium-based browsers are converted to origins
+func NewManifest(browser, path string, extensions []string) Manifest {
+	m := Manifest{
+		Name:        HostName,
+		Description: "Passtool password manager",
+		Path:        path,
+		Type:        "stdio",
+	}
+
+	if IsFirefox(browser) {
+		m.AllowedExtensions = extensions
+		return m
+	}
+
+	for _, id := range extensions {
+		m.AllowedOrigins = append(m.AllowedOrigins, "chrome-extension://"+id+"/")
+	}
+
+	return m
+}
+
+// IsFirefox checks whether the browser identifies extensions the Firefox way
+func IsFirefox(browser string) bool {
+	return browser == BrowserFirefox
+}
+
+// ManifestPath returns the path of the per-user manifest of the browser on the given OS
+func ManifestPath(browser, goos, home string) (string, error) {
+	dirs, ok := manifestDirs[goos]
+	if !ok {
+		return "", fmt.Errorf("manifests are written on Linux and macOS only, on %s register the host manually", goos)
+	}
+
+	dir, ok := dirs[browser]
+	if !ok {
+		return "", fmt.Errorf("unknown browser %q", browser)
+	}
+
+	return filepath.Join(home, dir, HostName+".json"), nil
+}
+
+// WriteManifest writes the manifest to the given path creating its directory
+func WriteManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to serialize manifest: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create manifest directory: %w", err)
+	}
+
+	if err = os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write manifest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package nativehost
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestPath(t *testing.T) {
+	tests := []struct {
+		browser string
+		goos    string
+		want    string
+		wantErr bool
+	}{
+		{browser: BrowserChrome, goos: "linux", want: "/home/bob/.config/google-chrome/NativeMessagingHosts"},
+		{browser: BrowserChromium, goos: "linux", want: "/home/bob/.config/chromium/NativeMessagingHosts"},
+		{browser: BrowserBrave, goos: "linux", want: "/home/bob/.config/BraveSoftware/Brave-Browser/NativeMessagingHosts"},
+		{browser: BrowserEdge, goos: "linux", want: "/home/bob/.config/microsoft-edge/NativeMessagingHosts"},
+		{browser: BrowserFirefox, goos: "linux", want: "/home/bob/.mozilla/native-messaging-hosts"},
+		{browser: BrowserChrome, goos: "darwin",
+			want: "/home/bob/Library/Application Support/Google/Chrome/NativeMessagingHosts"},
+		{browser: BrowserFirefox, goos: "darwin",
+			want: "/home/bob/Library/Application Support/Mozilla/NativeMessagingHosts"},
+		{browser: BrowserChrome, goos: "windows", wantErr: true},
+		{browser: "opera", goos: "linux", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ManifestPath(tt.browser, tt.goos, "/home/bob")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s on %s: got path %q, want an error", tt.browser, tt.goos, got)
+			}
+			continue
+		}
+
+		if want := filepath.Join(tt.want, HostName+".json"); err != nil || got != want {
+			t.Errorf("%s on %s: got path %q, %v, want %q", tt.browser, tt.goos, got, err, want)
+		}
+	}
+}
+
+func TestEachBrowserHasManifestPath(t *testing.T) {
+	for _, goos := range []string{"linux", "darwin"} {
+		for _, browser := range Browsers {
+			if _, err := ManifestPath(browser, goos, "/home/bob"); err != nil {
+				t.Errorf("got %v for %s on %s, want the manifest path", err, browser, goos)
+			}
+		}
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	chrome := NewManifest(BrowserChrome, "/usr/bin/host", []string{"abc", "def"})
+	wantOrigins := []string{"chrome-extension://abc/", "chrome-extension://def/"}
+	if !reflect.DeepEqual(chrome.AllowedOrigins, wantOrigins) || chrome.AllowedExtensions != nil {
+		t.Errorf("got manifest %+v, want origins %q", chrome, wantOrigins)
+	}
+
+	firefox := NewManifest(BrowserFirefox, "/usr/bin/host", []string{"passtool@example.com"})
+	wantExtensions := []string{"passtool@example.com"}
+	if !reflect.DeepEqual(firefox.AllowedExtensions, wantExtensions) || firefox.AllowedOrigins != nil {
+		t.Errorf("got manifest %+v, want extensions %q", firefox, wantExtensions)
+	}
+
+	for _, m := range []Manifest{chrome, firefox} {
+		if m.Name != HostName || m.Path != "/usr/bin/host" || m.Type != "stdio" {
+			t.Errorf("got manifest %+v, want the stdio host %s at the path", m, HostName)
+		}
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "NativeMessagingHosts", HostName+".json")
+	want := NewManifest(BrowserChrome, "/usr/bin/host", []string{"abc"})
+	if err := WriteManifest(path, want); err != nil {
+		t.Fatalf("unable to write manifest: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Manifest
+	if err = json.Unmarshal(data, &got); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got manifest %+v, %v, want %+v", got, err, want)
+	}
+}
@@ -0,0 +1,61 @@
+// Package nativehost implements the native messaging protocol browsers use to talk to local applications
+package nativehost
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxMessageSize is the maximum size of a message, browsers don't accept bigger messages from the host
+const MaxMessageSize = 1024 * 1024
+
+// ReadMessage reads the length-prefixed JSON message to v, io.EOF is returned when the browser closes the stream
+func ReadMessage(r io.Reader, v interface{}) error {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return fmt.Errorf("unable to read message length: %w", err)
+	}
+
+	if size > MaxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", size, MaxMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("unable to read message: %w", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unable to parse message: %w", err)
+	}
+
+	return nil
+}
+
+// WriteMessage writes v as the length-prefixed JSON message
+func WriteMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to serialize message: %w", err)
+	}
+
+	if len(data) > MaxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", len(data), MaxMessageSize)
+	}
+
+	message := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(message, uint32(len(data)))
+	copy(message[4:], data)
+
+	if _, err = w.Write(message); err != nil {
+		return fmt.Errorf("unable to write message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package nativehost
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// framed returns the data prefixed with the given length
+func framed(size uint32, data string) []byte {
+	message := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(message, size)
+	return append(message, data...)
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "message", input: framed(17, `{"action":"find"}`), want: map[string]string{"action": "find"}},
+		{name: "length shorter than message", input: framed(16, `{"action":"find"}`), wantErr: "unable to parse message"},
+		{name: "closed stream", input: nil, wantErr: io.EOF.Error()},
+		{name: "partial length", input: []byte{1, 0}, wantErr: "unable to read message length"},
+		{name: "partial message", input: framed(17, `{"action"`), wantErr: "unable to read message"},
+		{name: "too big message", input: framed(MaxMessageSize+1, ""), wantErr: "exceeds the limit"},
+		{name: "not JSON", input: framed(4, "find"), wantErr: "unable to parse message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]string
+			err := ReadMessage(bytes.NewReader(tt.input), &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil || got["action"] != tt.want["action"] {
+				t.Errorf("got message %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMessageReturnsEOFOnlyBetweenMessages(t *testing.T) {
+	var got map[string]string
+	if err := ReadMessage(bytes.NewReader(nil), &got); !errors.Is(err, io.EOF) {
+		t.Errorf("got error %v of the closed stream, want io.EOF", err)
+	}
+
+	for _, input := range [][]byte{{1}, framed(17, `{"action"`)} {
+		if err := ReadMessage(bytes.NewReader(input), &got); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("got error %v of the stream closed within a message, want it not to be io.EOF", err)
+		}
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, map[string]string{"action": "find"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := framed(17, `{"action":"find"}`); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got message %q, want %q", buf.Bytes(), want)
+	}
+
+	// messages are read back one by one until the stream ends
+	if err := WriteMessage(&buf, map[string]string{"action": "get"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"find", "get"} {
+		var got map[string]string
+		if err := ReadMessage(&buf, &got); err != nil || got["action"] != want {
+			t.Errorf("got message %v, %v, want action %q", got, err, want)
+		}
+	}
+	if err := ReadMessage(&buf, new(map[string]string)); !errors.Is(err, io.EOF) {
+		t.Errorf("got error %v after the last message, want io.EOF", err)
+	}
+}
+
+func TestWriteMessageRejectsTooBigMessages(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMessage(&buf, strings.Repeat("a", MaxMessageSize))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("got error %v, want the limit exceeded", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %d bytes written, want nothing", buf.Len())
+	}
+}
@@ -2,21 +2,28 @@ package output
 
 import (
 	"github.com/fatih/color"
-	"os"
+	"io"
 )
 
 // colorWrapper wrapper function that returns function for printing with the given color
-func colorWrapper(colorAttr color.Attribute) func(msg string, a ...interface{}) {
+func (o Out) colorWrapper(colorAttr color.Attribute) func(msg string, a ...interface{}) {
 	return func(msg string, a ...interface{}) {
-		color.New(colorAttr).PrintfFunc()(msg, a...)
+		if o.w == nil {
+			color.New(colorAttr).PrintfFunc()(msg, a...)
+			return
+		}
+		color.New(colorAttr).FprintfFunc()(o.w, msg, a...)
 	}
 }
 
-type Out struct{}
+// Out prints to stdout unless it's created with another writer
+type Out struct {
+	w io.Writer
+}
 
 // Simple for printing regular text
 func (o Out) Simple(msg string, a ...interface{}) {
-	colorWrapper(color.FgWhite)(msg, a...)
+	o.colorWrapper(color.FgWhite)(msg, a...)
 }
 
 // Simpleln for printing regular text with new line
@@ -26,7 +33,7 @@ func (o Out) Simpleln(msg string, a ...interface{}) {
 
 // Info for printing info text
 func (o Out) Info(msg string, a ...interface{}) {
-	colorWrapper(color.FgBlue)(msg, a...)
+	o.colorWrapper(color.FgBlue)(msg, a...)
 }
 
 // Infoln for printing info text with new line
@@ -36,31 +43,31 @@ func (o Out) Infoln(msg string, a ...interface{}) {
 
 // Header for printing header text
 func (o Out) Header(msg string, a ...interface{}) {
-	colorWrapper(color.FgMagenta)(msg+"\n", a...)
+	o.colorWrapper(color.FgMagenta)(msg+"\n", a...)
 }
 
 // Success for printing success message
 func (o Out) Success(msg string, a ...interface{}) {
-	colorWrapper(color.FgGreen)(msg+"\n", a...)
+	o.colorWrapper(color.FgGreen)(msg+"\n", a...)
 }
 
 // Warning for printing warning message
 func (o Out) Warning(msg string, a ...interface{}) {
-	colorWrapper(color.FgYellow)(msg+"\n", a...)
+	o.colorWrapper(color.FgYellow)(msg+"\n", a...)
 }
 
 // Error for printing error message
 func (o Out) Error(msg string, a ...interface{}) {
-	colorWrapper(color.FgRed)(msg, a...)
-}
-
-// ErrorWithExit for printing error message with the following stopping execution
-func (o Out) ErrorWithExit(msg string, a ...interface{}) {
-	o.Error(msg+"\n", a...)
-	os.Exit(1)
+	o.colorWrapper(color.FgRed)(msg, a...)
 }
 
 // New returns new instance of Out
 func New() Out {
 	return Out{}
 }
+
+// NewWithWriter returns new instance of Out printing to the given writer, e.g. to stderr
+// when stdout is used by a protocol
+func NewWithWriter(w io.Writer) Out {
+	return Out{w: w}
+}
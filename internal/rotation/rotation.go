@@ -0,0 +1,139 @@
+package rotation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statuses of the accounts selected for the rotation
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusSkipped = "skipped"
+)
+
+// Item is an account selected for the rotation
+type Item struct {
+	AccountID uint   `json:"account_id"`
+	Status    string `json:"status"`
+	// Generated is the new password encrypted with the secret key of the account, it's kept until the change
+	// is confirmed, so the same password is offered again if the rotation is interrupted
+	Generated string    `json:"generated,omitempty"`
+	Salt      string    `json:"salt,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Session is the rotation in progress, it's kept in the file until all the selected accounts are rotated or skipped
+type Session struct {
+	path      string
+	StartedAt time.Time `json:"started_at"`
+	Items     []Item    `json:"items"`
+}
+
+// Start creates the session for the given accounts and saves it to the file at the given path
+func Start(path string, accountIDs []uint, now time.Time) (*Session, error) {
+	s := &Session{path: path, StartedAt: now}
+	for _, id := range accountIDs {
+		s.Items = append(s.Items, Item{AccountID: id, Status: StatusPending, UpdatedAt: now})
+	}
+
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Load reads the session from the file at the given path, returns nil if there is no rotation in progress
+func Load(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rotation: %w", err)
+	}
+
+	s := &Session{path: path}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("unable to parse rotation: %w", err)
+	}
+
+	return s, nil
+}
+
+// Save writes the session to its file, the file is replaced atomically
+func (s *Session) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode rotation: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to save rotation: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save rotation: %w", err)
+	}
+
+	return nil
+}
+
+// Finish removes the session file
+func (s *Session) Finish() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to finish rotation: %w", err)
+	}
+
+	return nil
+}
+
+// Pending returns pointers to the items which are neither rotated nor skipped yet
+func (s *Session) Pending() []*Item {
+	var pending []*Item
+	for i := range s.Items {
+		if s.Items[i].Status == StatusPending {
+			pending = append(pending, &s.Items[i])
+		}
+	}
+
+	return pending
+}
+
+// Count returns the number of items with the given status
+func (s *Session) Count(status string) int {
+	count := 0
+	for _, item := range s.Items {
+		if item.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+// SetGenerated keeps the new password of the item encrypted with the account secret key and saves the session
+func (s *Session) SetGenerated(item *Item, encrypted, salt string, now time.Time) error {
+	item.Generated, item.Salt, item.UpdatedAt = encrypted, salt, now
+	return s.Save()
+}
+
+// Resolve sets the final status of the item, forgets its generated password and saves the session
+func (s *Session) Resolve(item *Item, status string, now time.Time) error {
+	item.Status, item.Generated, item.Salt, item.UpdatedAt = status, "", "", now
+	return s.Save()
+}
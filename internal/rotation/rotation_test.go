@@ -0,0 +1,89 @@
+package rotation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionIsResumedFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool_rotation.json")
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+
+	s, err := Start(path, []uint{1, 2, 3}, now)
+	if err != nil {
+		t.Fatalf("unable to start rotation: %v", err)
+	}
+	pending := s.Pending()
+	if len(pending) != 3 {
+		t.Fatalf("got %d pending items, want 3", len(pending))
+	}
+	if err = s.SetGenerated(pending[0], "encrypted", "salt", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Resolve(pending[1], StatusDone, now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("got session file %v, %v, want it readable by the owner only", info, err)
+	}
+
+	// the interrupted rotation offers the same generated password again
+	loaded, err := Load(path)
+	if err != nil || loaded == nil {
+		t.Fatalf("got session %v, %v, want the saved one", loaded, err)
+	}
+	pending = loaded.Pending()
+	if len(pending) != 2 || pending[0].AccountID != 1 || pending[1].AccountID != 3 {
+		t.Fatalf("got pending items %+v, want accounts 1 and 3", pending)
+	}
+	if pending[0].Generated != "encrypted" || pending[0].Salt != "salt" {
+		t.Errorf("got generated password %q with salt %q, want the saved one", pending[0].Generated, pending[0].Salt)
+	}
+	if !loaded.StartedAt.Equal(now) {
+		t.Errorf("got start time %v, want %v", loaded.StartedAt, now)
+	}
+
+	if err = loaded.Resolve(pending[0], StatusSkipped, now.Add(3*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if pending[0].Generated != "" || pending[0].Salt != "" {
+		t.Errorf("got generated password %q kept after the resolve, want it forgotten", pending[0].Generated)
+	}
+	for status, want := range map[string]int{StatusPending: 1, StatusDone: 1, StatusSkipped: 1} {
+		if got := loaded.Count(status); got != want {
+			t.Errorf("got %d items %s, want %d", got, status, want)
+		}
+	}
+}
+
+func TestFinishRemovesSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool_rotation.json")
+	s, err := Start(path, []uint{1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = s.Finish(); err != nil {
+			t.Fatalf("unable to finish rotation: %v", err)
+		}
+	}
+
+	if loaded, err := Load(path); loaded != nil || err != nil {
+		t.Errorf("got session %v, %v after finish, want none", loaded, err)
+	}
+}
+
+func TestLoadOfBrokenSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool_rotation.json")
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("got the broken session loaded, want an error")
+	}
+}
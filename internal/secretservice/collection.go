@@ -0,0 +1,224 @@
+package secretservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/godbus/dbus/v5"
+)
+
+var collectionSignals = []introspectSignal{
+	{name: "ItemCreated", args: []string{"o"}},
+	{name: "ItemDeleted", args: []string{"o"}},
+	{name: "ItemChanged", args: []string{"o"}},
+}
+
+// loginAttributes are the attributes used as the login of the new account, the first one found is used
+var loginAttributes = []string{"username", "user", "account", "login", "email"}
+
+// defaultLogin is the login of the new account if the item has no login attributes
+const defaultLogin = "secret"
+
+// collection implements org.freedesktop.Secret.Collection, all the vault accounts are its items
+type collection struct {
+	p *Provider
+}
+
+// properties returns the properties of the collection
+func (c *collection) properties() *properties {
+	return &properties{
+		p:     c.p,
+		iface: collectionInterface,
+		types: map[string]string{"Items": "ao", "Label": "s", "Locked": "b", "Created": "t", "Modified": "t"},
+		get: func() (map[string]dbus.Variant, *dbus.Error) {
+			accounts, err := c.p.loadAccounts()
+			if err != nil {
+				return nil, dbus.MakeFailedError(err)
+			}
+
+			items := make([]dbus.ObjectPath, 0, len(accounts))
+			var created, modified uint64
+			for _, account := range accounts {
+				items = append(items, itemPath(account.ID))
+				if t := uint64(account.CreatedAt.Unix()); created == 0 || t < created {
+					created = t
+				}
+				if t := uint64(account.Password.UpdatedAt.Unix()); t > modified {
+					modified = t
+				}
+			}
+
+			return map[string]dbus.Variant{
+				"Items":    dbus.MakeVariant(items),
+				"Label":    dbus.MakeVariant(collectionLabel),
+				"Locked":   dbus.MakeVariant(!c.p.vault.IsUnlocked()),
+				"Created":  dbus.MakeVariant(created),
+				"Modified": dbus.MakeVariant(modified),
+			}, nil
+		},
+	}
+}
+
+// Delete is not supported as the collection is the vault
+func (c *collection) Delete() (dbus.ObjectPath, *dbus.Error) {
+	return noPrompt, errNotSupported
+}
+
+// SearchItems returns the items with the given attributes
+func (c *collection) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+
+	accounts, err := c.p.loadAccounts()
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+
+	results := []dbus.ObjectPath{}
+	for _, account := range accounts {
+		if matchAttributes(itemAttributes(account), attributes) {
+			results = append(results, itemPath(account.ID))
+		}
+	}
+
+	return results, nil
+}
+
+// CreateItem saves the new account, the service name is the item label and the login is taken from
+// the attributes, with replace the password of the item with the same attributes is updated
+func (c *collection) CreateItem(
+	sender dbus.Sender,
+	properties map[string]dbus.Variant,
+	sec secret,
+	replace bool,
+) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+
+	if !c.p.vault.IsUnlocked() {
+		return noPrompt, noPrompt, errIsLocked
+	}
+
+	ss, dbusErr := c.p.session(sec.Session, sender)
+	if dbusErr != nil {
+		return noPrompt, noPrompt, dbusErr
+	}
+
+	value, err := ss.decode(sec)
+	if err != nil {
+		return noPrompt, noPrompt, dbus.MakeFailedError(err)
+	}
+
+	label, _ := properties[itemLabelProperty].Value().(string)
+	attributes, _ := properties[itemAttributesProperty].Value().(map[string]string)
+
+	accounts, err := c.p.loadAccounts()
+	if err != nil {
+		return noPrompt, noPrompt, dbus.MakeFailedError(err)
+	}
+
+	if replace {
+		for _, account := range accounts {
+			if !equalAttributes(itemAttributes(account), attributes) {
+				continue
+			}
+			if !c.p.vault.CanDecrypt(account) {
+				return noPrompt, noPrompt, errIsLocked
+			}
+			if err = c.p.vault.SetSecret(account, string(value)); err != nil {
+				return noPrompt, noPrompt, dbus.MakeFailedError(err)
+			}
+
+			c.p.emit("ItemChanged", itemPath(account.ID))
+			return itemPath(account.ID), noPrompt, nil
+		}
+	}
+
+	if label == "" {
+		label = collectionLabel
+	}
+
+	encoded, err := encodeAttributes(attributes)
+	if err != nil {
+		return noPrompt, noPrompt, dbus.MakeFailedError(err)
+	}
+
+	account, err := c.p.vault.Create(label, uniqueLogin(accounts, label, attributes), string(value), encoded)
+	if err != nil {
+		return noPrompt, noPrompt, dbus.MakeFailedError(err)
+	}
+
+	if _, err = c.p.loadAccounts(); err != nil {
+		return noPrompt, noPrompt, dbus.MakeFailedError(err)
+	}
+
+	c.p.emit("ItemCreated", itemPath(account.ID))
+	return itemPath(account.ID), noPrompt, nil
+}
+
+// itemAttributes returns the lookup attributes of the account, accounts saved without attributes
+// are found by the service and username attributes
+func itemAttributes(account models.Account) map[string]string {
+	var attributes map[string]string
+	if account.Attributes != "" && json.Unmarshal([]byte(account.Attributes), &attributes) == nil && len(attributes) > 0 {
+		return attributes
+	}
+
+	return map[string]string{"service": account.Service.Name, "username": account.Login}
+}
+
+// encodeAttributes returns the attributes as a JSON object with sorted keys
+func encodeAttributes(attributes map[string]string) (string, error) {
+	if len(attributes) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode attributes: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// matchAttributes checks whether the attributes contain all the query attributes
+func matchAttributes(attributes, query map[string]string) bool {
+	for name, value := range query {
+		if v, ok := attributes[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalAttributes checks whether the attributes are the same
+func equalAttributes(a, b map[string]string) bool {
+	return len(a) == len(b) && matchAttributes(a, b)
+}
+
+// uniqueLogin returns the login for the new account of the service taken from the attributes,
+// a number is appended if the service already has the account with the login
+func uniqueLogin(accounts []models.Account, serviceName string, attributes map[string]string) string {
+	base := defaultLogin
+	for _, name := range loginAttributes {
+		if value := attributes[name]; value != "" {
+			base = value
+			break
+		}
+	}
+
+	taken := make(map[string]bool)
+	for _, account := range accounts {
+		if account.Service.Name == serviceName {
+			taken[account.Login] = true
+		}
+	}
+
+	login := base
+	for n := 2; taken[login]; n++ {
+		login = fmt.Sprintf("%s (%d)", base, n)
+	}
+
+	return login
+}
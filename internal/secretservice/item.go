@@ -0,0 +1,154 @@
+package secretservice
+
+import (
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/godbus/dbus/v5"
+)
+
+// item implements org.freedesktop.Secret.Item for the vault account
+type item struct {
+	p  *Provider
+	id uint
+}
+
+// properties returns the properties of the item, attributes can be changed
+func (i *item) properties() *properties {
+	return &properties{
+		p:     i.p,
+		iface: itemInterface,
+		types: map[string]string{"Locked": "b", "Attributes": "a{ss}", "Label": "s", "Created": "t", "Modified": "t"},
+		get: func() (map[string]dbus.Variant, *dbus.Error) {
+			account, err := i.p.findAccount(itemPath(i.id))
+			if err != nil {
+				return nil, err
+			}
+
+			return map[string]dbus.Variant{
+				"Locked":     dbus.MakeVariant(!i.p.vault.CanDecrypt(account)),
+				"Attributes": dbus.MakeVariant(itemAttributes(account)),
+				"Label":      dbus.MakeVariant(account.Service.Name),
+				"Created":    dbus.MakeVariant(uint64(account.CreatedAt.Unix())),
+				"Modified":   dbus.MakeVariant(uint64(account.Password.UpdatedAt.Unix())),
+			}, nil
+		},
+		writable: "Attributes",
+		set: func(value dbus.Variant) *dbus.Error {
+			attributes, ok := value.Value().(map[string]string)
+			if !ok {
+				return dbus.MakeFailedError(errInvalidAttributes)
+			}
+
+			account, dbusErr := i.p.findAccount(itemPath(i.id))
+			if dbusErr != nil {
+				return dbusErr
+			}
+
+			encoded, err := encodeAttributes(attributes)
+			if err == nil {
+				err = i.p.vault.SetAttributes(account, encoded)
+			}
+			if err != nil {
+				return dbus.MakeFailedError(err)
+			}
+
+			i.p.emit("ItemChanged", itemPath(i.id))
+			return nil
+		},
+	}
+}
+
+// Delete deletes the account of the item
+func (i *item) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.p.mu.Lock()
+	defer i.p.mu.Unlock()
+
+	account, dbusErr := i.unlockedAccount()
+	if dbusErr != nil {
+		return noPrompt, dbusErr
+	}
+
+	if err := i.p.vault.Delete(account); err != nil {
+		return noPrompt, dbus.MakeFailedError(err)
+	}
+
+	if _, err := i.p.loadAccounts(); err != nil {
+		return noPrompt, dbus.MakeFailedError(err)
+	}
+
+	i.p.emit("ItemDeleted", itemPath(i.id))
+	return noPrompt, nil
+}
+
+// GetSecret returns the password of the account encoded for the session
+func (i *item) GetSecret(sender dbus.Sender, sessionPath dbus.ObjectPath) (secret, *dbus.Error) {
+	i.p.mu.Lock()
+	defer i.p.mu.Unlock()
+
+	ss, dbusErr := i.p.session(sessionPath, sender)
+	if dbusErr != nil {
+		return secret{}, dbusErr
+	}
+
+	account, dbusErr := i.unlockedAccount()
+	if dbusErr != nil {
+		return secret{}, dbusErr
+	}
+
+	return i.p.itemSecret(account, ss)
+}
+
+// SetSecret saves the new password of the account
+func (i *item) SetSecret(sender dbus.Sender, sec secret) *dbus.Error {
+	i.p.mu.Lock()
+	defer i.p.mu.Unlock()
+
+	ss, dbusErr := i.p.session(sec.Session, sender)
+	if dbusErr != nil {
+		return dbusErr
+	}
+
+	account, dbusErr := i.unlockedAccount()
+	if dbusErr != nil {
+		return dbusErr
+	}
+
+	value, err := ss.decode(sec)
+	if err == nil {
+		err = i.p.vault.SetSecret(account, string(value))
+	}
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	i.p.emit("ItemChanged", itemPath(i.id))
+	return nil
+}
+
+// unlockedAccount returns the account of the item, errIsLocked is returned if its password can't be decrypted
+func (i *item) unlockedAccount() (models.Account, *dbus.Error) {
+	account, dbusErr := i.p.findAccount(itemPath(i.id))
+	if dbusErr != nil {
+		return models.Account{}, dbusErr
+	}
+
+	if !i.p.vault.CanDecrypt(account) {
+		return models.Account{}, errIsLocked
+	}
+
+	return account, nil
+}
+
+// itemSecret returns the decrypted password of the account encoded for the session
+func (p *Provider) itemSecret(account models.Account, ss *session) (secret, *dbus.Error) {
+	password, err := p.vault.Secret(account)
+	if err != nil {
+		return secret{}, dbus.MakeFailedError(err)
+	}
+
+	sec, err := ss.encode([]byte(password))
+	if err != nil {
+		return secret{}, dbus.MakeFailedError(err)
+	}
+
+	return sec, nil
+}
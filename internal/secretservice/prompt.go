@@ -0,0 +1,51 @@
+package secretservice
+
+import (
+	"github.com/godbus/dbus/v5"
+	"sync"
+)
+
+// prompt implements org.freedesktop.Secret.Prompt, the action runs when the client calls Prompt
+type prompt struct {
+	p    *Provider
+	path dbus.ObjectPath
+	// action performs the prompt and returns its result, or true if the user dismissed it
+	action func() (dbus.Variant, bool)
+	once   sync.Once
+}
+
+// newPrompt exports the new prompt performing the action
+func (p *Provider) newPrompt(action func() (dbus.Variant, bool)) (dbus.ObjectPath, *dbus.Error) {
+	pr := &prompt{p: p, path: p.nextPath(promptPrefix), action: action}
+	if err := p.export(pr.path, promptInterface, pr, nil, promptSignals); err != nil {
+		return noPrompt, dbus.MakeFailedError(err)
+	}
+
+	return pr.path, nil
+}
+
+var promptSignals = []introspectSignal{{name: "Completed", args: []string{"b", "v"}}}
+
+// Prompt performs the prompt in background, the Completed signal is emitted when it's done
+func (pr *prompt) Prompt(windowID string) *dbus.Error {
+	go func() {
+		result, dismissed := pr.action()
+		pr.complete(dismissed, result)
+	}()
+
+	return nil
+}
+
+// Dismiss dismisses the prompt
+func (pr *prompt) Dismiss() *dbus.Error {
+	pr.complete(true, dbus.MakeVariant(""))
+	return nil
+}
+
+// complete emits the Completed signal and removes the prompt, only the first call has effect
+func (pr *prompt) complete(dismissed bool, result dbus.Variant) {
+	pr.once.Do(func() {
+		_ = pr.p.conn.Emit(pr.path, promptInterface+".Completed", dismissed, result)
+		pr.p.unexport(pr.path, promptInterface)
+	})
+}
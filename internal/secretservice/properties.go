@@ -0,0 +1,109 @@
+package secretservice
+
+import (
+	"errors"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"sort"
+)
+
+var errInvalidAttributes = errors.New("attributes must be a string dictionary")
+
+// properties implements org.freedesktop.DBus.Properties for the interface of the object
+type properties struct {
+	p     *Provider
+	iface string
+	// types are the D-Bus types of the properties
+	types map[string]string
+	get   func() (map[string]dbus.Variant, *dbus.Error)
+	// writable is the only property which can be set
+	writable string
+	set      func(value dbus.Variant) *dbus.Error
+}
+
+// Get returns the property value
+func (pp *properties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	values, err := pp.GetAll(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+
+	value, ok := values[name]
+	if !ok {
+		return dbus.Variant{}, dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []interface{}{name})
+	}
+
+	return value, nil
+}
+
+// GetAll returns all the property values of the interface
+func (pp *properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	if iface != pp.iface {
+		return map[string]dbus.Variant{}, nil
+	}
+
+	pp.p.mu.Lock()
+	defer pp.p.mu.Unlock()
+	return pp.get()
+}
+
+// Set sets the property value
+func (pp *properties) Set(iface, name string, value dbus.Variant) *dbus.Error {
+	if iface != pp.iface || name != pp.writable {
+		return errNotSupported
+	}
+
+	pp.p.mu.Lock()
+	defer pp.p.mu.Unlock()
+	return pp.set(value)
+}
+
+// introspectSignal describes the signal with the types of its arguments
+type introspectSignal struct {
+	name string
+	args []string
+}
+
+// introspectNode returns the introspection data of the object
+func introspectNode(iface string, v interface{}, props *properties, signals []introspectSignal) introspect.Introspectable {
+	i := introspect.Interface{Name: iface, Methods: introspect.Methods(v)}
+
+	for _, s := range signals {
+		signal := introspect.Signal{Name: s.name}
+		for _, arg := range s.args {
+			signal.Args = append(signal.Args, introspect.Arg{Type: arg})
+		}
+		i.Signals = append(i.Signals, signal)
+	}
+
+	if props == nil {
+		return introspect.NewIntrospectable(&introspect.Node{Interfaces: []introspect.Interface{introspect.IntrospectData, i}})
+	}
+
+	names := make([]string, 0, len(props.types))
+	for name := range props.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		access := "read"
+		if name == props.writable {
+			access = "readwrite"
+		}
+		i.Properties = append(i.Properties, introspect.Property{Name: name, Type: props.types[name], Access: access})
+	}
+
+	return introspect.NewIntrospectable(&introspect.Node{Interfaces: []introspect.Interface{
+		introspect.IntrospectData,
+		i,
+		{
+			Name: propertiesInterface,
+			Methods: []introspect.Method{
+				{Name: "Get", Args: []introspect.Arg{{Type: "s", Direction: "in"}, {Type: "s", Direction: "in"}, {Type: "v", Direction: "out"}}},
+				{Name: "GetAll", Args: []introspect.Arg{{Type: "s", Direction: "in"}, {Type: "a{sv}", Direction: "out"}}},
+				{Name: "Set", Args: []introspect.Arg{{Type: "s", Direction: "in"}, {Type: "s", Direction: "in"}, {Type: "v", Direction: "in"}}},
+			},
+		},
+	}})
+}
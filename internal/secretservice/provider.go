@@ -0,0 +1,238 @@
+// Package secretservice implements the freedesktop Secret Service API over D-Bus on top of the vault,
+// so desktop applications keep their secrets in the vault instead of GNOME Keyring or KWallet
+package secretservice
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/godbus/dbus/v5"
+	"strconv"
+	"sync"
+)
+
+// BusName is the well-known name of the Secret Service
+const BusName = "org.freedesktop.secrets"
+
+const (
+	servicePath    dbus.ObjectPath = "/org/freedesktop/secrets"
+	collectionPath dbus.ObjectPath = "/org/freedesktop/secrets/collection/passtool"
+	aliasPath      dbus.ObjectPath = "/org/freedesktop/secrets/aliases/default"
+	noPrompt       dbus.ObjectPath = "/"
+	sessionPrefix                  = "/org/freedesktop/secrets/session/s"
+	promptPrefix                   = "/org/freedesktop/secrets/prompt/p"
+
+	serviceInterface    = "org.freedesktop.Secret.Service"
+	collectionInterface = "org.freedesktop.Secret.Collection"
+	itemInterface       = "org.freedesktop.Secret.Item"
+	sessionInterface    = "org.freedesktop.Secret.Session"
+	promptInterface     = "org.freedesktop.Secret.Prompt"
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+	introspectInterface = "org.freedesktop.DBus.Introspectable"
+
+	itemLabelProperty      = itemInterface + ".Label"
+	itemAttributesProperty = itemInterface + ".Attributes"
+	collectionLabel        = "Passtool"
+	defaultAlias           = "default"
+)
+
+var (
+	errIsLocked     = dbus.NewError("org.freedesktop.Secret.Error.IsLocked", []interface{}{"the object is locked"})
+	errNoSession    = dbus.NewError("org.freedesktop.Secret.Error.NoSession", []interface{}{"the session doesn't exist"})
+	errNoSuchObject = dbus.NewError("org.freedesktop.Secret.Error.NoSuchObject", []interface{}{"no such item or collection"})
+	errNotSupported = dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []interface{}{"not supported by passtool"})
+)
+
+// Vault gives the provider access to the vault accounts and the secret keys
+type Vault interface {
+	// Accounts returns all the accounts with loaded services and passwords
+	Accounts() ([]models.Account, error)
+	// Unlock requests the secret key from the user, returns false if the user dismissed the request
+	Unlock() (bool, error)
+	// Lock forgets the secret keys
+	Lock()
+	// IsUnlocked checks whether a secret key is known
+	IsUnlocked() bool
+	// CanDecrypt checks whether the account password can be decrypted with the known secret keys
+	CanDecrypt(account models.Account) bool
+	// Secret returns the decrypted password of the account
+	Secret(account models.Account) (string, error)
+	// Create saves the new account with the password encrypted with the known secret key
+	Create(serviceName, login, password, attributes string) (models.Account, error)
+	// SetSecret saves the new password of the account
+	SetSecret(account models.Account, password string) error
+	// SetAttributes saves the JSON-encoded lookup attributes of the account
+	SetAttributes(account models.Account, attributes string) error
+	// Delete deletes the account
+	Delete(account models.Account) error
+}
+
+// Provider serves the Secret Service objects on the bus, each vault account is the item of the only collection
+type Provider struct {
+	conn  *dbus.Conn
+	vault Vault
+	// mu serializes calls of the bus clients
+	mu       sync.Mutex
+	sessions map[dbus.ObjectPath]*session
+	items    map[dbus.ObjectPath]bool
+	lastID   uint64
+}
+
+// NewProvider returns the provider serving the vault on the bus connection
+func NewProvider(conn *dbus.Conn, vault Vault) *Provider {
+	return &Provider{
+		conn:     conn,
+		vault:    vault,
+		sessions: make(map[dbus.ObjectPath]*session),
+		items:    make(map[dbus.ObjectPath]bool),
+	}
+}
+
+// Start exports the service and the collection and requests the bus name,
+// replace takes the name over from the running service if it allows that
+func (p *Provider) Start(replace bool) error {
+	svc := &service{p: p}
+	if err := p.export(servicePath, serviceInterface, svc, svc.properties(), serviceSignals); err != nil {
+		return err
+	}
+
+	c := &collection{p: p}
+	for _, path := range []dbus.ObjectPath{collectionPath, aliasPath} {
+		if err := p.export(path, collectionInterface, c, c.properties(), collectionSignals); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	_, err := p.loadAccounts()
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	flags := dbus.NameFlagDoNotQueue
+	if replace {
+		flags |= dbus.NameFlagReplaceExisting
+	}
+
+	reply, err := p.conn.RequestName(BusName, flags)
+	if err != nil {
+		return fmt.Errorf("unable to request bus name: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return errors.New("another Secret Service provider is running, e.g. GNOME Keyring or KWallet")
+	}
+
+	return nil
+}
+
+// export exports the object with its properties and introspection data at the path
+func (p *Provider) export(path dbus.ObjectPath, iface string, v interface{}, props *properties, signals []introspectSignal) error {
+	if err := p.conn.Export(v, path, iface); err != nil {
+		return fmt.Errorf("unable to export %s: %w", path, err)
+	}
+
+	if props != nil {
+		if err := p.conn.Export(props, path, propertiesInterface); err != nil {
+			return fmt.Errorf("unable to export %s properties: %w", path, err)
+		}
+	}
+
+	node := introspectNode(iface, v, props, signals)
+	if err := p.conn.Export(node, path, introspectInterface); err != nil {
+		return fmt.Errorf("unable to export %s introspection: %w", path, err)
+	}
+
+	return nil
+}
+
+// unexport removes the object from the bus
+func (p *Provider) unexport(path dbus.ObjectPath, iface string) {
+	for _, i := range []string{iface, propertiesInterface, introspectInterface} {
+		_ = p.conn.Export(nil, path, i)
+	}
+}
+
+// nextPath returns the new unique path with the given prefix
+func (p *Provider) nextPath(prefix string) dbus.ObjectPath {
+	p.lastID++
+	return dbus.ObjectPath(prefix + strconv.FormatUint(p.lastID, 10))
+}
+
+// loadAccounts returns the vault accounts and exports their items, items of deleted accounts are removed
+func (p *Provider) loadAccounts() ([]models.Account, error) {
+	accounts, err := p.vault.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[dbus.ObjectPath]bool, len(accounts))
+	for _, account := range accounts {
+		path := itemPath(account.ID)
+		current[path] = true
+		if p.items[path] {
+			continue
+		}
+
+		i := &item{p: p, id: account.ID}
+		if err = p.export(path, itemInterface, i, i.properties(), nil); err != nil {
+			return nil, err
+		}
+		p.items[path] = true
+	}
+
+	for path := range p.items {
+		if !current[path] {
+			p.unexport(path, itemInterface)
+			delete(p.items, path)
+		}
+	}
+
+	return accounts, nil
+}
+
+// findAccount returns the account of the item path
+func (p *Provider) findAccount(path dbus.ObjectPath) (models.Account, *dbus.Error) {
+	accounts, err := p.loadAccounts()
+	if err != nil {
+		return models.Account{}, dbus.MakeFailedError(err)
+	}
+
+	for _, account := range accounts {
+		if itemPath(account.ID) == path {
+			return account, nil
+		}
+	}
+
+	return models.Account{}, errNoSuchObject
+}
+
+// session returns the session opened by the sender
+func (p *Provider) session(path dbus.ObjectPath, sender dbus.Sender) (*session, *dbus.Error) {
+	ss, ok := p.sessions[path]
+	if !ok || ss.owner != sender {
+		return nil, errNoSession
+	}
+
+	return ss, nil
+}
+
+// emit emits the signal of the collection
+func (p *Provider) emit(signal string, path dbus.ObjectPath) {
+	_ = p.conn.Emit(collectionPath, collectionInterface+"."+signal, path)
+}
+
+// itemPath returns the path of the item of the account
+func itemPath(accountID uint) dbus.ObjectPath {
+	return collectionPath + "/" + dbus.ObjectPath(strconv.FormatUint(uint64(accountID), 10))
+}
+
+// asDBusError converts the error to the D-Bus error
+func asDBusError(err error) *dbus.Error {
+	var dbusErr *dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr
+	}
+
+	return dbus.MakeFailedError(err)
+}
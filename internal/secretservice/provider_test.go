@@ -0,0 +1,495 @@
+package secretservice
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/godbus/dbus/v5"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// busConfig is the config of the private session bus, everyone connected may own names and call everything
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// fakeVault keeps the accounts in memory, passwords are stored as plain text
+type fakeVault struct {
+	mu       sync.Mutex
+	accounts []models.Account
+	unlocked bool
+	// dismiss makes the user dismiss unlock requests
+	dismiss bool
+}
+
+func (v *fakeVault) Accounts() ([]models.Account, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]models.Account{}, v.accounts...), nil
+}
+
+func (v *fakeVault) Unlock() (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.unlocked = !v.dismiss
+	return v.unlocked, nil
+}
+
+func (v *fakeVault) Lock() {
+	v.setUnlocked(false)
+}
+
+func (v *fakeVault) IsUnlocked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.unlocked
+}
+
+func (v *fakeVault) CanDecrypt(models.Account) bool {
+	return v.IsUnlocked()
+}
+
+func (v *fakeVault) Secret(account models.Account) (string, error) {
+	return account.Password.Encrypted, nil
+}
+
+func (v *fakeVault) Create(serviceName, login, password, attributes string) (models.Account, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	account := models.Account{
+		Login:      login,
+		Service:    models.Service{Name: serviceName},
+		Password:   models.Password{Encrypted: password},
+		Attributes: attributes,
+	}
+	account.ID = uint(len(v.accounts) + 1)
+	v.accounts = append(v.accounts, account)
+
+	return account, nil
+}
+
+func (v *fakeVault) SetSecret(account models.Account, password string) error {
+	return v.update(account, func(a *models.Account) { a.Password.Encrypted = password })
+}
+
+func (v *fakeVault) SetAttributes(account models.Account, attributes string) error {
+	return v.update(account, func(a *models.Account) { a.Attributes = attributes })
+}
+
+func (v *fakeVault) Delete(account models.Account) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.accounts {
+		if v.accounts[i].ID == account.ID {
+			v.accounts = append(v.accounts[:i], v.accounts[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("account not found")
+}
+
+// setUnlocked sets whether a secret key is known
+func (v *fakeVault) setUnlocked(unlocked bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.unlocked = unlocked
+}
+
+// update changes the stored account
+func (v *fakeVault) update(account models.Account, change func(a *models.Account)) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range v.accounts {
+		if v.accounts[i].ID == account.ID {
+			change(&v.accounts[i])
+			return nil
+		}
+	}
+
+	return errors.New("account not found")
+}
+
+// account returns the stored account of the service with the login
+func (v *fakeVault) account(t *testing.T, serviceName, login string) models.Account {
+	t.Helper()
+	accounts, _ := v.Accounts()
+	for _, account := range accounts {
+		if account.Service.Name == serviceName && account.Login == login {
+			return account
+		}
+	}
+
+	t.Fatalf("account %q at %q is not found", login, serviceName)
+	return models.Account{}
+}
+
+// client is the application using the Secret Service
+type client struct {
+	conn    *dbus.Conn
+	address string
+}
+
+// startBus starts the private session bus, the test is skipped if dbus-daemon is not installed
+func startBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(busConfig, filepath.Join(dir, "bus"))), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	daemon := exec.Command("dbus-daemon", "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := daemon.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = daemon.Start(); err != nil {
+		t.Fatalf("unable to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = daemon.Process.Kill()
+		_ = daemon.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("unable to read bus address: %v", err)
+	}
+
+	return strings.TrimSpace(address)
+}
+
+// connect connects to the bus
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("unable to connect to bus: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// serve starts the provider of the vault on the private bus and returns the client connected to it
+func serve(t *testing.T, vault *fakeVault) client {
+	t.Helper()
+	address := startBus(t)
+	if err := NewProvider(connect(t, address), vault).Start(false); err != nil {
+		t.Fatalf("unable to start provider: %v", err)
+	}
+
+	return client{conn: connect(t, address), address: address}
+}
+
+// newVault returns the locked vault with the account of bob at github.com and the mail account of amy
+func newVault() *fakeVault {
+	v := &fakeVault{}
+	_, _ = v.Create("github.com", "bob", "password", "")
+	_, _ = v.Create("mail", "amy", "other", `{"app":"mail","username":"amy"}`)
+	return v
+}
+
+// call calls the method of the object and stores its results
+func (c client) call(path dbus.ObjectPath, method string, args []interface{}, results ...interface{}) error {
+	return c.conn.Object(BusName, path).Call(method, 0, args...).Store(results...)
+}
+
+// mustCall calls the method of the object and fails the test on error
+func (c client) mustCall(t *testing.T, path dbus.ObjectPath, method string, args []interface{}, results ...interface{}) {
+	t.Helper()
+	if err := c.call(path, method, args, results...); err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+}
+
+// openSession opens the session with the algorithm, the session key is agreed for the DH algorithm
+func (c client) openSession(t *testing.T, algorithm string) *session {
+	t.Helper()
+	input := dbus.MakeVariant("")
+	var private *dhKeyPair
+	if algorithm == algorithmDH {
+		private = newDHKeyPair(t)
+		input = dbus.MakeVariant(private.public.Bytes())
+	}
+
+	var output dbus.Variant
+	ss := &session{}
+	c.mustCall(t, servicePath, serviceInterface+".OpenSession", []interface{}{algorithm, input}, &output, &ss.path)
+	if private != nil {
+		serverKey, ok := output.Value().([]byte)
+		if !ok {
+			t.Fatalf("got output %v, want the public key", output)
+		}
+		ss.key = private.sharedKey(t, serverKey)
+	}
+
+	return ss
+}
+
+// waitPrompt performs the prompt and returns its result once it's completed
+func (c client) waitPrompt(t *testing.T, prompt dbus.ObjectPath) (bool, dbus.Variant) {
+	t.Helper()
+	if err := c.conn.AddMatchSignal(dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(promptInterface)); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	c.mustCall(t, prompt, promptInterface+".Prompt", []interface{}{""})
+	select {
+	case signal := <-signals:
+		if signal.Name != promptInterface+".Completed" || len(signal.Body) != 2 {
+			t.Fatalf("got signal %v, want Completed", signal)
+		}
+		return signal.Body[0].(bool), signal.Body[1].(dbus.Variant)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the prompt is not completed")
+		return false, dbus.Variant{}
+	}
+}
+
+// assertDBusError checks the name of the D-Bus error
+func assertDBusError(t *testing.T, err error, want *dbus.Error) {
+	t.Helper()
+	var got dbus.Error
+	if !errors.As(err, &got) || got.Name != want.Name {
+		t.Errorf("got error %v, want %s", err, want.Name)
+	}
+}
+
+func TestSearchAndUnlock(t *testing.T) {
+	vault := newVault()
+	c := serve(t, vault)
+	github, mail := itemPath(1), itemPath(2)
+
+	var unlocked, locked []dbus.ObjectPath
+	c.mustCall(t, servicePath, serviceInterface+".SearchItems", []interface{}{map[string]string{"service": "github.com"}}, &unlocked, &locked)
+	if len(unlocked) != 0 || !reflect.DeepEqual(locked, []dbus.ObjectPath{github}) {
+		t.Errorf("got unlocked %v and locked %v, want the github item locked", unlocked, locked)
+	}
+
+	var found []dbus.ObjectPath
+	c.mustCall(t, collectionPath, collectionInterface+".SearchItems", []interface{}{map[string]string{"app": "mail"}}, &found)
+	if !reflect.DeepEqual(found, []dbus.ObjectPath{mail}) {
+		t.Errorf("got %v searching by saved attributes, want the mail item", found)
+	}
+
+	var prompt dbus.ObjectPath
+	c.mustCall(t, servicePath, serviceInterface+".Unlock", []interface{}{[]dbus.ObjectPath{github}}, &unlocked, &prompt)
+	if len(unlocked) != 0 || prompt == noPrompt {
+		t.Fatalf("got unlocked %v and prompt %v, want the prompt", unlocked, prompt)
+	}
+	dismissed, result := c.waitPrompt(t, prompt)
+	if dismissed || !reflect.DeepEqual(result.Value(), []dbus.ObjectPath{github}) {
+		t.Errorf("got dismissed %v with %v, want the github item unlocked", dismissed, result)
+	}
+
+	ss := c.openSession(t, algorithmPlain)
+	var secrets map[dbus.ObjectPath]secret
+	c.mustCall(t, servicePath, serviceInterface+".GetSecrets", []interface{}{[]dbus.ObjectPath{github, mail}, ss.path}, &secrets)
+	got := make(map[dbus.ObjectPath]string)
+	for path, sec := range secrets {
+		got[path] = string(sec.Value)
+	}
+	if want := map[dbus.ObjectPath]string{github: "password", mail: "other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got secrets %q, want %q", got, want)
+	}
+
+	// no prompt is needed for unlocked items
+	c.mustCall(t, servicePath, serviceInterface+".Unlock", []interface{}{[]dbus.ObjectPath{mail}}, &unlocked, &prompt)
+	if !reflect.DeepEqual(unlocked, []dbus.ObjectPath{mail}) || prompt != noPrompt {
+		t.Errorf("got unlocked %v and prompt %v, want the item unlocked without the prompt", unlocked, prompt)
+	}
+}
+
+func TestUnlockDismissed(t *testing.T) {
+	vault := newVault()
+	vault.dismiss = true
+	c := serve(t, vault)
+
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	c.mustCall(t, servicePath, serviceInterface+".Unlock", []interface{}{[]dbus.ObjectPath{collectionPath}}, &unlocked, &prompt)
+	if dismissed, _ := c.waitPrompt(t, prompt); !dismissed {
+		t.Error("got the prompt completed, want it dismissed")
+	}
+	if vault.IsUnlocked() {
+		t.Error("got the vault unlocked")
+	}
+}
+
+func TestLockedItemsRefuseSecrets(t *testing.T) {
+	c := serve(t, newVault())
+	ss := c.openSession(t, algorithmPlain)
+
+	var sec secret
+	err := c.call(itemPath(1), itemInterface+".GetSecret", []interface{}{ss.path}, &sec)
+	assertDBusError(t, err, errIsLocked)
+
+	var secrets map[dbus.ObjectPath]secret
+	c.mustCall(t, servicePath, serviceInterface+".GetSecrets", []interface{}{[]dbus.ObjectPath{itemPath(1)}, ss.path}, &secrets)
+	if len(secrets) != 0 {
+		t.Errorf("got secrets %v of locked items", secrets)
+	}
+
+	var item, prompt dbus.ObjectPath
+	props := map[string]dbus.Variant{itemLabelProperty: dbus.MakeVariant("example.com")}
+	err = c.call(collectionPath, collectionInterface+".CreateItem", []interface{}{props, secret{Session: ss.path, Value: []byte("x")}, false}, &item, &prompt)
+	assertDBusError(t, err, errIsLocked)
+}
+
+func TestSessionOfAnotherClient(t *testing.T) {
+	vault := newVault()
+	vault.setUnlocked(true)
+	c := serve(t, vault)
+	ss := c.openSession(t, algorithmPlain)
+
+	intruder := client{conn: connect(t, c.address), address: c.address}
+
+	var sec secret
+	err := intruder.call(itemPath(1), itemInterface+".GetSecret", []interface{}{ss.path}, &sec)
+	assertDBusError(t, err, errNoSession)
+
+	c.mustCall(t, ss.path, sessionInterface+".Close", nil)
+	err = c.call(itemPath(1), itemInterface+".GetSecret", []interface{}{ss.path}, &sec)
+	assertDBusError(t, err, errNoSession)
+}
+
+func TestCreateItemInEncryptedSession(t *testing.T) {
+	vault := newVault()
+	vault.setUnlocked(true)
+	c := serve(t, vault)
+	ss := c.openSession(t, algorithmDH)
+
+	create := func(value string, replace bool) dbus.ObjectPath {
+		t.Helper()
+		sec, err := ss.encode([]byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		props := map[string]dbus.Variant{
+			itemLabelProperty:      dbus.MakeVariant("example.com"),
+			itemAttributesProperty: dbus.MakeVariant(map[string]string{"username": "eve", "app": "browser"}),
+		}
+
+		var item, prompt dbus.ObjectPath
+		c.mustCall(t, collectionPath, collectionInterface+".CreateItem", []interface{}{props, sec, replace}, &item, &prompt)
+		if prompt != noPrompt {
+			t.Errorf("got prompt %v creating item, want none", prompt)
+		}
+		return item
+	}
+
+	item := create("hunter2", false)
+	account := vault.account(t, "example.com", "eve")
+	if item != itemPath(account.ID) || account.Password.Encrypted != "hunter2" || account.Attributes != `{"app":"browser","username":"eve"}` {
+		t.Errorf("got item %v of account %+v, want the account of eve with the decrypted secret", item, account)
+	}
+
+	var sec secret
+	c.mustCall(t, item, itemInterface+".GetSecret", []interface{}{ss.path}, &sec)
+	if string(sec.Value) == "hunter2" {
+		t.Error("got the plain secret in the encrypted session")
+	}
+	if value, err := ss.decode(sec); err != nil || string(value) != "hunter2" {
+		t.Errorf("got secret %q, %v, want hunter2", value, err)
+	}
+
+	if replaced := create("changed", true); replaced != item {
+		t.Errorf("got item %v replacing, want %v", replaced, item)
+	}
+	if got := vault.account(t, "example.com", "eve").Password.Encrypted; got != "changed" {
+		t.Errorf("got password %q after replacing, want changed", got)
+	}
+
+	if added := create("third", false); added == item {
+		t.Error("got the item replaced, want the new one")
+	}
+	vault.account(t, "example.com", "eve (2)")
+}
+
+func TestItemChanges(t *testing.T) {
+	vault := newVault()
+	vault.setUnlocked(true)
+	c := serve(t, vault)
+	ss := c.openSession(t, algorithmPlain)
+	github := itemPath(1)
+
+	c.mustCall(t, github, itemInterface+".SetSecret", []interface{}{secret{Session: ss.path, Parameters: []byte{}, Value: []byte("changed")}})
+	if got := vault.account(t, "github.com", "bob").Password.Encrypted; got != "changed" {
+		t.Errorf("got password %q, want changed", got)
+	}
+
+	attributes := map[string]string{"service": "github.com", "username": "bob", "scope": "repo"}
+	c.mustCall(t, github, propertiesInterface+".Set", []interface{}{itemInterface, "Attributes", dbus.MakeVariant(attributes)})
+	var value dbus.Variant
+	c.mustCall(t, github, propertiesInterface+".Get", []interface{}{itemInterface, "Attributes"}, &value)
+	if !reflect.DeepEqual(value.Value(), attributes) {
+		t.Errorf("got attributes %v, want %v", value, attributes)
+	}
+	err := c.call(github, propertiesInterface+".Set", []interface{}{itemInterface, "Label", dbus.MakeVariant("other")})
+	assertDBusError(t, err, errNotSupported)
+
+	var prompt dbus.ObjectPath
+	c.mustCall(t, github, itemInterface+".Delete", nil, &prompt)
+	if accounts, _ := vault.Accounts(); len(accounts) != 1 {
+		t.Errorf("got %d accounts, want the deleted one removed", len(accounts))
+	}
+	c.mustCall(t, collectionPath, propertiesInterface+".Get", []interface{}{collectionInterface, "Items"}, &value)
+	if !reflect.DeepEqual(value.Value(), []dbus.ObjectPath{itemPath(2)}) {
+		t.Errorf("got items %v, want the deleted one removed", value)
+	}
+	if err = c.call(github, itemInterface+".GetSecret", []interface{}{ss.path}, &secret{}); err == nil {
+		t.Error("got the secret of the deleted item")
+	}
+}
+
+func TestDefaultAlias(t *testing.T) {
+	vault := newVault()
+	c := serve(t, vault)
+
+	var path dbus.ObjectPath
+	c.mustCall(t, servicePath, serviceInterface+".ReadAlias", []interface{}{defaultAlias}, &path)
+	if path != collectionPath {
+		t.Errorf("got %v for the default alias, want the collection", path)
+	}
+
+	var locked dbus.Variant
+	c.mustCall(t, aliasPath, propertiesInterface+".Get", []interface{}{collectionInterface, "Locked"}, &locked)
+	if locked.Value() != true {
+		t.Errorf("got locked %v of the locked vault, want true", locked)
+	}
+
+	var lockedItems []dbus.ObjectPath
+	vault.setUnlocked(true)
+	c.mustCall(t, servicePath, serviceInterface+".Lock", []interface{}{[]dbus.ObjectPath{collectionPath}}, &lockedItems, &path)
+	if vault.IsUnlocked() {
+		t.Error("got the vault unlocked after locking")
+	}
+}
@@ -0,0 +1,186 @@
+package secretservice
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+var serviceSignals = []introspectSignal{
+	{name: "CollectionCreated", args: []string{"o"}},
+	{name: "CollectionDeleted", args: []string{"o"}},
+	{name: "CollectionChanged", args: []string{"o"}},
+}
+
+// service implements org.freedesktop.Secret.Service
+type service struct {
+	p *Provider
+}
+
+// properties returns the properties of the service
+func (s *service) properties() *properties {
+	return &properties{
+		p:     s.p,
+		iface: serviceInterface,
+		types: map[string]string{"Collections": "ao"},
+		get: func() (map[string]dbus.Variant, *dbus.Error) {
+			return map[string]dbus.Variant{"Collections": dbus.MakeVariant([]dbus.ObjectPath{collectionPath})}, nil
+		},
+	}
+}
+
+// OpenSession opens the session to transfer secrets with the given algorithm
+func (s *service) OpenSession(sender dbus.Sender, algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	ss := &session{p: s.p, path: s.p.nextPath(sessionPrefix), owner: sender}
+	output, err := ss.negotiate(algorithm, input)
+	if err != nil {
+		return dbus.Variant{}, noPrompt, asDBusError(err)
+	}
+
+	if err = s.p.conn.Export(ss, ss.path, sessionInterface); err != nil {
+		return dbus.Variant{}, noPrompt, dbus.MakeFailedError(err)
+	}
+	s.p.sessions[ss.path] = ss
+
+	return output, ss.path, nil
+}
+
+// CreateCollection returns the only collection as passtool keeps all the items in the vault
+func (s *service) CreateCollection(properties map[string]dbus.Variant, alias string) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return collectionPath, noPrompt, nil
+}
+
+// SearchItems returns the unlocked and locked items with the given attributes
+func (s *service) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	accounts, err := s.p.loadAccounts()
+	if err != nil {
+		return nil, nil, dbus.MakeFailedError(err)
+	}
+
+	unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	for _, account := range accounts {
+		if !matchAttributes(itemAttributes(account), attributes) {
+			continue
+		}
+
+		if s.p.vault.CanDecrypt(account) {
+			unlocked = append(unlocked, itemPath(account.ID))
+		} else {
+			locked = append(locked, itemPath(account.ID))
+		}
+	}
+
+	return unlocked, locked, nil
+}
+
+// Unlock unlocks the objects, the prompt requesting the secret key is returned if some of them are locked
+func (s *service) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	unlocked, locked, err := s.p.lockState(objects)
+	if err != nil {
+		return nil, noPrompt, err
+	}
+	if len(locked) == 0 {
+		return unlocked, noPrompt, nil
+	}
+
+	pr, err := s.p.newPrompt(func() (dbus.Variant, bool) {
+		ok, err := s.p.vault.Unlock()
+		if err != nil || !ok {
+			return dbus.MakeVariant([]dbus.ObjectPath{}), true
+		}
+
+		s.p.mu.Lock()
+		defer s.p.mu.Unlock()
+		unlocked, _, _ := s.p.lockState(objects)
+		return dbus.MakeVariant(unlocked), false
+	})
+	if err != nil {
+		return nil, noPrompt, err
+	}
+
+	return []dbus.ObjectPath{}, pr, nil
+}
+
+// Lock forgets the secret keys, so all the items are locked
+func (s *service) Lock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	s.p.vault.Lock()
+	return objects, noPrompt, nil
+}
+
+// GetSecrets returns the secrets of the unlocked items among the given ones
+func (s *service) GetSecrets(sender dbus.Sender, items []dbus.ObjectPath, sessionPath dbus.ObjectPath) (map[dbus.ObjectPath]secret, *dbus.Error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	ss, dbusErr := s.p.session(sessionPath, sender)
+	if dbusErr != nil {
+		return nil, dbusErr
+	}
+
+	secrets := make(map[dbus.ObjectPath]secret, len(items))
+	for _, path := range items {
+		account, dbusErr := s.p.findAccount(path)
+		if dbusErr != nil || !s.p.vault.CanDecrypt(account) {
+			continue
+		}
+
+		sec, dbusErr := s.p.itemSecret(account, ss)
+		if dbusErr != nil {
+			return nil, dbusErr
+		}
+		secrets[path] = sec
+	}
+
+	return secrets, nil
+}
+
+// ReadAlias returns the collection for the default alias
+func (s *service) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if name != defaultAlias {
+		return noPrompt, nil
+	}
+
+	return collectionPath, nil
+}
+
+// SetAlias accepts the default alias of the only collection only
+func (s *service) SetAlias(name string, collection dbus.ObjectPath) *dbus.Error {
+	if name != defaultAlias || (collection != collectionPath && collection != aliasPath) {
+		return errNotSupported
+	}
+
+	return nil
+}
+
+// lockState splits the objects into unlocked and locked ones, the collection is unlocked if a secret key is known
+func (p *Provider) lockState(objects []dbus.ObjectPath) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	for _, path := range objects {
+		isUnlocked := p.vault.IsUnlocked()
+		if path != collectionPath && path != aliasPath {
+			account, err := p.findAccount(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			isUnlocked = p.vault.CanDecrypt(account)
+		}
+
+		if isUnlocked {
+			unlocked = append(unlocked, path)
+		} else {
+			locked = append(locked, path)
+		}
+	}
+
+	return unlocked, locked, nil
+}
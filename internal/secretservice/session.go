@@ -0,0 +1,156 @@
+package secretservice
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"math/big"
+)
+
+const (
+	algorithmPlain = "plain"
+	algorithmDH    = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
+	contentType    = "text/plain; charset=utf8"
+)
+
+// dhPrime is the 1024-bit MODP group prime of RFC 2409 the Secret Service uses with the generator 2
+var dhPrime, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+	"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9"+
+	"A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+// secret is the secret value passed over the bus, encrypted with the session key if the session has one
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// session is the session secrets are transferred in, key is nil for the plain algorithm
+type session struct {
+	p     *Provider
+	path  dbus.ObjectPath
+	owner dbus.Sender
+	key   []byte
+}
+
+// Close closes the session
+func (ss *session) Close() *dbus.Error {
+	ss.p.mu.Lock()
+	defer ss.p.mu.Unlock()
+
+	delete(ss.p.sessions, ss.path)
+	_ = ss.p.conn.Export(nil, ss.path, sessionInterface)
+	return nil
+}
+
+// negotiate agrees the session key with the client for the algorithm and returns the output for the client
+func (ss *session) negotiate(algorithm string, input dbus.Variant) (dbus.Variant, error) {
+	switch algorithm {
+	case algorithmPlain:
+		return dbus.MakeVariant(""), nil
+	case algorithmDH:
+		clientKey, ok := input.Value().([]byte)
+		if !ok {
+			return dbus.Variant{}, errors.New("the public key must be a byte array")
+		}
+
+		publicKey, key, err := deriveSessionKey(clientKey)
+		if err != nil {
+			return dbus.Variant{}, err
+		}
+
+		ss.key = key
+		return dbus.MakeVariant(publicKey), nil
+	default:
+		return dbus.Variant{}, errNotSupported
+	}
+}
+
+// encode returns the value as the secret of the session
+func (ss *session) encode(value []byte) (secret, error) {
+	s := secret{Session: ss.path, Parameters: []byte{}, Value: value, ContentType: contentType}
+	if ss.key == nil {
+		return s, nil
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return secret{}, err
+	}
+
+	block, err := aes.NewCipher(ss.key)
+	if err != nil {
+		return secret{}, err
+	}
+
+	padding := aes.BlockSize - len(value)%aes.BlockSize
+	encrypted := append(append([]byte{}, value...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	s.Parameters, s.Value = iv, encrypted
+	return s, nil
+}
+
+// decode returns the value of the secret of the session
+func (ss *session) decode(s secret) ([]byte, error) {
+	if ss.key == nil {
+		return s.Value, nil
+	}
+
+	if len(s.Parameters) != aes.BlockSize || len(s.Value) == 0 || len(s.Value)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted secret")
+	}
+
+	block, err := aes.NewCipher(ss.key)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, len(s.Value))
+	cipher.NewCBCDecrypter(block, s.Parameters).CryptBlocks(value, s.Value)
+
+	padding := int(value[len(value)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(value[len(value)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("invalid secret padding")
+	}
+
+	return value[:len(value)-padding], nil
+}
+
+// deriveSessionKey performs the Diffie-Hellman exchange with the client public key,
+// returns the public key for the client and the AES key derived from the shared secret with HKDF
+func deriveSessionKey(clientKey []byte) ([]byte, []byte, error) {
+	clientPublic := new(big.Int).SetBytes(clientKey)
+	upper := new(big.Int).Sub(dhPrime, big.NewInt(1))
+	if clientPublic.Cmp(big.NewInt(1)) <= 0 || clientPublic.Cmp(upper) >= 0 {
+		return nil, nil, errors.New("invalid public key")
+	}
+
+	private, err := rand.Int(rand.Reader, upper)
+	if err != nil {
+		return nil, nil, err
+	}
+	private.Add(private, big.NewInt(1))
+
+	public := new(big.Int).Exp(big.NewInt(2), private, dhPrime)
+	shared := new(big.Int).Exp(clientPublic, private, dhPrime)
+
+	// the shared secret is padded to the prime size
+	ikm := make([]byte, (dhPrime.BitLen()+7)/8)
+	shared.FillBytes(ikm)
+
+	key := make([]byte, 16)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, ikm, nil, nil), key); err != nil {
+		return nil, nil, fmt.Errorf("unable to derive session key: %w", err)
+	}
+
+	return public.Bytes(), key, nil
+}
@@ -0,0 +1,98 @@
+package secretservice
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"math/big"
+	"testing"
+)
+
+// dhKeyPair is the Diffie-Hellman key pair of the client
+type dhKeyPair struct {
+	private *big.Int
+	public  *big.Int
+}
+
+// newDHKeyPair generates the key pair of the client in the group of the Secret Service
+func newDHKeyPair(t *testing.T) *dhKeyPair {
+	t.Helper()
+	private, err := rand.Int(rand.Reader, new(big.Int).Sub(dhPrime, big.NewInt(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	private.Add(private, big.NewInt(1))
+
+	return &dhKeyPair{private: private, public: new(big.Int).Exp(big.NewInt(2), private, dhPrime)}
+}
+
+// sharedKey returns the AES key the client derives from the public key of the service
+func (kp *dhKeyPair) sharedKey(t *testing.T, serverKey []byte) []byte {
+	t.Helper()
+	shared := new(big.Int).Exp(new(big.Int).SetBytes(serverKey), kp.private, dhPrime)
+	ikm := make([]byte, (dhPrime.BitLen()+7)/8)
+	shared.FillBytes(ikm)
+
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, nil), key); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestDeriveSessionKey(t *testing.T) {
+	client := newDHKeyPair(t)
+	serverKey, key, err := deriveSessionKey(client.public.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.sharedKey(t, serverKey); !bytes.Equal(got, key) {
+		t.Errorf("got client key %x, want the service key %x", got, key)
+	}
+
+	for _, invalid := range [][]byte{{0}, {1}, new(big.Int).Sub(dhPrime, big.NewInt(1)).Bytes(), dhPrime.Bytes()} {
+		if _, _, err = deriveSessionKey(invalid); err == nil {
+			t.Errorf("got the key derived from the invalid public key %x", invalid)
+		}
+	}
+}
+
+func TestSessionEncodeDecode(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"", "password", "exactly 16 bytes"} {
+		for name, ss := range map[string]*session{"plain": {}, "encrypted": {key: key}} {
+			sec, err := ss.encode([]byte(value))
+			if err != nil {
+				t.Fatalf("%s: unable to encode %q: %v", name, value, err)
+			}
+			if ss.key != nil && (len(sec.Value)%16 != 0 || bytes.Contains(sec.Value, []byte(value)) && value != "") {
+				t.Errorf("%s: got value %x, want %q encrypted", name, sec.Value, value)
+			}
+
+			decoded, err := ss.decode(sec)
+			if err != nil || string(decoded) != value {
+				t.Errorf("%s: got %q, %v, want %q", name, decoded, err, value)
+			}
+		}
+	}
+
+	ss := &session{key: key}
+	sec, err := ss.encode([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec.Value[len(sec.Value)-1] ^= 0xff
+	if _, err = ss.decode(sec); err == nil {
+		t.Error("got the secret with broken padding decoded")
+	}
+	if _, err = ss.decode(secret{Parameters: []byte{1}, Value: make([]byte, 16)}); err == nil {
+		t.Error("got the secret with the invalid IV decoded")
+	}
+}
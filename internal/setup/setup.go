@@ -0,0 +1,91 @@
+package setup
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/audit"
+	"github.com/MirToykin/passtool/internal/backup"
+	"github.com/MirToykin/passtool/internal/config"
+	"github.com/MirToykin/passtool/internal/gitsync"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"os"
+)
+
+// Components are the opened storage and the services working on top of it
+type Components struct {
+	Repo    storage.Repository
+	Syncer  *gitsync.Syncer
+	Backups *backup.Manager
+	Audit   *audit.Log
+}
+
+// Open opens the storage of the given config, the repository commits each change to the sync repository
+// if it's initialized and backs the storage up according to the backup policy.
+// If the storage is encrypted, getKey is called to get the storage key, warn reports failures of both.
+func Open(cfg *config.Config, getKey storage.KeyGetter, warn func(msg string, a ...interface{})) (Components, error) {
+	// the directory of the default vault is made by user, named vaults are created on first use
+	if cfg.Vault != "" {
+		if err := os.MkdirAll(cfg.BasePath, 0700); err != nil {
+			return Components{}, fmt.Errorf("unable to create vault directory: %w", err)
+		}
+	}
+
+	repo, err := storage.Open(cfg.StorageBackend, cfg.StoragePath, getKey)
+	if err != nil {
+		return Components{}, fmt.Errorf("unable to initialize DB: %w", err)
+	}
+
+	return Wrap(cfg, repo, warn)
+}
+
+// Wrap returns the components working on top of the opened repository of the given config,
+// the repository is wrapped the same way Open does
+func Wrap(cfg *config.Config, repo storage.Repository, warn func(msg string, a ...interface{})) (Components, error) {
+	syncer, err := gitsync.New(cfg.SyncPath)
+	if err != nil {
+		return Components{}, fmt.Errorf("unable to initialize sync: %w", err)
+	}
+
+	if syncer.IsInitialized() {
+		repo = gitsync.NewRepository(repo, syncer, warn)
+	}
+
+	var backupTargets []backup.Target
+	for _, rawURL := range cfg.BackupTargets {
+		target, err := backup.ParseTarget(rawURL)
+		if err != nil {
+			return Components{}, fmt.Errorf("unable to initialize backups: %w", err)
+		}
+		backupTargets = append(backupTargets, target)
+	}
+
+	backups := backup.NewManager(cfg.BackupPath, cfg.BackupFilenameTemplate, backup.Policy{
+		Changes:    cfg.BackupIndex,
+		Interval:   cfg.BackupInterval,
+		KeepLast:   cfg.BackupCountToStore,
+		KeepDaily:  cfg.BackupKeepDaily,
+		KeepWeekly: cfg.BackupKeepWeekly,
+	}).WithTargets(backupTargets, cfg.BackupKeyPath)
+
+	return Components{
+		Repo:    backup.NewRepository(repo, backups, warn),
+		Syncer:  syncer,
+		Backups: backups,
+		Audit:   audit.New(cfg.AuditLogPath),
+	}, nil
+}
+
+// AuditEntry returns the audit log entry of the operation with the account, services and logins are not recorded
+// when the storage is encrypted, such entries reference accounts by their IDs
+func AuditEntry(repo storage.Repository, operation string, account *models.Account, details string) audit.Entry {
+	entry := audit.Entry{Operation: operation, Details: details}
+	if account != nil {
+		entry.AccountID = account.ID
+		if encrypted, err := repo.IsEncrypted(); err == nil && !encrypted {
+			entry.Service = account.Service.Name
+			entry.Login = account.Login
+		}
+	}
+
+	return entry
+}
@@ -0,0 +1,211 @@
+package sharing
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/crypto"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"strings"
+	"time"
+)
+
+const (
+	dataKeyLength = 32
+	saltLength    = 32
+	bundleVersion = 1
+)
+
+// ErrWrongPassphrase is returned when the identity private key can't be decrypted with the given passphrase
+var ErrWrongPassphrase = errors.New("wrong identity passphrase")
+
+// Bundle contains accounts shared with the recipient, only the recipient is able to open it
+type Bundle struct {
+	Version   int           `json:"version"`
+	Recipient string        `json:"recipient"`
+	PublicKey string        `json:"public_key"`
+	CreatedAt time.Time     `json:"created_at"`
+	Entries   []BundleEntry `json:"entries"`
+}
+
+// BundleEntry is the account shared with the bundle recipient
+type BundleEntry struct {
+	Service    string `json:"service"`
+	Login      string `json:"login"`
+	WrappedKey string `json:"wrapped_key"`
+	Encrypted  string `json:"encrypted"`
+}
+
+// NewIdentity generates the own identity with the private key encrypted with the passphrase
+func NewIdentity(name, passphrase string, keyLen int) (models.Identity, error) {
+	publicKey, privateKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("unable to generate key pair: %w", err)
+	}
+
+	saltBytes, err := crypto.RandomBytes(saltLength)
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("unable to get salt: %w", err)
+	}
+	salt := base64.StdEncoding.EncodeToString(saltBytes)
+
+	key := crypto.DeriveKey(passphrase, salt, keyLen)
+	encrypted, err := crypto.Encrypt(key, base64.StdEncoding.EncodeToString(privateKey))
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("unable to encrypt private key: %w", err)
+	}
+
+	return models.Identity{
+		Name:                name,
+		PublicKey:           EncodeKey(publicKey),
+		EncryptedPrivateKey: encrypted,
+		Salt:                salt,
+	}, nil
+}
+
+// NewRecipient returns the identity of a teammate with the given public key
+func NewRecipient(name, encodedPublicKey string) (models.Identity, error) {
+	publicKey, err := DecodeKey(encodedPublicKey)
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	return models.Identity{Name: name, PublicKey: EncodeKey(publicKey)}, nil
+}
+
+// Unlock decrypts the private key of the own identity
+func Unlock(identity models.Identity, passphrase string, keyLen int) ([]byte, error) {
+	if !identity.IsOwn() {
+		return nil, fmt.Errorf("identity %q has no private key", identity.Name)
+	}
+
+	key := crypto.DeriveKey(passphrase, identity.Salt, keyLen)
+	decrypted, err := crypto.Decrypt(key, identity.EncryptedPrivateKey)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	privateKey, err := base64.StdEncoding.DecodeString(decrypted)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	// CFB decryption doesn't fail with a wrong key, so the result is checked against the public key
+	publicKey, err := crypto.PublicKeyOf(privateKey)
+	if err != nil || EncodeKey(publicKey) != identity.PublicKey {
+		return nil, ErrWrongPassphrase
+	}
+
+	return privateKey, nil
+}
+
+// Share encrypts the password with a new data key and wraps the key for each of the identities
+func Share(password string, identities []models.Identity) ([]models.Share, error) {
+	dataKey, err := crypto.RandomBytes(dataKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate data key: %w", err)
+	}
+
+	encrypted, err := crypto.EncryptBytes(dataKey, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt password: %w", err)
+	}
+
+	shares := make([]models.Share, 0, len(identities))
+	for _, identity := range identities {
+		publicKey, err := DecodeKey(identity.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("identity %q: %w", identity.Name, err)
+		}
+
+		wrapped, err := crypto.WrapKey(publicKey, dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to wrap data key for %q: %w", identity.Name, err)
+		}
+
+		shares = append(shares, models.Share{
+			IdentityID: identity.ID,
+			WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+			Encrypted:  base64.StdEncoding.EncodeToString(encrypted),
+			Identity:   identity,
+		})
+	}
+
+	return shares, nil
+}
+
+// NewBundle returns the bundle of the accounts shared with the recipient,
+// shares must have loaded accounts and their services
+func NewBundle(recipient models.Identity, shares []models.Share) Bundle {
+	bundle := Bundle{
+		Version:   bundleVersion,
+		Recipient: recipient.Name,
+		PublicKey: recipient.PublicKey,
+		CreatedAt: time.Now().UTC(),
+		Entries:   make([]BundleEntry, 0, len(shares)),
+	}
+
+	for _, share := range shares {
+		bundle.Entries = append(bundle.Entries, BundleEntry{
+			Service:    share.Account.Service.Name,
+			Login:      share.Account.Login,
+			WrappedKey: share.WrappedKey,
+			Encrypted:  share.Encrypted,
+		})
+	}
+
+	return bundle
+}
+
+// CheckRecipient checks that the bundle is made for the given identity
+func (b Bundle) CheckRecipient(identity models.Identity) error {
+	if b.Version > bundleVersion {
+		return fmt.Errorf("bundle version %d is not supported", b.Version)
+	}
+
+	if b.PublicKey != identity.PublicKey {
+		return fmt.Errorf("bundle is made for %q, not for %q", b.Recipient, identity.Name)
+	}
+
+	return nil
+}
+
+// Open decrypts the shared password with the recipient private key
+func (e BundleEntry) Open(privateKey []byte) (string, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(e.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode wrapped key: %w", err)
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(e.Encrypted)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode password: %w", err)
+	}
+
+	dataKey, err := crypto.UnwrapKey(privateKey, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("unable to unwrap data key: %w", err)
+	}
+
+	password, err := crypto.DecryptBytes(dataKey, encrypted)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt password: %w", err)
+	}
+
+	return string(password), nil
+}
+
+// EncodeKey returns the text representation of the public key
+func EncodeKey(publicKey []byte) string {
+	return base64.StdEncoding.EncodeToString(publicKey)
+}
+
+// DecodeKey parses the text representation of the public key
+func DecodeKey(encoded string) ([]byte, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(publicKey) != 32 {
+		return nil, errors.New("invalid public key")
+	}
+
+	return publicKey, nil
+}
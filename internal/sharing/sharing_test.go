@@ -0,0 +1,132 @@
+package sharing
+
+import (
+	"errors"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"testing"
+)
+
+const keyLen = 32
+
+// newOwnIdentity returns the own identity with the ID and its unlocked private key
+func newOwnIdentity(t *testing.T, id uint, name, passphrase string) (models.Identity, []byte) {
+	t.Helper()
+	identity, err := NewIdentity(name, passphrase, keyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity.ID = id
+
+	privateKey, err := Unlock(identity, passphrase, keyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return identity, privateKey
+}
+
+// sharedAccount returns the share with the account of the service with the login loaded
+func sharedAccount(share models.Share, service, login string) models.Share {
+	share.Account = models.Account{Login: login, Service: models.Service{Name: service}}
+	return share
+}
+
+func TestIdentityUnlock(t *testing.T) {
+	identity, err := NewIdentity("bob", "phrase", keyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.IsOwn() {
+		t.Fatal("got the identity without the private key")
+	}
+
+	if _, err = Unlock(identity, "wrong", keyLen); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("got %v with the wrong passphrase, want ErrWrongPassphrase", err)
+	}
+
+	recipient, err := NewRecipient("bob", identity.PublicKey)
+	if err != nil || recipient.PublicKey != identity.PublicKey || recipient.IsOwn() {
+		t.Errorf("got recipient %+v, %v, want the public key only", recipient, err)
+	}
+	if _, err = Unlock(recipient, "phrase", keyLen); err == nil {
+		t.Error("got the recipient without the private key unlocked")
+	}
+	for _, invalid := range []string{"", "not base64", EncodeKey([]byte("short"))} {
+		if _, err = NewRecipient("eve", invalid); err == nil {
+			t.Errorf("got the recipient with the invalid key %q", invalid)
+		}
+	}
+}
+
+func TestShareAndOpenBundle(t *testing.T) {
+	amy, amyKey := newOwnIdentity(t, 1, "amy", "amy phrase")
+	eve, eveKey := newOwnIdentity(t, 2, "eve", "eve phrase")
+
+	shares, err := Share("password", []models.Identity{amy, eve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 2 || shares[0].IdentityID != amy.ID || shares[1].IdentityID != eve.ID {
+		t.Fatalf("got shares %+v, want one for each identity", shares)
+	}
+
+	for _, tc := range []struct {
+		identity   models.Identity
+		privateKey []byte
+		share      models.Share
+	}{
+		{amy, amyKey, shares[0]},
+		{eve, eveKey, shares[1]},
+	} {
+		bundle := NewBundle(tc.identity, []models.Share{sharedAccount(tc.share, "github.com", "bob")})
+		if err = bundle.CheckRecipient(tc.identity); err != nil {
+			t.Errorf("%s: got %v checking the own bundle", tc.identity.Name, err)
+		}
+
+		entry := bundle.Entries[0]
+		if entry.Service != "github.com" || entry.Login != "bob" {
+			t.Errorf("%s: got entry %+v, want the shared account", tc.identity.Name, entry)
+		}
+		if password, err := entry.Open(tc.privateKey); err != nil || password != "password" {
+			t.Errorf("%s: got %q, %v, want the shared password", tc.identity.Name, password, err)
+		}
+	}
+
+	// the share of amy is not opened by eve
+	bundle := NewBundle(amy, []models.Share{sharedAccount(shares[0], "github.com", "bob")})
+	if err = bundle.CheckRecipient(eve); err == nil {
+		t.Error("got the bundle of amy accepted for eve")
+	}
+	if _, err = bundle.Entries[0].Open(eveKey); err == nil {
+		t.Error("got the entry of amy opened by eve")
+	}
+}
+
+func TestOpenChangedEntry(t *testing.T) {
+	amy, amyKey := newOwnIdentity(t, 1, "amy", "amy phrase")
+	shares, err := Share("password", []models.Identity{amy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := NewBundle(amy, []models.Share{sharedAccount(shares[0], "github.com", "bob")}).Entries[0]
+
+	other, err := Share("other", []models.Identity{amy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, changed := range map[string]BundleEntry{
+		"password of another share": {WrappedKey: entry.WrappedKey, Encrypted: other[0].Encrypted},
+		"invalid wrapped key":       {WrappedKey: "not base64", Encrypted: entry.Encrypted},
+		"invalid password":          {WrappedKey: entry.WrappedKey, Encrypted: "not base64"},
+	} {
+		if _, err = changed.Open(amyKey); err == nil {
+			t.Errorf("%s: got the entry opened", name)
+		}
+	}
+
+	bundle := Bundle{Version: bundleVersion + 1, PublicKey: amy.PublicKey}
+	if err = bundle.CheckRecipient(amy); err == nil {
+		t.Error("got the bundle of the unsupported version accepted")
+	}
+}
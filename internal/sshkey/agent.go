@@ -0,0 +1,74 @@
+package sshkey
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"sync"
+)
+
+// ErrDenied is returned to the client when the use of the key is not confirmed
+var ErrDenied = errors.New("use of the key is denied")
+
+// Agent is the ssh-agent serving keys from the in-memory keyring, each signature may require a confirmation
+type Agent struct {
+	agent.ExtendedAgent
+	// confirm is called before each signature with the key, nil means no confirmation is required
+	confirm func(key ssh.PublicKey) bool
+	// onSign is called after each signature with the key
+	onSign func(key ssh.PublicKey)
+	mu     sync.Mutex
+}
+
+// NewAgent returns the agent with the empty keyring
+func NewAgent(confirm func(key ssh.PublicKey) bool, onSign func(key ssh.PublicKey)) *Agent {
+	return &Agent{
+		ExtendedAgent: agent.NewKeyring().(agent.ExtendedAgent),
+		confirm:       confirm,
+		onSign:        onSign,
+	}
+}
+
+// Sign signs the data with the key after the confirmation
+func (a *Agent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags signs the data with the key using the given flags after the confirmation
+func (a *Agent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	if a.confirm != nil {
+		// confirmations are requested one by one
+		a.mu.Lock()
+		allowed := a.confirm(key)
+		a.mu.Unlock()
+		if !allowed {
+			return nil, ErrDenied
+		}
+	}
+
+	signature, err := a.ExtendedAgent.SignWithFlags(key, data, flags)
+	if err == nil && a.onSign != nil {
+		a.onSign(key)
+	}
+
+	return signature, err
+}
+
+// Serve serves the agent protocol on the connections accepted by the listener until it's closed
+func (a *Agent) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			_ = agent.ServeAgent(a, conn)
+		}()
+	}
+}
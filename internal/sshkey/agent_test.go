@@ -0,0 +1,119 @@
+package sshkey
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// serveAgent serves the agent on the socket in the temporary directory and returns the client connected to it,
+// the agent is stopped when the test ends
+func serveAgent(t *testing.T, a *Agent) agent.ExtendedAgent {
+	t.Helper()
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- a.Serve(listener)
+	}()
+
+	conn, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = listener.Close()
+		if err := <-served; err != nil {
+			t.Errorf("got agent stopped with %v, want nil", err)
+		}
+	})
+
+	return agent.NewClient(conn)
+}
+
+// addKey generates the key and adds it to the agent
+func addKey(t *testing.T, a *Agent) ssh.PublicKey {
+	t.Helper()
+	key, err := Generate(TypeEd25519, 0, "bob@laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := Parse(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Add(agent.AddedKey{PrivateKey: privateKey, Comment: "bob@laptop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.Public))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return publicKey
+}
+
+func TestAgentSignsWithConfirmedKeys(t *testing.T) {
+	allow := true
+	var confirmed, signed []string
+	a := NewAgent(func(key ssh.PublicKey) bool {
+		confirmed = append(confirmed, ssh.FingerprintSHA256(key))
+		return allow
+	}, func(key ssh.PublicKey) {
+		signed = append(signed, ssh.FingerprintSHA256(key))
+	})
+	publicKey := addKey(t, a)
+	client := serveAgent(t, a)
+
+	keys, err := client.List()
+	if err != nil || len(keys) != 1 || keys[0].Comment != "bob@laptop" {
+		t.Fatalf("got keys %v, %v, want the added key", keys, err)
+	}
+
+	data := []byte("session data")
+	signature, err := client.Sign(publicKey, data)
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	if err = publicKey.Verify(data, signature); err != nil {
+		t.Errorf("got invalid signature: %v", err)
+	}
+
+	// the client gets a generic failure of the agent protocol
+	allow = false
+	if _, err = client.Sign(publicKey, data); err == nil {
+		t.Error("got the data signed without the confirmation, want an error")
+	}
+
+	fingerprint := ssh.FingerprintSHA256(publicKey)
+	if len(confirmed) != 2 || confirmed[0] != fingerprint || confirmed[1] != fingerprint {
+		t.Errorf("got confirmations of %q, want 2 of %q", confirmed, fingerprint)
+	}
+	if len(signed) != 1 || signed[0] != fingerprint {
+		t.Errorf("got signatures of %q, want the confirmed one of %q", signed, fingerprint)
+	}
+}
+
+func TestAgentWithoutConfirmation(t *testing.T) {
+	a := NewAgent(nil, nil)
+	publicKey := addKey(t, a)
+
+	if _, err := a.Sign(publicKey, []byte("data")); err != nil {
+		t.Errorf("unable to sign without confirmation: %v", err)
+	}
+
+	denied := NewAgent(func(ssh.PublicKey) bool { return false }, nil)
+	publicKey = addKey(t, denied)
+	if _, err := denied.Sign(publicKey, []byte("data")); !errors.Is(err, ErrDenied) {
+		t.Errorf("got error %v, want %v", err, ErrDenied)
+	}
+}
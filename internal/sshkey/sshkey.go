@@ -0,0 +1,128 @@
+package sshkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+// supported key types
+const (
+	TypeEd25519 = "ed25519"
+	TypeRSA     = "rsa"
+	TypeECDSA   = "ecdsa"
+)
+
+const defaultRSABits = 4096
+
+// Key is the private key in the OpenSSH format together with its public key in the authorized_keys format
+type Key struct {
+	Private string
+	Public  string
+}
+
+// Generate creates the new key of the given type, bits are used for RSA and ECDSA keys only, 0 means default
+func Generate(keyType string, bits int, comment string) (Key, error) {
+	var privateKey interface{}
+	var err error
+
+	switch keyType {
+	case TypeEd25519:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case TypeRSA:
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		privateKey, err = rsa.GenerateKey(rand.Reader, bits)
+	case TypeECDSA:
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return Key{}, fmt.Errorf("unsupported ECDSA key size %d, use 256, 384 or 521", bits)
+		}
+		privateKey, err = ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %q, use %s, %s or %s", keyType, TypeEd25519, TypeRSA, TypeECDSA)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("unable to generate key: %w", err)
+	}
+
+	return newKey(privateKey, comment)
+}
+
+// Import converts the private key in any format supported by OpenSSH to the unencrypted OpenSSH format,
+// getPassphrase is called if the key is protected with a passphrase
+func Import(data []byte, comment string, getPassphrase func() (string, error)) (Key, error) {
+	privateKey, err := ssh.ParseRawPrivateKey(data)
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, err := getPassphrase()
+		if err != nil {
+			return Key{}, err
+		}
+
+		privateKey, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(passphrase))
+		if err != nil {
+			return Key{}, fmt.Errorf("unable to decrypt key: %w", err)
+		}
+	} else if err != nil {
+		return Key{}, fmt.Errorf("unable to parse key: %w", err)
+	}
+
+	return newKey(privateKey, comment)
+}
+
+// Parse returns the private key kept in the OpenSSH format
+func Parse(private string) (interface{}, error) {
+	privateKey, err := ssh.ParseRawPrivateKey([]byte(private))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key: %w", err)
+	}
+
+	return privateKey, nil
+}
+
+// Fingerprint returns the SHA256 fingerprint and the type of the public key in the authorized_keys format
+func Fingerprint(public string) (fingerprint, keyType string, err error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(public))
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse public key: %w", err)
+	}
+
+	return ssh.FingerprintSHA256(publicKey), publicKey.Type(), nil
+}
+
+// newKey encodes the private key and its public key
+func newKey(privateKey interface{}, comment string) (Key, error) {
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return Key{}, fmt.Errorf("unable to encode key: %w", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return Key{}, fmt.Errorf("unable to get public key: %w", err)
+	}
+
+	public := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if comment != "" {
+		public += " " + comment
+	}
+
+	return Key{Private: string(pem.EncodeToMemory(block)), Public: public}, nil
+}
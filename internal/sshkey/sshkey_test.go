@@ -0,0 +1,135 @@
+package sshkey
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		keyType  string
+		bits     int
+		wantType string
+	}{
+		{TypeEd25519, 0, ssh.KeyAlgoED25519},
+		{TypeRSA, 2048, ssh.KeyAlgoRSA},
+		{TypeECDSA, 0, ssh.KeyAlgoECDSA256},
+		{TypeECDSA, 384, ssh.KeyAlgoECDSA384},
+		{TypeECDSA, 521, ssh.KeyAlgoECDSA521},
+	}
+
+	for _, tt := range tests {
+		key, err := Generate(tt.keyType, tt.bits, "bob@laptop")
+		if err != nil {
+			t.Fatalf("unable to generate %s key of %d bits: %v", tt.keyType, tt.bits, err)
+		}
+
+		if _, err = Parse(key.Private); err != nil {
+			t.Errorf("unable to parse generated %s key: %v", tt.keyType, err)
+		}
+		if !strings.HasSuffix(key.Public, " bob@laptop") {
+			t.Errorf("got public key %q, want the comment at the end", key.Public)
+		}
+		if _, keyType, err := Fingerprint(key.Public); err != nil || keyType != tt.wantType {
+			t.Errorf("got public key type %q, %v, want %q", keyType, err, tt.wantType)
+		}
+	}
+}
+
+func TestGenerateRejectsUnsupportedKeys(t *testing.T) {
+	for _, tt := range []struct {
+		keyType string
+		bits    int
+	}{{"dsa", 0}, {TypeECDSA, 128}} {
+		if _, err := Generate(tt.keyType, tt.bits, ""); err == nil {
+			t.Errorf("got %s key of %d bits generated, want an error", tt.keyType, tt.bits)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		wantAsked  bool
+		wantErr    bool
+	}{
+		{name: "plain", data: pem.EncodeToMemory(plain)},
+		{name: "protected", data: pem.EncodeToMemory(protected), passphrase: "passphrase", wantAsked: true},
+		{name: "wrong passphrase", data: pem.EncodeToMemory(protected), passphrase: "wrong", wantAsked: true, wantErr: true},
+		{name: "not a key", data: []byte("not a key"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked := false
+			key, err := Import(tt.data, "imported", func() (string, error) {
+				asked = true
+				return tt.passphrase, nil
+			})
+			if asked != tt.wantAsked {
+				t.Errorf("got passphrase asked %v, want %v", asked, tt.wantAsked)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Error("got the key imported, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to import key: %v", err)
+			}
+
+			// the imported key is kept unencrypted
+			if _, err = Parse(key.Private); err != nil {
+				t.Errorf("unable to parse imported key: %v", err)
+			}
+			if fingerprint, _, err := Fingerprint(key.Public); err != nil || fingerprint != wantFingerprint {
+				t.Errorf("got fingerprint %q, %v, want %q", fingerprint, err, wantFingerprint)
+			}
+		})
+	}
+}
+
+func TestImportFailsIfPassphraseIsNotGiven(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCancelled := errors.New("cancelled")
+	_, err = Import(pem.EncodeToMemory(protected), "", func() (string, error) {
+		return "", errCancelled
+	})
+	if !errors.Is(err, errCancelled) {
+		t.Errorf("got error %v, want %v", err, errCancelled)
+	}
+}
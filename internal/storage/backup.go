@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+)
+
+// backupDB writes a consistent copy of the database used by db to backupPath.
+// The in-memory database of the encrypted storage is written encrypted with the storage key,
+// the plain database is copied with the SQLite online backup, so concurrent writes can't corrupt the copy.
+func backupDB(db *gorm.DB, backupPath string) error {
+	if pool, ok := db.ConnPool.(*encryptedPool); ok {
+		data, err := serialize(db)
+		if err != nil {
+			return fmt.Errorf("unable to read storage: %w", err)
+		}
+
+		return writeEncrypted(backupPath, pool.key, pool.salt, data)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(backupPath), filepath.Base(backupPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	_ = tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err = onlineBackup(sqlDB, tmp.Name()); err != nil {
+		return fmt.Errorf("unable to backup database: %w", err)
+	}
+
+	if err = os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to set file permissions: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), backupPath); err != nil {
+		return fmt.Errorf("unable to replace file: %w", err)
+	}
+
+	return nil
+}
+
+// onlineBackup copies the database to the SQLite database file at the given path
+func onlineBackup(db *sql.DB, path string) error {
+	dsn, err := fileDSN(path, "")
+	if err != nil {
+		return err
+	}
+
+	dest, err := sql.Open(sqlite.DriverName, dsn)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	return withSQLiteConn(ctx, dest, func(destConn *sqlite3.SQLiteConn) error {
+		return withSQLiteConn(ctx, db, func(srcConn *sqlite3.SQLiteConn) error {
+			return copyDB(destConn, srcConn)
+		})
+	})
+}
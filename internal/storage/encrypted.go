@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/crypto"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+)
+
+const (
+	encryptedHeader      = "PASSTOOL-ENC-DB\x01"
+	encryptionSaltLength = 32
+	encryptionKeyLength  = 32
+)
+
+// ErrInvalidKey is returned when the storage can't be decrypted with the given key
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// KeyGetter returns the key the encrypted storage is protected with
+type KeyGetter func() (string, error)
+
+// isEncryptedFile checks whether the storage file at the given path is encrypted.
+// Not existing file is considered as not encrypted.
+func isEncryptedFile(storagePath string) (bool, error) {
+	f, err := os.Open(storagePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to open storage file: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, len(encryptedHeader))
+	n, _ := f.Read(header)
+
+	return n == len(encryptedHeader) && string(header) == encryptedHeader, nil
+}
+
+// encryptDB converts the plain storage used by db to the encrypted one protected with the given key.
+// The db must not be used for writing after the conversion.
+func encryptDB(db *gorm.DB, storagePath, secret string) error {
+	encrypted, err := isEncryptedFile(storagePath)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return errors.New("storage is already encrypted")
+	}
+
+	data, err := serialize(db)
+	if err != nil {
+		return fmt.Errorf("unable to read storage: %w", err)
+	}
+
+	key, salt, err := newStorageKey(secret)
+	if err != nil {
+		return err
+	}
+
+	return writeEncrypted(storagePath, key, salt, data)
+}
+
+// decryptDB converts the encrypted storage used by db to the plain one.
+// The db must not be used for writing after the conversion.
+func decryptDB(db *gorm.DB, storagePath string) error {
+	encrypted, err := isEncryptedFile(storagePath)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		return errors.New("storage is not encrypted")
+	}
+
+	data, err := serialize(db)
+	if err != nil {
+		return fmt.Errorf("unable to read storage: %w", err)
+	}
+
+	return writeFileAtomically(storagePath, data)
+}
+
+// encryptedPool is a gorm connection pool over the in-memory SQLite database,
+// the database is written to the encrypted storage file after each committed change
+type encryptedPool struct {
+	*sql.DB
+	path string
+	key  []byte
+	salt []byte
+}
+
+// BeginTx starts a transaction which flushes the database to the storage file on commit
+func (p *encryptedPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedTx{Tx: tx, pool: p}, nil
+}
+
+// ExecContext executes the query out of transaction and flushes the database to the storage file
+func (p *encryptedPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := p.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, p.flush(ctx)
+}
+
+// GetDBConn returns the underlying database handle
+func (p *encryptedPool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
+
+// flush writes current state of the database to the encrypted storage file
+func (p *encryptedPool) flush(ctx context.Context) error {
+	var data []byte
+	err := withSQLiteConn(ctx, p.DB, func(conn *sqlite3.SQLiteConn) (err error) {
+		data, err = conn.Serialize("main")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read storage: %w", err)
+	}
+
+	return writeEncrypted(p.path, p.key, p.salt, data)
+}
+
+type encryptedTx struct {
+	*sql.Tx
+	pool *encryptedPool
+}
+
+// Commit commits the transaction and flushes the database to the storage file
+func (t *encryptedTx) Commit() error {
+	if err := t.Tx.Commit(); err != nil {
+		return err
+	}
+
+	return t.pool.flush(context.Background())
+}
+
+// openEncrypted decrypts the storage file and loads it to the in-memory database
+func openEncrypted(storagePath string, secret string) (*encryptedPool, error) {
+	data, key, salt, err := readEncrypted(storagePath, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openMemoryDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = loadMemoryDB(db, data); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to load storage: %w", err)
+	}
+
+	return &encryptedPool{DB: db, path: storagePath, key: key, salt: salt}, nil
+}
+
+// openMemoryDB opens the in-memory database, which lives as long as its only connection
+func openMemoryDB() (*sql.DB, error) {
+	db, err := sql.Open(sqlite.DriverName, ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open in-memory database: %w", err)
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	return db, nil
+}
+
+// loadMemoryDB copies the serialized database into the in-memory database.
+// Deserialized database can't grow, so it is used only as a source of the SQLite backup.
+func loadMemoryDB(db *sql.DB, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	src, err := openMemoryDB()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	return withSQLiteConn(ctx, src, func(srcConn *sqlite3.SQLiteConn) error {
+		if err := srcConn.Deserialize(data, "main"); err != nil {
+			return err
+		}
+
+		return withSQLiteConn(ctx, db, func(destConn *sqlite3.SQLiteConn) error {
+			return copyDB(destConn, srcConn)
+		})
+	})
+}
+
+// copyDB copies the main database of src to the main database of dest with the SQLite online backup
+func copyDB(dest, src *sqlite3.SQLiteConn) error {
+	backup, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+
+	if _, err = backup.Step(-1); err != nil {
+		_ = backup.Finish()
+		return err
+	}
+
+	return backup.Finish()
+}
+
+// serialize returns the content of the main database used by db
+func serialize(db *gorm.DB) ([]byte, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err = withSQLiteConn(context.Background(), sqlDB, func(conn *sqlite3.SQLiteConn) (err error) {
+		data, err = conn.Serialize("main")
+		return err
+	})
+
+	return data, err
+}
+
+// withSQLiteConn calls fn with the driver connection of the given database
+func withSQLiteConn(ctx context.Context, db *sql.DB, fn func(conn *sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return errors.New("unexpected database driver")
+		}
+
+		return fn(sqliteConn)
+	})
+}
+
+// readEncrypted reads and decrypts the encrypted storage file,
+// returns the decrypted data with the key and the salt it was encrypted with
+func readEncrypted(storagePath, secret string) (data, key, salt []byte, err error) {
+	content, err := os.ReadFile(storagePath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to read storage file: %w", err)
+	}
+
+	salt, ciphertext, encrypted := splitEncrypted(content)
+	if !encrypted {
+		return nil, nil, nil, errors.New("storage file is corrupted")
+	}
+
+	key = deriveStorageKey(secret, salt)
+	data, err = crypto.DecryptBytes(key, ciphertext)
+	if err != nil {
+		return nil, nil, nil, ErrInvalidKey
+	}
+
+	return data, key, salt, nil
+}
+
+// splitEncrypted returns the salt and the encrypted data of the encrypted storage file content,
+// encrypted is false if the content is not the encrypted storage
+func splitEncrypted(content []byte) (salt, ciphertext []byte, encrypted bool) {
+	if !bytes.HasPrefix(content, []byte(encryptedHeader)) || len(content) < len(encryptedHeader)+encryptionSaltLength {
+		return nil, nil, false
+	}
+
+	payload := content[len(encryptedHeader):]
+	return payload[:encryptionSaltLength], payload[encryptionSaltLength:], true
+}
+
+// newStorageKey creates the storage encryption key from the secret with the new random salt
+func newStorageKey(secret string) (key, salt []byte, err error) {
+	salt, err = crypto.RandomBytes(encryptionSaltLength)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get salt: %w", err)
+	}
+
+	return deriveStorageKey(secret, salt), salt, nil
+}
+
+// deriveStorageKey creates the storage encryption key from the secret
+func deriveStorageKey(secret string, salt []byte) []byte {
+	return []byte(crypto.DeriveKey(secret, string(salt), encryptionKeyLength))
+}
+
+// writeEncrypted encrypts the data and writes it to the storage file
+func writeEncrypted(storagePath string, key, salt, data []byte) error {
+	encrypted, err := crypto.EncryptBytes(key, data)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt storage: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(encryptedHeader)
+	buf.Write(salt)
+	buf.Write(encrypted)
+
+	return writeFileAtomically(storagePath, buf.Bytes())
+}
+
+// writeFileAtomically replaces the file content, so the file is never left partially written
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to write temporary file: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to sync temporary file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temporary file: %w", err)
+	}
+
+	if err = os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("unable to set file permissions: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// storageFiles are the storage file names of the backends
+var storageFiles = map[string]string{
+	BackendSQLite: "passtool.db",
+	BackendFile:   "passtool.json",
+}
+
+// keyGetter returns the getter of the given storage key
+func keyGetter(key string) KeyGetter {
+	return func() (string, error) {
+		return key, nil
+	}
+}
+
+// noKey fails the test if the storage key is requested
+func noKey(t *testing.T) KeyGetter {
+	return func() (string, error) {
+		t.Helper()
+		t.Fatal("storage key is requested from the plain storage")
+		return "", nil
+	}
+}
+
+// openRepo opens the repository or fails the test
+func openRepo(t *testing.T, backend, path string, getKey KeyGetter) Repository {
+	t.Helper()
+	repo, err := Open(backend, path, getKey)
+	if err != nil {
+		t.Fatalf("unable to open storage: %v", err)
+	}
+
+	return repo
+}
+
+// saveAccount saves the account of the service with the password
+func saveAccount(t *testing.T, repo Repository, service, login, password string) {
+	t.Helper()
+	s, err := repo.Services().FetchOrCreate(service)
+	if err != nil {
+		t.Fatalf("unable to save service: %v", err)
+	}
+
+	account := models.Account{Login: login, Service: s, ServiceID: s.ID}
+	if err = repo.Accounts().SaveWithPassword(&account, &models.Password{Encrypted: password, Salt: "salt"}); err != nil {
+		t.Fatalf("unable to save account: %v", err)
+	}
+}
+
+// storedPasswords returns the encrypted passwords of the accounts by "service/login"
+func storedPasswords(t *testing.T, repo Repository) map[string]string {
+	t.Helper()
+	accounts, err := repo.Accounts().List()
+	if err != nil {
+		t.Fatalf("unable to list accounts: %v", err)
+	}
+
+	passwords := make(map[string]string)
+	for _, account := range accounts {
+		passwords[account.Service.Name+"/"+account.Login] = account.Password.Encrypted
+	}
+
+	return passwords
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			repo := openRepo(t, backend, path, noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+
+			if err := repo.Encrypt("storage key"); err != nil {
+				t.Fatalf("unable to encrypt storage: %v", err)
+			}
+			if encrypted, err := isEncryptedFile(path); err != nil || !encrypted {
+				t.Fatalf("got encrypted %v, %v, want the storage file encrypted", encrypted, err)
+			}
+
+			repo = openRepo(t, backend, path, keyGetter("storage key"))
+			if encrypted, err := repo.IsEncrypted(); err != nil || !encrypted {
+				t.Errorf("got encrypted %v, %v after reopening, want true", encrypted, err)
+			}
+			saveAccount(t, repo, "gitlab.com", "amy", "other")
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, plain := range []string{"github.com", "gitlab.com", "amy"} {
+				if bytes.Contains(content, []byte(plain)) {
+					t.Errorf("got %q in the encrypted storage file", plain)
+				}
+			}
+
+			repo = openRepo(t, backend, path, keyGetter("storage key"))
+			want := map[string]string{"github.com/bob": "password", "gitlab.com/amy": "other"}
+			if got := storedPasswords(t, repo); !reflect.DeepEqual(got, want) {
+				t.Errorf("got accounts %q after reopening, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEncryptedStorageWrongKey(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			repo := openRepo(t, backend, path, noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+			if err := repo.Encrypt("storage key"); err != nil {
+				t.Fatalf("unable to encrypt storage: %v", err)
+			}
+
+			if _, err := Open(backend, path, keyGetter("wrong key")); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("got %v with the wrong key, want ErrInvalidKey", err)
+			}
+			if _, err := OpenReadOnly(backend, path, keyGetter("wrong key")); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("got %v opening for reading with the wrong key, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
+
+func TestDecryptStorage(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			repo := openRepo(t, backend, path, noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+			if err := repo.Encrypt("storage key"); err != nil {
+				t.Fatalf("unable to encrypt storage: %v", err)
+			}
+
+			repo = openRepo(t, backend, path, keyGetter("storage key"))
+			if err := repo.Decrypt(); err != nil {
+				t.Fatalf("unable to decrypt storage: %v", err)
+			}
+			if err := repo.Decrypt(); err == nil {
+				t.Error("got the plain storage decrypted again, want an error")
+			}
+
+			repo = openRepo(t, backend, path, noKey(t))
+			if encrypted, err := repo.IsEncrypted(); err != nil || encrypted {
+				t.Errorf("got encrypted %v, %v after decrypting, want false", encrypted, err)
+			}
+			want := map[string]string{"github.com/bob": "password"}
+			if got := storedPasswords(t, repo); !reflect.DeepEqual(got, want) {
+				t.Errorf("got accounts %q after decrypting, want %q", got, want)
+			}
+		})
+	}
+}
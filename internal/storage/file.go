@@ -0,0 +1,1050 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/crypto"
+	"github.com/MirToykin/passtool/internal/lib/filelock"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"gorm.io/gorm"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	fileVaultVersion = 1
+	fileLockTimeout  = 5 * time.Second
+)
+
+// FileRepository is the Repository implementation over a single JSON file.
+// The file is pretty-printed and ordered, so it can be synced through git or file-sync tools.
+// Changes are applied to the file reloaded while holding the lock file, so concurrent processes don't lose them.
+type FileRepository struct {
+	path  string
+	key   []byte
+	salt  []byte
+	vault fileVault
+}
+
+type fileVault struct {
+	Version int `json:"version"`
+	// NextIDs are the IDs of the next records, so IDs of deleted records are not given to new ones
+	NextIDs    fileNextIDs    `json:"next_ids"`
+	Services   []fileService  `json:"services"`
+	Accounts   []fileAccount  `json:"accounts"`
+	Passwords  []filePassword `json:"passwords"`
+	Identities []fileIdentity `json:"identities,omitempty"`
+	Shares     []fileShare    `json:"shares,omitempty"`
+}
+
+type fileNextIDs struct {
+	Services   uint `json:"services,omitempty"`
+	Accounts   uint `json:"accounts,omitempty"`
+	Passwords  uint `json:"passwords,omitempty"`
+	Identities uint `json:"identities,omitempty"`
+	Shares     uint `json:"shares,omitempty"`
+}
+
+// clone returns the copy of the vault which is not changed by changes of the vault records
+func (v fileVault) clone() fileVault {
+	v.Services = append([]fileService(nil), v.Services...)
+	v.Accounts = append([]fileAccount(nil), v.Accounts...)
+	v.Passwords = append([]filePassword(nil), v.Passwords...)
+	v.Identities = append([]fileIdentity(nil), v.Identities...)
+	v.Shares = append([]fileShare(nil), v.Shares...)
+
+	return v
+}
+
+type fileRecord struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// getID returns ID of the record
+func (r fileRecord) getID() uint {
+	return r.ID
+}
+
+// model returns gorm.Model with the record fields
+func (r fileRecord) model() gorm.Model {
+	return gorm.Model{ID: r.ID, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+}
+
+type fileService struct {
+	fileRecord
+	Name string `json:"name"`
+}
+
+type fileAccount struct {
+	fileRecord
+	Login          string     `json:"login"`
+	ServiceID      uint       `json:"service_id"`
+	PasswordID     uint       `json:"password_id"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	SSHPublicKey   string     `json:"ssh_public_key,omitempty"`
+	Attributes     string     `json:"attributes,omitempty"`
+}
+
+type filePassword struct {
+	fileRecord
+	Encrypted string `json:"encrypted"`
+	Salt      string `json:"salt"`
+	Verifier  string `json:"verifier,omitempty"`
+}
+
+type fileIdentity struct {
+	fileRecord
+	Name                string `json:"name"`
+	PublicKey           string `json:"public_key"`
+	EncryptedPrivateKey string `json:"encrypted_private_key,omitempty"`
+	Salt                string `json:"salt,omitempty"`
+}
+
+type fileShare struct {
+	fileRecord
+	AccountID  uint   `json:"account_id"`
+	IdentityID uint   `json:"identity_id"`
+	WrappedKey string `json:"wrapped_key"`
+	Encrypted  string `json:"encrypted"`
+}
+
+// NewFileRepository loads the vault file at the given path, not existing file is treated as an empty vault.
+// If the file is encrypted, getKey is called to get the storage key.
+func NewFileRepository(path string, getKey KeyGetter) (*FileRepository, error) {
+	r := &FileRepository{path: path, vault: fileVault{Version: fileVaultVersion}}
+
+	encrypted, err := isEncryptedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if encrypted {
+		secret, err := getKey()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get storage key: %w", err)
+		}
+
+		data, r.key, r.salt, err = readEncrypted(path, secret)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err = os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read vault file: %w", err)
+		}
+	}
+
+	if r.vault, err = parseFileVault(data); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// parseFileVault parses the content of the vault file
+func parseFileVault(data []byte) (fileVault, error) {
+	var vault fileVault
+	if err := json.Unmarshal(data, &vault); err != nil {
+		return fileVault{}, fmt.Errorf("unable to parse vault file: %w", err)
+	}
+
+	if vault.Version > fileVaultVersion {
+		return fileVault{}, fmt.Errorf("vault file version %d is not supported", vault.Version)
+	}
+
+	return vault, nil
+}
+
+// Services returns the repository of services
+func (r *FileRepository) Services() ServiceRepository {
+	return fileServices{r}
+}
+
+// Accounts returns the repository of accounts
+func (r *FileRepository) Accounts() AccountRepository {
+	return fileAccounts{r}
+}
+
+// Passwords returns the repository of passwords
+func (r *FileRepository) Passwords() PasswordRepository {
+	return filePasswords{r}
+}
+
+// Identities returns the repository of identities
+func (r *FileRepository) Identities() IdentityRepository {
+	return fileIdentities{r}
+}
+
+// Shares returns the repository of shares
+func (r *FileRepository) Shares() ShareRepository {
+	return fileShares{r}
+}
+
+// IsEncrypted checks whether the vault file is encrypted
+func (r *FileRepository) IsEncrypted() (bool, error) {
+	return r.key != nil, nil
+}
+
+// Encrypt rewrites the vault file encrypted with the given key
+func (r *FileRepository) Encrypt(secret string) error {
+	if r.key != nil {
+		return errors.New("storage is already encrypted")
+	}
+
+	key, salt, err := newStorageKey(secret)
+	if err != nil {
+		return err
+	}
+
+	err = r.update(func() error {
+		r.key, r.salt = key, salt
+		return nil
+	})
+	if err != nil {
+		r.key, r.salt = nil, nil
+		return err
+	}
+
+	return nil
+}
+
+// Decrypt rewrites the encrypted vault file as the plain one
+func (r *FileRepository) Decrypt() error {
+	if r.key == nil {
+		return errors.New("storage is not encrypted")
+	}
+
+	key, salt := r.key, r.salt
+	err := r.update(func() error {
+		r.key, r.salt = nil, nil
+		return nil
+	})
+	if err != nil {
+		r.key, r.salt = key, salt
+		return err
+	}
+
+	return nil
+}
+
+// Backup writes a copy of the vault to backupPath, the copy of the encrypted vault is encrypted with the same key
+func (r *FileRepository) Backup(backupPath string) error {
+	return r.writeTo(backupPath)
+}
+
+// CheckIntegrity checks the vault records refer to existing ones and their IDs are unique
+func (r *FileRepository) CheckIntegrity() error {
+	if err := checkUniqueIDs(r.vault.Services, "service"); err != nil {
+		return err
+	}
+	if err := checkUniqueIDs(r.vault.Accounts, "account"); err != nil {
+		return err
+	}
+	if err := checkUniqueIDs(r.vault.Passwords, "password"); err != nil {
+		return err
+	}
+
+	for _, fa := range r.vault.Accounts {
+		if findByID(r.vault.Services, fa.ServiceID) < 0 {
+			return fmt.Errorf("vault is corrupted: account %d refers to missing service %d", fa.ID, fa.ServiceID)
+		}
+		if findByID(r.vault.Passwords, fa.PasswordID) < 0 {
+			return fmt.Errorf("vault is corrupted: account %d refers to missing password %d", fa.ID, fa.PasswordID)
+		}
+	}
+
+	for _, fs := range r.vault.Shares {
+		if findByID(r.vault.Accounts, fs.AccountID) < 0 || findByID(r.vault.Identities, fs.IdentityID) < 0 {
+			return fmt.Errorf("vault is corrupted: share %d refers to missing account or identity", fs.ID)
+		}
+	}
+
+	return nil
+}
+
+// Close does nothing, the vault file is only kept open while it is read or written
+func (r *FileRepository) Close() error {
+	return nil
+}
+
+// update applies the change to the vault reloaded from the file while holding the lock file and saves it,
+// so changes saved by concurrent processes are not lost. The vault is restored to the previous state on failure.
+func (r *FileRepository) update(change func() error) error {
+	unlock, err := filelock.Lock(r.path+".lock", fileLockTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to lock vault file: %w", err)
+	}
+	defer unlock()
+
+	if err = r.reload(); err != nil {
+		return err
+	}
+
+	previous := r.vault.clone()
+	if err = change(); err == nil {
+		err = r.writeTo(r.path)
+	}
+	if err != nil {
+		r.vault = previous
+		return err
+	}
+
+	return nil
+}
+
+// reload reads the vault saved to the file by other processes, not existing file leaves the vault as it is
+func (r *FileRepository) reload() error {
+	content, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read vault file: %w", err)
+	}
+
+	data := content
+	if salt, ciphertext, encrypted := splitEncrypted(content); encrypted || r.key != nil {
+		if !encrypted || !bytes.Equal(salt, r.salt) {
+			return errors.New("vault file was encrypted or decrypted by another process, open it again")
+		}
+		if data, err = crypto.DecryptBytes(r.key, ciphertext); err != nil {
+			return ErrInvalidKey
+		}
+	}
+
+	r.vault, err = parseFileVault(data)
+	return err
+}
+
+// writeTo writes the vault to the file at the given path
+func (r *FileRepository) writeTo(path string) error {
+	sortByID(r.vault.Services)
+	sortByID(r.vault.Accounts)
+	sortByID(r.vault.Passwords)
+	sortByID(r.vault.Identities)
+	sortByID(r.vault.Shares)
+
+	data, err := json.MarshalIndent(r.vault, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to serialize vault: %w", err)
+	}
+	data = append(data, '\n')
+
+	if r.key != nil {
+		return writeEncrypted(path, r.key, r.salt, data)
+	}
+
+	return writeFileAtomically(path, data)
+}
+
+// findService returns index of the service with the given id or -1
+func (r *FileRepository) findService(id uint) int {
+	return findByID(r.vault.Services, id)
+}
+
+// serviceNamed returns the service with the given name, adds it to the vault if it doesn't exist
+func (r *FileRepository) serviceNamed(name string) models.Service {
+	for _, fs := range r.vault.Services {
+		if fs.Name == name {
+			return fs.toModel()
+		}
+	}
+
+	fs := fileService{fileRecord: newRecord(r.vault.Services, &r.vault.NextIDs.Services), Name: name}
+	r.vault.Services = append(r.vault.Services, fs)
+	return fs.toModel()
+}
+
+// accountsOf returns accounts of the service with the given id
+func (r *FileRepository) accountsOf(serviceID uint) []models.Account {
+	var accounts []models.Account
+	for _, a := range r.vault.Accounts {
+		if a.ServiceID == serviceID {
+			accounts = append(accounts, a.toModel())
+		}
+	}
+
+	return accounts
+}
+
+type fileServices struct {
+	r *FileRepository
+}
+
+// List returns all the services
+func (s fileServices) List(withAccounts bool) ([]models.Service, error) {
+	services := make([]models.Service, 0, len(s.r.vault.Services))
+	for _, fs := range s.r.vault.Services {
+		service := fs.toModel()
+		if withAccounts {
+			service.Accounts = s.r.accountsOf(service.ID)
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+// Count returns count of the services
+func (s fileServices) Count() (int64, error) {
+	return int64(len(s.r.vault.Services)), nil
+}
+
+// FetchOrCreate returns the service with the given name, creates it if it doesn't exist
+func (s fileServices) FetchOrCreate(name string) (models.Service, error) {
+	for _, fs := range s.r.vault.Services {
+		if fs.Name == name {
+			return fs.toModel(), nil
+		}
+	}
+
+	var service models.Service
+	err := s.r.update(func() error {
+		service = s.r.serviceNamed(name)
+		return nil
+	})
+	if err != nil {
+		return models.Service{}, fmt.Errorf("unable to fetch or create service: %w", err)
+	}
+
+	return service, nil
+}
+
+// LoadAccounts loads accounts of the given service
+func (s fileServices) LoadAccounts(service *models.Service) error {
+	service.Accounts = s.r.accountsOf(service.ID)
+	return nil
+}
+
+// AccountsCount returns count of the service accounts
+func (s fileServices) AccountsCount(service models.Service) (int64, error) {
+	return int64(len(s.r.accountsOf(service.ID))), nil
+}
+
+// Delete deletes the given service, the service with accounts is not deleted
+func (s fileServices) Delete(service models.Service) error {
+	if service.ID == 0 {
+		return errors.New("unable to delete service, service data not loaded")
+	}
+
+	err := s.r.update(func() error {
+		i := s.r.findService(service.ID)
+		if i < 0 {
+			return ErrNotFound
+		}
+		if len(s.r.accountsOf(service.ID)) > 0 {
+			return ErrServiceNotEmpty
+		}
+
+		s.r.vault.Services = append(s.r.vault.Services[:i], s.r.vault.Services[i+1:]...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete service: %w", err)
+	}
+
+	return nil
+}
+
+type fileAccounts struct {
+	r *FileRepository
+}
+
+// Exists checks whether the account with the given login exists for the service
+func (a fileAccounts) Exists(login string, serviceID uint) (bool, error) {
+	for _, fa := range a.r.vault.Accounts {
+		if fa.Login == login && fa.ServiceID == serviceID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SaveWithPassword saves the new account together with its password
+func (a fileAccounts) SaveWithPassword(account *models.Account, password *models.Password) error {
+	if account.ServiceID == 0 {
+		account.ServiceID = account.Service.ID
+	}
+
+	var fa fileAccount
+	var fp filePassword
+	err := a.r.update(func() (err error) {
+		fa, fp, err = a.insert(*account, *password)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save account with password: %w", err)
+	}
+
+	password.Model = fp.model()
+	account.Model = fa.model()
+	account.PasswordID = fp.ID
+
+	return nil
+}
+
+// SaveAllWithPasswords saves the new accounts together with their passwords and services with a single write
+// of the vault, the vault is left unchanged on failure
+func (a fileAccounts) SaveAllWithPasswords(accounts []models.Account, passwords []models.Password) error {
+	saved := make([]fileAccount, len(accounts))
+	savedPasswords := make([]filePassword, len(passwords))
+	services := make([]models.Service, len(accounts))
+	err := a.r.update(func() error {
+		for i := range accounts {
+			services[i] = a.r.serviceNamed(accounts[i].Service.Name)
+			account := accounts[i]
+			account.ServiceID = services[i].ID
+
+			var err error
+			if saved[i], savedPasswords[i], err = a.insert(account, passwords[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save accounts with passwords: %w", err)
+	}
+
+	for i := range accounts {
+		passwords[i].Model = savedPasswords[i].model()
+		accounts[i].Model = saved[i].model()
+		accounts[i].Service = services[i]
+		accounts[i].ServiceID = services[i].ID
+		accounts[i].PasswordID = savedPasswords[i].ID
+	}
+
+	return nil
+}
+
+// insert adds the new account with the password to the vault, the service of the account must exist
+func (a fileAccounts) insert(account models.Account, password models.Password) (fileAccount, filePassword, error) {
+	if a.r.findService(account.ServiceID) < 0 {
+		return fileAccount{}, filePassword{}, ErrNotFound
+	}
+
+	exists, _ := a.Exists(account.Login, account.ServiceID)
+	if exists {
+		return fileAccount{}, filePassword{}, errors.New("account already exists")
+	}
+
+	fp := filePassword{
+		fileRecord: newRecord(a.r.vault.Passwords, &a.r.vault.NextIDs.Passwords),
+		Encrypted:  password.Encrypted,
+		Salt:       password.Salt,
+		Verifier:   password.Verifier,
+	}
+	a.r.vault.Passwords = append(a.r.vault.Passwords, fp)
+
+	fa := fileAccount{
+		fileRecord:   newRecord(a.r.vault.Accounts, &a.r.vault.NextIDs.Accounts),
+		Login:        account.Login,
+		ServiceID:    account.ServiceID,
+		PasswordID:   fp.ID,
+		ExpiresAt:    account.ExpiresAt,
+		SSHPublicKey: account.SSHPublicKey,
+		Attributes:   account.Attributes,
+	}
+	a.r.vault.Accounts = append(a.r.vault.Accounts, fa)
+
+	return fa, fp, nil
+}
+
+// DeleteWithPassword deletes the account together with its password
+func (a fileAccounts) DeleteWithPassword(account models.Account) error {
+	err := a.r.update(func() error {
+		i := findByID(a.r.vault.Accounts, account.ID)
+		if i < 0 {
+			return ErrNotFound
+		}
+		a.r.vault.Accounts = append(a.r.vault.Accounts[:i], a.r.vault.Accounts[i+1:]...)
+
+		if i = findByID(a.r.vault.Passwords, account.PasswordID); i >= 0 {
+			a.r.vault.Passwords = append(a.r.vault.Passwords[:i], a.r.vault.Passwords[i+1:]...)
+		}
+
+		a.r.vault.Shares = filterRecords(a.r.vault.Shares, func(fs fileShare) bool {
+			return fs.AccountID != account.ID
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete account with password: %w", err)
+	}
+
+	return nil
+}
+
+// LoadPassword loads the password of the given account
+func (a fileAccounts) LoadPassword(account *models.Account) error {
+	i := findByID(a.r.vault.Passwords, account.PasswordID)
+	if i < 0 {
+		return fmt.Errorf("unable to load password: %w", ErrNotFound)
+	}
+
+	account.Password = a.r.vault.Passwords[i].toModel()
+	return nil
+}
+
+// List returns all the accounts with loaded services and passwords
+func (a fileAccounts) List() ([]models.Account, error) {
+	accounts := make([]models.Account, 0, len(a.r.vault.Accounts))
+	for _, fa := range a.r.vault.Accounts {
+		account := fa.toModel()
+		if i := a.r.findService(fa.ServiceID); i >= 0 {
+			account.Service = a.r.vault.Services[i].toModel()
+		}
+		if i := findByID(a.r.vault.Passwords, fa.PasswordID); i >= 0 {
+			account.Password = a.r.vault.Passwords[i].toModel()
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// MarkAccessed sets the time the account password was last accessed, the account is not considered updated
+func (a fileAccounts) MarkAccessed(account *models.Account, at time.Time) error {
+	err := a.updateAccount(account.ID, func(fa *fileAccount) {
+		fa.LastAccessedAt = &at
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark account accessed: %w", err)
+	}
+
+	account.LastAccessedAt = &at
+	return nil
+}
+
+// SetExpiry sets the date the account password should be rotated by
+func (a fileAccounts) SetExpiry(account *models.Account, expiresAt *time.Time) error {
+	err := a.updateAccount(account.ID, func(fa *fileAccount) {
+		fa.ExpiresAt = expiresAt
+		fa.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set account expiry: %w", err)
+	}
+
+	account.ExpiresAt = expiresAt
+	return nil
+}
+
+// SavePassword saves changes of the account password together with the expiry date with a single write of the vault
+func (a fileAccounts) SavePassword(account *models.Account, expiresAt *time.Time) error {
+	var saved filePassword
+	err := a.r.update(func() error {
+		i := findByID(a.r.vault.Accounts, account.ID)
+		j := findByID(a.r.vault.Passwords, account.Password.ID)
+		if i < 0 || j < 0 {
+			return ErrNotFound
+		}
+
+		now := time.Now()
+		fp := &a.r.vault.Passwords[j]
+		fp.Encrypted = account.Password.Encrypted
+		fp.Salt = account.Password.Salt
+		fp.Verifier = account.Password.Verifier
+		fp.UpdatedAt = now
+		saved = *fp
+
+		fa := &a.r.vault.Accounts[i]
+		fa.ExpiresAt = expiresAt
+		fa.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save account password: %w", err)
+	}
+
+	account.Password.Model = saved.model()
+	account.ExpiresAt = expiresAt
+	return nil
+}
+
+// SetSSHPublicKey sets the public key of the SSH private key kept as the account password
+func (a fileAccounts) SetSSHPublicKey(account *models.Account, publicKey string) error {
+	err := a.updateAccount(account.ID, func(fa *fileAccount) {
+		fa.SSHPublicKey = publicKey
+		fa.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set account public key: %w", err)
+	}
+
+	account.SSHPublicKey = publicKey
+	return nil
+}
+
+// SetAttributes sets the JSON-encoded lookup attributes of the account
+func (a fileAccounts) SetAttributes(account *models.Account, attributes string) error {
+	err := a.updateAccount(account.ID, func(fa *fileAccount) {
+		fa.Attributes = attributes
+		fa.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set account attributes: %w", err)
+	}
+
+	account.Attributes = attributes
+	return nil
+}
+
+// updateAccount applies the change to the stored account with the given ID
+func (a fileAccounts) updateAccount(id uint, change func(fa *fileAccount)) error {
+	return a.r.update(func() error {
+		i := findByID(a.r.vault.Accounts, id)
+		if i < 0 {
+			return ErrNotFound
+		}
+
+		change(&a.r.vault.Accounts[i])
+		return nil
+	})
+}
+
+type filePasswords struct {
+	r *FileRepository
+}
+
+// Save saves changes of the existing password
+func (p filePasswords) Save(password *models.Password) error {
+	var saved filePassword
+	err := p.r.update(func() error {
+		i := findByID(p.r.vault.Passwords, password.ID)
+		if i < 0 {
+			return ErrNotFound
+		}
+
+		fp := &p.r.vault.Passwords[i]
+		fp.Encrypted = password.Encrypted
+		fp.Salt = password.Salt
+		fp.Verifier = password.Verifier
+		fp.UpdatedAt = time.Now()
+		saved = *fp
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save password: %w", err)
+	}
+
+	password.Model = saved.model()
+	return nil
+}
+
+// SaveAll saves changes of the existing passwords with a single write of the vault,
+// the vault is left unchanged on failure
+func (p filePasswords) SaveAll(passwords []models.Password) error {
+	saved := make([]filePassword, len(passwords))
+	err := p.r.update(func() error {
+		now := time.Now()
+		for i := range passwords {
+			j := findByID(p.r.vault.Passwords, passwords[i].ID)
+			if j < 0 {
+				return ErrNotFound
+			}
+
+			fp := &p.r.vault.Passwords[j]
+			fp.Encrypted = passwords[i].Encrypted
+			fp.Salt = passwords[i].Salt
+			fp.Verifier = passwords[i].Verifier
+			fp.UpdatedAt = now
+			saved[i] = *fp
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save passwords: %w", err)
+	}
+
+	for i := range passwords {
+		passwords[i].Model = saved[i].model()
+	}
+
+	return nil
+}
+
+type fileIdentities struct {
+	r *FileRepository
+}
+
+// List returns all the identities ordered by name
+func (i fileIdentities) List() ([]models.Identity, error) {
+	identities := make([]models.Identity, 0, len(i.r.vault.Identities))
+	for _, fi := range i.r.vault.Identities {
+		identities = append(identities, fi.toModel())
+	}
+
+	sort.Slice(identities, func(a, b int) bool {
+		return identities[a].Name < identities[b].Name
+	})
+
+	return identities, nil
+}
+
+// FetchByName returns the identity with the given name
+func (i fileIdentities) FetchByName(name string) (models.Identity, error) {
+	for _, fi := range i.r.vault.Identities {
+		if fi.Name == name {
+			return fi.toModel(), nil
+		}
+	}
+
+	return models.Identity{}, ErrNotFound
+}
+
+// FetchOwn returns the identity of the vault owner
+func (i fileIdentities) FetchOwn() (models.Identity, error) {
+	for _, fi := range i.r.vault.Identities {
+		if fi.EncryptedPrivateKey != "" {
+			return fi.toModel(), nil
+		}
+	}
+
+	return models.Identity{}, ErrNotFound
+}
+
+// Create saves the new identity
+func (i fileIdentities) Create(identity *models.Identity) error {
+	var fi fileIdentity
+	err := i.r.update(func() error {
+		if _, err := i.FetchByName(identity.Name); err == nil {
+			return fmt.Errorf("identity %q already exists", identity.Name)
+		}
+
+		fi = fileIdentity{
+			fileRecord:          newRecord(i.r.vault.Identities, &i.r.vault.NextIDs.Identities),
+			Name:                identity.Name,
+			PublicKey:           identity.PublicKey,
+			EncryptedPrivateKey: identity.EncryptedPrivateKey,
+			Salt:                identity.Salt,
+		}
+		i.r.vault.Identities = append(i.r.vault.Identities, fi)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create identity: %w", err)
+	}
+
+	identity.Model = fi.model()
+	return nil
+}
+
+// Delete deletes the identity together with the shares for it
+func (i fileIdentities) Delete(identity models.Identity) error {
+	err := i.r.update(func() error {
+		index := findByID(i.r.vault.Identities, identity.ID)
+		if index < 0 {
+			return ErrNotFound
+		}
+
+		i.r.vault.Identities = append(i.r.vault.Identities[:index], i.r.vault.Identities[index+1:]...)
+		i.r.vault.Shares = filterRecords(i.r.vault.Shares, func(fs fileShare) bool {
+			return fs.IdentityID != identity.ID
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete identity: %w", err)
+	}
+
+	return nil
+}
+
+type fileShares struct {
+	r *FileRepository
+}
+
+// ListByAccount returns shares of the account with loaded identities
+func (s fileShares) ListByAccount(accountID uint) ([]models.Share, error) {
+	var shares []models.Share
+	for _, fs := range s.r.vault.Shares {
+		if fs.AccountID != accountID {
+			continue
+		}
+
+		share := fs.toModel()
+		if i := findByID(s.r.vault.Identities, fs.IdentityID); i >= 0 {
+			share.Identity = s.r.vault.Identities[i].toModel()
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// ListByIdentity returns shares for the identity with loaded accounts and their services
+func (s fileShares) ListByIdentity(identityID uint) ([]models.Share, error) {
+	var shares []models.Share
+	for _, fs := range s.r.vault.Shares {
+		if fs.IdentityID != identityID {
+			continue
+		}
+
+		share := fs.toModel()
+		if i := findByID(s.r.vault.Accounts, fs.AccountID); i >= 0 {
+			share.Account = s.r.vault.Accounts[i].toModel()
+			if j := s.r.findService(share.Account.ServiceID); j >= 0 {
+				share.Account.Service = s.r.vault.Services[j].toModel()
+			}
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// Replace replaces all the account shares with the given ones
+func (s fileShares) Replace(accountID uint, shares []models.Share) error {
+	saved := make([]fileShare, len(shares))
+	err := s.r.update(func() error {
+		s.r.vault.Shares = filterRecords(s.r.vault.Shares, func(fs fileShare) bool {
+			return fs.AccountID != accountID
+		})
+
+		for i := range shares {
+			saved[i] = fileShare{
+				fileRecord: newRecord(s.r.vault.Shares, &s.r.vault.NextIDs.Shares),
+				AccountID:  accountID,
+				IdentityID: shares[i].IdentityID,
+				WrappedKey: shares[i].WrappedKey,
+				Encrypted:  shares[i].Encrypted,
+			}
+			s.r.vault.Shares = append(s.r.vault.Shares, saved[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save account shares: %w", err)
+	}
+
+	for i := range shares {
+		shares[i].Model = saved[i].model()
+		shares[i].AccountID = accountID
+	}
+
+	return nil
+}
+
+// toModel converts the record to models.Service
+func (fs fileService) toModel() models.Service {
+	return models.Service{Model: fs.model(), Name: fs.Name}
+}
+
+// toModel converts the record to models.Account
+func (fa fileAccount) toModel() models.Account {
+	return models.Account{
+		Model:          fa.model(),
+		Login:          fa.Login,
+		ServiceID:      fa.ServiceID,
+		PasswordID:     fa.PasswordID,
+		LastAccessedAt: fa.LastAccessedAt,
+		ExpiresAt:      fa.ExpiresAt,
+		SSHPublicKey:   fa.SSHPublicKey,
+		Attributes:     fa.Attributes,
+	}
+}
+
+// toModel converts the record to models.Password
+func (fp filePassword) toModel() models.Password {
+	return models.Password{Model: fp.model(), Encrypted: fp.Encrypted, Salt: fp.Salt, Verifier: fp.Verifier}
+}
+
+// toModel converts the record to models.Identity
+func (fi fileIdentity) toModel() models.Identity {
+	return models.Identity{
+		Model:               fi.model(),
+		Name:                fi.Name,
+		PublicKey:           fi.PublicKey,
+		EncryptedPrivateKey: fi.EncryptedPrivateKey,
+		Salt:                fi.Salt,
+	}
+}
+
+// toModel converts the record to models.Share
+func (fs fileShare) toModel() models.Share {
+	return models.Share{
+		Model:      fs.model(),
+		AccountID:  fs.AccountID,
+		IdentityID: fs.IdentityID,
+		WrappedKey: fs.WrappedKey,
+		Encrypted:  fs.Encrypted,
+	}
+}
+
+type identified interface {
+	getID() uint
+}
+
+// newRecord returns the record with the next ID and the current timestamps and advances the next ID.
+// IDs above the existing ones are given if the next ID is not saved, e.g. in vaults written by older versions.
+func newRecord[R identified](records []R, nextID *uint) fileRecord {
+	id := *nextID
+	if id == 0 {
+		id = 1
+	}
+	for _, r := range records {
+		if r.getID() >= id {
+			id = r.getID() + 1
+		}
+	}
+	*nextID = id + 1
+
+	now := time.Now()
+	return fileRecord{ID: id, CreatedAt: now, UpdatedAt: now}
+}
+
+// findByID returns index of the record with the given ID or -1
+func findByID[R identified](records []R, id uint) int {
+	for i, r := range records {
+		if r.getID() == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// sortByID sorts records by their IDs
+func sortByID[R identified](records []R) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].getID() < records[j].getID()
+	})
+}
+
+// checkUniqueIDs checks there are no records with the same ID
+func checkUniqueIDs[R identified](records []R, name string) error {
+	seen := make(map[uint]bool, len(records))
+	for _, r := range records {
+		if seen[r.getID()] {
+			return fmt.Errorf("vault is corrupted: duplicate %s %d", name, r.getID())
+		}
+		seen[r.getID()] = true
+	}
+
+	return nil
+}
+
+// filterRecords returns the records satisfying keep
+func filterRecords[R any](records []R, keep func(R) bool) []R {
+	filtered := records[:0]
+	for _, r := range records {
+		if keep(r) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered
+}
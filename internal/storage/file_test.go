@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// openFileRepo opens the plain vault file in the temporary directory
+func openFileRepo(t *testing.T, path string) *FileRepository {
+	t.Helper()
+	repo, err := NewFileRepository(path, noKey(t))
+	if err != nil {
+		t.Fatalf("unable to open vault: %v", err)
+	}
+
+	return repo
+}
+
+// findAccount returns the stored account of the service with the login
+func findAccount(t *testing.T, repo Repository, service, login string) models.Account {
+	t.Helper()
+	accounts, err := repo.Accounts().List()
+	if err != nil {
+		t.Fatalf("unable to list accounts: %v", err)
+	}
+	for _, account := range accounts {
+		if account.Service.Name == service && account.Login == login {
+			return account
+		}
+	}
+
+	t.Fatalf("account %q at %q is not found", login, service)
+	return models.Account{}
+}
+
+func TestFileIDsOfDeletedRecordsAreNotReused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool.json")
+	repo := openFileRepo(t, path)
+	saveAccount(t, repo, "github.com", "bob", "password")
+	saveAccount(t, repo, "github.com", "amy", "other")
+
+	deleted := findAccount(t, repo, "github.com", "amy")
+	if err := repo.Accounts().DeleteWithPassword(deleted); err != nil {
+		t.Fatalf("unable to delete account: %v", err)
+	}
+
+	saveAccount(t, repo, "github.com", "eve", "third")
+	if added := findAccount(t, repo, "github.com", "eve"); added.ID == deleted.ID || added.PasswordID == deleted.PasswordID {
+		t.Errorf("got account %d with password %d, want IDs of the deleted account %d with password %d not reused",
+			added.ID, added.PasswordID, deleted.ID, deleted.PasswordID)
+	}
+
+	// the next IDs are kept in the file
+	last := findAccount(t, repo, "github.com", "eve")
+	if err := repo.Accounts().DeleteWithPassword(last); err != nil {
+		t.Fatalf("unable to delete account: %v", err)
+	}
+	repo = openFileRepo(t, path)
+	saveAccount(t, repo, "github.com", "joe", "fourth")
+	if added := findAccount(t, repo, "github.com", "joe"); added.ID <= last.ID {
+		t.Errorf("got account %d after reopening, want the ID above the deleted %d", added.ID, last.ID)
+	}
+}
+
+func TestFileIDsOfVaultWithoutNextIDs(t *testing.T) {
+	var vault fileVault
+	vault.Services = []fileService{{fileRecord: fileRecord{ID: 3}}, {fileRecord: fileRecord{ID: 7}}}
+
+	if got := newRecord(vault.Services, &vault.NextIDs.Services).ID; got != 8 {
+		t.Errorf("got ID %d, want the one above the existing IDs", got)
+	}
+	if vault.NextIDs.Services != 9 {
+		t.Errorf("got next ID %d, want 9", vault.NextIDs.Services)
+	}
+
+	var empty fileVault
+	if got := newRecord(empty.Accounts, &empty.NextIDs.Accounts).ID; got != 1 {
+		t.Errorf("got ID %d of the first record, want 1", got)
+	}
+}
+
+func TestFileChangesAreRolledBackOnSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	repo := openFileRepo(t, filepath.Join(dir, "passtool.json"))
+	saveAccount(t, repo, "github.com", "bob", "password")
+	account := findAccount(t, repo, "github.com", "bob")
+	want := repo.vault.clone()
+
+	// the vault can't be written to the file in the missing directory
+	repo.path = filepath.Join(dir, "missing", "passtool.json")
+
+	if _, err := repo.Services().FetchOrCreate("gitlab.com"); err == nil {
+		t.Error("got the service created, want the save error")
+	}
+	service := findAccount(t, repo, "github.com", "bob").Service
+	if err := repo.Accounts().SaveWithPassword(&models.Account{Login: "amy", ServiceID: service.ID}, &models.Password{}); err == nil {
+		t.Error("got the account saved, want the save error")
+	}
+	if err := repo.Accounts().DeleteWithPassword(account); err == nil {
+		t.Error("got the account deleted, want the save error")
+	}
+	if err := repo.Accounts().SetAttributes(&account, `{"a":"b"}`); err == nil {
+		t.Error("got the attributes set, want the save error")
+	}
+	if err := repo.Services().Delete(service); err == nil {
+		t.Error("got the service deleted, want the save error")
+	}
+	if err := repo.Identities().Create(&models.Identity{Name: "alice", PublicKey: "key"}); err == nil {
+		t.Error("got the identity created, want the save error")
+	}
+	if err := repo.Encrypt("storage key"); err == nil {
+		t.Error("got the vault encrypted, want the save error")
+	}
+
+	if !reflect.DeepEqual(repo.vault, want) {
+		t.Errorf("got vault changed after failed saves:\n%+v\nwant:\n%+v", repo.vault, want)
+	}
+	if encrypted, _ := repo.IsEncrypted(); encrypted {
+		t.Error("got the vault encrypted after the failed save")
+	}
+}
+
+func TestFileChangesOfConcurrentRepositoriesAreKept(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool.json")
+	first := openFileRepo(t, path)
+	second := openFileRepo(t, path)
+
+	saveAccount(t, first, "github.com", "bob", "password")
+	saveAccount(t, second, "gitlab.com", "amy", "other")
+	saveAccount(t, first, "example.com", "eve", "third")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(login string) {
+			defer wg.Done()
+			repo, err := NewFileRepository(path, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s, err := repo.Services().FetchOrCreate("github.com")
+			if err == nil {
+				account := models.Account{Login: login, ServiceID: s.ID}
+				err = repo.Accounts().SaveWithPassword(&account, &models.Password{Encrypted: "password", Salt: "salt"})
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+
+	got := storedPasswords(t, openFileRepo(t, path))
+	if len(got) != 8 || got["github.com/bob"] != "password" || got["gitlab.com/amy"] != "other" || got["example.com/eve"] != "third" {
+		t.Errorf("got accounts %q, want the accounts saved by all the repositories", got)
+	}
+	if err := openFileRepo(t, path).CheckIntegrity(); err != nil {
+		t.Errorf("got %v, want the vault consistent", err)
+	}
+}
+
+func TestFileRepositoryRefusesVaultEncryptedByAnother(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passtool.json")
+	first := openFileRepo(t, path)
+	saveAccount(t, first, "github.com", "bob", "password")
+	if err := openFileRepo(t, path).Encrypt("storage key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := first.Services().FetchOrCreate("gitlab.com"); err == nil {
+		t.Error("got the plain vault written over the encrypted one")
+	}
+	if encrypted, err := isEncryptedFile(path); err != nil || !encrypted {
+		t.Errorf("got encrypted %v, %v, want the vault file kept encrypted", encrypted, err)
+	}
+}
+
+func TestServiceWithAccountsIsNotDeleted(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			repo := openRepo(t, backend, filepath.Join(t.TempDir(), name), noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+			account := findAccount(t, repo, "github.com", "bob")
+			service, err := repo.Services().FetchOrCreate("github.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = repo.Services().Delete(service); !errors.Is(err, ErrServiceNotEmpty) {
+				t.Errorf("got %v deleting the service with accounts, want ErrServiceNotEmpty", err)
+			}
+			if got := storedPasswords(t, repo); len(got) != 1 {
+				t.Errorf("got accounts %q, want the account kept", got)
+			}
+
+			if err = repo.Accounts().DeleteWithPassword(account); err != nil {
+				t.Fatal(err)
+			}
+			if err = repo.Services().Delete(service); err != nil {
+				t.Errorf("got %v deleting the service without accounts", err)
+			}
+			if err = repo.Services().Delete(service); !errors.Is(err, ErrNotFound) {
+				t.Errorf("got %v deleting the deleted service, want ErrNotFound", err)
+			}
+		})
+	}
+}
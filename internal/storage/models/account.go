@@ -3,13 +3,20 @@ package models
 import (
 	"fmt"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Account struct {
 	gorm.Model
-	Login      string `gorm:"index:idx_login_service,unique;not null"`
-	ServiceID  uint   `gorm:"index:idx_login_service,unique;not null"`
-	PasswordID uint   `gorm:"not null"`
+	Login          string `gorm:"index:idx_login_service,unique;not null"`
+	ServiceID      uint   `gorm:"index:idx_login_service,unique;not null"`
+	PasswordID     uint   `gorm:"not null"`
+	LastAccessedAt *time.Time
+	ExpiresAt      *time.Time
+	// SSHPublicKey is the public key in the authorized_keys format if the password is an OpenSSH private key
+	SSHPublicKey string
+	// Attributes are the JSON-encoded lookup attributes of the item saved through the Secret Service
+	Attributes string
 
 	Service  Service
 	Password Password
@@ -64,6 +71,31 @@ func (a *Account) SaveWithPassword(db *gorm.DB, password *Password) error {
 	return nil
 }
 
+// SaveAllWithPasswords performs transactional save of the accounts with their passwords,
+// services are fetched or created by the names of the account services
+func (a *Account) SaveAllWithPasswords(db *gorm.DB, accounts []Account, passwords []Password) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range accounts {
+			if err := accounts[i].Service.FetchOrCreate(tx, accounts[i].Service.Name); err != nil {
+				return err
+			}
+			accounts[i].ServiceID = accounts[i].Service.ID
+
+			if err := accounts[i].SaveWithPassword(tx, &passwords[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to save accounts with passwords: %w", err)
+	}
+
+	return nil
+}
+
 // DeleteWithPassword performs transactional deletion of password and account from database
 func (a *Account) DeleteWithPassword(db *gorm.DB) error {
 	err := db.Transaction(func(tx *gorm.DB) error {
@@ -75,6 +107,10 @@ func (a *Account) DeleteWithPassword(db *gorm.DB) error {
 			return err
 		}
 
+		if err := tx.Unscoped().Where("account_id = ?", a.ID).Delete(&Share{}).Error; err != nil {
+			return err
+		}
+
 		return nil
 	})
 
@@ -84,3 +120,93 @@ func (a *Account) DeleteWithPassword(db *gorm.DB) error {
 
 	return nil
 }
+
+// GetAll returns all the accounts with loaded services and passwords
+func (a *Account) GetAll(db *gorm.DB) ([]Account, error) {
+	var accounts []Account
+	err := db.Preload("Service").Preload("Password").Order("id").Find(&accounts).Error
+	return accounts, err
+}
+
+// MarkAccessed sets the time the account password was last accessed, the account is not considered updated
+func (a *Account) MarkAccessed(db *gorm.DB, at time.Time) error {
+	if err := db.Model(a).UpdateColumn("last_accessed_at", at).Error; err != nil {
+		return fmt.Errorf("unable to mark account accessed: %w", err)
+	}
+
+	a.LastAccessedAt = &at
+	return nil
+}
+
+// SetExpiry sets the date the account password should be rotated by, nil means never
+func (a *Account) SetExpiry(db *gorm.DB, expiresAt *time.Time) error {
+	if err := db.Model(a).Update("expires_at", expiresAt).Error; err != nil {
+		return fmt.Errorf("unable to set account expiry: %w", err)
+	}
+
+	a.ExpiresAt = expiresAt
+	return nil
+}
+
+// SavePassword performs transactional save of the account password and the expiry date
+func (a *Account) SavePassword(db *gorm.DB, expiresAt *time.Time) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := a.Password.Save(tx); err != nil {
+			return err
+		}
+
+		return tx.Model(a).Update("expires_at", expiresAt).Error
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to save account password: %w", err)
+	}
+
+	a.ExpiresAt = expiresAt
+	return nil
+}
+
+// SetSSHPublicKey sets the public key of the SSH private key kept as the account password
+func (a *Account) SetSSHPublicKey(db *gorm.DB, publicKey string) error {
+	if err := db.Model(a).Update("ssh_public_key", publicKey).Error; err != nil {
+		return fmt.Errorf("unable to set account public key: %w", err)
+	}
+
+	a.SSHPublicKey = publicKey
+	return nil
+}
+
+// SetAttributes sets the JSON-encoded lookup attributes of the account
+func (a *Account) SetAttributes(db *gorm.DB, attributes string) error {
+	if err := db.Model(a).Update("attributes", attributes).Error; err != nil {
+		return fmt.Errorf("unable to set account attributes: %w", err)
+	}
+
+	a.Attributes = attributes
+	return nil
+}
+
+// IsSSHKey checks whether the account password is an SSH private key
+func (a *Account) IsSSHKey() bool {
+	return a.SSHPublicKey != ""
+}
+
+// DueAt returns the time the account password should be rotated at: the expiry date or the time the password
+// becomes older than maxAge, whichever is earlier. Returns nil if neither is set, the password must be loaded.
+func (a *Account) DueAt(maxAge time.Duration) *time.Time {
+	due := a.ExpiresAt
+	if maxAge > 0 && !a.Password.UpdatedAt.IsZero() {
+		aged := a.Password.UpdatedAt.Add(maxAge)
+		if due == nil || aged.Before(*due) {
+			due = &aged
+		}
+	}
+
+	return due
+}
+
+// IsDue checks whether the account password should be rotated by the given time
+func (a *Account) IsDue(maxAge time.Duration, by time.Time) bool {
+	due := a.DueAt(maxAge)
+	return due != nil && !due.After(by)
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// Identity is a key pair used for sharing accounts. Own identity has the private key encrypted with a passphrase,
+// identities of teammates have the public key only.
+type Identity struct {
+	gorm.Model
+	Name                string `gorm:"uniqueIndex;not null"`
+	PublicKey           string `gorm:"not null"`
+	EncryptedPrivateKey string
+	Salt                string
+}
+
+// IsOwn checks whether the identity has the private key, so it belongs to the vault owner
+func (i *Identity) IsOwn() bool {
+	return i.EncryptedPrivateKey != ""
+}
+
+// GetList fetches all the identities and return them
+func (i *Identity) GetList(db *gorm.DB) ([]Identity, error) {
+	var identities []Identity
+	if err := db.Order("name").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("unable to get identities list: %w", err)
+	}
+
+	return identities, nil
+}
+
+// FetchByName fetches identity by its name
+func (i *Identity) FetchByName(db *gorm.DB, name string) error {
+	return db.Where("name = ?", name).First(i).Error
+}
+
+// FetchOwn fetches the identity having the private key
+func (i *Identity) FetchOwn(db *gorm.DB) error {
+	return db.Where("encrypted_private_key <> ''").First(i).Error
+}
+
+// Create saves the new identity to the DB
+func (i *Identity) Create(db *gorm.DB) error {
+	if err := db.Create(i).Error; err != nil {
+		return fmt.Errorf("unable to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteWithShares performs transactional deletion of the identity and accounts shares with it
+func (i *Identity) DeleteWithShares(db *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("identity_id = ?", i.ID).Delete(&Share{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&Identity{}, i.ID).Error
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to delete identity: %w", err)
+	}
+
+	return nil
+}
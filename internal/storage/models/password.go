@@ -2,27 +2,82 @@ package models
 
 import (
 	"errors"
+	"fmt"
 	"github.com/MirToykin/passtool/internal/crypto"
 	"gorm.io/gorm"
 )
 
+// ErrWrongSecret is returned when the secret doesn't match the verification tag of the password
+var ErrWrongSecret = errors.New("wrong secret")
+
+// ErrNoVerifier is returned when the password was saved without the verification tag
+var ErrNoVerifier = errors.New("password has no verification tag")
+
 type Password struct {
 	gorm.Model
 	Encrypted string `gorm:"not null"`
 	Salt      string `gorm:"not null"`
+	// Verifier is the verification tag of the key derived from the secret, empty for passwords saved before
+	Verifier string
 }
 
-// GetDecrypted returns decoded password
+// GetDecrypted returns decoded password, the secret is checked against the verification tag first if there is one
 func (p *Password) GetDecrypted(secret string, keyLen int) (string, error) {
 	if p.Encrypted == "" {
 		return "", errors.New("account password is not valid")
 	}
 
 	key := crypto.DeriveKey(secret, p.Salt, keyLen)
+	if p.Verifier != "" && !crypto.CheckVerificationTag(key, p.Verifier) {
+		return "", ErrWrongSecret
+	}
+
 	return crypto.Decrypt(key, p.Encrypted)
 }
 
+// SetEncrypted encrypts the user password with the key derived from the secret and the salt,
+// the verification tag of the key is set too
+func (p *Password) SetEncrypted(userPassword, secret, salt string, keyLen int) error {
+	key := crypto.DeriveKey(secret, salt, keyLen)
+
+	encrypted, err := crypto.Encrypt(key, userPassword)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt the password: %w", err)
+	}
+
+	p.Encrypted = encrypted
+	p.Salt = salt
+	p.Verifier = crypto.VerificationTag(key)
+	return nil
+}
+
+// CheckSecret checks the secret against the verification tag without decrypting the password
+func (p *Password) CheckSecret(secret string, keyLen int) error {
+	if p.Verifier == "" {
+		return ErrNoVerifier
+	}
+
+	if !crypto.CheckVerificationTag(crypto.DeriveKey(secret, p.Salt, keyLen), p.Verifier) {
+		return ErrWrongSecret
+	}
+
+	return nil
+}
+
 // Save saves given password to the DB
 func (p *Password) Save(db *gorm.DB) error {
 	return db.Save(p).Error
 }
+
+// SaveAll saves the given passwords to the DB in a single transaction
+func (p *Password) SaveAll(db *gorm.DB, passwords []Password) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range passwords {
+			if err := passwords[i].Save(tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -6,6 +6,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrServiceNotEmpty is returned when the service to delete still has accounts
+var ErrServiceNotEmpty = errors.New("service has accounts")
+
 type Service struct {
 	gorm.Model
 	Name string `gorm:"uniqueIndex;not null"`
@@ -112,14 +115,27 @@ func (s *Service) AccountsCount(db *gorm.DB) (int64, error) {
 	return count, nil
 }
 
-// Delete deletes the given service from the DB
+// Delete deletes the given service from the DB, the service with accounts is not deleted
 func (s *Service) Delete(db *gorm.DB) error {
 	if s.ID == 0 {
 		return errors.New("unable to delete service, service data not loaded")
 	}
-	err := db.Unscoped().Delete(Service{}, s.ID).Error
-	if err != nil {
+	result := db.Unscoped().
+		Where("NOT EXISTS (SELECT 1 FROM accounts WHERE accounts.service_id = services.id)").
+		Delete(Service{}, s.ID)
+	if result.Error != nil {
+		return fmt.Errorf("unable to delete service: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(Service{}).Where("id = ?", s.ID).Count(&count).Error; err != nil {
 		return fmt.Errorf("unable to delete service: %w", err)
 	}
-	return nil
+	if count == 0 {
+		return fmt.Errorf("unable to delete service: %w", gorm.ErrRecordNotFound)
+	}
+	return fmt.Errorf("unable to delete service: %w", ErrServiceNotEmpty)
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// Share gives the identity access to the account password.
+// The password is encrypted with a data key, which is wrapped for the identity public key.
+type Share struct {
+	gorm.Model
+	AccountID  uint   `gorm:"index:idx_account_identity,unique;not null"`
+	IdentityID uint   `gorm:"index:idx_account_identity,unique;not null"`
+	WrappedKey string `gorm:"not null"`
+	Encrypted  string `gorm:"not null"`
+
+	Account  Account
+	Identity Identity
+}
+
+// ListByAccount fetches shares of the account with loaded identities
+func (s *Share) ListByAccount(db *gorm.DB, accountID uint) ([]Share, error) {
+	var shares []Share
+	err := db.Preload("Identity").Where("account_id = ?", accountID).Find(&shares).Error
+	if err != nil {
+		return nil, fmt.Errorf("unable to get account shares: %w", err)
+	}
+
+	return shares, nil
+}
+
+// ListByIdentity fetches shares of the identity with loaded accounts and their services
+func (s *Share) ListByIdentity(db *gorm.DB, identityID uint) ([]Share, error) {
+	var shares []Share
+	err := db.Preload("Account.Service").Where("identity_id = ?", identityID).Find(&shares).Error
+	if err != nil {
+		return nil, fmt.Errorf("unable to get identity shares: %w", err)
+	}
+
+	return shares, nil
+}
+
+// ReplaceForAccount performs transactional replacement of all the account shares with the given ones
+func (s *Share) ReplaceForAccount(db *gorm.DB, accountID uint, shares []Share) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("account_id = ?", accountID).Delete(&Share{}).Error; err != nil {
+			return err
+		}
+
+		for i := range shares {
+			shares[i].AccountID = accountID
+			if err := tx.Omit("Account", "Identity").Create(&shares[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to save account shares: %w", err)
+	}
+
+	return nil
+}
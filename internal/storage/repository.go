@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"gorm.io/gorm"
+	"os"
+	"time"
+)
+
+const (
+	BackendSQLite = "sqlite"
+	BackendFile   = "file"
+)
+
+// ErrNotFound is returned when the requested record doesn't exist, the same error is returned by all the backends
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrServiceNotEmpty is returned when the service to delete still has accounts
+var ErrServiceNotEmpty = models.ErrServiceNotEmpty
+
+// Repository gives access to the stored services, accounts and passwords regardless of the storage backend
+type Repository interface {
+	Services() ServiceRepository
+	Accounts() AccountRepository
+	Passwords() PasswordRepository
+	Identities() IdentityRepository
+	Shares() ShareRepository
+
+	// IsEncrypted checks whether the whole storage is encrypted with a storage key
+	IsEncrypted() (bool, error)
+	// Encrypt converts the storage to the encrypted one protected with the given storage key
+	Encrypt(key string) error
+	// Decrypt converts the encrypted storage to the plain one
+	Decrypt() error
+	// Backup writes a consistent copy of the storage to backupPath, the copy of the encrypted storage is encrypted
+	Backup(backupPath string) error
+	// CheckIntegrity checks the storage is not corrupted
+	CheckIntegrity() error
+	// Close releases the storage file, the repository must not be used after that
+	Close() error
+}
+
+// ServiceRepository manages stored services
+type ServiceRepository interface {
+	// List returns all the services, withAccounts defines whether to load services accounts or not
+	List(withAccounts bool) ([]models.Service, error)
+	// Count returns count of the services
+	Count() (int64, error)
+	// FetchOrCreate returns the service with the given name, creates it if it doesn't exist
+	FetchOrCreate(name string) (models.Service, error)
+	// LoadAccounts loads accounts of the given service
+	LoadAccounts(service *models.Service) error
+	// AccountsCount returns count of the service accounts
+	AccountsCount(service models.Service) (int64, error)
+	// Delete deletes the given service, fails with ErrServiceNotEmpty if it has accounts
+	Delete(service models.Service) error
+}
+
+// AccountRepository manages stored accounts
+type AccountRepository interface {
+	// Exists checks whether the account with the given login exists for the service
+	Exists(login string, serviceID uint) (bool, error)
+	// SaveWithPassword saves the new account together with its password
+	SaveWithPassword(account *models.Account, password *models.Password) error
+	// SaveAllWithPasswords saves the new accounts together with their passwords in a single transaction,
+	// services are found or created by the names of the account services, nothing is saved on failure
+	SaveAllWithPasswords(accounts []models.Account, passwords []models.Password) error
+	// DeleteWithPassword deletes the account together with its password
+	DeleteWithPassword(account models.Account) error
+	// LoadPassword loads the password of the given account
+	LoadPassword(account *models.Account) error
+	// List returns all the accounts with loaded services and passwords
+	List() ([]models.Account, error)
+	// MarkAccessed sets the time the account password was last accessed
+	MarkAccessed(account *models.Account, at time.Time) error
+	// SetExpiry sets the date the account password should be rotated by, nil means never
+	SetExpiry(account *models.Account, expiresAt *time.Time) error
+	// SavePassword saves changes of the account password together with the expiry date in a single transaction
+	SavePassword(account *models.Account, expiresAt *time.Time) error
+	// SetSSHPublicKey sets the public key of the SSH private key kept as the account password
+	SetSSHPublicKey(account *models.Account, publicKey string) error
+	// SetAttributes sets the JSON-encoded lookup attributes of the account
+	SetAttributes(account *models.Account, attributes string) error
+}
+
+// PasswordRepository manages stored passwords
+type PasswordRepository interface {
+	// Save saves changes of the existing password
+	Save(password *models.Password) error
+	// SaveAll saves changes of the existing passwords in a single transaction, none of them is saved on failure
+	SaveAll(passwords []models.Password) error
+}
+
+// IdentityRepository manages identities used for sharing accounts
+type IdentityRepository interface {
+	// List returns all the identities ordered by name
+	List() ([]models.Identity, error)
+	// FetchByName returns the identity with the given name
+	FetchByName(name string) (models.Identity, error)
+	// FetchOwn returns the identity of the vault owner, the one having the private key
+	FetchOwn() (models.Identity, error)
+	// Create saves the new identity
+	Create(identity *models.Identity) error
+	// Delete deletes the identity together with the shares for it
+	Delete(identity models.Identity) error
+}
+
+// ShareRepository manages accounts shared with identities
+type ShareRepository interface {
+	// ListByAccount returns shares of the account with loaded identities
+	ListByAccount(accountID uint) ([]models.Share, error)
+	// ListByIdentity returns shares for the identity with loaded accounts and their services
+	ListByIdentity(identityID uint) ([]models.Share, error)
+	// Replace replaces all the account shares with the given ones
+	Replace(accountID uint, shares []models.Share) error
+}
+
+// Open opens the repository of the given backend stored at storagePath.
+// If the storage is encrypted, getKey is called to get the storage key.
+func Open(backend, storagePath string, getKey KeyGetter) (Repository, error) {
+	switch backend {
+	case BackendSQLite:
+		db, err := New(storagePath, getKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLiteRepository(db, storagePath), nil
+	case BackendFile:
+		return NewFileRepository(storagePath, getKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// OpenReadOnly opens the repository of the given backend stored at storagePath for reading, e.g. to inspect a backup.
+// Nothing is written to the storage file, if it is encrypted, getKey is called to get the storage key.
+func OpenReadOnly(backend, storagePath string, getKey KeyGetter) (Repository, error) {
+	switch backend {
+	case BackendSQLite:
+		db, err := NewReadOnly(storagePath, getKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLiteRepository(db, storagePath), nil
+	case BackendFile:
+		if _, err := os.Stat(storagePath); err != nil {
+			return nil, fmt.Errorf("unable to open vault file: %w", err)
+		}
+		return NewFileRepository(storagePath, getKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveAllWithPasswords(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			repo := openRepo(t, backend, filepath.Join(t.TempDir(), name), noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+
+			accounts := []models.Account{
+				{Login: "amy", Service: models.Service{Name: "github.com"}},
+				{Login: "amy", Service: models.Service{Name: "gitlab.com"}},
+			}
+			passwords := []models.Password{{Encrypted: "other", Salt: "salt"}, {Encrypted: "third", Salt: "salt"}}
+			if err := repo.Accounts().SaveAllWithPasswords(accounts, passwords); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]string{"github.com/bob": "password", "github.com/amy": "other", "gitlab.com/amy": "third"}
+			if got := storedPasswords(t, repo); !reflect.DeepEqual(got, want) {
+				t.Errorf("got accounts %q, want %q", got, want)
+			}
+			for i, account := range accounts {
+				if account.ID == 0 || account.PasswordID != passwords[i].ID || account.ServiceID != account.Service.ID || account.ServiceID == 0 {
+					t.Errorf("got account %+v with password %d, want the saved IDs", account, passwords[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveAllWithPasswordsSavesNothingOnFailure(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			repo := openRepo(t, backend, filepath.Join(t.TempDir(), name), noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+
+			// the last account already exists
+			accounts := []models.Account{
+				{Login: "amy", Service: models.Service{Name: "gitlab.com"}},
+				{Login: "bob", Service: models.Service{Name: "github.com"}},
+			}
+			passwords := []models.Password{{Encrypted: "other", Salt: "salt"}, {Encrypted: "third", Salt: "salt"}}
+			if err := repo.Accounts().SaveAllWithPasswords(accounts, passwords); err == nil {
+				t.Fatal("got the existing account saved again")
+			}
+
+			if got := storedPasswords(t, repo); !reflect.DeepEqual(got, map[string]string{"github.com/bob": "password"}) {
+				t.Errorf("got accounts %q, want none of the failed ones saved", got)
+			}
+			if count, err := repo.Services().Count(); err != nil || count != 1 {
+				t.Errorf("got %d services, %v, want no service created", count, err)
+			}
+		})
+	}
+}
+
+func TestOpenReadOnlyOfPathWithURICharacters(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "a?b#c%20d e")
+			if err := os.Mkdir(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, name)
+			repo := openRepo(t, backend, path, noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+			backupPath := filepath.Join(dir, "backup?"+name)
+			if err := repo.Backup(backupPath); err != nil {
+				t.Fatalf("unable to backup storage: %v", err)
+			}
+			if err := repo.Close(); err != nil {
+				t.Fatalf("unable to close storage: %v", err)
+			}
+
+			readOnly, err := OpenReadOnly(backend, backupPath, noKey(t))
+			if err != nil {
+				t.Fatalf("unable to open storage for reading: %v", err)
+			}
+			want := map[string]string{"github.com/bob": "password"}
+			if got := storedPasswords(t, readOnly); !reflect.DeepEqual(got, want) {
+				t.Errorf("got accounts %q, want %q", got, want)
+			}
+			if err = readOnly.Close(); err != nil {
+				t.Errorf("unable to close storage: %v", err)
+			}
+		})
+	}
+}
+
+func TestSavePassword(t *testing.T) {
+	for backend, name := range storageFiles {
+		t.Run(backend, func(t *testing.T) {
+			repo := openRepo(t, backend, filepath.Join(t.TempDir(), name), noKey(t))
+			saveAccount(t, repo, "github.com", "bob", "password")
+
+			account := findAccount(t, repo, "github.com", "bob")
+			account.Password.Encrypted = "changed"
+			expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+			if err := repo.Accounts().SavePassword(&account, &expiresAt); err != nil {
+				t.Fatal(err)
+			}
+
+			saved := findAccount(t, repo, "github.com", "bob")
+			if saved.Password.Encrypted != "changed" || saved.ExpiresAt == nil || !saved.ExpiresAt.Equal(expiresAt) {
+				t.Errorf("got password %q expiring at %v, want %q expiring at %v",
+					saved.Password.Encrypted, saved.ExpiresAt, "changed", expiresAt)
+			}
+
+			if err := repo.Accounts().SavePassword(&saved, nil); err != nil || findAccount(t, repo, "github.com", "bob").ExpiresAt != nil {
+				t.Errorf("got %v, want the expiry removed", err)
+			}
+		})
+	}
+}
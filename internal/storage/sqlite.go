@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// SQLiteRepository is the Repository implementation over the SQLite database
+type SQLiteRepository struct {
+	db          *gorm.DB
+	storagePath string
+}
+
+// NewSQLiteRepository returns the repository over the given database stored at storagePath
+func NewSQLiteRepository(db *gorm.DB, storagePath string) *SQLiteRepository {
+	return &SQLiteRepository{db: db, storagePath: storagePath}
+}
+
+// Services returns the repository of services
+func (r *SQLiteRepository) Services() ServiceRepository {
+	return sqliteServices{db: r.db}
+}
+
+// Accounts returns the repository of accounts
+func (r *SQLiteRepository) Accounts() AccountRepository {
+	return sqliteAccounts{db: r.db}
+}
+
+// Passwords returns the repository of passwords
+func (r *SQLiteRepository) Passwords() PasswordRepository {
+	return sqlitePasswords{db: r.db}
+}
+
+// Identities returns the repository of identities
+func (r *SQLiteRepository) Identities() IdentityRepository {
+	return sqliteIdentities{db: r.db}
+}
+
+// Shares returns the repository of shares
+func (r *SQLiteRepository) Shares() ShareRepository {
+	return sqliteShares{db: r.db}
+}
+
+// IsEncrypted checks whether the database file is encrypted
+func (r *SQLiteRepository) IsEncrypted() (bool, error) {
+	return isEncryptedFile(r.storagePath)
+}
+
+// Encrypt converts the database file to the encrypted one
+func (r *SQLiteRepository) Encrypt(key string) error {
+	return encryptDB(r.db, r.storagePath, key)
+}
+
+// Decrypt converts the encrypted database file to the plain one
+func (r *SQLiteRepository) Decrypt() error {
+	return decryptDB(r.db, r.storagePath)
+}
+
+// Backup writes a consistent copy of the database to backupPath using the SQLite online backup,
+// the copy of the encrypted storage is encrypted with the same key
+func (r *SQLiteRepository) Backup(backupPath string) error {
+	return backupDB(r.db, backupPath)
+}
+
+// CheckIntegrity checks the database with the SQLite integrity check
+func (r *SQLiteRepository) CheckIntegrity() error {
+	var results []string
+	if err := r.db.Raw("PRAGMA integrity_check").Scan(&results).Error; err != nil {
+		return fmt.Errorf("unable to check database integrity: %w", err)
+	}
+
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf("database is corrupted: %s", strings.Join(results, "; "))
+	}
+
+	return nil
+}
+
+// Close closes the database connections
+func (r *SQLiteRepository) Close() error {
+	db, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+type sqliteServices struct {
+	db *gorm.DB
+}
+
+// List returns all the services
+func (s sqliteServices) List(withAccounts bool) ([]models.Service, error) {
+	var service models.Service
+	return service.GetList(s.db, withAccounts)
+}
+
+// Count returns count of the services
+func (s sqliteServices) Count() (int64, error) {
+	var service models.Service
+	var count int64
+	err := service.List(s.db).Count(&count).Error
+	return count, err
+}
+
+// FetchOrCreate returns the service with the given name, creates it if it doesn't exist
+func (s sqliteServices) FetchOrCreate(name string) (models.Service, error) {
+	var service models.Service
+	err := service.FetchOrCreate(s.db, name)
+	return service, err
+}
+
+// LoadAccounts loads accounts of the given service
+func (s sqliteServices) LoadAccounts(service *models.Service) error {
+	return service.LoadAccounts(s.db)
+}
+
+// AccountsCount returns count of the service accounts
+func (s sqliteServices) AccountsCount(service models.Service) (int64, error) {
+	return service.AccountsCount(s.db)
+}
+
+// Delete deletes the given service
+func (s sqliteServices) Delete(service models.Service) error {
+	return service.Delete(s.db)
+}
+
+type sqliteAccounts struct {
+	db *gorm.DB
+}
+
+// Exists checks whether the account with the given login exists for the service
+func (a sqliteAccounts) Exists(login string, serviceID uint) (bool, error) {
+	var account models.Account
+	var count int64
+	err := account.FindByLoginAndServiceID(a.db, login, serviceID).Count(&count).Error
+	return count > 0, err
+}
+
+// SaveWithPassword saves the new account together with its password
+func (a sqliteAccounts) SaveWithPassword(account *models.Account, password *models.Password) error {
+	return account.SaveWithPassword(a.db, password)
+}
+
+// SaveAllWithPasswords saves the new accounts together with their passwords and services in a single transaction
+func (a sqliteAccounts) SaveAllWithPasswords(accounts []models.Account, passwords []models.Password) error {
+	var account models.Account
+	return account.SaveAllWithPasswords(a.db, accounts, passwords)
+}
+
+// DeleteWithPassword deletes the account together with its password
+func (a sqliteAccounts) DeleteWithPassword(account models.Account) error {
+	return account.DeleteWithPassword(a.db)
+}
+
+// LoadPassword loads the password of the given account
+func (a sqliteAccounts) LoadPassword(account *models.Account) error {
+	return account.LoadPassword(a.db)
+}
+
+// List returns all the accounts with loaded services and passwords
+func (a sqliteAccounts) List() ([]models.Account, error) {
+	var account models.Account
+	return account.GetAll(a.db)
+}
+
+// MarkAccessed sets the time the account password was last accessed
+func (a sqliteAccounts) MarkAccessed(account *models.Account, at time.Time) error {
+	return account.MarkAccessed(a.db, at)
+}
+
+// SetExpiry sets the date the account password should be rotated by
+func (a sqliteAccounts) SetExpiry(account *models.Account, expiresAt *time.Time) error {
+	return account.SetExpiry(a.db, expiresAt)
+}
+
+// SavePassword saves changes of the account password together with the expiry date
+func (a sqliteAccounts) SavePassword(account *models.Account, expiresAt *time.Time) error {
+	return account.SavePassword(a.db, expiresAt)
+}
+
+// SetSSHPublicKey sets the public key of the SSH private key kept as the account password
+func (a sqliteAccounts) SetSSHPublicKey(account *models.Account, publicKey string) error {
+	return account.SetSSHPublicKey(a.db, publicKey)
+}
+
+// SetAttributes sets the JSON-encoded lookup attributes of the account
+func (a sqliteAccounts) SetAttributes(account *models.Account, attributes string) error {
+	return account.SetAttributes(a.db, attributes)
+}
+
+type sqlitePasswords struct {
+	db *gorm.DB
+}
+
+// Save saves changes of the existing password
+func (p sqlitePasswords) Save(password *models.Password) error {
+	return password.Save(p.db)
+}
+
+// SaveAll saves changes of the existing passwords in a single transaction
+func (p sqlitePasswords) SaveAll(passwords []models.Password) error {
+	var password models.Password
+	return password.SaveAll(p.db, passwords)
+}
+
+type sqliteIdentities struct {
+	db *gorm.DB
+}
+
+// List returns all the identities ordered by name
+func (i sqliteIdentities) List() ([]models.Identity, error) {
+	var identity models.Identity
+	return identity.GetList(i.db)
+}
+
+// FetchByName returns the identity with the given name
+func (i sqliteIdentities) FetchByName(name string) (models.Identity, error) {
+	var identity models.Identity
+	err := identity.FetchByName(i.db, name)
+	return identity, err
+}
+
+// FetchOwn returns the identity of the vault owner
+func (i sqliteIdentities) FetchOwn() (models.Identity, error) {
+	var identity models.Identity
+	err := identity.FetchOwn(i.db)
+	return identity, err
+}
+
+// Create saves the new identity
+func (i sqliteIdentities) Create(identity *models.Identity) error {
+	return identity.Create(i.db)
+}
+
+// Delete deletes the identity together with the shares for it
+func (i sqliteIdentities) Delete(identity models.Identity) error {
+	return identity.DeleteWithShares(i.db)
+}
+
+type sqliteShares struct {
+	db *gorm.DB
+}
+
+// ListByAccount returns shares of the account with loaded identities
+func (s sqliteShares) ListByAccount(accountID uint) ([]models.Share, error) {
+	var share models.Share
+	return share.ListByAccount(s.db, accountID)
+}
+
+// ListByIdentity returns shares for the identity with loaded accounts and their services
+func (s sqliteShares) ListByIdentity(identityID uint) ([]models.Share, error) {
+	var share models.Share
+	return share.ListByIdentity(s.db, identityID)
+}
+
+// Replace replaces all the account shares with the given ones
+func (s sqliteShares) Replace(accountID uint, shares []models.Share) error {
+	var share models.Share
+	return share.ReplaceForAccount(s.db, accountID, shares)
+}
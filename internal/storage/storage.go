@@ -6,21 +6,114 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"net/url"
+	"os"
+	"path/filepath"
 )
 
-// New returns a pointer to gorm database and an error
-func New(storagePath string) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(storagePath), &gorm.Config{
+// New returns a pointer to gorm database and an error.
+// If the storage file is encrypted, getKey is called to get the storage key.
+func New(storagePath string, getKey KeyGetter) (*gorm.DB, error) {
+	encrypted, err := isEncryptedFile(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := fileDSN(storagePath, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var dialector gorm.Dialector = sqlite.Open(dsn)
+	if encrypted {
+		key, err := getKey()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get storage key: %w", err)
+		}
+
+		pool, err := openEncrypted(storagePath, key)
+		if err != nil {
+			return nil, err
+		}
+
+		dialector = &sqlite.Dialector{Conn: pool}
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to DB: %w", err)
 	}
 
-	err = db.AutoMigrate(&models.Service{}, &models.Account{}, models.Password{})
+	err = db.AutoMigrate(&models.Service{}, &models.Account{}, models.Password{}, &models.Identity{}, &models.Share{})
 	if err != nil {
 		return nil, fmt.Errorf("failed apply migrations: %w", err)
 	}
 
 	return db, nil
 }
+
+// NewReadOnly returns a pointer to gorm database opened without migrations, nothing is written to the storage file.
+// If the storage file is encrypted, getKey is called to get the storage key.
+func NewReadOnly(storagePath string, getKey KeyGetter) (*gorm.DB, error) {
+	if _, err := os.Stat(storagePath); err != nil {
+		return nil, fmt.Errorf("unable to open storage file: %w", err)
+	}
+
+	encrypted, err := isEncryptedFile(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := fileDSN(storagePath, "mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	var dialector gorm.Dialector = sqlite.Open(dsn)
+	if encrypted {
+		key, err := getKey()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get storage key: %w", err)
+		}
+
+		data, _, _, err := readEncrypted(storagePath, key)
+		if err != nil {
+			return nil, err
+		}
+
+		memDB, err := openMemoryDB()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = loadMemoryDB(memDB, data); err != nil {
+			_ = memDB.Close()
+			return nil, fmt.Errorf("unable to load storage: %w", err)
+		}
+
+		dialector = &sqlite.Dialector{Conn: memDB}
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+	}
+
+	return db, nil
+}
+
+// fileDSN returns the URI of the database file with the given query, the path is made absolute and escaped,
+// so characters like ? and # are not taken for the URI parts
+func fileDSN(storagePath, query string) (string, error) {
+	absPath, err := filepath.Abs(storagePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve storage path: %w", err)
+	}
+
+	dsn := url.URL{Scheme: "file", Path: filepath.ToSlash(absPath), RawQuery: query}
+	return dsn.String(), nil
+}
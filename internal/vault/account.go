@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"time"
+)
+
+// Account is the account of a service kept in the vault
+type Account struct {
+	ID      uint
+	Service string
+	Login   string
+	// Password is the decrypted password, it's set by Get only
+	Password string
+	// SharedWith are the names of the teammates the account is shared with, it's set by Get and Set only
+	SharedWith []string
+
+	CreatedAt         time.Time
+	PasswordChangedAt time.Time
+	LastAccessedAt    *time.Time
+	// ExpiresAt is the date the password should be rotated by, nil means never
+	ExpiresAt *time.Time
+	// SSHPublicKey is the public key in the authorized_keys format if the password is an OpenSSH private key
+	SSHPublicKey string
+}
+
+// newAccount returns the account of the stored one, the password must be loaded
+func newAccount(account models.Account) Account {
+	return Account{
+		ID:                account.ID,
+		Service:           account.Service.Name,
+		Login:             account.Login,
+		CreatedAt:         account.CreatedAt,
+		PasswordChangedAt: account.Password.UpdatedAt,
+		LastAccessedAt:    account.LastAccessedAt,
+		ExpiresAt:         account.ExpiresAt,
+		SSHPublicKey:      account.SSHPublicKey,
+	}
+}
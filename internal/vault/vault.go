@@ -0,0 +1,395 @@
+// Package vault implements the vault of accounts over the opened repository, it's exposed to other programs
+// by pkg/passtool and used by the CLI directly.
+//
+// Each password of the vault is encrypted with its own secret key, there is no master one. Unlock sets the secret
+// key passwords are decrypted and encrypted with until Lock, so accounts using other secret keys are opened by
+// unlocking the vault with their keys.
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/config"
+	"github.com/MirToykin/passtool/internal/sharing"
+	"github.com/MirToykin/passtool/internal/storage"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	passGenerator "github.com/sethvargo/go-password/password"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the account doesn't exist
+	ErrNotFound = errors.New("account not found")
+	// ErrExists is returned when the account to add already exists
+	ErrExists = errors.New("account already exists")
+	// ErrLocked is returned when the operation needs the secret key, but the vault is locked
+	ErrLocked = errors.New("vault is locked")
+	// ErrWrongSecret is returned when the account password is encrypted with another secret key
+	ErrWrongSecret = models.ErrWrongSecret
+)
+
+// audited operations, the same the CLI records
+const (
+	operationAdd    = "add"
+	operationGet    = "get"
+	operationSet    = "set"
+	operationDel    = "del"
+	operationExpire = "expire"
+)
+
+// Vault gives access to the accounts of the vault, it's safe for concurrent use,
+// operations are performed one at a time
+type Vault struct {
+	repo   storage.Repository
+	config *config.Config
+	record func(operation string, account *models.Account)
+	warn   func(msg string, a ...interface{})
+
+	// mu guards the secret key and serializes operations with the repository
+	mu     sync.Mutex
+	secret string
+}
+
+// New returns the vault over the opened repository, operations with accounts are passed to record
+// and failures which don't fail operations, e.g. of saving the access time, to warn
+func New(
+	repo storage.Repository,
+	cfg *config.Config,
+	record func(operation string, account *models.Account),
+	warn func(msg string, a ...interface{}),
+) *Vault {
+	return &Vault{repo: repo, config: cfg, record: record, warn: warn}
+}
+
+// Close closes the repository of the vault, the vault must not be used after that
+func (v *Vault) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secret = ""
+	return v.repo.Close()
+}
+
+// Unlock sets the secret key passwords are decrypted and encrypted with
+func (v *Vault) Unlock(secret string) error {
+	if secret == "" {
+		return fmt.Errorf("secret key is empty")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secret = secret
+	return nil
+}
+
+// Lock forgets the secret key
+func (v *Vault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secret = ""
+}
+
+// IsUnlocked checks whether the vault has the secret key
+func (v *Vault) IsUnlocked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.secret != ""
+}
+
+// List returns all the accounts ordered by services and logins, passwords are not included
+func (v *Vault) List() ([]Account, error) {
+	return v.filter(func(models.Account) bool { return true })
+}
+
+// Search returns the accounts whose service name or login contains the query, case-insensitively,
+// passwords are not included
+func (v *Vault) Search(query string) ([]Account, error) {
+	query = strings.ToLower(query)
+	return v.filter(func(account models.Account) bool {
+		return strings.Contains(strings.ToLower(account.Service.Name), query) ||
+			strings.Contains(strings.ToLower(account.Login), query)
+	})
+}
+
+// Get returns the account with the decrypted password and the teammates it's shared with,
+// the time of access is saved
+func (v *Vault) Get(service, login string) (Account, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	secret, err := v.unlockedSecret()
+	if err != nil {
+		return Account{}, err
+	}
+
+	account, err := v.find(service, login)
+	if err != nil {
+		return Account{}, err
+	}
+
+	password, err := account.Password.GetDecrypted(secret, v.config.SecretKeyLength)
+	if err != nil {
+		if errors.Is(err, models.ErrWrongSecret) {
+			return Account{}, err
+		}
+		// passwords saved without the verification tag only fail to decrypt with another secret key
+		return Account{}, fmt.Errorf("%w: unable to decrypt the password: %v", ErrWrongSecret, err)
+	}
+	v.record(operationGet, &account)
+
+	if err = v.repo.Accounts().MarkAccessed(&account, time.Now()); err != nil {
+		v.warn("unable to save last access time: %v", err)
+	}
+
+	shares, err := v.repo.Shares().ListByAccount(account.ID)
+	if err != nil {
+		return Account{}, fmt.Errorf("unable to load shares: %w", err)
+	}
+
+	result := newAccount(account)
+	result.Password = password
+	result.SharedWith = identityNames(shares)
+	return result, nil
+}
+
+// Add saves the new account with the password encrypted with the secret key, the service is created
+// if it doesn't exist. The expiry date is saved if it's set, other fields besides the names are ignored.
+func (v *Vault) Add(account Account) (Account, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	secret, err := v.unlockedSecret()
+	if err != nil {
+		return Account{}, err
+	}
+
+	if account.Service == "" || account.Login == "" || account.Password == "" {
+		return Account{}, fmt.Errorf("service name, login and password are required")
+	}
+
+	if _, err = v.find(account.Service, account.Login); err == nil {
+		return Account{}, ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return Account{}, err
+	}
+
+	service, err := v.repo.Services().FetchOrCreate(account.Service)
+	if err != nil {
+		return Account{}, fmt.Errorf("unable to save service: %w", err)
+	}
+
+	saved := models.Account{Login: account.Login, Service: service, ExpiresAt: account.ExpiresAt}
+	var password models.Password
+	if err = v.encrypt(&password, account.Password, secret); err != nil {
+		return Account{}, err
+	}
+
+	if err = v.repo.Accounts().SaveWithPassword(&saved, &password); err != nil {
+		return Account{}, err
+	}
+	saved.Password = password
+	v.record(operationAdd, &saved)
+
+	return newAccount(saved), nil
+}
+
+// Set saves the new password of the account encrypted with the secret key, the expiry date which has come is
+// removed as fulfilled and the teammates the account is shared with get the new password
+func (v *Vault) Set(service, login, password string) (Account, error) {
+	return v.set(service, login, password, func(expiresAt *time.Time) *time.Time {
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return nil
+		}
+		return expiresAt
+	})
+}
+
+// SetWithExpiry saves the new password the same way Set does together with the date the password should be
+// rotated by, nil means never
+func (v *Vault) SetWithExpiry(service, login, password string, expiresAt *time.Time) (Account, error) {
+	return v.set(service, login, password, func(*time.Time) *time.Time {
+		return expiresAt
+	})
+}
+
+// set saves the new password of the account with the expiry date returned by expiry for the current one
+func (v *Vault) set(service, login, password string, expiry func(expiresAt *time.Time) *time.Time) (Account, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	secret, err := v.unlockedSecret()
+	if err != nil {
+		return Account{}, err
+	}
+
+	if password == "" {
+		return Account{}, fmt.Errorf("password is required")
+	}
+
+	account, err := v.find(service, login)
+	if err != nil {
+		return Account{}, err
+	}
+
+	if err = v.encrypt(&account.Password, password, secret); err != nil {
+		return Account{}, err
+	}
+
+	if err = v.repo.Accounts().SavePassword(&account, expiry(account.ExpiresAt)); err != nil {
+		return Account{}, err
+	}
+	v.record(operationSet, &account)
+
+	shares, err := v.reshare(account.ID, password)
+	if err != nil {
+		return Account{}, fmt.Errorf("unable to share the new password: %w", err)
+	}
+
+	result := newAccount(account)
+	result.SharedWith = identityNames(shares)
+	return result, nil
+}
+
+// Expire sets the date the account password should be rotated by, nil means never
+func (v *Vault) Expire(service, login string, expiresAt *time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	account, err := v.find(service, login)
+	if err != nil {
+		return err
+	}
+
+	if err = v.repo.Accounts().SetExpiry(&account, expiresAt); err != nil {
+		return err
+	}
+	v.record(operationExpire, &account)
+
+	return nil
+}
+
+// Delete deletes the account together with its password and shares, the service is deleted
+// if it has no accounts left, serviceDeleted tells whether it was. The secret key is not required.
+func (v *Vault) Delete(service, login string) (serviceDeleted bool, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	account, err := v.find(service, login)
+	if err != nil {
+		return false, err
+	}
+
+	if err = v.repo.Accounts().DeleteWithPassword(account); err != nil {
+		return false, err
+	}
+	v.record(operationDel, &account)
+
+	err = v.repo.Services().Delete(account.Service)
+	if errors.Is(err, storage.ErrServiceNotEmpty) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unlockedSecret returns the secret key, ErrLocked if there is none, mu must be held
+func (v *Vault) unlockedSecret() (string, error) {
+	if v.secret == "" {
+		return "", ErrLocked
+	}
+	return v.secret, nil
+}
+
+// find returns the account of the service with the given login with loaded service and password
+func (v *Vault) find(service, login string) (models.Account, error) {
+	accounts, err := v.repo.Accounts().List()
+	if err != nil {
+		return models.Account{}, fmt.Errorf("unable to load accounts: %w", err)
+	}
+
+	for _, account := range accounts {
+		if account.Service.Name == service && account.Login == login {
+			return account, nil
+		}
+	}
+
+	return models.Account{}, fmt.Errorf("%w: %q at %q", ErrNotFound, login, service)
+}
+
+// filter returns the accounts matching the predicate ordered by services and logins
+func (v *Vault) filter(matches func(models.Account) bool) ([]Account, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	accounts, err := v.repo.Accounts().List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load accounts: %w", err)
+	}
+
+	var result []Account
+	for _, account := range accounts {
+		if matches(account) {
+			result = append(result, newAccount(account))
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Service != result[j].Service {
+			return result[i].Service < result[j].Service
+		}
+		return result[i].Login < result[j].Login
+	})
+
+	return result, nil
+}
+
+// encrypt sets the user password encrypted with the secret key with a new salt
+func (v *Vault) encrypt(password *models.Password, userPassword, secret string) error {
+	settings := v.config.PasswordSettings
+	salt, err := passGenerator.Generate(
+		settings.Length,
+		settings.NumDigits,
+		settings.NumSymbols,
+		settings.NoUpper,
+		settings.AllowRepeat)
+	if err != nil {
+		return fmt.Errorf("unable to get salt: %w", err)
+	}
+
+	return password.SetEncrypted(userPassword, secret, salt, v.config.SecretKeyLength)
+}
+
+// reshare shares the new password with the identities the account is already shared with, returns their shares
+func (v *Vault) reshare(accountID uint, password string) ([]models.Share, error) {
+	existing, err := v.repo.Shares().ListByAccount(accountID)
+	if err != nil || len(existing) == 0 {
+		return nil, err
+	}
+
+	identities := make([]models.Identity, 0, len(existing))
+	for _, share := range existing {
+		identities = append(identities, share.Identity)
+	}
+
+	shares, err := sharing.Share(password, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	return shares, v.repo.Shares().Replace(accountID, shares)
+}
+
+// identityNames returns names of the identities of the shares
+func identityNames(shares []models.Share) []string {
+	var names []string
+	for _, share := range shares {
+		names = append(names, share.Identity.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,81 @@
+// Package passtool gives Go programs access to the passtool vault, the same one the passtool CLI works with.
+//
+// Each password of the vault is encrypted with its own secret key, there is no master one. Unlock sets the secret
+// key passwords are decrypted and encrypted with until Lock, so accounts using other secret keys are opened by
+// unlocking the vault with their keys.
+package passtool
+
+import (
+	"fmt"
+	"github.com/MirToykin/passtool/internal/config"
+	"github.com/MirToykin/passtool/internal/setup"
+	"github.com/MirToykin/passtool/internal/storage/models"
+	"github.com/MirToykin/passtool/internal/vault"
+	"log"
+)
+
+var (
+	// ErrNotFound is returned when the account doesn't exist
+	ErrNotFound = vault.ErrNotFound
+	// ErrExists is returned when the account to add already exists
+	ErrExists = vault.ErrExists
+	// ErrLocked is returned when the operation needs the secret key, but the vault is locked
+	ErrLocked = vault.ErrLocked
+	// ErrWrongSecret is returned when the account password is encrypted with another secret key
+	ErrWrongSecret = vault.ErrWrongSecret
+)
+
+// Vault gives access to the accounts of the passtool vault, it's safe for concurrent use,
+// operations are performed one at a time. Close it when it's not needed anymore.
+type Vault = vault.Vault
+
+// Account is the account of a service kept in the vault
+type Account = vault.Account
+
+// Options configure the vault to open, zero values are taken from the passtool environment variables
+type Options struct {
+	// StoragePath is the directory the vault is stored in, PASSTOOL_STORAGE_PATH by default
+	StoragePath string
+	// Vault is the name of the vault of the storage, the default vault is used if empty
+	Vault string
+	// StorageKey is called to get the storage key if the whole storage is encrypted
+	StorageKey func() (string, error)
+	// Warn reports failures which don't fail operations, e.g. of backups or the audit log, log.Printf by default
+	Warn func(msg string, a ...interface{})
+}
+
+// Open opens the vault, changes are backed up, synced and recorded to the audit log the same way the CLI does
+func Open(opts Options) (*Vault, error) {
+	cfg, err := config.LoadWithOverrides(config.Overrides{StorageDir: opts.StoragePath, Vault: opts.Vault})
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.IsValid() {
+		return nil, fmt.Errorf("storage path is not set")
+	}
+
+	getKey := opts.StorageKey
+	if getKey == nil {
+		getKey = func() (string, error) {
+			return "", fmt.Errorf("storage is encrypted, the storage key is required")
+		}
+	}
+
+	warn := opts.Warn
+	if warn == nil {
+		warn = log.Printf
+	}
+
+	components, err := setup.Open(cfg, getKey, warn)
+	if err != nil {
+		return nil, err
+	}
+
+	record := func(operation string, account *models.Account) {
+		if err := components.Audit.Record(setup.AuditEntry(components.Repo, operation, account, "")); err != nil {
+			warn("unable to record audit log: %v", err)
+		}
+	}
+
+	return vault.New(components.Repo, cfg, record, warn), nil
+}
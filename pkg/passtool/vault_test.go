@@ -0,0 +1,153 @@
+package passtool
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MirToykin/passtool/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestVault opens the vault in the temporary directory with the file backend, which keeps no locks itself
+func openTestVault(t *testing.T) *Vault {
+	t.Helper()
+	for _, ev := range config.Variables() {
+		t.Setenv(ev.Name, "")
+	}
+	t.Setenv("PASSTOOL_STORAGE_BACKEND", "file")
+
+	vault, err := Open(Options{StoragePath: t.TempDir(), Warn: t.Logf})
+	if err != nil {
+		t.Fatalf("unable to open vault: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := vault.Close(); err != nil {
+			t.Errorf("unable to close vault: %v", err)
+		}
+	})
+	if err = vault.Unlock("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	return vault
+}
+
+func TestVaultConcurrentUse(t *testing.T) {
+	vault := openTestVault(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			login := fmt.Sprintf("user%d", i)
+			if _, err := vault.Add(Account{Service: "github.com", Login: login, Password: "password"}); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := vault.Set("github.com", login, "changed"); err != nil {
+				errs <- err
+			}
+			if _, err := vault.List(); err != nil {
+				errs <- err
+			}
+			if account, err := vault.Get("github.com", login); err != nil || account.Password != "changed" {
+				errs <- fmt.Errorf("got %q, %v getting %s, want the changed password", account.Password, err, login)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	accounts, err := vault.List()
+	if err != nil || len(accounts) != 10 {
+		t.Errorf("got %d accounts, %v, want all the added ones", len(accounts), err)
+	}
+}
+
+func TestVaultLocked(t *testing.T) {
+	vault := openTestVault(t)
+	vault.Lock()
+
+	if _, err := vault.Add(Account{Service: "github.com", Login: "bob", Password: "password"}); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v adding to the locked vault, want ErrLocked", err)
+	}
+	if _, err := vault.Get("github.com", "bob"); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v getting from the locked vault, want ErrLocked", err)
+	}
+	if _, err := vault.Delete("github.com", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v deleting the missing account, want ErrNotFound", err)
+	}
+}
+
+func TestVaultDeleteReportsDeletedService(t *testing.T) {
+	vault := openTestVault(t)
+	for _, login := range []string{"bob", "amy"} {
+		if _, err := vault.Add(Account{Service: "github.com", Login: login, Password: "password"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		login string
+		want  bool
+	}{{"bob", false}, {"amy", true}} {
+		if serviceDeleted, err := vault.Delete("github.com", tt.login); err != nil || serviceDeleted != tt.want {
+			t.Errorf("got service deleted %t, %v deleting %s, want %t", serviceDeleted, err, tt.login, tt.want)
+		}
+	}
+}
+
+func TestVaultSetExpiry(t *testing.T) {
+	vault := openTestVault(t)
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if _, err := vault.Add(Account{Service: "github.com", Login: "bob", Password: "password", ExpiresAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the expiry which has come is fulfilled by the new password
+	if account, err := vault.Set("github.com", "bob", "changed"); err != nil || account.ExpiresAt != nil {
+		t.Errorf("got expiry %v, %v, want it removed", account.ExpiresAt, err)
+	}
+
+	account, err := vault.SetWithExpiry("github.com", "bob", "again", &future)
+	if err != nil || account.ExpiresAt == nil || !account.ExpiresAt.Equal(future) {
+		t.Errorf("got expiry %v, %v, want %v", account.ExpiresAt, err, future)
+	}
+	if account, err = vault.Get("github.com", "bob"); err != nil || account.Password != "again" {
+		t.Errorf("got password %q, %v, want the one saved with the expiry", account.Password, err)
+	}
+	if account, err = vault.Set("github.com", "bob", "third"); err != nil || account.ExpiresAt == nil {
+		t.Errorf("got expiry %v, %v, want the future one kept", account.ExpiresAt, err)
+	}
+}
+
+func TestOpenFails(t *testing.T) {
+	for _, ev := range config.Variables() {
+		t.Setenv(ev.Name, "")
+	}
+	dir := t.TempDir()
+	storagePath := filepath.Join(dir, "storage")
+
+	for _, name := range []string{"..", "../..", "a/b", "."} {
+		if _, err := Open(Options{StoragePath: storagePath, Vault: name}); err == nil {
+			t.Errorf("got vault %q opened, want an error", name)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("got %v, %v created, want nothing", entries, err)
+	}
+
+	t.Setenv("PASSTOOL_BACKUP_COUNT", "abc")
+	if _, err := Open(Options{StoragePath: storagePath}); err == nil || !strings.Contains(err.Error(), "PASSTOOL_BACKUP_COUNT") {
+		t.Errorf("got error %v, want the invalid variable reported", err)
+	}
+}